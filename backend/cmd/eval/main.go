@@ -0,0 +1,315 @@
+// Command eval runs golden question sets against a knowledge base, so
+// changes to chunking, models and prompts can be measured before and after.
+//
+//	eval import -kb 1 -name smoke -file cases.json
+//	eval run -set 1 -label baseline [-mock] [-min-recall 0.8]
+//	eval compare -base 1 -head 2
+//	eval serve-mock -addr :8090
+//
+// cases.json is an array of {"question", "expected_answer",
+// "expected_sources"} objects. run exits with status 1 when the run fails
+// or a score is below its -min threshold, so it can gate CI. With -mock
+// the models are replaced by the deterministic providers of package eval;
+// the documents must have been indexed with the same mock embeddings, for
+// example by a worker pointed at serve-mock.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"backend/config"
+	"backend/internal/eval"
+	"backend/internal/models"
+	"backend/internal/rag"
+	"backend/internal/schemas"
+	"backend/internal/services"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "import":
+		err = importSet(os.Args[2:])
+	case "run":
+		err = run(os.Args[2:])
+	case "compare":
+		err = compare(os.Args[2:])
+	case "serve-mock":
+		err = serveMock(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "eval: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: eval import|run|compare|serve-mock [flags]")
+	os.Exit(2)
+}
+
+func initDB() error {
+	if err := services.InitDB(); err != nil {
+		return err
+	}
+	return services.DB.AutoMigrate(&models.EvalSet{}, &models.EvalCase{}, &models.EvalRun{}, &models.EvalResult{})
+}
+
+func importSet(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	kbID := fs.Uint("kb", 0, "knowledge base ID")
+	name := fs.String("name", "", "set name")
+	description := fs.String("description", "", "set description")
+	file := fs.String("file", "", "JSON file with the cases")
+	fs.Parse(args)
+	if *kbID == 0 || *name == "" || *file == "" {
+		return fmt.Errorf("-kb, -name and -file are required")
+	}
+
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+	var reqs []schemas.EvalCaseRequest
+	if err := json.Unmarshal(data, &reqs); err != nil {
+		return fmt.Errorf("invalid cases file: %w", err)
+	}
+
+	if err := initDB(); err != nil {
+		return err
+	}
+	defer services.CloseDB()
+	kb, err := models.GetKnowledgeBaseByID(*kbID)
+	if err != nil {
+		return fmt.Errorf("knowledge base %d not found", *kbID)
+	}
+
+	set := models.EvalSet{UserID: kb.UserID, KnowledgeBaseID: kb.ID, Name: *name, Description: *description, Status: models.EvalSetReady}
+	for i, r := range reqs {
+		if r.Question == "" {
+			return fmt.Errorf("case %d has no question", i+1)
+		}
+		c := models.EvalCase{Question: r.Question, ExpectedAnswer: r.ExpectedAnswer}
+		if len(r.ExpectedSources) > 0 {
+			b, _ := json.Marshal(r.ExpectedSources)
+			c.ExpectedSources = models.JSON(b)
+		}
+		set.Cases = append(set.Cases, c)
+	}
+	if err := models.CreateEvalSet(&set); err != nil {
+		return err
+	}
+	fmt.Printf("created eval set %d with %d cases\n", set.ID, len(set.Cases))
+	return nil
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	setID := fs.Uint("set", 0, "eval set ID")
+	label := fs.String("label", "", "run label, e.g. the change being measured")
+	mode := fs.String("mode", "", "retrieval mode: vector, keyword or hybrid")
+	topK := fs.Int("top-k", 0, "chunks retrieved per question (default RAG_TOP_K)")
+	rewrite := fs.String("rewrite", "", "query rewriting (default the knowledge base's)")
+	judge := fs.String("judge", eval.JudgeString, "answer scoring: string, llm or none")
+	mock := fs.Bool("mock", false, "use the mock model providers")
+	dimension := fs.Int("dimension", 1536, "mock embedding dimension, must match the collection")
+	minRecall := fs.Float64("min-recall", 0, "fail below this recall@k")
+	minMRR := fs.Float64("min-mrr", 0, "fail below this MRR")
+	minCorrectness := fs.Float64("min-correctness", 0, "fail below this correctness")
+	asJSON := fs.Bool("json", false, "print the run as JSON")
+	fs.Parse(args)
+	if *setID == 0 {
+		return fmt.Errorf("-set is required")
+	}
+	if *judge != eval.JudgeString && *judge != eval.JudgeLLM && *judge != eval.JudgeNone {
+		return fmt.Errorf("unknown judge %q", *judge)
+	}
+
+	cfg := config.LoadConfig()
+	if *mock {
+		url, stop, err := startMock(*dimension)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		cfg.LLMBaseURL, cfg.LLMModel = url, "mock"
+		cfg.EmbeddingBaseURL, cfg.EmbeddingModel = url, "mock"
+	}
+
+	if err := initDB(); err != nil {
+		return err
+	}
+	defer services.CloseDB()
+	set, err := models.GetEvalSetByID(*setID)
+	if err != nil {
+		return fmt.Errorf("eval set %d not found", *setID)
+	}
+	if set.Status == models.EvalSetGenerating {
+		return fmt.Errorf("eval set %d is still being generated", set.ID)
+	}
+	kb, err := models.GetKnowledgeBaseByID(set.KnowledgeBaseID)
+	if err != nil {
+		return fmt.Errorf("knowledge base %d not found", set.KnowledgeBaseID)
+	}
+	cases, err := models.ListEvalCases(set.ID)
+	if err != nil {
+		return err
+	}
+	if len(cases) == 0 {
+		return fmt.Errorf("eval set %d has no cases", set.ID)
+	}
+
+	evalCfg := eval.Config{
+		TopK:           *topK,
+		Mode:           *mode,
+		Rewrite:        *rewrite,
+		Judge:          *judge,
+		AnswerModel:    cfg.LLMModel,
+		EmbeddingModel: cfg.EmbeddingModel,
+	}
+	if evalCfg.TopK == 0 {
+		evalCfg.TopK = cfg.RAGTopK
+	}
+	if *judge == eval.JudgeLLM {
+		evalCfg.JudgeModel = cfg.LLMModel
+	}
+
+	llm := services.NewLLMService(cfg.LLMBaseURL, cfg.LLMAPIKey, cfg.LLMModel)
+	embedder := services.NewEmbeddingService(cfg.EmbeddingBaseURL, cfg.EmbeddingAPIKey, cfg.EmbeddingModel)
+	qdrant := services.NewQdrantService(cfg.QdrantURL, cfg.QdrantAPIKey, cfg.QdrantCollection)
+	runner := eval.NewRunner(rag.NewPipeline(rag.NewRetriever(embedder, qdrant, cfg.TextSearchConfigs), llm), llm)
+
+	evalRun := models.EvalRun{
+		SetID:           set.ID,
+		KnowledgeBaseID: kb.ID,
+		Label:           *label,
+		Status:          models.EvalRunRunning,
+		StartedAt:       time.Now(),
+	}
+	if err := models.CreateEvalRun(&evalRun); err != nil {
+		return err
+	}
+	if err := runner.Run(context.Background(), kb, &evalRun, cases, evalCfg); err != nil {
+		return fmt.Errorf("run %d failed: %w", evalRun.ID, err)
+	}
+	results, err := models.ListEvalResults(evalRun.ID)
+	if err != nil {
+		return err
+	}
+
+	var metrics eval.Metrics
+	json.Unmarshal(evalRun.Metrics, &metrics)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(map[string]interface{}{"run": evalRun, "results": results})
+	} else {
+		for _, r := range results {
+			fmt.Printf("case %-5d recall=%s rr=%s faith=%s correct=%s %dms", r.CaseID,
+				score(r.Recall), score(r.ReciprocalRank), score(r.Faithfulness), score(r.Correctness), r.LatencyMs)
+			if r.Error != "" {
+				fmt.Printf(" error: %s", r.Error)
+			}
+			fmt.Println()
+		}
+		fmt.Printf("run %d: %d cases, %d failed, recall@%d=%s mrr=%s faithfulness=%s correctness=%s avg %dms\n",
+			evalRun.ID, metrics.Cases, metrics.Failed, metrics.K, score(metrics.RecallAtK), score(metrics.MRR),
+			score(metrics.Faithfulness), score(metrics.Correctness), metrics.AvgLatencyMs)
+		if metrics.ChunkRecallAtK != nil {
+			// generated sets also know the chunk each question was written from
+			fmt.Printf("chunk recall@%d=%s chunk mrr=%s\n", metrics.K, score(metrics.ChunkRecallAtK), score(metrics.ChunkMRR))
+		}
+	}
+
+	var failed []string
+	check := func(name string, value *float64, min float64) {
+		if min > 0 && (value == nil || *value < min) {
+			failed = append(failed, fmt.Sprintf("%s %s < %.3f", name, score(value), min))
+		}
+	}
+	check("recall", metrics.RecallAtK, *minRecall)
+	check("mrr", metrics.MRR, *minMRR)
+	check("correctness", metrics.Correctness, *minCorrectness)
+	if metrics.Failed > 0 {
+		failed = append(failed, fmt.Sprintf("%d cases failed", metrics.Failed))
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("run %d below thresholds: %v", evalRun.ID, failed)
+	}
+	return nil
+}
+
+func compare(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	baseID := fs.Uint("base", 0, "base run ID")
+	headID := fs.Uint("head", 0, "head run ID")
+	fs.Parse(args)
+	if *baseID == 0 || *headID == 0 {
+		return fmt.Errorf("-base and -head are required")
+	}
+
+	if err := initDB(); err != nil {
+		return err
+	}
+	defer services.CloseDB()
+	base, err := models.GetEvalRunByID(*baseID)
+	if err != nil {
+		return fmt.Errorf("run %d not found", *baseID)
+	}
+	head, err := models.GetEvalRunByID(*headID)
+	if err != nil {
+		return fmt.Errorf("run %d not found", *headID)
+	}
+	baseResults, err := models.ListEvalResults(base.ID)
+	if err != nil {
+		return err
+	}
+	headResults, err := models.ListEvalResults(head.ID)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(eval.Compare(base, head, baseResults, headResults))
+}
+
+func serveMock(args []string) error {
+	fs := flag.NewFlagSet("serve-mock", flag.ExitOnError)
+	addr := fs.String("addr", ":8090", "listen address")
+	dimension := fs.Int("dimension", 1536, "embedding dimension, must match the collection")
+	fs.Parse(args)
+
+	fmt.Printf("mock model providers listening on %s\n", *addr)
+	return http.ListenAndServe(*addr, eval.MockProvider(*dimension))
+}
+
+// startMock serves the mock providers on a free local port.
+func startMock(dimension int) (string, func(), error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, err
+	}
+	srv := &http.Server{Handler: eval.MockProvider(dimension)}
+	go srv.Serve(ln)
+	return "http://" + ln.Addr().String(), func() { srv.Close() }, nil
+}
+
+func score(v *float64) string {
+	if v == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.3f", *v)
+}
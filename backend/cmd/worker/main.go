@@ -9,16 +9,16 @@ import (
 
     "github.com/hibiken/asynq"
 
-    "backend/internal/database"
+    "backend/internal/services"
     "backend/internal/models"
     "backend/internal/queues"
 )
 
 func main() {
-    if err := database.InitDB(); err != nil {
+    if err := services.InitDB(); err != nil {
         panic(err)
     }
-    defer database.CloseDB()
+    defer services.CloseDB()
 
     redisAddr := os.Getenv("REDIS_ADDR")
     if redisAddr == "" {
@@ -2,6 +2,9 @@ package config
 
 import (
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 )
 
 type Config struct {
@@ -16,8 +19,42 @@ type Config struct {
 	MinioSecretKey   string
 	MinioUseSSL      bool
 	MinioBucket      string
-	RedisAddr        string
-	JWTSecret        string
+	MinioRegion      string
+	// MinioPublicEndpoint is the MinIO address reachable by API clients; it
+	// is used to sign presigned URLs.
+	MinioPublicEndpoint  string
+	PresignExpiryMinutes int
+	// UploadSweepMinutes is how often expired upload sessions and their
+	// objects are removed.
+	UploadSweepMinutes int
+	RedisAddr          string
+	JWTSecret          string
+	// Retrieval must use the worker's embedding model and collection.
+	EmbeddingBaseURL string
+	EmbeddingAPIKey  string
+	EmbeddingModel   string
+	QdrantURL        string
+	QdrantAPIKey     string
+	QdrantCollection string
+	// OpenAI-compatible chat model that answers questions.
+	LLMBaseURL string
+	LLMAPIKey  string
+	LLMModel   string
+	// LLMModels are the models chat sessions may pick, LLMModel among them.
+	LLMModels []string
+	// Chunks retrieved per question and earlier messages sent with it.
+	RAGTopK            int
+	RAGHistoryMessages int
+	RAGHistoryTokens   int
+	// TextSearchConfigs are the PostgreSQL text search configurations the
+	// worker indexes chunks with; keyword search queries each of them.
+	TextSearchConfigs []string
+	// ChatTools are the tools the chat model may call, ChatToolMaxSteps
+	// bounds the rounds of calls per answer. HTTPToolAllowlist holds the URL
+	// prefixes the http_get tool may fetch.
+	ChatTools         []string
+	ChatToolMaxSteps  int
+	HTTPToolAllowlist []string
 }
 
 func LoadConfig() *Config {
@@ -27,19 +64,40 @@ func LoadConfig() *Config {
 	}
 
 	return &Config{
-		Port:             getEnv("PORT", "8080"),
-		PostGresUser:     getEnv("POSTGRES_USER", "postgres"),
-		PostGresPassword: getEnv("POSTGRES_PASSWORD", "postgres"),
-		PostGresDB:       getEnv("POSTGRES_DB", "rag_chatbot_db"),
-		PostGresHost:     getEnv("POSTGRES_HOST", "localhost"),
-		PostGresPort:     getEnv("POSTGRES_PORT", "5432"),
-		MinioEndpoint:    getEnv("MINIO_ENDPOINT", "localhost:9008"),
-		MinioAccessKey:   getEnv("MINIO_ACCESS_KEY", "minioadmin"),
-		MinioSecretKey:   getEnv("MINIO_SECRET_KEY", "minioadmin"),
-		MinioUseSSL:      useSSL,
-		MinioBucket:      getEnv("MINIO_BUCKET", "documents"),
-		RedisAddr:        getEnv("REDIS_ADDR", "localhost:6379"),
-		JWTSecret:        getEnv("JWT_SECRET", "your_jwt_secret_key"),
+		Port:                 getEnv("PORT", "8080"),
+		PostGresUser:         getEnv("POSTGRES_USER", "postgres"),
+		PostGresPassword:     getEnv("POSTGRES_PASSWORD", "postgres"),
+		PostGresDB:           getEnv("POSTGRES_DB", "rag_chatbot_db"),
+		PostGresHost:         getEnv("POSTGRES_HOST", "localhost"),
+		PostGresPort:         getEnv("POSTGRES_PORT", "5432"),
+		MinioEndpoint:        getEnv("MINIO_ENDPOINT", "localhost:9008"),
+		MinioAccessKey:       getEnv("MINIO_ACCESS_KEY", "minioadmin"),
+		MinioSecretKey:       getEnv("MINIO_SECRET_KEY", "minioadmin"),
+		MinioUseSSL:          useSSL,
+		MinioBucket:          getEnv("MINIO_BUCKET", "documents"),
+		MinioRegion:          getEnv("MINIO_REGION", "us-east-1"),
+		MinioPublicEndpoint:  getEnv("MINIO_PUBLIC_ENDPOINT", getEnv("MINIO_ENDPOINT", "localhost:9008")),
+		PresignExpiryMinutes: getEnvInt("PRESIGN_EXPIRY_MINUTES", 60),
+		UploadSweepMinutes:   getEnvInt("UPLOAD_SWEEP_MINUTES", 15),
+		RedisAddr:            getEnv("REDIS_ADDR", "localhost:6379"),
+		JWTSecret:            getEnv("JWT_SECRET", "your_jwt_secret_key"),
+		EmbeddingBaseURL:     getEnv("EMBEDDING_BASE_URL", "https://api.openai.com/v1"),
+		EmbeddingAPIKey:      getEnv("EMBEDDING_API_KEY", ""),
+		EmbeddingModel:       getEnv("EMBEDDING_MODEL", "text-embedding-3-small"),
+		QdrantURL:            getEnv("QDRANT_URL", "http://localhost:6333"),
+		QdrantAPIKey:         getEnv("QDRANT_API_KEY", "qdrantadmin123"),
+		QdrantCollection:     getEnv("QDRANT_COLLECTION", "document_chunks"),
+		LLMBaseURL:           getEnv("LLM_BASE_URL", "https://api.openai.com/v1"),
+		LLMAPIKey:            getEnv("LLM_API_KEY", ""),
+		LLMModel:             getEnv("LLM_MODEL", "gpt-4o-mini"),
+		LLMModels:            getEnvList("LLM_MODELS", getEnv("LLM_MODEL", "gpt-4o-mini")),
+		RAGTopK:              getEnvInt("RAG_TOP_K", 5),
+		RAGHistoryMessages:   getEnvInt("RAG_HISTORY_MESSAGES", 10),
+		RAGHistoryTokens:     getEnvInt("RAG_HISTORY_TOKENS", 2000),
+		TextSearchConfigs:    textSearchConfigs(getEnv("FTS_LANGUAGE_CONFIGS", "en:english,vi:simple"), getEnv("FTS_DEFAULT_CONFIG", "simple")),
+		ChatTools:            getEnvList("CHAT_TOOLS", ""),
+		ChatToolMaxSteps:     getEnvInt("CHAT_TOOL_MAX_STEPS", 5),
+		HTTPToolAllowlist:    getEnvList("HTTP_TOOL_ALLOWLIST", ""),
 	}
 }
 
@@ -49,3 +107,47 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvList splits a comma-separated variable, always including extra
+// unless it is empty.
+func getEnvList(key, extra string) []string {
+	var list []string
+	if extra != "" {
+		list = append(list, extra)
+	}
+	for _, v := range strings.Split(getEnv(key, ""), ",") {
+		if v = strings.TrimSpace(v); v != "" && v != extra {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// textSearchConfigs lists the distinct configurations of the worker's
+// language mapping, such as "en:english,vi:simple", and its default.
+// "simple" is always included, the worker indexes chunks without a
+// configuration with it.
+func textSearchConfigs(languages, defaultConfig string) []string {
+	configs := []string{"simple"}
+	add := func(config string) {
+		if config = strings.TrimSpace(config); config != "" && !slices.Contains(configs, config) {
+			configs = append(configs, config)
+		}
+	}
+	add(defaultConfig)
+	for _, pair := range strings.Split(languages, ",") {
+		if _, config, ok := strings.Cut(pair, ":"); ok {
+			add(config)
+		}
+	}
+	return configs
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value, exists := os.LookupEnv(key); exists {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"backend/internal/models"
+	"backend/internal/queues"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// archiveExtensions lists the archive formats the worker can expand.
+var archiveExtensions = []string{".zip", ".tar.gz", ".tgz"}
+
+func isArchiveName(name string) bool {
+	name = strings.ToLower(name)
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateArchiveImport stores an uploaded ZIP or tar.gz archive and queues it
+// for the worker, which creates one document per supported file inside it.
+// Poll GetArchiveImport for the outcome.
+func CreateArchiveImport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		kb := loadOwnedKnowledgeBase(c)
+		if kb == nil {
+			return
+		}
+
+		file, header, err := c.Request.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+			return
+		}
+		defer file.Close()
+
+		if !isArchiveName(header.Filename) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file must be a .zip, .tar.gz or .tgz archive"})
+			return
+		}
+
+		ctx := context.Background()
+		storageSvc, bucket, err := newDocumentStorage(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		objectName := fmt.Sprintf("kb_%d/archives/%s/%s", kb.ID, uuid.NewString(), path.Base(header.Filename))
+		if err := storageSvc.UploadObject(ctx, bucket, objectName, file, header.Size, "application/octet-stream"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to upload file: %v", err)})
+			return
+		}
+
+		imp := &models.ArchiveImport{
+			KnowledgeBaseID: kb.ID,
+			UserID:          userID,
+			FileName:        header.Filename,
+			ObjectName:      objectName,
+			Status:          "pending",
+		}
+		if err := models.CreateArchiveImport(imp); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := queues.EnqueueImportArchive(queues.ImportArchivePayload{
+			ImportID:        imp.ID,
+			KnowledgeBaseID: kb.ID,
+			UserID:          userID,
+			Bucket:          bucket,
+			ObjectName:      objectName,
+			FileName:        header.Filename,
+		}); err != nil {
+			log.Printf("Failed to enqueue archive import %d: %v", imp.ID, err)
+			imp.Status = "failed"
+			imp.Error = "failed to queue import"
+			if err := models.UpdateArchiveImport(imp); err != nil {
+				log.Printf("Failed to update archive import %d: %v", imp.ID, err)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to queue import"})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, imp)
+	}
+}
+
+func ListArchiveImports() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kb := loadOwnedKnowledgeBase(c)
+		if kb == nil {
+			return
+		}
+
+		imports, err := models.ListArchiveImports(kb.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, imports)
+	}
+}
+
+// GetArchiveImport returns the status of an import with its per-entry report.
+func GetArchiveImport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kb := loadOwnedKnowledgeBase(c)
+		if kb == nil {
+			return
+		}
+
+		importID, err := strconv.ParseUint(c.Param("importId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid import id"})
+			return
+		}
+
+		imp, err := models.GetArchiveImportByID(uint(importID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if imp == nil || imp.KnowledgeBaseID != kb.ID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "archive import not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, imp)
+	}
+}
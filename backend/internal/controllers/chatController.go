@@ -0,0 +1,628 @@
+package controllers
+
+import (
+	"backend/config"
+	"backend/internal/models"
+	"backend/internal/rag"
+	"backend/internal/schemas"
+	"backend/internal/tools"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Chat answers a user message in a chat session from the session's knowledge
+// bases and stores both the question and the answer with its citations at
+// the end of the active branch. Citations name their knowledge base when the
+// session searches several. Tool calls the model makes on the way are
+// stored between the question and the answer and returned as tool_steps.
+func Chat() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session := loadOwnedChatSession(c)
+		if session == nil {
+			return
+		}
+
+		var req schemas.ChatRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		userMessage, assistantMessage, result := replyToNewMessage(c, session, session.ActiveLeafID, req.Message, chatOptions{
+			Filter: req.Filter,
+			TopK:   req.TopK,
+			Mode:   req.Mode,
+		})
+		if result == nil {
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"user_message":      userMessage,
+			"assistant_message": assistantMessage,
+			"sources":           result.Sources,
+			"tool_steps":        result.ToolSteps,
+		})
+	}
+}
+
+// EditChatMessage re-runs the conversation from an edited user message. The
+// edit is stored as a sibling of the original, which stays as it was, and
+// the new branch becomes the active one.
+func EditChatMessage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session := loadOwnedChatSession(c)
+		if session == nil {
+			return
+		}
+		original := loadSessionMessage(c, session)
+		if original == nil {
+			return
+		}
+		if original.Role != "user" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "only user messages can be edited"})
+			return
+		}
+
+		var req schemas.EditChatMessageRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		userMessage, assistantMessage, result := replyToNewMessage(c, session, original.ParentID, req.Message, chatOptions{
+			Filter: req.Filter,
+			TopK:   req.TopK,
+			Mode:   req.Mode,
+		})
+		if result == nil {
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"user_message":      userMessage,
+			"assistant_message": assistantMessage,
+			"sources":           result.Sources,
+			"tool_steps":        result.ToolSteps,
+		})
+	}
+}
+
+// RegenerateChatMessage answers the question of an assistant message again.
+// The new answer, with any tool calls leading to it, is stored as a sibling
+// of the old one and becomes the active branch.
+func RegenerateChatMessage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session := loadOwnedChatSession(c)
+		if session == nil {
+			return
+		}
+		previous := loadSessionMessage(c, session)
+		if previous == nil {
+			return
+		}
+		if previous.Role != "assistant" || previous.IsToolStep() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "only answers to a user message can be regenerated"})
+			return
+		}
+		question, err := answerQuestion(previous, models.GetChatMessageByID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "only answers to a user message can be regenerated"})
+			return
+		}
+
+		// the body is optional
+		var req schemas.RegenerateChatMessageRequest
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		result := answerTurn(c, session, question.ParentID, question.Message, chatOptions{
+			Filter: req.Filter,
+			TopK:   req.TopK,
+			Mode:   req.Mode,
+		})
+		if result == nil {
+			return
+		}
+		searchQueries, err := marshalSearchQueries(result.SearchQueries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		assistantMessage, err := saveAnswer(session, question.ID, result, searchQueries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		activateAnswer(session, assistantMessage)
+
+		c.JSON(http.StatusCreated, gin.H{
+			"assistant_message": assistantMessage,
+			"sources":           result.Sources,
+			"tool_steps":        result.ToolSteps,
+		})
+	}
+}
+
+// chatOptions tune retrieval for one turn, overriding the session settings.
+type chatOptions struct {
+	Filter string
+	TopK   int
+	Mode   string
+}
+
+// replyToNewMessage answers question as a reply to parentID and stores the
+// question and the answer as a new branch, which becomes the active one. It
+// writes the error response itself and returns a nil result on failure.
+func replyToNewMessage(c *gin.Context, session *models.ChatSession, parentID *uint, question string, opts chatOptions) (*models.ChatMessage, *models.ChatMessage, *rag.ChatResult) {
+	result := answerTurn(c, session, parentID, question, opts)
+	if result == nil {
+		return nil, nil, nil
+	}
+	searchQueries, err := marshalSearchQueries(result.SearchQueries)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, nil, nil
+	}
+
+	userMessage := models.ChatMessage{
+		SessionID:     session.ID,
+		ParentID:      parentID,
+		Role:          "user",
+		Message:       question,
+		SearchQueries: searchQueries,
+		CreatedAt:     time.Now(),
+	}
+	if err := models.CreateChatMessage(&userMessage); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, nil, nil
+	}
+	assistantMessage, err := saveAnswer(session, userMessage.ID, result, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, nil, nil
+	}
+	activateAnswer(session, assistantMessage)
+	return &userMessage, assistantMessage, result
+}
+
+// answerTurn answers question as a reply to the path ending at parentID,
+// searching all knowledge bases of the session with the settings of the
+// session and its first knowledge base; opts override the
+// session's retrieval settings for this turn. It writes the error response
+// itself and returns nil when the request cannot proceed.
+func answerTurn(c *gin.Context, session *models.ChatSession, parentID *uint, question string, opts chatOptions) *rag.ChatResult {
+	filter, err := rag.ParseFilter(opts.Filter)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid filter: " + err.Error()})
+		return nil
+	}
+
+	kbs, err := sessionKnowledgeBases(session)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil
+	}
+	rewrite := rag.RewriteNone
+	var kbID *uint
+	var kbIDs []uint
+	var kbNames map[uint]string
+	var template, kbName string
+	var guardrails rag.Guardrails
+	if len(kbs) > 0 {
+		// the first knowledge base's settings apply
+		kb := kbs[0]
+		kbID = &kb.ID
+		rewrite = kb.QueryRewrite
+		template = kb.SystemPrompt
+		kbName = kb.Name
+		guardrails = rag.Guardrails{
+			MinRelevance:   kb.MinRelevance,
+			FallbackAnswer: kb.FallbackAnswer,
+			GroundingCheck: kb.GroundingCheck,
+		}
+	}
+	if len(kbs) > 1 {
+		kbNames = make(map[uint]string, len(kbs))
+		for _, kb := range kbs {
+			kbIDs = append(kbIDs, kb.ID)
+			kbNames[kb.ID] = kb.Name
+		}
+	}
+
+	settings := session.Settings
+	if opts.TopK != 0 {
+		settings.TopK = opts.TopK
+	}
+	if opts.Mode != "" {
+		settings.RetrievalMode = opts.Mode
+	}
+	// the knowledge bases may have been restricted since the settings were saved
+	if err := validateSessionSettings(settings, kbs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid settings: " + err.Error()})
+		return nil
+	}
+	if settings.TopK == 0 {
+		settings.TopK = config.LoadConfig().RAGTopK
+		for _, kb := range kbs {
+			if kb.MaxTopK > 0 && settings.TopK > kb.MaxTopK {
+				settings.TopK = kb.MaxTopK
+			}
+		}
+	}
+	if settings.RetrievalMode == "" {
+		// the default mode is vector, unless a knowledge base disallows it
+		settings.RetrievalMode = defaultRetrievalMode(kbs)
+		if settings.RetrievalMode == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the knowledge bases allow no common retrieval mode"})
+			return nil
+		}
+	}
+
+	ctx := c.Request.Context()
+	conversation, err := conversationHistory(ctx, session, parentID, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil
+	}
+
+	chatTools, searchTool, err := newChatTools(kbs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil
+	}
+
+	result, err := newRAGPipeline().Answer(ctx, rag.ChatRequest{
+		KnowledgeBaseID:    kbID,
+		KnowledgeBaseIDs:   kbIDs,
+		KnowledgeBaseNames: kbNames,
+		Summary:            conversation.Summary,
+		History:            conversation.Messages,
+		Question:           question,
+		Filter:             filter,
+		TopK:               settings.TopK,
+		Mode:               settings.RetrievalMode,
+		Model:              settings.Model,
+		Temperature:        settings.Temperature,
+		Rewrite:            rewrite,
+		Template:           template,
+		UserName:           userName(session.UserID),
+		KnowledgeBaseName:  kbName,
+		Guardrails:         guardrails,
+		Tools:              chatTools,
+		SearchTool:         searchTool,
+		MaxToolSteps:       config.LoadConfig().ChatToolMaxSteps,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return nil
+	}
+	return result
+}
+
+// defaultRetrievalMode returns the first retrieval mode, vector preferred,
+// that every knowledge base allows, or "" when there is none.
+func defaultRetrievalMode(kbs []*models.KnowledgeBase) string {
+	for _, mode := range rag.Modes {
+		allowed := true
+		for _, kb := range kbs {
+			if list := kb.AllowedModeList(); len(list) > 0 && !slices.Contains(list, mode) {
+				allowed = false
+				break
+			}
+		}
+		if allowed {
+			return mode
+		}
+	}
+	return ""
+}
+
+// conversationHistory returns the memory for a reply to the path ending at
+// leafID. A running summary of turns that are not on the path, left over
+// from another branch, is dropped; with compact it is also cleared on the
+// session and the turns that no longer fit are summarized anew.
+func conversationHistory(ctx context.Context, session *models.ChatSession, leafID *uint, compact bool) (rag.ConversationContext, error) {
+	var path []models.ChatMessage
+	if leafID != nil {
+		var err error
+		path, err = models.ListChatPath(*leafID)
+		if err != nil {
+			return rag.ConversationContext{}, err
+		}
+	}
+
+	start := 0
+	if session.SummarizedUntil != 0 {
+		start = -1
+		for i, msg := range path {
+			if msg.ID == session.SummarizedUntil {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			if compact {
+				if _, err := models.UpdateChatSessionSummary(session, "", 0); err != nil {
+					return rag.ConversationContext{}, err
+				}
+			}
+			session.Summary, session.SummarizedUntil = "", 0
+			start = 0
+		}
+	}
+	messages := path[start:]
+
+	memory := newConversationMemory()
+	if compact {
+		var err error
+		messages, err = memory.Compact(ctx, session, messages)
+		if err != nil {
+			return rag.ConversationContext{}, err
+		}
+	}
+	return memory.Window(session, messages), nil
+}
+
+// saveAnswer stores a generated answer as a reply to the message parentID,
+// preceded by the tool calls the model made: each round of calls is an
+// assistant message followed by a tool message per result, so the answer
+// replies to the last result. searchQueries are only stored on answers
+// whose question was asked before, i.e. regenerated ones.
+func saveAnswer(session *models.ChatSession, parentID uint, result *rag.ChatResult, searchQueries models.JSON) (*models.ChatMessage, error) {
+	for _, step := range result.ToolSteps {
+		type toolCall struct {
+			ID        string `json:"id"`
+			Name      string `json:"name"`
+			Arguments string `json:"arguments"`
+		}
+		calls := make([]toolCall, len(step.Calls))
+		for i, call := range step.Calls {
+			calls[i] = toolCall{ID: call.ID, Name: call.Name, Arguments: call.Arguments}
+		}
+		b, err := json.Marshal(calls)
+		if err != nil {
+			return nil, err
+		}
+		callMessage := models.ChatMessage{
+			SessionID: session.ID,
+			ParentID:  &parentID,
+			Role:      "assistant",
+			Message:   step.Content,
+			ToolCalls: models.JSON(b),
+			CreatedAt: time.Now(),
+		}
+		if err := models.CreateChatMessage(&callMessage); err != nil {
+			return nil, err
+		}
+		parentID = callMessage.ID
+		for _, call := range step.Calls {
+			resultMessage := models.ChatMessage{
+				SessionID:  session.ID,
+				ParentID:   &parentID,
+				Role:       "tool",
+				Message:    call.Result,
+				ToolCallID: call.ID,
+				ToolName:   call.Name,
+				CreatedAt:  time.Now(),
+			}
+			if err := models.CreateChatMessage(&resultMessage); err != nil {
+				return nil, err
+			}
+			parentID = resultMessage.ID
+		}
+	}
+
+	citations, err := json.Marshal(result.Sources)
+	if err != nil {
+		return nil, err
+	}
+	var grounding models.JSON
+	if result.Grounding != nil {
+		b, err := json.Marshal(result.Grounding)
+		if err != nil {
+			return nil, err
+		}
+		grounding = models.JSON(b)
+	}
+	message := models.ChatMessage{
+		SessionID:     session.ID,
+		ParentID:      &parentID,
+		Role:          "assistant",
+		Message:       result.Answer,
+		Citations:     models.JSON(citations),
+		SearchQueries: searchQueries,
+		Grounding:     grounding,
+		CreatedAt:     time.Now(),
+	}
+	if err := models.CreateChatMessage(&message); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// answerQuestion returns the user message an answer replies to, above the
+// tool calls that led to the answer. get loads a message by ID.
+func answerQuestion(answer *models.ChatMessage, get func(id uint) (*models.ChatMessage, error)) (*models.ChatMessage, error) {
+	parentID := answer.ParentID
+	for parentID != nil {
+		message, err := get(*parentID)
+		if err != nil {
+			return nil, err
+		}
+		if message.Role == "user" {
+			return message, nil
+		}
+		if !message.IsToolStep() {
+			break
+		}
+		parentID = message.ParentID
+	}
+	return nil, errors.New("the answer does not reply to a user message")
+}
+
+// activateAnswer continues the session from a new answer. The answer is
+// stored either way, so a failure is only logged.
+func activateAnswer(session *models.ChatSession, answer *models.ChatMessage) {
+	if err := models.SetChatSessionActiveLeaf(session, &answer.ID); err != nil {
+		log.Printf("Failed to update chat session %d: %v", session.ID, err)
+	}
+}
+
+func marshalSearchQueries(queries []string) (models.JSON, error) {
+	if len(queries) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(queries)
+	if err != nil {
+		return nil, err
+	}
+	return models.JSON(b), nil
+}
+
+// loadOwnedChatSession resolves the :id param and checks that the chat
+// session belongs to the calling user. It writes the error response itself
+// and returns nil when the request cannot proceed.
+func loadOwnedChatSession(c *gin.Context) *models.ChatSession {
+	userID := c.GetUint("user_id")
+
+	sessionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session ID"})
+		return nil
+	}
+
+	session, err := models.GetChatSessionByID(uint(sessionID))
+	if err != nil || session == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "chat session not found"})
+		return nil
+	}
+	if session.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "no permission"})
+		return nil
+	}
+	return session
+}
+
+// loadSessionMessage resolves the :messageId param to a message of session.
+// It writes the error response itself and returns nil when the request
+// cannot proceed.
+func loadSessionMessage(c *gin.Context, session *models.ChatSession) *models.ChatMessage {
+	id, err := strconv.ParseUint(c.Param("messageId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message ID"})
+		return nil
+	}
+	message, err := models.GetChatMessageByID(uint(id))
+	if err != nil || message == nil || message.SessionID != session.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "message not found in this session"})
+		return nil
+	}
+	return message
+}
+
+// userName is the name prompt templates address the user by, empty when the
+// user cannot be loaded.
+func userName(userID uint) string {
+	user, err := models.GetUserByID(userID)
+	if err != nil || user == nil {
+		return ""
+	}
+	return user.Name
+}
+
+// newConversationMemory bounds chat history by the configured token budget
+// and message count.
+func newConversationMemory() *rag.Memory {
+	cfg := config.LoadConfig()
+	return rag.NewMemory(newLLMService(), rag.MemoryOptions{
+		HistoryTokens: cfg.RAGHistoryTokens,
+		MaxMessages:   cfg.RAGHistoryMessages,
+	})
+}
+
+// newChatTools builds the tools configured in CHAT_TOOLS for a turn over
+// kbs. The knowledge base search tool is built by the pipeline, which
+// reports whether it is enabled; query_csv is only offered when the
+// knowledge bases hold CSV documents.
+func newChatTools(kbs []*models.KnowledgeBase) ([]tools.Tool, bool, error) {
+	cfg := config.LoadConfig()
+	var chatTools []tools.Tool
+	searchTool := false
+	for _, name := range cfg.ChatTools {
+		switch name {
+		case tools.NameSearchKnowledgeBase:
+			searchTool = true
+		case tools.NameCalculator:
+			chatTools = append(chatTools, tools.Calculator{})
+		case tools.NameHTTPGet:
+			if t := tools.NewHTTPGet(cfg.HTTPToolAllowlist); !t.Empty() {
+				chatTools = append(chatTools, t)
+			}
+		case tools.NameQueryCSV:
+			var documents []models.Document
+			for _, kb := range kbs {
+				docs, err := models.ListDocumentsByKnowledgeBase(kb.ID)
+				if err != nil {
+					return nil, false, err
+				}
+				for _, doc := range docs {
+					if doc.FileType == "csv" {
+						documents = append(documents, doc)
+					}
+				}
+			}
+			if len(documents) > 0 {
+				chatTools = append(chatTools, tools.NewCSVQuery(documents, openDocumentFile))
+			}
+		default:
+			log.Printf("Unknown chat tool %q in CHAT_TOOLS", name)
+		}
+	}
+	return chatTools, searchTool, nil
+}
+
+// openDocumentFile reads the file of the version a document serves.
+func openDocumentFile(ctx context.Context, doc *models.Document) (io.ReadCloser, error) {
+	storageSvc, bucket, err := newDocumentStorage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	objectName := doc.ObjectName
+	if objectName == "" {
+		// documents uploaded before object names were recorded
+		objectName = fmt.Sprintf("kb_%d/%s", doc.KnowledgeBaseID, doc.Name)
+	}
+	return storageSvc.GetObject(ctx, bucket, objectName)
+}
+
+// GetChatContext shows the conversation memory the next chat turn of a
+// session would be answered with, for debugging prompts.
+func GetChatContext() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session := loadOwnedChatSession(c)
+		if session == nil {
+			return
+		}
+
+		conversation, err := conversationHistory(c.Request.Context(), session, session.ActiveLeafID, false)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, conversation)
+	}
+}
@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"errors"
+	"testing"
+
+	"backend/internal/models"
+)
+
+func TestAnswerQuestion(t *testing.T) {
+	id := func(v uint) *uint { return &v }
+	messages := map[uint]*models.ChatMessage{
+		1: {ID: 1, Role: "user", Message: "How many vacation days?"},
+		2: {ID: 2, Role: "assistant", ParentID: id(1), Message: "25 days."},
+		// an answer after two rounds of tool calls
+		3: {ID: 3, Role: "assistant", ParentID: id(1), ToolCalls: models.JSON(`[{"id":"a"}]`)},
+		4: {ID: 4, Role: "tool", ParentID: id(3), ToolCallID: "a"},
+		5: {ID: 5, Role: "assistant", ParentID: id(4), ToolCalls: models.JSON(`[{"id":"b"}]`)},
+		6: {ID: 6, Role: "tool", ParentID: id(5), ToolCallID: "b"},
+		7: {ID: 7, Role: "assistant", ParentID: id(6), Message: "25 days [1]."},
+		// replies to an answer rather than to a question
+		8: {ID: 8, Role: "assistant", ParentID: id(2), Message: "Anything else?"},
+		9: {ID: 9, Role: "assistant", Message: "Welcome!"},
+		// its parent was deleted
+		10: {ID: 10, Role: "assistant", ParentID: id(99)},
+	}
+	lookups := 0
+	get := func(id uint) (*models.ChatMessage, error) {
+		lookups++
+		if m, ok := messages[id]; ok {
+			return m, nil
+		}
+		return nil, errors.New("record not found")
+	}
+
+	tests := []struct {
+		answer  uint
+		want    uint
+		lookups int
+	}{
+		{answer: 2, want: 1, lookups: 1},
+		{answer: 7, want: 1, lookups: 5},
+		{answer: 8, lookups: 1},
+		{answer: 9},
+		{answer: 10, lookups: 1},
+	}
+	for _, tt := range tests {
+		lookups = 0
+		question, err := answerQuestion(messages[tt.answer], get)
+		if tt.want == 0 {
+			if err == nil {
+				t.Errorf("answer %d: question = %d, want an error", tt.answer, question.ID)
+			}
+		} else if err != nil || question.ID != tt.want {
+			t.Errorf("answer %d: question = %v, %v, want %d", tt.answer, question, err, tt.want)
+		}
+		if lookups != tt.lookups {
+			t.Errorf("answer %d: loaded %d messages, want %d", tt.answer, lookups, tt.lookups)
+		}
+	}
+}
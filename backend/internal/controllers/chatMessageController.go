@@ -3,6 +3,7 @@ package controllers
 import (
 	"backend/internal/models"
 	"backend/internal/schemas"
+	"log"
 	"net/http"
 	"strconv"
 	"time"
@@ -44,6 +45,7 @@ func CreateChatMessage() gin.HandlerFunc {
 
 		message := models.ChatMessage{
 			SessionID: uint(sessionID),
+			ParentID:  session.ActiveLeafID,
 			Role:      messageReq.Role,
 			Message:   messageReq.Message,
 			CreatedAt: time.Now(),
@@ -54,10 +56,9 @@ func CreateChatMessage() gin.HandlerFunc {
 			return
 		}
 
-		// Update session's UpdatedAt timestamp
-		session.UpdatedAt = time.Now()
-		if err := models.UpdateChatSession(session); err != nil {
-			// Log the error but don't fail the request
+		// Continue the active branch from the new message
+		if err := models.SetChatSessionActiveLeaf(session, &message.ID); err != nil {
+			log.Printf("Failed to update chat session %d: %v", session.ID, err)
 		}
 
 		c.JSON(http.StatusCreated, message)
@@ -90,7 +91,13 @@ func ListChatMessages() gin.HandlerFunc {
 			return
 		}
 
-		messages, err := models.ListChatMessagesBySessionID(uint(sessionID))
+		// The active branch by default, every branch with ?branches=all
+		var messages []models.ChatMessage
+		if c.Query("branches") == "all" {
+			messages, err = models.ListChatMessagesBySessionID(uint(sessionID))
+		} else {
+			messages, err = activeChatPath(session)
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -201,6 +208,18 @@ func UpdateChatMessage() gin.HandlerFunc {
 			return
 		}
 
+		// Rewriting a message that was replied to would leave the replies
+		// answering something else; edits branch off instead
+		replies, err := models.ListChatMessageSiblings(session.ID, &message.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(replies) > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "message has replies; edit or regenerate it to start a new branch"})
+			return
+		}
+
 		var messageReq schemas.UpdateChatMessageRequest
 		if err := c.ShouldBindJSON(&messageReq); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -267,11 +286,135 @@ func DeleteChatMessage() gin.HandlerFunc {
 			return
 		}
 
+		path, err := activeChatPath(session)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
 		if err := models.DeleteChatMessage(uint(id)); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
+		// Deleting part of the active branch continues from the most recent
+		// remaining message below the deleted one's parent
+		for _, m := range path {
+			if m.ID != message.ID {
+				continue
+			}
+			leafID, err := latestBranchLeaf(session.ID, message.ParentID)
+			if err == nil {
+				err = models.SetChatSessionActiveLeaf(session, leafID)
+			}
+			if err != nil {
+				log.Printf("Failed to update chat session %d: %v", session.ID, err)
+			}
+			break
+		}
+
 		c.JSON(http.StatusNoContent, nil)
 	}
 }
+
+// ListChatMessageBranches lists the alternatives of a message: the message
+// and its siblings, which reply to the same parent. Active is the sibling on
+// the active branch, if any.
+func ListChatMessageBranches() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session := loadOwnedChatSession(c)
+		if session == nil {
+			return
+		}
+		message := loadSessionMessage(c, session)
+		if message == nil {
+			return
+		}
+
+		siblings, err := models.ListChatMessageSiblings(session.ID, message.ParentID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		path, err := activeChatPath(session)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		onPath := make(map[uint]bool, len(path))
+		for _, m := range path {
+			onPath[m.ID] = true
+		}
+		var active *uint
+		for i := range siblings {
+			if onPath[siblings[i].ID] {
+				active = &siblings[i].ID
+				break
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"parent_id": message.ParentID,
+			"active_id": active,
+			"branches":  siblings,
+		})
+	}
+}
+
+// ActivateChatMessage switches the session to the branch through a message.
+// The conversation continues from the most recent message below it, and the
+// resulting path is returned.
+func ActivateChatMessage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session := loadOwnedChatSession(c)
+		if session == nil {
+			return
+		}
+		message := loadSessionMessage(c, session)
+		if message == nil {
+			return
+		}
+
+		leafID, err := models.LatestChatDescendant(message.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := models.SetChatSessionActiveLeaf(session, &leafID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		path, err := models.ListChatPath(leafID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"active_leaf_id": leafID,
+			"messages":       path,
+		})
+	}
+}
+
+// activeChatPath returns the messages of the session's active branch,
+// oldest first.
+func activeChatPath(session *models.ChatSession) ([]models.ChatMessage, error) {
+	if session.ActiveLeafID == nil {
+		return []models.ChatMessage{}, nil
+	}
+	return models.ListChatPath(*session.ActiveLeafID)
+}
+
+// latestBranchLeaf returns the most recent message below parentID, or of the
+// whole session when parentID is nil.
+func latestBranchLeaf(sessionID uint, parentID *uint) (*uint, error) {
+	if parentID == nil {
+		return models.LatestChatMessageID(sessionID)
+	}
+	leafID, err := models.LatestChatDescendant(*parentID)
+	if err != nil {
+		return nil, err
+	}
+	return &leafID, nil
+}
@@ -1,9 +1,13 @@
 package controllers
 
 import (
+	"backend/config"
 	"backend/internal/models"
+	"backend/internal/rag"
 	"backend/internal/schemas"
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 	"time"
 
@@ -20,17 +24,31 @@ func CreateChatSession() gin.HandlerFunc {
 		}
 
 		session := models.ChatSession{
-			UserID:          userID,
-			Title:           sessionReq.Title,
-			KnowledgeBaseID: sessionReq.KnowledgeBaseID,
-			CreatedAt:       time.Now(),
-			UpdatedAt:       time.Now(),
+			UserID:    userID,
+			Title:     sessionReq.Title,
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		}
+		kbs := attachKnowledgeBases(c, &session, sessionReq.KnowledgeBaseID, sessionReq.KnowledgeBaseIDs)
+		if kbs == nil {
+			return
+		}
+		if sessionReq.Settings != nil {
+			session.Settings = sessionSettings(*sessionReq.Settings)
+		}
+		if err := validateSessionSettings(session.Settings, kbs); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid settings: " + err.Error()})
+			return
 		}
 
 		if err := models.CreateChatSession(&session); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		if err := models.SetChatSessionKnowledgeBases(&session, session.KnowledgeBaseIDs); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 
 		c.JSON(http.StatusCreated, session)
 	}
@@ -75,6 +93,13 @@ func GetChatSessionByID() gin.HandlerFunc {
 			return
 		}
 
+		messages, err := activeChatPath(session)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		session.Messages = messages
+
 		c.JSON(http.StatusOK, session)
 	}
 }
@@ -110,13 +135,27 @@ func UpdateChatSession() gin.HandlerFunc {
 		}
 
 		session.Title = sessionReq.Title
-		session.KnowledgeBaseID = sessionReq.KnowledgeBaseID
+		kbs := attachKnowledgeBases(c, session, sessionReq.KnowledgeBaseID, sessionReq.KnowledgeBaseIDs)
+		if kbs == nil {
+			return
+		}
+		if sessionReq.Settings != nil {
+			session.Settings = sessionSettings(*sessionReq.Settings)
+		}
+		if err := validateSessionSettings(session.Settings, kbs); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid settings: " + err.Error()})
+			return
+		}
 		session.UpdatedAt = time.Now()
 
 		if err := models.UpdateChatSession(session); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		if err := models.SetChatSessionKnowledgeBases(session, session.KnowledgeBaseIDs); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 
 		c.JSON(http.StatusOK, session)
 	}
@@ -155,3 +194,105 @@ func DeleteChatSession() gin.HandlerFunc {
 		c.JSON(http.StatusNoContent, nil)
 	}
 }
+
+func sessionSettings(req schemas.ChatSessionSettings) models.ChatSessionSettings {
+	return models.ChatSessionSettings{
+		Model:         req.Model,
+		Temperature:   req.Temperature,
+		TopK:          req.TopK,
+		RetrievalMode: req.RetrievalMode,
+	}
+}
+
+// attachKnowledgeBases sets the knowledge bases of a session from a request:
+// kbIDs, or primaryID alone. primaryID, which defaults to the first of
+// kbIDs, becomes the session's KnowledgeBaseID and is listed first. The
+// calling user must own every knowledge base. It returns them in order, or
+// writes the error response itself and returns nil.
+func attachKnowledgeBases(c *gin.Context, session *models.ChatSession, primaryID *uint, kbIDs []uint) []*models.KnowledgeBase {
+	var ids []uint
+	for _, id := range kbIDs {
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	if primaryID != nil {
+		if len(ids) > 0 && !slices.Contains(ids, *primaryID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "knowledge_base_id must be one of knowledge_base_ids"})
+			return nil
+		}
+		ids = slices.DeleteFunc(ids, func(id uint) bool { return id == *primaryID })
+		ids = append([]uint{*primaryID}, ids...)
+	}
+
+	kbs := make([]*models.KnowledgeBase, 0, len(ids))
+	for _, id := range ids {
+		kb, err := models.GetKnowledgeBaseByID(id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("knowledge base %d not found", id)})
+			return nil
+		}
+		if kb.UserID != session.UserID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "no permission"})
+			return nil
+		}
+		kbs = append(kbs, kb)
+	}
+
+	session.KnowledgeBaseID = nil
+	if len(ids) > 0 {
+		session.KnowledgeBaseID = &ids[0]
+	}
+	session.KnowledgeBaseIDs = ids
+	if ids == nil {
+		session.KnowledgeBaseIDs = []uint{}
+	}
+	return kbs
+}
+
+// sessionKnowledgeBases loads the knowledge bases a session searches, the
+// one whose settings apply first.
+func sessionKnowledgeBases(session *models.ChatSession) ([]*models.KnowledgeBase, error) {
+	ids := session.KnowledgeBaseIDs
+	if session.KnowledgeBaseID != nil {
+		ids = append([]uint{*session.KnowledgeBaseID}, slices.DeleteFunc(slices.Clone(ids), func(id uint) bool { return id == *session.KnowledgeBaseID })...)
+	}
+	kbs := make([]*models.KnowledgeBase, 0, len(ids))
+	for _, id := range ids {
+		kb, err := models.GetKnowledgeBaseByID(id)
+		if err != nil {
+			return nil, fmt.Errorf("knowledge base %d not found", id)
+		}
+		kbs = append(kbs, kb)
+	}
+	return kbs, nil
+}
+
+// validateSessionSettings checks that the chosen model is configured and
+// that every knowledge base of the session allows the chosen model,
+// retrieval mode and number of chunks. The graph mode is refused outright,
+// see rag.ModeGraph.
+func validateSessionSettings(settings models.ChatSessionSettings, kbs []*models.KnowledgeBase) error {
+	if settings.RetrievalMode == rag.ModeGraph {
+		return rag.ErrGraphUnsupported
+	}
+	if settings.Model != "" && !slices.Contains(config.LoadConfig().LLMModels, settings.Model) {
+		return fmt.Errorf("model %q is not available", settings.Model)
+	}
+	for _, kb := range kbs {
+		if settings.Model != "" {
+			if allowed := kb.AllowedModelList(); len(allowed) > 0 && !slices.Contains(allowed, settings.Model) {
+				return fmt.Errorf("model %q is not allowed in knowledge base %q", settings.Model, kb.Name)
+			}
+		}
+		if settings.RetrievalMode != "" {
+			if allowed := kb.AllowedModeList(); len(allowed) > 0 && !slices.Contains(allowed, settings.RetrievalMode) {
+				return fmt.Errorf("retrieval mode %q is not allowed in knowledge base %q", settings.RetrievalMode, kb.Name)
+			}
+		}
+		if kb.MaxTopK > 0 && settings.TopK > kb.MaxTopK {
+			return fmt.Errorf("top_k may be at most %d in knowledge base %q", kb.MaxTopK, kb.Name)
+		}
+	}
+	return nil
+}
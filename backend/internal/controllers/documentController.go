@@ -4,134 +4,622 @@ import (
 	"backend/config"
 	"backend/internal/models"
 	"backend/internal/queues"
+	"backend/internal/schemas"
 	"backend/internal/services"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"log"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"path"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
-func CreateDocument() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		userID := c.GetUint("user_id")
+// Duplicate handling policies accepted in the on_duplicate form field.
+const (
+	DuplicateSkip    = "skip"
+	DuplicateReplace = "replace"
+	DuplicateVersion = "version"
+)
+
+// uploadedFile is the "file" part of a multipart request with its SHA-256.
+type uploadedFile struct {
+	file        multipart.File
+	header      *multipart.FileHeader
+	contentHash string
+}
+
+// readUploadedFile hashes the uploaded file and rewinds it for uploading.
+func readUploadedFile(c *gin.Context) (*uploadedFile, error) {
+	if err := c.Request.ParseMultipartForm(32 << 20); err != nil && err != http.ErrNotMultipart {
+		return nil, fmt.Errorf("failed to parse multipart form")
+	}
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		return nil, fmt.Errorf("file is required")
+	}
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	return &uploadedFile{file: file, header: header, contentHash: hex.EncodeToString(hasher.Sum(nil))}, nil
+}
+
+// newDocumentStorage connects to MinIO and makes sure the documents bucket exists.
+func newDocumentStorage(ctx context.Context) (*services.MinIOStorage, string, error) {
+	cfg := config.LoadConfig()
+
+	storageSvc, err := services.NewMinIOStorage(
+		cfg.MinioEndpoint,
+		cfg.MinioAccessKey,
+		cfg.MinioSecretKey,
+		cfg.MinioUseSSL,
+		cfg.MinioRegion,
+	)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to initialize MinIO storage: %w", err)
+	}
+
+	if err := storageSvc.EnsureBucket(ctx, cfg.MinioBucket); err != nil {
+		return nil, "", fmt.Errorf("failed to ensure bucket: %w", err)
+	}
+	return storageSvc, cfg.MinioBucket, nil
+}
+
+// newObjectName returns a key that is unique per upload, so an upload never
+// overwrites the object of another document or version.
+func newObjectName(kbID uint, fileName string) string {
+	return fmt.Sprintf("kb_%d/%s/%s", kbID, uuid.NewString(), path.Base(fileName))
+}
+
+// storedFile describes an uploaded file that already sits in the documents bucket.
+type storedFile struct {
+	bucket      string
+	objectName  string
+	fileName    string
+	contentHash string
+	size        int64
+}
+
+func storeUploadedFile(ctx context.Context, storageSvc *services.MinIOStorage, bucket string, kbID uint, f *uploadedFile) (*storedFile, error) {
+	objectName := newObjectName(kbID, f.header.Filename)
+
+	contentType := f.header.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	if err := storageSvc.UploadObject(ctx, bucket, objectName, f.file, f.header.Size, contentType); err != nil {
+		return nil, fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	log.Printf("File uploaded to MinIO: bucket=%s, object=%s, size=%d", bucket, objectName, f.header.Size)
+	return &storedFile{
+		bucket:      bucket,
+		objectName:  objectName,
+		fileName:    f.header.Filename,
+		contentHash: f.contentHash,
+		size:        f.header.Size,
+	}, nil
+}
+
+// loadOwnedKnowledgeBase resolves the :knowledgeBaseId param and checks that
+// the knowledge base belongs to the calling user. It writes the error
+// response itself and returns nil when the request cannot proceed.
+func loadOwnedKnowledgeBase(c *gin.Context) *models.KnowledgeBase {
+	userID := c.GetUint("user_id")
 
-		kbParam := c.Param("knowledgeBaseId")
-		kbID64, err := strconv.ParseUint(kbParam, 10, 64)
+	kbID, err := strconv.ParseUint(c.Param("knowledgeBaseId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid knowledge base id"})
+		return nil
+	}
+
+	kb, err := models.GetKnowledgeBaseByID(uint(kbID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "knowledge base not found"})
+		return nil
+	}
+	if kb.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "no permission"})
+		return nil
+	}
+	return kb
+}
+
+// loadOwnedDocument resolves the :knowledgeBaseId and :docId params and checks
+// that the document belongs to the calling user. It writes the error response
+// itself and returns nil when the request cannot proceed.
+func loadOwnedDocument(c *gin.Context) *models.Document {
+	userID := c.GetUint("user_id")
+
+	kbID, err := strconv.ParseUint(c.Param("knowledgeBaseId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid knowledge base id"})
+		return nil
+	}
+	docID, err := strconv.ParseUint(c.Param("docId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid document id"})
+		return nil
+	}
+
+	doc, err := models.GetDocumentByID(uint(docID))
+	if err != nil || doc.KnowledgeBaseID != uint(kbID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+		return nil
+	}
+	if doc.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "no permission"})
+		return nil
+	}
+	return doc
+}
+
+// findDuplicate looks for a document currently serving identical content
+// first, then for one with the same name. Content matching only an older
+// version is logged, the upload is then a revert rather than a no-op.
+func findDuplicate(kbID uint, contentHash, fileName string) (*models.Document, bool, error) {
+	if contentHash != "" {
+		existing, err := models.FindDocumentByContentHash(kbID, contentHash)
+		if err != nil || existing != nil {
+			return existing, existing != nil, err
+		}
+		version, err := models.FindDocumentVersionByContentHash(kbID, contentHash)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid knowledge base id"})
-			return
+			return nil, false, err
+		}
+		if version != nil {
+			log.Printf("Upload of %q matches version %d of document %d", fileName, version.Version, version.DocumentID)
+		}
+	}
+	existing, err := models.FindDocumentByName(kbID, fileName)
+	return existing, false, err
+}
+
+// skippedUpload answers an upload the duplicate policy discarded: the
+// existing document, marked so clients can tell that nothing was stored.
+type skippedUpload struct {
+	*models.Document
+	Skipped bool `json:"skipped"`
+}
+
+// keepsExisting reports whether the duplicate policy leaves the existing
+// document untouched: when skipping, or when replacing it with the very same
+// bytes.
+func keepsExisting(existing *models.Document, identical bool, onDuplicate string) bool {
+	return existing != nil && (onDuplicate == DuplicateSkip || (identical && onDuplicate == DuplicateReplace))
+}
+
+// commitStoredFile turns a stored file into a document: a new document, a new
+// version of existing, or a replacement of existing's current file, depending
+// on the duplicate policy. Non-nil metadata replaces the document's metadata.
+// It returns the HTTP status to answer with.
+func commitStoredFile(ctx context.Context, storageSvc *services.MinIOStorage, kbID, userID uint, existing *models.Document, sf *storedFile, fileType, description string, metadata models.JSON, onDuplicate string) (*models.Document, int, error) {
+	if existing != nil {
+		if metadata != nil {
+			existing.Metadata = metadata
+		}
+		var err error
+		switch onDuplicate {
+		case DuplicateReplace:
+			err = replaceDocumentFile(ctx, storageSvc, existing, sf, fileType, description)
+		default:
+			_, err = addDocumentVersion(existing, sf, fileType, description, userID)
+		}
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		return existing, http.StatusOK, nil
+	}
+
+	// create document record with processing status
+	now := time.Now()
+	doc := models.Document{
+		KnowledgeBaseID: kbID,
+		UserID:          userID,
+		Name:            sf.fileName,
+		FileType:        fileType,
+		Description:     description,
+		Metadata:        metadata,
+		ObjectName:      sf.objectName,
+		ContentHash:     sf.contentHash,
+		Size:            sf.size,
+		Version:         1,
+		EmbeddingStatus: "processing",
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	version := models.DocumentVersion{
+		Version:         1,
+		FileName:        sf.fileName,
+		FileType:        fileType,
+		Description:     description,
+		ObjectName:      sf.objectName,
+		ContentHash:     sf.contentHash,
+		Size:            sf.size,
+		EmbeddingStatus: "processing",
+		UploadedBy:      userID,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+
+	if err := models.CreateDocumentWithVersion(&doc, &version); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	// enqueue asynq task
+	if err := queues.EnqueueProcessDocument(kbID, doc.ID, doc.Version, description, sf.bucket, sf.objectName, fileType); err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to enqueue processing task: %w", err)
+	}
+	return &doc, http.StatusCreated, nil
+}
+
+// addDocumentVersion records sf as the next version of doc and makes it the
+// version the document should serve. The previous version stays searchable
+// until the worker has indexed the new one.
+func addDocumentVersion(doc *models.Document, sf *storedFile, fileType, description string, userID uint) (*models.DocumentVersion, error) {
+	if err := models.EnsureInitialVersion(doc); err != nil {
+		return nil, err
+	}
+	next, err := models.NextDocumentVersion(doc.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	version := models.DocumentVersion{
+		DocumentID:      doc.ID,
+		Version:         next,
+		FileName:        sf.fileName,
+		FileType:        fileType,
+		Description:     description,
+		ObjectName:      sf.objectName,
+		ContentHash:     sf.contentHash,
+		Size:            sf.size,
+		EmbeddingStatus: "processing",
+		UploadedBy:      userID,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if err := models.CreateDocumentVersion(&version); err != nil {
+		return nil, err
+	}
+
+	doc.Version = version.Version
+	doc.FileType = fileType
+	doc.ObjectName = sf.objectName
+	doc.ContentHash = sf.contentHash
+	doc.Size = sf.size
+	doc.EmbeddingStatus = "processing"
+	doc.UpdatedAt = now
+	if description != "" {
+		doc.Description = description
+	}
+	if err := models.UpdateDocument(doc); err != nil {
+		return nil, err
+	}
+
+	if err := queues.EnqueueProcessDocument(doc.KnowledgeBaseID, doc.ID, version.Version, doc.Description, sf.bucket, sf.objectName, fileType); err != nil {
+		return nil, fmt.Errorf("failed to enqueue processing task: %w", err)
+	}
+	return &version, nil
+}
+
+// replaceDocumentFile swaps the file of the document's current version in place.
+func replaceDocumentFile(ctx context.Context, storageSvc *services.MinIOStorage, doc *models.Document, sf *storedFile, fileType, description string) error {
+	if err := models.EnsureInitialVersion(doc); err != nil {
+		return err
+	}
+	version, err := models.GetDocumentVersion(doc.ID, doc.Version)
+	if err != nil {
+		return err
+	}
+	if version == nil {
+		return fmt.Errorf("version %d of document %d not found", doc.Version, doc.ID)
+	}
+
+	oldObject := doc.ObjectName
+	now := time.Now()
+
+	version.FileName = sf.fileName
+	version.FileType = fileType
+	version.ObjectName = sf.objectName
+	version.ContentHash = sf.contentHash
+	version.Size = sf.size
+	version.EmbeddingStatus = "processing"
+	version.UpdatedAt = now
+	if description != "" {
+		version.Description = description
+	}
+	if err := models.UpdateDocumentVersion(version); err != nil {
+		return err
+	}
+
+	doc.FileType = fileType
+	doc.ObjectName = sf.objectName
+	doc.ContentHash = sf.contentHash
+	doc.Size = sf.size
+	doc.EmbeddingStatus = "processing"
+	doc.UpdatedAt = now
+	if description != "" {
+		doc.Description = description
+	}
+	if err := models.UpdateDocument(doc); err != nil {
+		return err
+	}
+
+	if oldObject != "" && oldObject != sf.objectName {
+		if err := storageSvc.RemoveObject(ctx, sf.bucket, oldObject); err != nil {
+			log.Printf("Failed to remove replaced object %s: %v", oldObject, err)
 		}
-		kbID := uint(kbID64)
+	}
+
+	if err := queues.EnqueueProcessDocument(doc.KnowledgeBaseID, doc.ID, doc.Version, doc.Description, sf.bucket, sf.objectName, fileType); err != nil {
+		return fmt.Errorf("failed to enqueue processing task: %w", err)
+	}
+	return nil
+}
+
+// validateDocumentFileType checks the file_type enum.
+func validateDocumentFileType(fileType string) error {
+	allowed := map[string]bool{"csv": true, "doc": true, "graph": true, "image": true}
+	if !allowed[fileType] {
+		return fmt.Errorf("file_type must be one of csv, doc, graph, image")
+	}
+	return nil
+}
+
+func validateOnDuplicate(onDuplicate string) error {
+	if onDuplicate != DuplicateSkip && onDuplicate != DuplicateReplace && onDuplicate != DuplicateVersion {
+		return fmt.Errorf("on_duplicate must be one of skip, replace, version")
+	}
+	return nil
+}
+
+func CreateDocument() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
 
-		// Parse multipart form
-		if err := c.Request.ParseMultipartForm(32 << 20); err != nil && err != http.ErrNotMultipart {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse multipart form"})
+		kb := loadOwnedKnowledgeBase(c)
+		if kb == nil {
 			return
 		}
 
-		file, header, err := c.Request.FormFile("file")
+		f, err := readUploadedFile(c)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		defer file.Close()
+		defer f.file.Close()
 
 		fileType := c.PostForm("file_type")
 		description := c.PostForm("description")
 
 		// validate file type enum
-		allowed := map[string]bool{"csv": true, "doc": true, "graph": true}
-		if !allowed[fileType] {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "file_type must be one of csv, doc, graph"})
+		if err := validateDocumentFileType(fileType); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		// prepare object name
-		objectName := fmt.Sprintf("kb_%d/%s", kbID, header.Filename)
+		onDuplicate := c.DefaultPostForm("on_duplicate", DuplicateSkip)
+		if err := validateOnDuplicate(onDuplicate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
-		// load config
-		cfg := config.LoadConfig()
-		bucket := cfg.MinioBucket
-
-		// Use MinIO storage
-		storageSvc, err := services.NewMinIOStorage(
-			cfg.MinioEndpoint,
-			cfg.MinioAccessKey,
-			cfg.MinioSecretKey,
-			cfg.MinioUseSSL,
-		)
+		metadata, err := metadataForm(c.PostForm("metadata"))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to initialize MinIO storage: " + err.Error()})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		existing, identical, err := findDuplicate(kb.ID, f.contentHash, f.header.Filename)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if keepsExisting(existing, identical, onDuplicate) {
+			c.JSON(http.StatusOK, skippedUpload{Document: existing, Skipped: true})
 			return
 		}
 
-		// ensure bucket exists and upload
 		ctx := context.Background()
-		if err := storageSvc.EnsureBucket(ctx, bucket); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to ensure bucket: " + err.Error()})
+		storageSvc, bucket, err := newDocumentStorage(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		sf, err := storeUploadedFile(ctx, storageSvc, bucket, kb.ID, f)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		contentType := header.Header.Get("Content-Type")
-		if contentType == "" {
-			contentType = "application/octet-stream"
+		doc, status, err := commitStoredFile(ctx, storageSvc, kb.ID, userID, existing, sf, fileType, description, metadata, onDuplicate)
+		if err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
 		}
 
-		if err := storageSvc.UploadObject(ctx, bucket, objectName, file, header.Size, contentType); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to upload file: " + err.Error()})
+		c.JSON(status, doc)
+	}
+}
+
+// DownloadDocumentFile serves the original file of a document, by default of
+// the version it currently serves. With ?presign=true it returns a short-lived
+// presigned URL instead of streaming the file through the API.
+func DownloadDocumentFile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		doc := loadOwnedDocument(c)
+		if doc == nil {
 			return
 		}
 
-		log.Printf("File uploaded to MinIO: bucket=%s, object=%s, size=%d", bucket, objectName, header.Size)
+		objectName := doc.ObjectName
+		fileName := doc.Name
+		if v := c.Query("version"); v != "" {
+			number, err := strconv.Atoi(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
+				return
+			}
+			version, err := models.GetDocumentVersion(doc.ID, number)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if version == nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "version not found"})
+				return
+			}
+			objectName = version.ObjectName
+			fileName = version.FileName
+		}
+		if objectName == "" {
+			// documents uploaded before object names were recorded
+			objectName = fmt.Sprintf("kb_%d/%s", doc.KnowledgeBaseID, doc.Name)
+		}
 
-		// create document record with processing status
-		now := time.Now()
-		doc := models.Document{
-			KnowledgeBaseID: kbID,
-			UserID:          userID,
-			Name:            header.Filename,
-			FileType:        fileType,
-			Description:     description,
-			EmbeddingStatus: "processing",
-			CreatedAt:       now,
-			UpdatedAt:       now,
+		disposition := "attachment"
+		if c.Query("disposition") == "inline" {
+			disposition = "inline"
 		}
+		contentDisposition := mime.FormatMediaType(disposition, map[string]string{"filename": path.Base(fileName)})
 
-		if err := models.CreateDocument(&doc); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx := c.Request.Context()
+		cfg := config.LoadConfig()
+
+		if c.Query("presign") == "true" {
+			presigner, err := newPresignStorage()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			expiry := time.Duration(cfg.PresignExpiryMinutes) * time.Minute
+			params := url.Values{}
+			params.Set("response-content-disposition", contentDisposition)
+			u, err := presigner.PresignedGetObject(ctx, cfg.MinioBucket, objectName, expiry, params)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"url": u.String(), "expires_at": time.Now().Add(expiry)})
 			return
 		}
 
-		// enqueue asynq task
-		if err := queues.EnqueueProcessDocument(kbID, doc.ID, description, bucket, objectName, fileType); err != nil {
-			// log but respond success because upload and DB succeeded
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enqueue processing task: " + err.Error()})
+		storageSvc, bucket, err := newDocumentStorage(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		info, err := storageSvc.StatObject(ctx, bucket, objectName)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+			return
+		}
+		object, err := storageSvc.GetObject(ctx, bucket, objectName)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		defer object.Close()
 
-		c.JSON(http.StatusCreated, doc)
+		if info.ContentType != "" {
+			c.Header("Content-Type", info.ContentType)
+		}
+		c.Header("Content-Disposition", contentDisposition)
+		if info.ETag != "" {
+			c.Header("ETag", `"`+info.ETag+`"`)
+		}
+		// ServeContent answers Range and conditional requests
+		http.ServeContent(c.Writer, c.Request, fileName, info.LastModified, object)
 	}
 }
 
+// ListDocuments returns the documents of a knowledge base with their
+// generated summaries, so users can tell files apart without opening them.
 func ListDocuments() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.JSON(http.StatusNotImplemented, gin.H{"error": "not implemented"})
+		kb := loadOwnedKnowledgeBase(c)
+		if kb == nil {
+			return
+		}
+
+		docs, err := models.ListDocumentsByKnowledgeBase(kb.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, docs)
 	}
 }
 
 func GetDocumentByID() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.JSON(http.StatusNotImplemented, gin.H{"error": "not implemented"})
+		doc := loadOwnedDocument(c)
+		if doc == nil {
+			return
+		}
+		c.JSON(http.StatusOK, doc)
 	}
 }
 
+// UpdateDocument renames a document or replaces its metadata. The indexed
+// chunks pick up the change without the document being embedded again.
 func UpdateDocument() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.JSON(http.StatusNotImplemented, gin.H{"error": "not implemented"})
+		doc := loadOwnedDocument(c)
+		if doc == nil {
+			return
+		}
+
+		var req schemas.UpdateDocumentRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if req.Name != "" {
+			doc.Name = req.Name
+		}
+		if req.Metadata != nil {
+			metadata, err := parseMetadata(*req.Metadata)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			doc.Metadata = metadata
+		}
+		doc.UpdatedAt = time.Now()
+
+		if err := models.UpdateDocumentDetails(doc); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := queues.EnqueueUpdateMetadata(doc.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to enqueue metadata update: %v", err)})
+			return
+		}
+
+		c.JSON(http.StatusOK, doc)
 	}
 }
 
@@ -0,0 +1,376 @@
+package controllers
+
+import (
+	"backend/internal/models"
+	"backend/internal/queues"
+	"backend/internal/schemas"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robfig/cron/v3"
+)
+
+// Crawl limits applied when a url source does not set its own.
+const (
+	defaultCrawlDepth = 2
+	defaultCrawlPages = 100
+)
+
+// webSourceConfig is stored in DocumentSource.Config for url sources.
+type webSourceConfig struct {
+	MaxDepth       int      `json:"max_depth"`
+	MaxPages       int      `json:"max_pages"`
+	AllowedDomains []string `json:"allowed_domains"`
+}
+
+func newWebSourceConfig(req schemas.CreateDocumentSourceRequest, u *url.URL) webSourceConfig {
+	cfg := webSourceConfig{
+		MaxDepth:       defaultCrawlDepth,
+		MaxPages:       defaultCrawlPages,
+		AllowedDomains: []string{u.Hostname()},
+	}
+	if req.MaxDepth != nil {
+		cfg.MaxDepth = *req.MaxDepth
+	}
+	if req.MaxPages > 0 {
+		cfg.MaxPages = req.MaxPages
+	}
+	if len(req.AllowedDomains) > 0 {
+		cfg.AllowedDomains = nil
+		for _, d := range req.AllowedDomains {
+			if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+				cfg.AllowedDomains = append(cfg.AllowedDomains, d)
+			}
+		}
+	}
+	return cfg
+}
+
+// gitSourceConfig is stored in DocumentSource.Config for git sources. An
+// empty branch follows the repository's default branch.
+type gitSourceConfig struct {
+	Branch  string   `json:"branch,omitempty"`
+	Include []string `json:"include,omitempty"`
+}
+
+var gitBranchPattern = regexp.MustCompile(`^[A-Za-z0-9._/-]+$`)
+
+func newGitSourceConfig(req schemas.CreateDocumentSourceRequest) (gitSourceConfig, error) {
+	cfg := gitSourceConfig{Branch: strings.TrimSpace(req.Branch)}
+	if cfg.Branch != "" && (!gitBranchPattern.MatchString(cfg.Branch) || strings.HasPrefix(cfg.Branch, "-") || strings.Contains(cfg.Branch, "..")) {
+		return cfg, fmt.Errorf("invalid branch name")
+	}
+	for _, pattern := range req.Include {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return cfg, fmt.Errorf("invalid include pattern %q", pattern)
+		}
+		cfg.Include = append(cfg.Include, pattern)
+	}
+	return cfg, nil
+}
+
+// parseGitRemote accepts an absolute path to a repository on the worker, an
+// http(s), ssh, git or file URL, or the scp-like "user@host:path" syntax.
+func parseGitRemote(raw string) (string, error) {
+	remote := strings.TrimSpace(raw)
+	switch {
+	case remote == "" || strings.HasPrefix(remote, "-"):
+	case strings.HasPrefix(remote, "/"):
+		return remote, nil
+	case strings.Contains(remote, "://"):
+		u, err := url.Parse(remote)
+		if err == nil && (u.Scheme == "file" || u.Host != "") {
+			switch u.Scheme {
+			case "http", "https", "ssh", "git", "file":
+				return remote, nil
+			}
+		}
+	default:
+		host, repoPath, ok := strings.Cut(remote, ":")
+		if ok && host != "" && repoPath != "" && !strings.ContainsAny(host, "/ ") {
+			return remote, nil
+		}
+	}
+	return "", fmt.Errorf("url must be a repository URL or an absolute path")
+}
+
+// loadOwnedSource resolves :sourceId within the knowledge base. It writes the
+// error response itself and returns nil when the request cannot proceed.
+func loadOwnedSource(c *gin.Context, kb *models.KnowledgeBase) *models.DocumentSource {
+	sourceID, err := strconv.ParseUint(c.Param("sourceId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid source id"})
+		return nil
+	}
+
+	source, err := models.GetDocumentSourceByID(uint(sourceID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil
+	}
+	if source == nil || source.KnowledgeBaseID != kb.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "source not found"})
+		return nil
+	}
+	return source
+}
+
+func parseSourceURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("url must be an absolute http or https URL")
+	}
+	return u, nil
+}
+
+// validateSchedule accepts the cron specs understood by the worker's
+// scheduler: five fields or descriptors such as "@daily" and "@every 6h".
+func validateSchedule(schedule string) error {
+	if schedule == "" {
+		return nil
+	}
+	if _, err := cron.ParseStandard(schedule); err != nil {
+		return fmt.Errorf("invalid schedule: %v", err)
+	}
+	return nil
+}
+
+// CreateDocumentSource registers a web site, sitemap or git repository and
+// queues its first sync.
+func CreateDocumentSource() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		kb := loadOwnedKnowledgeBase(c)
+		if kb == nil {
+			return
+		}
+
+		var req schemas.CreateDocumentSourceRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.Schedule = strings.TrimSpace(req.Schedule)
+		if err := validateSchedule(req.Schedule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var location string
+		var cfg interface{}
+		switch req.Type {
+		case models.SourceTypeURL:
+			u, err := parseSourceURL(req.URL)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			location, cfg = u.String(), newWebSourceConfig(req, u)
+		case models.SourceTypeGit:
+			remote, err := parseGitRemote(req.URL)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			gitCfg, err := newGitSourceConfig(req)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			location, cfg = remote, gitCfg
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "type must be url or git"})
+			return
+		}
+		b, err := json.Marshal(cfg)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		source := &models.DocumentSource{
+			KnowledgeBaseID: kb.ID,
+			UserID:          userID,
+			Type:            req.Type,
+			URL:             location,
+			Config:          models.JSON(b),
+			Schedule:        req.Schedule,
+			Status:          "pending",
+		}
+		if err := models.CreateDocumentSource(source); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := queues.EnqueueSyncSource(source.ID); err != nil {
+			log.Printf("Failed to enqueue sync of source %d: %v", source.ID, err)
+		}
+
+		c.JSON(http.StatusCreated, source)
+	}
+}
+
+func ListDocumentSources() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kb := loadOwnedKnowledgeBase(c)
+		if kb == nil {
+			return
+		}
+
+		sources, err := models.ListDocumentSources(kb.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, sources)
+	}
+}
+
+func GetDocumentSource() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kb := loadOwnedKnowledgeBase(c)
+		if kb == nil {
+			return
+		}
+
+		source := loadOwnedSource(c, kb)
+		if source == nil {
+			return
+		}
+
+		c.JSON(http.StatusOK, source)
+	}
+}
+
+// UpdateDocumentSource changes the sync schedule of a source. The worker's
+// scheduler picks up the change within a few minutes.
+func UpdateDocumentSource() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kb := loadOwnedKnowledgeBase(c)
+		if kb == nil {
+			return
+		}
+
+		source := loadOwnedSource(c, kb)
+		if source == nil {
+			return
+		}
+
+		var req schemas.UpdateDocumentSourceRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Schedule != nil {
+			schedule := strings.TrimSpace(*req.Schedule)
+			if err := validateSchedule(schedule); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			source.Schedule = schedule
+		}
+
+		if err := models.UpdateDocumentSourceSchedule(source); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, source)
+	}
+}
+
+// ListSourceSyncHistory returns the latest sync runs of the knowledge base's
+// sources, newest first. ?source_id= restricts it to one source.
+func ListSourceSyncHistory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kb := loadOwnedKnowledgeBase(c)
+		if kb == nil {
+			return
+		}
+
+		var sourceID uint64
+		if raw := c.Query("source_id"); raw != "" {
+			var err error
+			sourceID, err = strconv.ParseUint(raw, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid source id"})
+				return
+			}
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		if err != nil || limit < 1 || limit > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+			return
+		}
+
+		runs, err := models.ListSourceSyncRuns(kb.ID, uint(sourceID), limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, runs)
+	}
+}
+
+// SyncDocumentSource queues a sync. Pages whose content did not change since
+// the last sync are left alone, changed pages get a new document version and
+// pages that disappeared are deleted.
+func SyncDocumentSource() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kb := loadOwnedKnowledgeBase(c)
+		if kb == nil {
+			return
+		}
+
+		source := loadOwnedSource(c, kb)
+		if source == nil {
+			return
+		}
+		if source.Status == "syncing" {
+			c.JSON(http.StatusConflict, gin.H{"error": "source is already syncing"})
+			return
+		}
+
+		if err := queues.EnqueueSyncSource(source.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to queue sync"})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, source)
+	}
+}
+
+func DeleteDocumentSource() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kb := loadOwnedKnowledgeBase(c)
+		if kb == nil {
+			return
+		}
+
+		source := loadOwnedSource(c, kb)
+		if source == nil {
+			return
+		}
+
+		if err := models.DeleteDocumentSource(source.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusNoContent, nil)
+	}
+}
@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"backend/internal/models"
+	"backend/internal/queues"
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func CreateDocumentVersion() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		doc := loadOwnedDocument(c)
+		if doc == nil {
+			return
+		}
+
+		f, err := readUploadedFile(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer f.file.Close()
+
+		fileType := c.DefaultPostForm("file_type", doc.FileType)
+		if err := validateDocumentFileType(fileType); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		metadata, err := metadataForm(c.PostForm("metadata"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if metadata != nil {
+			doc.Metadata = metadata
+		}
+
+		ctx := context.Background()
+		storageSvc, bucket, err := newDocumentStorage(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		sf, err := storeUploadedFile(ctx, storageSvc, bucket, doc.KnowledgeBaseID, f)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		version, err := addDocumentVersion(doc, sf, fileType, c.PostForm("description"), userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, version)
+	}
+}
+
+func ListDocumentVersions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		doc := loadOwnedDocument(c)
+		if doc == nil {
+			return
+		}
+
+		if err := models.EnsureInitialVersion(doc); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		versions, err := models.ListDocumentVersions(doc.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"active_version": doc.Version, "versions": versions})
+	}
+}
+
+// ActivateDocumentVersion makes an already indexed version the searchable one,
+// e.g. to roll back to a previous file.
+func ActivateDocumentVersion() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		doc := loadOwnedDocument(c)
+		if doc == nil {
+			return
+		}
+
+		number, err := strconv.Atoi(c.Param("version"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
+			return
+		}
+
+		if err := models.EnsureInitialVersion(doc); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		version, err := models.GetDocumentVersion(doc.ID, number)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if version == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "version not found"})
+			return
+		}
+		if version.EmbeddingStatus != "done" {
+			c.JSON(http.StatusConflict, gin.H{"error": "only versions that finished processing can be activated"})
+			return
+		}
+
+		doc.Version = version.Version
+		doc.FileType = version.FileType
+		doc.ObjectName = version.ObjectName
+		doc.ContentHash = version.ContentHash
+		doc.Size = version.Size
+		doc.EmbeddingStatus = version.EmbeddingStatus
+		doc.Language = version.Language
+		doc.Summary = version.Summary
+		doc.SuggestedTitle = version.SuggestedTitle
+		doc.Keywords = version.Keywords
+		doc.UpdatedAt = time.Now()
+		if err := models.UpdateDocument(doc); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := queues.EnqueueActivateDocument(doc.ID, doc.Version); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enqueue activation task: " + err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, doc)
+	}
+}
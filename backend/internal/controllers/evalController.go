@@ -0,0 +1,526 @@
+package controllers
+
+import (
+	"backend/config"
+	"backend/internal/eval"
+	"backend/internal/models"
+	"backend/internal/queues"
+	"backend/internal/schemas"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateEvalSet stores a golden question set for a knowledge base.
+func CreateEvalSet() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid knowledge base ID"})
+			return
+		}
+		kb, err := models.GetKnowledgeBaseByID(uint(id))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "knowledge base not found"})
+			return
+		}
+		if kb.UserID != userID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "no permission"})
+			return
+		}
+
+		var req schemas.CreateEvalSetRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		set := models.EvalSet{
+			UserID:          userID,
+			KnowledgeBaseID: kb.ID,
+			Name:            req.Name,
+			Description:     req.Description,
+			Status:          models.EvalSetReady,
+			Cases:           evalCases(0, req.Cases),
+		}
+		if err := models.CreateEvalSet(&set); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, set)
+	}
+}
+
+// GenerateEvalSet creates a set whose questions the worker writes from
+// sampled chunks of the knowledge base, with the document of each chunk as
+// the expected source. The set is "generating" until the worker is done;
+// afterwards its cases can be reviewed and edited like hand-written ones.
+func GenerateEvalSet() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid knowledge base ID"})
+			return
+		}
+		kb, err := models.GetKnowledgeBaseByID(uint(id))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "knowledge base not found"})
+			return
+		}
+		if kb.UserID != userID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "no permission"})
+			return
+		}
+
+		var req schemas.GenerateEvalSetRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Count == 0 {
+			req.Count = 20
+		}
+		for _, docID := range req.DocumentIDs {
+			doc, err := models.GetDocumentByID(docID)
+			if err != nil || doc.KnowledgeBaseID != kb.ID {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "document " + strconv.FormatUint(uint64(docID), 10) + " not found in knowledge base"})
+				return
+			}
+		}
+
+		set := models.EvalSet{
+			UserID:          userID,
+			KnowledgeBaseID: kb.ID,
+			Name:            req.Name,
+			Description:     req.Description,
+			Status:          models.EvalSetGenerating,
+		}
+		if err := models.CreateEvalSet(&set); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := queues.EnqueueGenerateEvalSet(queues.GenerateEvalSetPayload{
+			SetID:           set.ID,
+			KnowledgeBaseID: kb.ID,
+			Count:           req.Count,
+			DocumentIDs:     req.DocumentIDs,
+		}); err != nil {
+			set.Status = models.EvalSetFailed
+			set.Error = err.Error()
+			if err := models.UpdateEvalSet(&set); err != nil {
+				log.Printf("Failed to update eval set %d: %v", set.ID, err)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enqueue generation"})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, set)
+	}
+}
+
+func ListEvalSets() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid knowledge base ID"})
+			return
+		}
+		kb, err := models.GetKnowledgeBaseByID(uint(id))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "knowledge base not found"})
+			return
+		}
+		if kb.UserID != userID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "no permission"})
+			return
+		}
+
+		sets, err := models.ListEvalSetsByKnowledgeBase(kb.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, sets)
+	}
+}
+
+// GetEvalSet returns a set with its cases.
+func GetEvalSet() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		set := loadOwnedEvalSet(c)
+		if set == nil {
+			return
+		}
+
+		cases, err := models.ListEvalCases(set.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		set.Cases = cases
+
+		c.JSON(http.StatusOK, set)
+	}
+}
+
+func UpdateEvalSet() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		set := loadOwnedEvalSet(c)
+		if set == nil {
+			return
+		}
+
+		var req schemas.UpdateEvalSetRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Name != nil {
+			set.Name = *req.Name
+		}
+		if req.Description != nil {
+			set.Description = *req.Description
+		}
+		if err := models.UpdateEvalSet(set); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, set)
+	}
+}
+
+func DeleteEvalSet() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		set := loadOwnedEvalSet(c)
+		if set == nil {
+			return
+		}
+
+		if err := models.DeleteEvalSet(set.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusNoContent, nil)
+	}
+}
+
+func AddEvalCases() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		set := loadOwnedEvalSet(c)
+		if set == nil || evalSetGenerating(c, set) {
+			return
+		}
+
+		var req schemas.AddEvalCasesRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		cases := evalCases(set.ID, req.Cases)
+		if err := models.CreateEvalCases(cases); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, cases)
+	}
+}
+
+// UpdateEvalCase edits a case, typically to correct a generated question
+// or answer.
+func UpdateEvalCase() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		set := loadOwnedEvalSet(c)
+		if set == nil || evalSetGenerating(c, set) {
+			return
+		}
+		caseID, err := strconv.ParseUint(c.Param("caseId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid case ID"})
+			return
+		}
+		ec, err := models.GetEvalCase(set.ID, uint(caseID))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "eval case not found"})
+			return
+		}
+
+		var req schemas.UpdateEvalCaseRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Question != nil {
+			ec.Question = *req.Question
+		}
+		if req.ExpectedAnswer != nil {
+			ec.ExpectedAnswer = *req.ExpectedAnswer
+		}
+		if req.ExpectedSources != nil {
+			ec.ExpectedSources = nil
+			if len(*req.ExpectedSources) > 0 {
+				if b, err := json.Marshal(*req.ExpectedSources); err == nil {
+					ec.ExpectedSources = models.JSON(b)
+				}
+			}
+		}
+		if err := models.UpdateEvalCase(ec); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, ec)
+	}
+}
+
+func DeleteEvalCase() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		set := loadOwnedEvalSet(c)
+		if set == nil || evalSetGenerating(c, set) {
+			return
+		}
+		caseID, err := strconv.ParseUint(c.Param("caseId"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid case ID"})
+			return
+		}
+
+		if err := models.DeleteEvalCase(set.ID, uint(caseID)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusNoContent, nil)
+	}
+}
+
+// StartEvalRun evaluates a set against its knowledge base in the
+// background. Poll the returned run until it is no longer running.
+func StartEvalRun() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		set := loadOwnedEvalSet(c)
+		if set == nil || evalSetGenerating(c, set) {
+			return
+		}
+
+		var req schemas.StartEvalRunRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		kb, err := models.GetKnowledgeBaseByID(set.KnowledgeBaseID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "knowledge base not found"})
+			return
+		}
+		cases, err := models.ListEvalCases(set.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(cases) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "eval set has no cases"})
+			return
+		}
+
+		run := models.EvalRun{
+			SetID:           set.ID,
+			KnowledgeBaseID: kb.ID,
+			Label:           req.Label,
+			Status:          models.EvalRunRunning,
+			StartedAt:       time.Now(),
+		}
+		if err := models.CreateEvalRun(&run); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		cfg := config.LoadConfig()
+		evalCfg := eval.Config{
+			TopK:           req.TopK,
+			Mode:           req.Mode,
+			Rewrite:        req.Rewrite,
+			Judge:          req.Judge,
+			AnswerModel:    cfg.LLMModel,
+			EmbeddingModel: cfg.EmbeddingModel,
+		}
+		if evalCfg.TopK == 0 {
+			evalCfg.TopK = cfg.RAGTopK
+		}
+		if evalCfg.Judge == eval.JudgeLLM {
+			evalCfg.JudgeModel = cfg.LLMModel
+		}
+		// the run outlives the request
+		go func(run models.EvalRun) {
+			runner := eval.NewRunner(newRAGPipeline(), newLLMService())
+			if err := runner.Run(context.Background(), kb, &run, cases, evalCfg); err != nil {
+				log.Printf("Eval run %d failed: %v", run.ID, err)
+			}
+		}(run)
+
+		c.JSON(http.StatusAccepted, run)
+	}
+}
+
+func ListEvalRuns() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		set := loadOwnedEvalSet(c)
+		if set == nil {
+			return
+		}
+
+		runs, err := models.ListEvalRunsBySet(set.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, runs)
+	}
+}
+
+// GetEvalRun returns a run with the result of every case.
+func GetEvalRun() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		run := loadOwnedEvalRun(c, c.Param("runId"))
+		if run == nil {
+			return
+		}
+
+		results, err := models.ListEvalResults(run.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"run": run, "results": results})
+	}
+}
+
+// CompareEvalRuns compares a run with the run given by ?base=, typically an
+// earlier run of the same set, and lists the cases whose scores changed.
+func CompareEvalRuns() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		head := loadOwnedEvalRun(c, c.Param("runId"))
+		if head == nil {
+			return
+		}
+		if c.Query("base") == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "base is required"})
+			return
+		}
+		base := loadOwnedEvalRun(c, c.Query("base"))
+		if base == nil {
+			return
+		}
+		if base.SetID != head.SetID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "runs belong to different eval sets"})
+			return
+		}
+
+		baseResults, err := models.ListEvalResults(base.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		headResults, err := models.ListEvalResults(head.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, eval.Compare(base, head, baseResults, headResults))
+	}
+}
+
+// evalCases converts requested cases into cases of set.
+func evalCases(setID uint, reqs []schemas.EvalCaseRequest) []models.EvalCase {
+	cases := make([]models.EvalCase, 0, len(reqs))
+	for _, r := range reqs {
+		ec := models.EvalCase{SetID: setID, Question: r.Question, ExpectedAnswer: r.ExpectedAnswer}
+		if len(r.ExpectedSources) > 0 {
+			if b, err := json.Marshal(r.ExpectedSources); err == nil {
+				ec.ExpectedSources = models.JSON(b)
+			}
+		}
+		cases = append(cases, ec)
+	}
+	return cases
+}
+
+// loadOwnedEvalSet resolves the :setId param to a set of the calling user.
+// It writes the error response itself and returns nil when the request
+// cannot proceed.
+func loadOwnedEvalSet(c *gin.Context) *models.EvalSet {
+	userID := c.GetUint("user_id")
+
+	id, err := strconv.ParseUint(c.Param("setId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid eval set ID"})
+		return nil
+	}
+	set, err := models.GetEvalSetByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "eval set not found"})
+		return nil
+	}
+	if set.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "no permission"})
+		return nil
+	}
+	return set
+}
+
+// evalSetGenerating rejects changes to a set the worker is still filling in.
+func evalSetGenerating(c *gin.Context, set *models.EvalSet) bool {
+	if set.Status != models.EvalSetGenerating {
+		return false
+	}
+	c.JSON(http.StatusConflict, gin.H{"error": "eval set is still being generated"})
+	return true
+}
+
+// loadOwnedEvalRun resolves a run ID to a run of a set of the calling user,
+// writing the error response itself like loadOwnedEvalSet.
+func loadOwnedEvalRun(c *gin.Context, param string) *models.EvalRun {
+	userID := c.GetUint("user_id")
+
+	id, err := strconv.ParseUint(param, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid eval run ID"})
+		return nil
+	}
+	run, err := models.GetEvalRunByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "eval run not found"})
+		return nil
+	}
+	set, err := models.GetEvalSetByID(run.SetID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "eval run not found"})
+		return nil
+	}
+	if set.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "no permission"})
+		return nil
+	}
+	return run
+}
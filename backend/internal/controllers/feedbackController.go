@@ -0,0 +1,247 @@
+package controllers
+
+import (
+	"backend/internal/models"
+	"backend/internal/schemas"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultReportDays is the range of a feedback report without dates.
+const defaultReportDays = 30
+
+// SaveMessageFeedback rates an assistant answer, replacing an earlier
+// rating of it. The rating is reported to the knowledge bases the answer's
+// sources came from, see feedbackKnowledgeBases.
+func SaveMessageFeedback() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session := loadOwnedChatSession(c)
+		if session == nil {
+			return
+		}
+		message := loadSessionMessage(c, session)
+		if message == nil {
+			return
+		}
+		if message.Role != "assistant" || message.IsToolStep() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "only assistant answers can be rated"})
+			return
+		}
+
+		var req schemas.FeedbackRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Rating > 0 {
+			req.Reason = ""
+		}
+
+		now := time.Now()
+		feedback := models.MessageFeedback{
+			MessageID:        message.ID,
+			UserID:           session.UserID,
+			KnowledgeBaseID:  session.KnowledgeBaseID,
+			Rating:           req.Rating,
+			Reason:           req.Reason,
+			Comment:          req.Comment,
+			KnowledgeBaseIDs: feedbackKnowledgeBases(session, message),
+			CreatedAt:        now,
+			UpdatedAt:        now,
+		}
+		if err := models.SaveMessageFeedback(&feedback); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		saved, err := models.GetMessageFeedback(message.ID)
+		if err != nil || saved == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load feedback"})
+			return
+		}
+
+		c.JSON(http.StatusOK, saved)
+	}
+}
+
+// feedbackKnowledgeBases returns the knowledge bases of the session that
+// the answer's sources came from, in the session's order. An answer without
+// sources, e.g. one generated without retrieval, is reported to every
+// knowledge base of the session.
+func feedbackKnowledgeBases(session *models.ChatSession, message *models.ChatMessage) []uint {
+	attached := session.KnowledgeBaseIDs
+	if len(attached) == 0 && session.KnowledgeBaseID != nil {
+		attached = []uint{*session.KnowledgeBaseID}
+	}
+
+	var sources []struct {
+		KnowledgeBaseID uint `json:"knowledge_base_id"`
+	}
+	if len(message.Citations) > 0 {
+		_ = json.Unmarshal(message.Citations, &sources)
+	}
+	fromSources := map[uint]bool{}
+	for _, s := range sources {
+		fromSources[s.KnowledgeBaseID] = true
+	}
+	cited := make([]uint, 0, len(attached))
+	for _, id := range attached {
+		if fromSources[id] {
+			cited = append(cited, id)
+		}
+	}
+	if len(cited) == 0 {
+		return attached
+	}
+	return cited
+}
+
+func GetMessageFeedback() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session := loadOwnedChatSession(c)
+		if session == nil {
+			return
+		}
+		message := loadSessionMessage(c, session)
+		if message == nil {
+			return
+		}
+
+		feedback, err := models.GetMessageFeedback(message.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if feedback == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "feedback not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, feedback)
+	}
+}
+
+func DeleteMessageFeedback() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session := loadOwnedChatSession(c)
+		if session == nil {
+			return
+		}
+		message := loadSessionMessage(c, session)
+		if message == nil {
+			return
+		}
+
+		if err := models.DeleteMessageFeedback(message.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusNoContent, nil)
+	}
+}
+
+// GetFeedbackReport aggregates the ratings of a knowledge base's answers:
+// ratings over time, the reasons given for bad answers, the questions with
+// the worst rated answers and the documents those answers cited, so content
+// owners know what to fix.
+func GetFeedbackReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid knowledge base ID"})
+			return
+		}
+		kb, err := models.GetKnowledgeBaseByID(uint(id))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "knowledge base not found"})
+			return
+		}
+		if kb.UserID != userID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "no permission"})
+			return
+		}
+
+		var req schemas.FeedbackReportRequest
+		if err := c.ShouldBindQuery(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		q := models.FeedbackReportQuery{
+			KnowledgeBaseID: kb.ID,
+			Interval:        req.Interval,
+			Limit:           req.Limit,
+		}
+		if q.Interval == "" {
+			q.Interval = "day"
+		}
+		if q.Limit == 0 {
+			q.Limit = 10
+		}
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+		q.To = today.AddDate(0, 0, 1)
+		if req.To != "" {
+			to, _ := time.Parse("2006-01-02", req.To)
+			q.To = to.AddDate(0, 0, 1)
+		}
+		q.From = q.To.AddDate(0, 0, -defaultReportDays)
+		if req.From != "" {
+			q.From, _ = time.Parse("2006-01-02", req.From)
+		}
+		if !q.From.Before(q.To) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must not be after to"})
+			return
+		}
+
+		timeline, err := models.FeedbackTimeline(q)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		reasons, err := models.FeedbackReasons(q)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		queries, err := models.WorstRatedQueries(q)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		documents, err := models.DocumentsInBadAnswers(q)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		up, down := 0, 0
+		for _, p := range timeline {
+			up += p.Up
+			down += p.Down
+		}
+		var satisfaction *float64
+		if up+down > 0 {
+			rate := float64(up) / float64(up+down)
+			satisfaction = &rate
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"knowledge_base_id":        kb.ID,
+			"from":                     q.From,
+			"to":                       q.To,
+			"interval":                 q.Interval,
+			"up":                       up,
+			"down":                     down,
+			"satisfaction":             satisfaction,
+			"timeline":                 timeline,
+			"reasons":                  reasons,
+			"worst_queries":            queries,
+			"documents_in_bad_answers": documents,
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package controllers
+
+import (
+	"slices"
+	"testing"
+
+	"backend/internal/models"
+)
+
+func TestFeedbackKnowledgeBases(t *testing.T) {
+	kb := uint(2)
+	tests := []struct {
+		name      string
+		session   models.ChatSession
+		citations string
+		want      []uint
+	}{
+		{"cited", models.ChatSession{KnowledgeBaseIDs: []uint{2, 5, 7}},
+			`[{"knowledge_base_id":7},{"knowledge_base_id":5},{"knowledge_base_id":7}]`, []uint{5, 7}},
+		{"detached knowledge base", models.ChatSession{KnowledgeBaseIDs: []uint{2, 5}},
+			`[{"knowledge_base_id":9},{"knowledge_base_id":5}]`, []uint{5}},
+		{"no sources", models.ChatSession{KnowledgeBaseIDs: []uint{2, 5}}, `[]`, []uint{2, 5}},
+		{"no citations", models.ChatSession{KnowledgeBaseIDs: []uint{2, 5}}, ``, []uint{2, 5}},
+		{"single knowledge base", models.ChatSession{KnowledgeBaseID: &kb}, `[{"knowledge_base_id":2}]`, []uint{2}},
+		{"no knowledge base", models.ChatSession{}, `[{"knowledge_base_id":2}]`, nil},
+	}
+	for _, tt := range tests {
+		message := &models.ChatMessage{Citations: models.JSON(tt.citations)}
+		if got := feedbackKnowledgeBases(&tt.session, message); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: feedbackKnowledgeBases = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -3,10 +3,14 @@ package controllers
 import (
 	"time"
 	"fmt"
+	"encoding/json"
+	"slices"
+	"backend/config"
 	"net/http"
 	"strconv"
 	"github.com/gin-gonic/gin"
 	"backend/internal/models"
+	"backend/internal/rag"
 	"backend/internal/schemas"
 )
 
@@ -18,10 +22,29 @@ func CreateKnowledgeBase() gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if err := rag.ValidatePromptTemplate(kbReq.SystemPrompt); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid system prompt: " + err.Error()})
+			return
+		}
 		kb := models.KnowledgeBase{
-			UserID:      userID,
-			Name:        kbReq.Name,
-			Description: kbReq.Description,
+			UserID:         userID,
+			Name:           kbReq.Name,
+			Description:    kbReq.Description,
+			QueryRewrite:   kbReq.QueryRewrite,
+			SystemPrompt:   kbReq.SystemPrompt,
+			MinRelevance:   kbReq.MinRelevance,
+			FallbackAnswer: kbReq.FallbackAnswer,
+			GroundingCheck: kbReq.GroundingCheck,
+			MaxTopK:        kbReq.MaxTopK,
+		}
+		if !setSessionLimits(c, &kb, kbReq.AllowedModels, kbReq.AllowedModes) {
+			return
+		}
+		if kb.QueryRewrite == "" {
+			kb.QueryRewrite = rag.RewriteCondense
+		}
+		if kb.GroundingCheck == "" {
+			kb.GroundingCheck = rag.GroundingOff
 		}
 		kb.CreatedAt = time.Now()
 		kb.UpdatedAt = time.Now()
@@ -99,6 +122,40 @@ func UpdateKnowledgeBase() gin.HandlerFunc {
 
 		kb.Name = kbReq.Name
 		kb.Description = kbReq.Description
+		if kbReq.QueryRewrite != "" {
+			kb.QueryRewrite = kbReq.QueryRewrite
+		}
+		if kbReq.SystemPrompt != nil {
+			if err := rag.ValidatePromptTemplate(*kbReq.SystemPrompt); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid system prompt: " + err.Error()})
+				return
+			}
+			kb.SystemPrompt = *kbReq.SystemPrompt
+		}
+		if kbReq.MinRelevance != nil {
+			kb.MinRelevance = *kbReq.MinRelevance
+		}
+		if kbReq.FallbackAnswer != nil {
+			kb.FallbackAnswer = *kbReq.FallbackAnswer
+		}
+		if kbReq.GroundingCheck != "" {
+			kb.GroundingCheck = kbReq.GroundingCheck
+		}
+		if kbReq.AllowedModels != nil || kbReq.AllowedModes != nil {
+			allowedModels, allowedModes := kb.AllowedModelList(), kb.AllowedModeList()
+			if kbReq.AllowedModels != nil {
+				allowedModels = *kbReq.AllowedModels
+			}
+			if kbReq.AllowedModes != nil {
+				allowedModes = *kbReq.AllowedModes
+			}
+			if !setSessionLimits(c, kb, allowedModels, allowedModes) {
+				return
+			}
+		}
+		if kbReq.MaxTopK != nil {
+			kb.MaxTopK = *kbReq.MaxTopK
+		}
 		kb.UpdatedAt = time.Now()
 
 		if err := models.UpdateKnowledgeBase(kb); err != nil {
@@ -125,4 +182,27 @@ func DeleteKnowledgeBase() gin.HandlerFunc {
 		}
 		c.JSON(http.StatusNoContent, nil)
 	}
-}
\ No newline at end of file
+}
+
+// setSessionLimits stores the models and retrieval modes chat sessions of kb
+// may pick. Models must be configured. It writes the error response itself
+// and returns false when the request cannot proceed.
+func setSessionLimits(c *gin.Context, kb *models.KnowledgeBase, allowedModels, allowedModes []string) bool {
+	configured := config.LoadConfig().LLMModels
+	for _, m := range allowedModels {
+		if !slices.Contains(configured, m) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("model %q is not available", m)})
+			return false
+		}
+	}
+	kb.AllowedModels, kb.AllowedModes = nil, nil
+	if len(allowedModels) > 0 {
+		b, _ := json.Marshal(allowedModels)
+		kb.AllowedModels = models.JSON(b)
+	}
+	if len(allowedModes) > 0 {
+		b, _ := json.Marshal(allowedModes)
+		kb.AllowedModes = models.JSON(b)
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"backend/internal/models"
+	"backend/internal/rag"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	maxMetadataKeys        = 50
+	maxMetadataValueLength = 1024
+	maxMetadataListLength  = 100
+)
+
+// parseMetadata checks user-defined document metadata and encodes it for
+// storage. Values are strings, numbers, booleans or lists of those, so every
+// key can be used in a search filter. An empty map yields nil.
+func parseMetadata(m map[string]interface{}) (models.JSON, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	if len(m) > maxMetadataKeys {
+		return nil, fmt.Errorf("metadata has more than %d keys", maxMetadataKeys)
+	}
+	for key, value := range m {
+		if !rag.ValidMetadataKey(key) {
+			return nil, fmt.Errorf("invalid metadata key %q: use letters, digits and underscores", key)
+		}
+		if rag.BuiltinFields[key] {
+			return nil, fmt.Errorf("metadata key %q is reserved", key)
+		}
+		if list, ok := value.([]interface{}); ok {
+			if len(list) > maxMetadataListLength {
+				return nil, fmt.Errorf("metadata %q has more than %d values", key, maxMetadataListLength)
+			}
+			for _, v := range list {
+				if err := validateMetadataValue(key, v); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		if err := validateMetadataValue(key, value); err != nil {
+			return nil, err
+		}
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return models.JSON(b), nil
+}
+
+func validateMetadataValue(key string, value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		if len(v) > maxMetadataValueLength {
+			return fmt.Errorf("metadata %q is longer than %d characters", key, maxMetadataValueLength)
+		}
+	case float64, bool:
+	default:
+		return fmt.Errorf("metadata %q must be a string, number, boolean or a list of those", key)
+	}
+	return nil
+}
+
+// metadataForm reads the optional "metadata" form field, a JSON object.
+func metadataForm(value string) (models.JSON, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &m); err != nil {
+		return nil, fmt.Errorf("metadata must be a JSON object")
+	}
+	return parseMetadata(m)
+}
@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"backend/config"
+	"backend/internal/rag"
+	"backend/internal/schemas"
+	"backend/internal/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newLLMService() *services.LLMService {
+	cfg := config.LoadConfig()
+	return services.NewLLMService(cfg.LLMBaseURL, cfg.LLMAPIKey, cfg.LLMModel)
+}
+
+// newRAGPipeline wires the retriever and the LLM from the configuration.
+func newRAGPipeline() *rag.Pipeline {
+	cfg := config.LoadConfig()
+	embedder := services.NewEmbeddingService(cfg.EmbeddingBaseURL, cfg.EmbeddingAPIKey, cfg.EmbeddingModel)
+	qdrant := services.NewQdrantService(cfg.QdrantURL, cfg.QdrantAPIKey, cfg.QdrantCollection)
+	return rag.NewPipeline(rag.NewRetriever(embedder, qdrant, cfg.TextSearchConfigs), newLLMService())
+}
+
+// Search returns the chunks of a knowledge base that best match the query
+// by meaning, keywords or both, optionally narrowed down by a metadata
+// filter expression.
+func Search() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kb := loadOwnedKnowledgeBase(c)
+		if kb == nil {
+			return
+		}
+
+		var req schemas.SearchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		filter, err := rag.ParseFilter(req.Filter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid filter: " + err.Error()})
+			return
+		}
+		if req.TopK == 0 {
+			req.TopK = config.LoadConfig().RAGTopK
+		}
+
+		sources, err := newRAGPipeline().Retriever().Search(c.Request.Context(), req.Query, rag.SearchOptions{
+			KnowledgeBaseID: kb.ID,
+			Filter:          filter,
+			TopK:            req.TopK,
+			Mode:            req.Mode,
+		})
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"results": sources})
+	}
+}
+
+// PromptPreview renders the prompt a chat turn with the given query would
+// send to the model, using the knowledge base's system prompt template or
+// the one in the request, without generating an answer.
+func PromptPreview() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kb := loadOwnedKnowledgeBase(c)
+		if kb == nil {
+			return
+		}
+
+		var req schemas.PromptPreviewRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		template := kb.SystemPrompt
+		if req.Template != nil {
+			template = *req.Template
+		}
+		if err := rag.ValidatePromptTemplate(template); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid system prompt: " + err.Error()})
+			return
+		}
+		filter, err := rag.ParseFilter(req.Filter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid filter: " + err.Error()})
+			return
+		}
+		if req.TopK == 0 {
+			req.TopK = config.LoadConfig().RAGTopK
+		}
+
+		turn, err := newRAGPipeline().Prepare(c.Request.Context(), rag.ChatRequest{
+			KnowledgeBaseID:   &kb.ID,
+			Question:          req.Query,
+			Filter:            filter,
+			TopK:              req.TopK,
+			Mode:              req.Mode,
+			Rewrite:           kb.QueryRewrite,
+			Template:          template,
+			UserName:          userName(c.GetUint("user_id")),
+			KnowledgeBaseName: kb.Name,
+		})
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"messages":       turn.Messages,
+			"sources":        turn.Sources,
+			"search_queries": turn.SearchQueries,
+			"default":        template == "",
+		})
+	}
+}
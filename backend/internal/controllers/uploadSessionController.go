@@ -0,0 +1,437 @@
+package controllers
+
+import (
+	"backend/config"
+	"backend/internal/models"
+	"backend/internal/schemas"
+	"backend/internal/services"
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+)
+
+const (
+	// uploads up to this size get a single presigned PUT URL
+	singleUploadMaxSize = 64 << 20
+	// default part size of multipart uploads; S3 allows at most 10000 parts
+	multipartPartSize = 64 << 20
+	maxUploadParts    = 10000
+)
+
+// newPresignStorage returns a MinIO client for the public endpoint. It is only
+// used to sign URLs, which does not require a connection.
+func newPresignStorage() (*services.MinIOStorage, error) {
+	cfg := config.LoadConfig()
+	return services.NewMinIOStorage(
+		cfg.MinioPublicEndpoint,
+		cfg.MinioAccessKey,
+		cfg.MinioSecretKey,
+		cfg.MinioUseSSL,
+		cfg.MinioRegion,
+	)
+}
+
+// loadUploadSession resolves :sessionId and checks that the pending session
+// belongs to the knowledge base and the calling user.
+func loadUploadSession(c *gin.Context, kb *models.KnowledgeBase) *models.UploadSession {
+	session, err := models.GetUploadSessionByID(c.Param("sessionId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil
+	}
+	if session == nil || session.KnowledgeBaseID != kb.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "upload session not found"})
+		return nil
+	}
+	if session.UserID != c.GetUint("user_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "no permission"})
+		return nil
+	}
+	if session.Status != "pending" {
+		c.JSON(http.StatusConflict, gin.H{"error": "upload session is " + session.Status})
+		return nil
+	}
+	return session
+}
+
+// CreateUploadSession hands out presigned URLs so the client can upload the
+// file straight to MinIO: a single PUT URL for small files, one URL per part
+// of a multipart upload otherwise.
+func CreateUploadSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		kb := loadOwnedKnowledgeBase(c)
+		if kb == nil {
+			return
+		}
+
+		var req schemas.CreateUploadSessionRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validateDocumentFileType(req.FileType); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.OnDuplicate == "" {
+			req.OnDuplicate = DuplicateSkip
+		}
+		if err := validateOnDuplicate(req.OnDuplicate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.ContentType == "" {
+			req.ContentType = "application/octet-stream"
+		}
+		metadata, err := parseMetadata(req.Metadata)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.SHA256 = strings.ToLower(req.SHA256)
+
+		if req.DocumentID != nil {
+			doc, err := models.GetDocumentByID(*req.DocumentID)
+			if err != nil || doc.KnowledgeBaseID != kb.ID {
+				c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+				return
+			}
+			if doc.UserID != userID {
+				c.JSON(http.StatusForbidden, gin.H{"error": "no permission"})
+				return
+			}
+		} else if req.SHA256 != "" {
+			// nothing to upload when the policy keeps an existing document
+			existing, identical, err := findDuplicate(kb.ID, req.SHA256, req.FileName)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if keepsExisting(existing, identical, req.OnDuplicate) {
+				c.JSON(http.StatusOK, gin.H{"document": existing, "skipped": true})
+				return
+			}
+		}
+
+		ctx := context.Background()
+		storageSvc, bucket, err := newDocumentStorage(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		presigner, err := newPresignStorage()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		expiry := time.Duration(config.LoadConfig().PresignExpiryMinutes) * time.Minute
+		now := time.Now()
+		session := models.UploadSession{
+			ID:              uuid.NewString(),
+			UserID:          userID,
+			KnowledgeBaseID: kb.ID,
+			DocumentID:      req.DocumentID,
+			FileName:        req.FileName,
+			FileType:        req.FileType,
+			Description:     req.Description,
+			Metadata:        metadata,
+			ContentType:     req.ContentType,
+			ContentHash:     req.SHA256,
+			OnDuplicate:     req.OnDuplicate,
+			Size:            req.Size,
+			ObjectName:      newObjectName(kb.ID, req.FileName),
+			Status:          "pending",
+			ExpiresAt:       now.Add(expiry),
+			CreatedAt:       now,
+			UpdatedAt:       now,
+		}
+
+		if req.Size <= singleUploadMaxSize {
+			u, err := presigner.PresignedPutObject(ctx, bucket, session.ObjectName, expiry)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if err := models.CreateUploadSession(&session); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusCreated, gin.H{"session": session, "upload_url": u.String()})
+			return
+		}
+
+		partSize := int64(multipartPartSize)
+		if req.Size > partSize*maxUploadParts {
+			// round up to whole MiB so the part count stays within the limit
+			partSize = ((req.Size/maxUploadParts)/(1<<20) + 1) << 20
+		}
+		partCount := int((req.Size + partSize - 1) / partSize)
+
+		uploadID, err := storageSvc.NewMultipartUpload(ctx, bucket, session.ObjectName, req.ContentType)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		session.UploadID = uploadID
+		session.PartSize = partSize
+		session.PartCount = partCount
+
+		parts := make([]gin.H, 0, partCount)
+		for n := 1; n <= partCount; n++ {
+			u, err := presigner.PresignedUploadPart(ctx, bucket, session.ObjectName, uploadID, n, expiry)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			parts = append(parts, gin.H{"part_number": n, "url": u.String()})
+		}
+
+		if err := models.CreateUploadSession(&session); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"session": session, "parts": parts})
+	}
+}
+
+// CompleteUploadSession verifies the uploaded object's size and ETag and
+// turns it into a document (or a new version of one) queued for
+// processing. The declared SHA-256 is taken as the content hash for
+// deduplication; the worker verifies it, or fills it in when none was
+// declared, and fails the document on a mismatch.
+func CompleteUploadSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		kb := loadOwnedKnowledgeBase(c)
+		if kb == nil {
+			return
+		}
+		session := loadUploadSession(c, kb)
+		if session == nil {
+			return
+		}
+		if time.Now().After(session.ExpiresAt) {
+			c.JSON(http.StatusGone, gin.H{"error": "upload session expired"})
+			return
+		}
+
+		var req schemas.CompleteUploadSessionRequest
+		if err := c.ShouldBindJSON(&req); err != nil && session.UploadID != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx := context.Background()
+		storageSvc, bucket, err := newDocumentStorage(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var etag string
+		if session.UploadID != "" {
+			if len(req.Parts) != session.PartCount {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "etags of all parts are required"})
+				return
+			}
+			parts := make([]minio.CompletePart, 0, len(req.Parts))
+			for _, p := range req.Parts {
+				parts = append(parts, minio.CompletePart{PartNumber: p.PartNumber, ETag: p.ETag})
+			}
+			sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+			etag, err = storageSvc.CompleteMultipartUpload(ctx, bucket, session.ObjectName, session.UploadID, parts)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		} else {
+			etag = req.ETag
+		}
+
+		// the object is verified by its metadata only, its content hash is
+		// checked by the worker, which reads the file anyway
+		info, err := storageSvc.StatObject(ctx, bucket, session.ObjectName)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "uploaded object not found"})
+			return
+		}
+		if info.Size != session.Size {
+			rejectUpload(ctx, storageSvc, bucket, session)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "uploaded size does not match the declared size"})
+			return
+		}
+		if etag != "" && strings.Trim(etag, `"`) != strings.Trim(info.ETag, `"`) {
+			rejectUpload(ctx, storageSvc, bucket, session)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "uploaded object does not match the etag"})
+			return
+		}
+
+		log.Printf("File uploaded to MinIO: bucket=%s, object=%s, size=%d", bucket, session.ObjectName, info.Size)
+
+		sf := &storedFile{
+			bucket:      bucket,
+			objectName:  session.ObjectName,
+			fileName:    session.FileName,
+			contentHash: session.ContentHash,
+			size:        info.Size,
+		}
+
+		var doc *models.Document
+		status := http.StatusOK
+		if session.DocumentID != nil {
+			doc, err = models.GetDocumentByID(*session.DocumentID)
+			if err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+				return
+			}
+			if session.Metadata != nil {
+				doc.Metadata = session.Metadata
+			}
+			if _, err := addDocumentVersion(doc, sf, session.FileType, session.Description, userID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		} else {
+			existing, identical, err := findDuplicate(kb.ID, session.ContentHash, session.FileName)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if keepsExisting(existing, identical, session.OnDuplicate) {
+				if err := storageSvc.RemoveObject(ctx, bucket, session.ObjectName); err != nil {
+					log.Printf("Failed to remove object %s: %v", session.ObjectName, err)
+				}
+				completeUploadSession(session, existing)
+				c.JSON(http.StatusOK, skippedUpload{Document: existing, Skipped: true})
+				return
+			}
+			doc, status, err = commitStoredFile(ctx, storageSvc, kb.ID, userID, existing, sf, session.FileType, session.Description, session.Metadata, session.OnDuplicate)
+			if err != nil {
+				c.JSON(status, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		completeUploadSession(session, doc)
+		c.JSON(status, doc)
+	}
+}
+
+// rejectUpload discards an uploaded object that failed verification and
+// aborts its session.
+func rejectUpload(ctx context.Context, storageSvc *services.MinIOStorage, bucket string, session *models.UploadSession) {
+	if err := storageSvc.RemoveObject(ctx, bucket, session.ObjectName); err != nil {
+		log.Printf("Failed to remove object %s: %v", session.ObjectName, err)
+	}
+	session.Status = "aborted"
+	session.UpdatedAt = time.Now()
+	if err := models.UpdateUploadSession(session); err != nil {
+		log.Printf("Failed to update upload session %s: %v", session.ID, err)
+	}
+}
+
+// completeUploadSession records the document an upload ended up in. The
+// document is stored either way, so a failure is only logged.
+func completeUploadSession(session *models.UploadSession, doc *models.Document) {
+	session.Status = "completed"
+	session.DocumentID = &doc.ID
+	session.UpdatedAt = time.Now()
+	if err := models.UpdateUploadSession(session); err != nil {
+		log.Printf("Failed to update upload session %s: %v", session.ID, err)
+	}
+}
+
+// AbortUploadSession discards a pending upload and whatever was uploaded so far.
+func AbortUploadSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kb := loadOwnedKnowledgeBase(c)
+		if kb == nil {
+			return
+		}
+		session := loadUploadSession(c, kb)
+		if session == nil {
+			return
+		}
+
+		ctx := context.Background()
+		storageSvc, bucket, err := newDocumentStorage(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if session.UploadID != "" {
+			err = storageSvc.AbortMultipartUpload(ctx, bucket, session.ObjectName, session.UploadID)
+		} else {
+			err = storageSvc.RemoveObject(ctx, bucket, session.ObjectName)
+		}
+		if err != nil {
+			log.Printf("Failed to clean up upload session %s: %v", session.ID, err)
+		}
+
+		session.Status = "aborted"
+		session.UpdatedAt = time.Now()
+		if err := models.UpdateUploadSession(session); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusNoContent, nil)
+	}
+}
+
+// SweepUploadSessions removes the objects of upload sessions that expired
+// without being completed, every interval until the process exits. The
+// clients' presigned URLs have expired too, so nothing can be added to them.
+func SweepUploadSessions(interval time.Duration) {
+	for {
+		if err := sweepUploadSessions(context.Background()); err != nil {
+			log.Printf("Failed to sweep upload sessions: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+func sweepUploadSessions(ctx context.Context) error {
+	sessions, err := models.ListExpiredUploadSessions(time.Now(), 100)
+	if err != nil || len(sessions) == 0 {
+		return err
+	}
+	storageSvc, bucket, err := newDocumentStorage(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range sessions {
+		session := &sessions[i]
+		// claim the session first, so a concurrent sweep or a late
+		// completion cannot use an object that is being removed
+		expired, err := models.ExpireUploadSession(session.ID)
+		if err != nil {
+			return err
+		}
+		if !expired {
+			continue
+		}
+		if session.UploadID != "" {
+			err = storageSvc.AbortMultipartUpload(ctx, bucket, session.ObjectName, session.UploadID)
+		} else {
+			err = storageSvc.RemoveObject(ctx, bucket, session.ObjectName)
+		}
+		if err != nil {
+			log.Printf("Failed to clean up upload session %s: %v", session.ID, err)
+		}
+	}
+	log.Printf("Swept %d expired upload sessions", len(sessions))
+	return nil
+}
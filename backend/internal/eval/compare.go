@@ -0,0 +1,149 @@
+package eval
+
+import (
+	"encoding/json"
+
+	"backend/internal/models"
+)
+
+// Comparison shows how a run (head) scores against an earlier one (base) of
+// the same set.
+type Comparison struct {
+	Base    Metrics          `json:"base"`
+	Head    Metrics          `json:"head"`
+	Delta   MetricDelta      `json:"delta"`
+	Changes []CaseComparison `json:"changes"`
+}
+
+// MetricDelta is head minus base for the metrics both runs have.
+type MetricDelta struct {
+	RecallAtK      *float64 `json:"recall_at_k,omitempty"`
+	MRR            *float64 `json:"mrr,omitempty"`
+	ChunkRecallAtK *float64 `json:"chunk_recall_at_k,omitempty"`
+	ChunkMRR       *float64 `json:"chunk_mrr,omitempty"`
+	Faithfulness   *float64 `json:"faithfulness,omitempty"`
+	Correctness    *float64 `json:"correctness,omitempty"`
+}
+
+// CaseComparison is a case whose scores differ between the runs. Regressed
+// is set when any score dropped.
+type CaseComparison struct {
+	CaseID    uint        `json:"case_id"`
+	Question  string      `json:"question"`
+	Base      *CaseScores `json:"base,omitempty"`
+	Head      *CaseScores `json:"head,omitempty"`
+	Regressed bool        `json:"regressed"`
+}
+
+type CaseScores struct {
+	Recall              *float64 `json:"recall,omitempty"`
+	ReciprocalRank      *float64 `json:"reciprocal_rank,omitempty"`
+	ChunkRecall         *float64 `json:"chunk_recall,omitempty"`
+	ChunkReciprocalRank *float64 `json:"chunk_reciprocal_rank,omitempty"`
+	Faithfulness        *float64 `json:"faithfulness,omitempty"`
+	Correctness         *float64 `json:"correctness,omitempty"`
+	Error               string   `json:"error,omitempty"`
+}
+
+// Compare lines up the results of two runs by case.
+func Compare(base, head *models.EvalRun, baseResults, headResults []models.EvalResult) Comparison {
+	var cmp Comparison
+	_ = json.Unmarshal(base.Metrics, &cmp.Base)
+	_ = json.Unmarshal(head.Metrics, &cmp.Head)
+	cmp.Delta = MetricDelta{
+		RecallAtK:      delta(cmp.Base.RecallAtK, cmp.Head.RecallAtK),
+		MRR:            delta(cmp.Base.MRR, cmp.Head.MRR),
+		ChunkRecallAtK: delta(cmp.Base.ChunkRecallAtK, cmp.Head.ChunkRecallAtK),
+		ChunkMRR:       delta(cmp.Base.ChunkMRR, cmp.Head.ChunkMRR),
+		Faithfulness:   delta(cmp.Base.Faithfulness, cmp.Head.Faithfulness),
+		Correctness:    delta(cmp.Base.Correctness, cmp.Head.Correctness),
+	}
+
+	byCase := map[uint]*CaseComparison{}
+	var order []uint
+	entry := func(r models.EvalResult) *CaseComparison {
+		c, ok := byCase[r.CaseID]
+		if !ok {
+			c = &CaseComparison{CaseID: r.CaseID, Question: r.Question}
+			byCase[r.CaseID] = c
+			order = append(order, r.CaseID)
+		}
+		return c
+	}
+	for _, r := range baseResults {
+		entry(r).Base = scoresOf(r)
+	}
+	for _, r := range headResults {
+		entry(r).Head = scoresOf(r)
+	}
+
+	cmp.Changes = []CaseComparison{}
+	for _, id := range order {
+		c := byCase[id]
+		if c.Base != nil && c.Head != nil && sameScores(c.Base, c.Head) {
+			continue
+		}
+		c.Regressed = regressed(c.Base, c.Head)
+		cmp.Changes = append(cmp.Changes, *c)
+	}
+	return cmp
+}
+
+func scoresOf(r models.EvalResult) *CaseScores {
+	return &CaseScores{
+		Recall:              r.Recall,
+		ReciprocalRank:      r.ReciprocalRank,
+		ChunkRecall:         r.ChunkRecall,
+		ChunkReciprocalRank: r.ChunkReciprocalRank,
+		Faithfulness:        r.Faithfulness,
+		Correctness:         r.Correctness,
+		Error:               r.Error,
+	}
+}
+
+func sameScores(a, b *CaseScores) bool {
+	return a.Error == b.Error &&
+		sameScore(a.Recall, b.Recall) &&
+		sameScore(a.ReciprocalRank, b.ReciprocalRank) &&
+		sameScore(a.ChunkRecall, b.ChunkRecall) &&
+		sameScore(a.ChunkReciprocalRank, b.ChunkReciprocalRank) &&
+		sameScore(a.Faithfulness, b.Faithfulness) &&
+		sameScore(a.Correctness, b.Correctness)
+}
+
+func sameScore(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func delta(base, head *float64) *float64 {
+	if base == nil || head == nil {
+		return nil
+	}
+	d := *head - *base
+	return &d
+}
+
+func regressed(base, head *CaseScores) bool {
+	if base == nil || head == nil {
+		return false
+	}
+	if base.Error == "" && head.Error != "" {
+		return true
+	}
+	for _, pair := range [][2]*float64{
+		{base.Recall, head.Recall},
+		{base.ReciprocalRank, head.ReciprocalRank},
+		{base.ChunkRecall, head.ChunkRecall},
+		{base.ChunkReciprocalRank, head.ChunkReciprocalRank},
+		{base.Faithfulness, head.Faithfulness},
+		{base.Correctness, head.Correctness},
+	} {
+		if d := delta(pair[0], pair[1]); d != nil && *d < 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"backend/internal/rag"
+	"backend/internal/services"
+)
+
+// Judges score generated answers.
+const (
+	// JudgeString compares words: the answer against the expected answer for
+	// correctness and against the passages for faithfulness. It needs no
+	// model, so scores are reproducible.
+	JudgeString = "string"
+	// JudgeLLM asks a model to grade the answer.
+	JudgeLLM = "llm"
+	// JudgeNone only measures retrieval.
+	JudgeNone = "none"
+)
+
+const judgePrompt = `You grade the answers of a question answering system that answers from retrieved passages.
+Score faithfulness from 0 to 1: the share of the answer's claims that the passages support. An answer saying it does not know is faithful.
+Score correctness from 0 to 1: how well the answer matches the expected answer in meaning, ignoring wording and citations. If no expected answer is given, use null.
+Reply with JSON only, in the form {"faithfulness": 0.5, "correctness": 1, "reason": "..."}.`
+
+// judgement is a score of one answer. Nil scores do not apply.
+type judgement struct {
+	Faithfulness *float64 `json:"faithfulness"`
+	Correctness  *float64 `json:"correctness"`
+	Reason       string   `json:"reason"`
+}
+
+// judgeString scores an answer by word overlap.
+func judgeString(expected, answer string, sources []rag.Source) judgement {
+	var j judgement
+	faithfulness := stringFaithfulness(answer, sources)
+	j.Faithfulness = &faithfulness
+	if strings.TrimSpace(expected) != "" {
+		correctness := stringCorrectness(answer, expected)
+		j.Correctness = &correctness
+	}
+	return j
+}
+
+// judgeLLM asks the model to grade an answer.
+func judgeLLM(ctx context.Context, llm *services.LLMService, question, expected, answer string, sources []rag.Source) (judgement, error) {
+	var sb strings.Builder
+	sb.WriteString("Question:\n")
+	sb.WriteString(question)
+	sb.WriteString("\n\nPassages:\n")
+	if len(sources) == 0 {
+		sb.WriteString("(none)")
+	}
+	for i, s := range sources {
+		if i > 0 {
+			sb.WriteString("\n\n")
+		}
+		fmt.Fprintf(&sb, "[%d] %s", i+1, s.Text)
+	}
+	sb.WriteString("\n\nExpected answer:\n")
+	if strings.TrimSpace(expected) == "" {
+		sb.WriteString("(none)")
+	} else {
+		sb.WriteString(expected)
+	}
+	sb.WriteString("\n\nAnswer:\n")
+	sb.WriteString(answer)
+
+	temperature := 0.0
+	resp, err := llm.Complete(ctx, services.LLMRequest{
+		Messages: []services.LLMMessage{
+			{Role: "system", Content: judgePrompt},
+			{Role: "user", Content: sb.String()},
+		},
+		Temperature: &temperature,
+		MaxTokens:   300,
+	})
+	if err != nil {
+		return judgement{}, fmt.Errorf("judge failed: %w", err)
+	}
+	return parseJudgement(resp.Content, strings.TrimSpace(expected) != "")
+}
+
+// parseJudgement reads the judge's JSON reply, tolerating text or code fences
+// around it, and clamps scores to [0, 1].
+func parseJudgement(reply string, hasExpected bool) (judgement, error) {
+	start, end := strings.Index(reply, "{"), strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return judgement{}, fmt.Errorf("judge returned no JSON")
+	}
+	var j judgement
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &j); err != nil {
+		return judgement{}, fmt.Errorf("judge returned invalid JSON: %w", err)
+	}
+	if !hasExpected {
+		j.Correctness = nil
+	}
+	for _, score := range []*float64{j.Faithfulness, j.Correctness} {
+		if score != nil {
+			*score = clamp(*score)
+		}
+	}
+	return j, nil
+}
+
+func clamp(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
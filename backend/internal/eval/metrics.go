@@ -0,0 +1,188 @@
+package eval
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"backend/internal/models"
+	"backend/internal/rag"
+)
+
+// matchesExpected reports whether a retrieved source is one of the expected
+// documents, given by ID or by name, or is an expected chunk.
+func matchesExpected(s rag.Source, expected string) bool {
+	expected = strings.TrimSpace(expected)
+	if expected == "" {
+		return false
+	}
+	if expected == s.ChunkID {
+		return true
+	}
+	if id, err := strconv.ParseUint(expected, 10, 64); err == nil && uint(id) == s.DocumentID {
+		return true
+	}
+	return strings.EqualFold(expected, s.DocumentName)
+}
+
+// RetrievalScores returns the share of expected documents found among the
+// first k sources (recall@k) and the reciprocal rank of the first source
+// that is an expected document, 0 when none is.
+func RetrievalScores(expected []string, sources []rag.Source, k int) (recall, reciprocalRank float64) {
+	if len(expected) == 0 {
+		return 0, 0
+	}
+	if k > 0 && len(sources) > k {
+		sources = sources[:k]
+	}
+	found := 0
+	for _, e := range expected {
+		for _, s := range sources {
+			if matchesExpected(s, e) {
+				found++
+				break
+			}
+		}
+	}
+	for rank, s := range sources {
+		for _, e := range expected {
+			if matchesExpected(s, e) {
+				return float64(found) / float64(len(expected)), 1 / float64(rank+1)
+			}
+		}
+	}
+	return float64(found) / float64(len(expected)), 0
+}
+
+// words lowercases text and splits it into words without punctuation.
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// stringCorrectness scores an answer against the expected one without a
+// model: 1 when the answer contains the expected answer, otherwise the F1
+// of their words.
+func stringCorrectness(answer, expected string) float64 {
+	a, e := words(answer), words(expected)
+	if len(e) == 0 || len(a) == 0 {
+		return 0
+	}
+	if strings.Contains(" "+strings.Join(a, " ")+" ", " "+strings.Join(e, " ")+" ") {
+		return 1
+	}
+	counts := map[string]int{}
+	for _, w := range e {
+		counts[w]++
+	}
+	common := 0
+	for _, w := range a {
+		if counts[w] > 0 {
+			counts[w]--
+			common++
+		}
+	}
+	if common == 0 {
+		return 0
+	}
+	precision := float64(common) / float64(len(a))
+	recall := float64(common) / float64(len(e))
+	return 2 * precision * recall / (precision + recall)
+}
+
+// stringFaithfulness is the share of the answer's words that occur in the
+// retrieved passages. Citation numbers are ignored.
+func stringFaithfulness(answer string, sources []rag.Source) float64 {
+	context := map[string]bool{}
+	for _, s := range sources {
+		for _, w := range words(s.Text) {
+			context[w] = true
+		}
+	}
+	total, supported := 0, 0
+	for _, w := range words(answer) {
+		if _, err := strconv.Atoi(w); err == nil && len(w) <= 2 {
+			continue
+		}
+		total++
+		if context[w] {
+			supported++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(supported) / float64(total)
+}
+
+// Metrics are the scores of a run averaged over its cases. A metric only
+// averages the cases it applies to: recall and MRR the cases with expected
+// sources, chunk recall and chunk MRR the generated cases whose source chunk
+// is still served, correctness the cases with an expected answer. Averages
+// are nil when no case applies.
+type Metrics struct {
+	Cases     int      `json:"cases"`
+	Failed    int      `json:"failed"`
+	K         int      `json:"k"`
+	RecallAtK *float64 `json:"recall_at_k,omitempty"`
+	MRR       *float64 `json:"mrr,omitempty"`
+	// ChunkRecallAtK and ChunkMRR only count the exact chunk a generated
+	// question was written from, not any chunk of its document.
+	ChunkRecallAtK *float64 `json:"chunk_recall_at_k,omitempty"`
+	ChunkMRR       *float64 `json:"chunk_mrr,omitempty"`
+	Faithfulness   *float64 `json:"faithfulness,omitempty"`
+	Correctness    *float64 `json:"correctness,omitempty"`
+	AvgLatencyMs   int64    `json:"avg_latency_ms"`
+}
+
+// average collects values and returns their mean, nil without values.
+type average struct {
+	sum   float64
+	count int
+}
+
+func (a *average) add(v *float64) {
+	if v != nil {
+		a.sum += *v
+		a.count++
+	}
+}
+
+func (a *average) value() *float64 {
+	if a.count == 0 {
+		return nil
+	}
+	v := a.sum / float64(a.count)
+	return &v
+}
+
+// Summarize averages the results of a run.
+func Summarize(results []models.EvalResult, k int) Metrics {
+	m := Metrics{Cases: len(results), K: k}
+	var recall, mrr, chunkRecall, chunkMRR, faithfulness, correctness average
+	var latency int64
+	for _, r := range results {
+		if r.Error != "" {
+			m.Failed++
+			continue
+		}
+		recall.add(r.Recall)
+		mrr.add(r.ReciprocalRank)
+		chunkRecall.add(r.ChunkRecall)
+		chunkMRR.add(r.ChunkReciprocalRank)
+		faithfulness.add(r.Faithfulness)
+		correctness.add(r.Correctness)
+		latency += r.LatencyMs
+	}
+	m.RecallAtK = recall.value()
+	m.MRR = mrr.value()
+	m.ChunkRecallAtK = chunkRecall.value()
+	m.ChunkMRR = chunkMRR.value()
+	m.Faithfulness = faithfulness.value()
+	m.Correctness = correctness.value()
+	if ok := m.Cases - m.Failed; ok > 0 {
+		m.AvgLatencyMs = latency / int64(ok)
+	}
+	return m
+}
@@ -0,0 +1,230 @@
+package eval
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"backend/internal/rag"
+	"backend/internal/services"
+)
+
+// MockProvider serves deterministic stand-ins for the OpenAI-compatible
+// /embeddings and /chat/completions APIs, so evaluations run in CI without
+// a model provider. Point EMBEDDING_BASE_URL and LLM_BASE_URL of both the
+// backend and the worker at it, so chunks and queries share its vector
+// space.
+//
+// Embeddings hash words into dimension buckets, so texts sharing words are
+// similar. Chat completions answer with the context sentence that shares
+// the most words with the question and cite its passage; condensing returns
+// the latest message, the answer judge and the grounding check get a
+// verdict computed from word overlap like JudgeString's, and anything else
+// is echoed.
+func MockProvider(dimension int) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/embeddings", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input []string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		type item struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		}
+		data := make([]item, len(req.Input))
+		for i, text := range req.Input {
+			data[i] = item{Index: i, Embedding: mockEmbedding(text, dimension)}
+		}
+		writeJSON(w, map[string]interface{}{"data": data})
+	})
+	mux.HandleFunc("/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model    string                `json:"model"`
+			Messages []services.LLMMessage `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reply := mockCompletion(req.Messages)
+		prompt := 0
+		for _, m := range req.Messages {
+			prompt += len(words(m.Content))
+		}
+		writeJSON(w, map[string]interface{}{
+			"model": "mock",
+			"choices": []map[string]interface{}{
+				{"message": services.LLMMessage{Role: "assistant", Content: reply}},
+			},
+			"usage": map[string]int{"prompt_tokens": prompt, "completion_tokens": len(words(reply))},
+		})
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// mockEmbedding hashes the words of text into a unit vector.
+func mockEmbedding(text string, dimension int) []float32 {
+	vec := make([]float64, dimension)
+	for _, w := range words(text) {
+		h := fnv.New64a()
+		h.Write([]byte(w))
+		sum := h.Sum64()
+		sign := 1.0
+		if sum&(1<<63) != 0 {
+			sign = -1
+		}
+		vec[sum%uint64(dimension)] += sign
+	}
+	norm := 0.0
+	for _, v := range vec {
+		norm += v * v
+	}
+	out := make([]float32, dimension)
+	if norm == 0 {
+		// cosine similarity is undefined for the zero vector
+		out[0] = 1
+		return out
+	}
+	norm = math.Sqrt(norm)
+	for i, v := range vec {
+		out[i] = float32(v / norm)
+	}
+	return out
+}
+
+// passageHeader matches the numbered passages of a rendered context.
+var passageHeader = regexp.MustCompile(`(?m)^\[(\d+)\][^\n]*\n`)
+
+func mockCompletion(messages []services.LLMMessage) string {
+	var system, last string
+	for _, m := range messages {
+		if m.Role == "system" && system == "" {
+			system = m.Content
+		}
+		if m.Role == "user" {
+			last = m.Content
+		}
+	}
+
+	switch {
+	case strings.Contains(system, "JSON"):
+		return mockVerdict(system, last)
+	case strings.Contains(last, "Latest message: "):
+		return strings.TrimSpace(last[strings.LastIndex(last, "Latest message: ")+len("Latest message: "):])
+	case passageHeader.MatchString(system):
+		return mockAnswer(system, last)
+	}
+	return last
+}
+
+// mockAnswer picks the context sentence sharing the most words with the
+// question and cites its passage.
+func mockAnswer(context, question string) string {
+	asked := map[string]bool{}
+	for _, w := range words(question) {
+		asked[w] = true
+	}
+
+	headers := passageHeader.FindAllStringSubmatchIndex(context, -1)
+	best, bestScore, bestPassage := "", 0, ""
+	for i, h := range headers {
+		end := len(context)
+		if i+1 < len(headers) {
+			end = headers[i+1][0]
+		}
+		passage := context[h[2]:h[3]]
+		for _, sentence := range strings.FieldsFunc(context[h[1]:end], func(r rune) bool {
+			return r == '\n' || r == '.' || r == '!' || r == '?'
+		}) {
+			score := 0
+			for _, w := range words(sentence) {
+				if asked[w] {
+					score++
+				}
+			}
+			if score > bestScore {
+				best, bestScore, bestPassage = strings.TrimSpace(sentence), score, passage
+			}
+		}
+	}
+	if best == "" {
+		return "I don't know."
+	}
+	return best + " [" + bestPassage + "]."
+}
+
+// mockVerdict grades the answer of a judge or grounding check prompt. The
+// judge gets the share of the answer's words found in the passages as
+// faithfulness and the word overlap with the expected answer as
+// correctness; the grounding check gets the sentences of which fewer than
+// half of the words are found in the passages.
+func mockVerdict(system, prompt string) string {
+	passages := []rag.Source{{Text: promptSection(prompt, "Passages:")}}
+	answer := promptSection(prompt, "Answer:")
+
+	if strings.Contains(system, `"unsupported"`) {
+		type claim struct {
+			Sentence int    `json:"sentence"`
+			Reason   string `json:"reason"`
+		}
+		unsupported := []claim{}
+		for _, line := range strings.Split(answer, "\n") {
+			number, sentence, ok := strings.Cut(line, ". ")
+			n, err := strconv.Atoi(number)
+			if !ok || err != nil {
+				continue
+			}
+			if stringFaithfulness(sentence, passages) < 0.5 {
+				unsupported = append(unsupported, claim{Sentence: n, Reason: "mostly not in the passages"})
+			}
+		}
+		b, _ := json.Marshal(map[string]interface{}{"unsupported": unsupported})
+		return string(b)
+	}
+
+	verdict := map[string]interface{}{
+		"faithfulness": stringFaithfulness(answer, passages),
+		"correctness":  nil,
+		"reason":       "mock verdict from word overlap",
+	}
+	if expected := promptSection(prompt, "Expected answer:"); expected != "" && expected != "(none)" {
+		verdict["correctness"] = stringCorrectness(answer, expected)
+	}
+	b, _ := json.Marshal(verdict)
+	return string(b)
+}
+
+// promptHeaders are the section headers of the judge and grounding check
+// prompts.
+var promptHeaders = []string{"Question:", "Passages:", "Expected answer:", "Answer:"}
+
+// promptSection returns the section of a judge or grounding check prompt
+// under header, which starts a line after a blank one or the prompt.
+func promptSection(prompt, header string) string {
+	prompt = "\n\n" + prompt
+	start := strings.Index(prompt, "\n\n"+header+"\n")
+	if start < 0 {
+		return ""
+	}
+	rest := prompt[start+len(header)+3:]
+	end := len(rest)
+	for _, next := range promptHeaders {
+		if i := strings.Index(rest, "\n\n"+next+"\n"); i >= 0 && i < end {
+			end = i
+		}
+	}
+	return strings.TrimSpace(rest[:end])
+}
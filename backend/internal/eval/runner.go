@@ -0,0 +1,200 @@
+package eval
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/rag"
+	"backend/internal/services"
+)
+
+// Config are the settings a run uses and records for comparison. Empty
+// retrieval settings fall back to the knowledge base's, the models and the
+// prompt are recorded by the runner.
+type Config struct {
+	TopK           int    `json:"top_k"`
+	Mode           string `json:"mode"`
+	Rewrite        string `json:"rewrite"`
+	Judge          string `json:"judge"`
+	AnswerModel    string `json:"answer_model,omitempty"`
+	JudgeModel     string `json:"judge_model,omitempty"`
+	EmbeddingModel string `json:"embedding_model,omitempty"`
+	// Prompt identifies the knowledge base's system prompt template:
+	// "default" or a hash of the custom template.
+	Prompt string `json:"prompt,omitempty"`
+}
+
+// Runner evaluates golden sets against a knowledge base with the same
+// retrieval and generation as chat.
+type Runner struct {
+	pipeline *rag.Pipeline
+	judge    *services.LLMService
+	// createResult and updateRun store results and runs
+	createResult func(*models.EvalResult) error
+	updateRun    func(*models.EvalRun) error
+	// chunkServed reports whether a case's source chunk can still be retrieved
+	chunkServed func(id string) (bool, error)
+}
+
+// NewRunner evaluates with pipeline and grades answers with judge, which is
+// only used by JudgeLLM.
+func NewRunner(pipeline *rag.Pipeline, judge *services.LLMService) *Runner {
+	return &Runner{
+		pipeline:     pipeline,
+		judge:        judge,
+		createResult: models.CreateEvalResult,
+		updateRun:    models.UpdateEvalRun,
+		chunkServed:  models.ChunkServed,
+	}
+}
+
+// Run evaluates every case, stores the result of each and finally the
+// metrics and status of run, which must already exist.
+func (r *Runner) Run(ctx context.Context, kb *models.KnowledgeBase, run *models.EvalRun, cases []models.EvalCase, cfg Config) error {
+	cfg = completeConfig(kb, cfg)
+	if b, err := json.Marshal(cfg); err == nil {
+		run.Config = models.JSON(b)
+	}
+
+	results := make([]models.EvalResult, 0, len(cases))
+	for _, c := range cases {
+		if err := ctx.Err(); err != nil {
+			return r.finish(run, results, cfg, err)
+		}
+		result := r.runCase(ctx, kb, c, cfg)
+		result.RunID = run.ID
+		if err := r.createResult(&result); err != nil {
+			return r.finish(run, results, cfg, err)
+		}
+		results = append(results, result)
+	}
+	return r.finish(run, results, cfg, nil)
+}
+
+func (r *Runner) finish(run *models.EvalRun, results []models.EvalResult, cfg Config, runErr error) error {
+	now := time.Now()
+	run.FinishedAt = &now
+	run.Status = models.EvalRunCompleted
+	if runErr != nil {
+		run.Status = models.EvalRunFailed
+		run.Error = runErr.Error()
+	}
+	if b, err := json.Marshal(Summarize(results, cfg.TopK)); err == nil {
+		run.Metrics = models.JSON(b)
+	}
+	if err := r.updateRun(run); err != nil {
+		log.Printf("Failed to update eval run %d: %v", run.ID, err)
+		if runErr == nil {
+			runErr = err
+		}
+	}
+	return runErr
+}
+
+// completeConfig fills in the knowledge base's settings and the prompt.
+func completeConfig(kb *models.KnowledgeBase, cfg Config) Config {
+	if cfg.TopK <= 0 {
+		cfg.TopK = 5
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = rag.ModeVector
+	}
+	if cfg.Rewrite == "" {
+		cfg.Rewrite = kb.QueryRewrite
+	}
+	if cfg.Judge == "" {
+		cfg.Judge = JudgeString
+	}
+	cfg.Prompt = "default"
+	if kb.SystemPrompt != "" {
+		sum := sha256.Sum256([]byte(kb.SystemPrompt))
+		cfg.Prompt = hex.EncodeToString(sum[:])[:12]
+	}
+	return cfg
+}
+
+// runCase answers one question like a first chat turn and scores retrieval
+// and the answer. Failures are recorded on the result.
+func (r *Runner) runCase(ctx context.Context, kb *models.KnowledgeBase, c models.EvalCase, cfg Config) (result models.EvalResult) {
+	result = models.EvalResult{CaseID: c.ID, Question: c.Question}
+	start := time.Now()
+	defer func() { result.LatencyMs = time.Since(start).Milliseconds() }()
+
+	req := rag.ChatRequest{
+		KnowledgeBaseID:   &kb.ID,
+		Question:          c.Question,
+		TopK:              cfg.TopK,
+		Mode:              cfg.Mode,
+		Rewrite:           cfg.Rewrite,
+		Template:          kb.SystemPrompt,
+		KnowledgeBaseName: kb.Name,
+		Guardrails: rag.Guardrails{
+			MinRelevance:   kb.MinRelevance,
+			FallbackAnswer: kb.FallbackAnswer,
+			GroundingCheck: kb.GroundingCheck,
+		},
+	}
+	turn, err := r.pipeline.Prepare(ctx, req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if b, err := json.Marshal(turn.Sources); err == nil {
+		result.Sources = models.JSON(b)
+	}
+	if b, err := json.Marshal(turn.SearchQueries); err == nil {
+		result.SearchQueries = models.JSON(b)
+	}
+
+	var expected []string
+	if len(c.ExpectedSources) > 0 {
+		if err := json.Unmarshal(c.ExpectedSources, &expected); err != nil {
+			result.Error = fmt.Sprintf("invalid expected sources: %v", err)
+			return result
+		}
+	}
+	if len(expected) > 0 {
+		recall, rr := RetrievalScores(expected, turn.Sources, cfg.TopK)
+		result.Recall, result.ReciprocalRank = &recall, &rr
+	}
+	if c.SourceChunkID != "" {
+		served, err := r.chunkServed(c.SourceChunkID)
+		if err != nil {
+			log.Printf("Failed to look up chunk %s of eval case %d: %v", c.SourceChunkID, c.ID, err)
+		} else if served {
+			recall, rr := RetrievalScores([]string{c.SourceChunkID}, turn.Sources, cfg.TopK)
+			result.ChunkRecall, result.ChunkReciprocalRank = &recall, &rr
+		}
+	}
+
+	if cfg.Judge == JudgeNone {
+		return result
+	}
+	answer, err := r.pipeline.Generate(ctx, req, turn)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Answer = answer.Answer
+
+	var j judgement
+	switch cfg.Judge {
+	case JudgeLLM:
+		j, err = judgeLLM(ctx, r.judge, c.Question, c.ExpectedAnswer, answer.Answer, turn.Sources)
+		if err != nil {
+			// keep the retrieval scores; the answer is just not graded
+			result.JudgeReason = err.Error()
+			return result
+		}
+	default:
+		j = judgeString(c.ExpectedAnswer, answer.Answer, turn.Sources)
+	}
+	result.Faithfulness, result.Correctness, result.JudgeReason = j.Faithfulness, j.Correctness, j.Reason
+	return result
+}
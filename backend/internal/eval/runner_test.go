@@ -0,0 +1,302 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"backend/internal/models"
+	"backend/internal/rag"
+	"backend/internal/services"
+)
+
+const testDimension = 64
+
+// testChunk is a chunk of the in-memory knowledge base.
+type testChunk struct {
+	id         string
+	documentID uint
+	document   string
+	text       string
+}
+
+var testChunks = []testChunk{
+	{"c1", 1, "handbook.pdf", "Employees get 25 vacation days per year. Vacation requests go to your manager."},
+	{"c2", 2, "security.md", "Passwords must be rotated every 90 days. Use a password manager."},
+	{"c3", 3, "expenses.pdf", "Travel expenses are approved by the finance team within a week."},
+}
+
+// testProvider serves the mock provider and a Qdrant search over
+// testChunks, embedded like the worker would with the mock.
+func testProvider(t *testing.T) *httptest.Server {
+	t.Helper()
+	mock := MockProvider(testDimension)
+	mux := http.NewServeMux()
+	mux.Handle("/embeddings", mock)
+	mux.Handle("/chat/completions", mock)
+	mux.HandleFunc("/collections/chunks/points/search", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Vector []float32 `json:"vector"`
+			Limit  int       `json:"limit"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		hits := make([]services.QdrantHit, len(testChunks))
+		for i, c := range testChunks {
+			hits[i] = services.QdrantHit{
+				ID:    c.id,
+				Score: cosine(req.Vector, mockEmbedding(c.text, testDimension)),
+				Payload: map[string]interface{}{
+					"knowledge_base_id": 1,
+					"document_id":       c.documentID,
+					"document_name":     c.document,
+					"text":              c.text,
+				},
+			}
+		}
+		sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+		if len(hits) > req.Limit {
+			hits = hits[:req.Limit]
+		}
+		writeJSON(w, map[string]interface{}{"result": hits})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func cosine(a, b []float32) float64 {
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
+
+// testRunner evaluates against testProvider and keeps results in memory.
+func testRunner(t *testing.T) (*Runner, *[]models.EvalResult) {
+	t.Helper()
+	srv := testProvider(t)
+	llm := services.NewLLMService(srv.URL, "", "mock")
+	embedder := services.NewEmbeddingService(srv.URL, "", "mock")
+	qdrant := services.NewQdrantService(srv.URL, "", "chunks")
+	runner := NewRunner(rag.NewPipeline(rag.NewRetriever(embedder, qdrant, nil), llm), llm)
+
+	var results []models.EvalResult
+	runner.createResult = func(r *models.EvalResult) error {
+		results = append(results, *r)
+		return nil
+	}
+	runner.updateRun = func(*models.EvalRun) error { return nil }
+	runner.chunkServed = func(id string) (bool, error) {
+		for _, c := range testChunks {
+			if c.id == id {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return runner, &results
+}
+
+func testCase(id uint, question, answer string, sources ...string) models.EvalCase {
+	b, _ := json.Marshal(sources)
+	return models.EvalCase{ID: id, Question: question, ExpectedAnswer: answer, ExpectedSources: models.JSON(b)}
+}
+
+var testCases = []models.EvalCase{
+	testCase(1, "How many vacation days do employees get per year?", "Employees get 25 vacation days per year", "handbook.pdf"),
+	testCase(2, "How often must passwords be rotated?", "every 90 days", "2"),
+	testCase(3, "Who approves travel expenses?", "The finance team approves them", "expenses.pdf", "handbook.pdf"),
+}
+
+func approx(t *testing.T, name string, got *float64, want float64) {
+	t.Helper()
+	if got == nil {
+		t.Errorf("%s = nil, want %.3f", name, want)
+		return
+	}
+	if math.Abs(*got-want) > 1e-9 {
+		t.Errorf("%s = %.3f, want %.3f", name, *got, want)
+	}
+}
+
+func TestRunnerRun(t *testing.T) {
+	for _, judge := range []string{JudgeString, JudgeLLM} {
+		t.Run(judge, func(t *testing.T) {
+			runner, results := testRunner(t)
+			kb := &models.KnowledgeBase{ID: 1, Name: "hr", QueryRewrite: "none"}
+			run := &models.EvalRun{ID: 7}
+
+			err := runner.Run(context.Background(), kb, run, testCases, Config{TopK: 1, Mode: rag.ModeVector, Judge: judge})
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if run.Status != models.EvalRunCompleted {
+				t.Errorf("status = %q, want %q", run.Status, models.EvalRunCompleted)
+			}
+			if len(*results) != len(testCases) {
+				t.Fatalf("stored %d results, want %d", len(*results), len(testCases))
+			}
+
+			want := []struct {
+				recall, rr, faithfulness, correctness float64
+				answer                                string
+			}{
+				{1, 1, 1, 1, "Employees get 25 vacation days per year [1]."},
+				{1, 1, 1, 1, "Passwords must be rotated every 90 days [1]."},
+				// 3 of the answer's 12 words, citation included, and of the
+				// expected 5 words match: F1 = 2 * 3/12 * 3/5 / (3/12 + 3/5)
+				{0.5, 1, 1, 6.0 / 17, "Travel expenses are approved by the finance team within a week [1]."},
+			}
+			for i, r := range *results {
+				if r.Error != "" || r.RunID != run.ID {
+					t.Errorf("case %d: error %q, run %d", i+1, r.Error, r.RunID)
+					continue
+				}
+				if r.Answer != want[i].answer {
+					t.Errorf("case %d: answer = %q, want %q", i+1, r.Answer, want[i].answer)
+				}
+				approx(t, "recall", r.Recall, want[i].recall)
+				approx(t, "reciprocal rank", r.ReciprocalRank, want[i].rr)
+				approx(t, "faithfulness", r.Faithfulness, want[i].faithfulness)
+				approx(t, "correctness", r.Correctness, want[i].correctness)
+			}
+
+			var m Metrics
+			if err := json.Unmarshal(run.Metrics, &m); err != nil {
+				t.Fatalf("metrics: %v", err)
+			}
+			if m.Cases != 3 || m.Failed != 0 || m.K != 1 {
+				t.Errorf("metrics = %+v", m)
+			}
+			approx(t, "recall@k", m.RecallAtK, 2.5/3)
+			approx(t, "MRR", m.MRR, 1)
+			approx(t, "faithfulness", m.Faithfulness, 1)
+			approx(t, "correctness", m.Correctness, (2+6.0/17)/3)
+		})
+	}
+}
+
+func TestRunnerRetrievalOnly(t *testing.T) {
+	runner, results := testRunner(t)
+	kb := &models.KnowledgeBase{ID: 1, Name: "hr", QueryRewrite: "none"}
+	run := &models.EvalRun{ID: 1}
+
+	// with k = 3 the handbook is among the sources of the travel question too
+	if err := runner.Run(context.Background(), kb, run, testCases[2:], Config{TopK: 3, Judge: JudgeNone}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	r := (*results)[0]
+	approx(t, "recall", r.Recall, 1)
+	approx(t, "reciprocal rank", r.ReciprocalRank, 1)
+	if r.Answer != "" || r.Faithfulness != nil || r.Correctness != nil {
+		t.Errorf("retrieval only run generated an answer: %+v", r)
+	}
+}
+
+func TestRunnerChunkScores(t *testing.T) {
+	runner, results := testRunner(t)
+	kb := &models.KnowledgeBase{ID: 1, Name: "hr", QueryRewrite: "none"}
+	run := &models.EvalRun{ID: 1}
+
+	generated := func(c models.EvalCase, chunkID string) models.EvalCase {
+		c.SourceChunkID = chunkID
+		return c
+	}
+	cases := []models.EvalCase{
+		generated(testCases[1], "c2"),
+		// the document is found, but not the chunk the question came from
+		generated(testCase(4, "How often must passwords be rotated?", "", "2"), "c3"),
+		// a chunk retired by re-ingestion is not scored
+		generated(testCases[1], "retired"),
+		testCases[0],
+	}
+	if err := runner.Run(context.Background(), kb, run, cases, Config{TopK: 1, Judge: JudgeNone}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := []struct {
+		scored      bool
+		chunkRecall float64
+	}{
+		{true, 1},
+		{true, 0},
+		{false, 0},
+		{false, 0},
+	}
+	for i, r := range *results {
+		approx(t, "recall", r.Recall, 1)
+		if !want[i].scored {
+			if r.ChunkRecall != nil || r.ChunkReciprocalRank != nil {
+				t.Errorf("case %d: has chunk scores, want none", i+1)
+			}
+			continue
+		}
+		approx(t, "chunk recall", r.ChunkRecall, want[i].chunkRecall)
+		approx(t, "chunk reciprocal rank", r.ChunkReciprocalRank, want[i].chunkRecall)
+	}
+
+	var m Metrics
+	if err := json.Unmarshal(run.Metrics, &m); err != nil {
+		t.Fatalf("metrics: %v", err)
+	}
+	approx(t, "recall@k", m.RecallAtK, 1)
+	approx(t, "chunk recall@k", m.ChunkRecallAtK, 0.5)
+	approx(t, "chunk MRR", m.ChunkMRR, 0.5)
+}
+
+func TestMockJudge(t *testing.T) {
+	srv := testProvider(t)
+	llm := services.NewLLMService(srv.URL, "", "mock")
+	sources := []rag.Source{{Text: testChunks[0].text}}
+
+	j, err := judgeLLM(context.Background(), llm, "How many vacation days do employees get?",
+		"25 days", "Employees get 40 vacation days and a company car [1].", sources)
+	if err != nil {
+		t.Fatalf("judgeLLM: %v", err)
+	}
+	// numbers are skipped; "and", "a", "company" and "car" are not in the passage
+	approx(t, "faithfulness", j.Faithfulness, 4.0/8)
+	approx(t, "correctness", j.Correctness, stringCorrectness("Employees get 40 vacation days and a company car [1].", "25 days"))
+	if *j.Correctness >= 1 {
+		t.Errorf("wrong answer judged correct")
+	}
+
+	j, err = judgeLLM(context.Background(), llm, "How many vacation days do employees get?", "", "Employees get 25 vacation days per year [1].", sources)
+	if err != nil {
+		t.Fatalf("judgeLLM: %v", err)
+	}
+	approx(t, "faithfulness", j.Faithfulness, 1)
+	if j.Correctness != nil {
+		t.Errorf("correctness = %v without an expected answer", *j.Correctness)
+	}
+}
+
+func TestMockGroundingCheck(t *testing.T) {
+	reply := mockCompletion([]services.LLMMessage{
+		{Role: "system", Content: `Reply with JSON only, in the form {"unsupported": [{"sentence": 2, "reason": "..."}]}.`},
+		{Role: "user", Content: "Passages:\n[1] handbook.pdf\n" + testChunks[0].text +
+			"\n\nAnswer:\n1. Employees get 25 vacation days per year [1].\n2. They also get a company car.\n"},
+	})
+	var parsed struct {
+		Unsupported []struct {
+			Sentence int `json:"sentence"`
+		} `json:"unsupported"`
+	}
+	if err := json.Unmarshal([]byte(reply), &parsed); err != nil {
+		t.Fatalf("reply %q: %v", reply, err)
+	}
+	if len(parsed.Unsupported) != 1 || parsed.Unsupported[0].Sentence != 2 {
+		t.Errorf("unsupported = %+v, want only sentence 2", parsed.Unsupported)
+	}
+	if !strings.Contains(reply, "reason") {
+		t.Errorf("reply %q has no reason", reply)
+	}
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"backend/internal/services"
+)
+
+// ArchiveImport tracks a ZIP or tar.gz upload that the worker expands into
+// one document per supported file. Report lists the outcome of every entry.
+type ArchiveImport struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	KnowledgeBaseID uint      `gorm:"index;not null" json:"knowledge_base_id"`
+	UserID          uint      `gorm:"index;not null" json:"user_id"`
+	FileName        string    `gorm:"size:255" json:"file_name"`
+	ObjectName      string    `gorm:"size:1024" json:"object_name"`
+	Status          string    `gorm:"size:20;default:'pending'" json:"status"` // "pending" | "processing" | "done" | "failed"
+	ImportedCount   int       `json:"imported_count"`
+	SkippedCount    int       `json:"skipped_count"`
+	Report          JSON      `gorm:"type:jsonb" json:"report"`
+	Error           string    `gorm:"type:text" json:"error,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+func CreateArchiveImport(a *ArchiveImport) error {
+	return services.DB.Create(a).Error
+}
+
+func GetArchiveImportByID(id uint) (*ArchiveImport, error) {
+	var a ArchiveImport
+	err := services.DB.First(&a, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &a, nil
+}
+
+// ListArchiveImports returns the imports of a knowledge base, newest first,
+// without their per-entry reports.
+func ListArchiveImports(kbID uint) ([]ArchiveImport, error) {
+	var imports []ArchiveImport
+	err := services.DB.Omit("report").Where("knowledge_base_id = ?", kbID).Order("id DESC").Find(&imports).Error
+	return imports, err
+}
+
+func UpdateArchiveImport(a *ArchiveImport) error {
+	return services.DB.Save(a).Error
+}
@@ -3,14 +3,29 @@ package models
 import (
 	"backend/internal/services"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type ChatMessage struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	SessionID uint      `gorm:"index;not null" json:"session_id"`
-	Role      string    `gorm:"size:20;not null" json:"role"` // "user" | "assistant" | "system"
-	Message   string    `gorm:"type:text" json:"message"`
-	CreatedAt time.Time `json:"created_at"`
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	SessionID     uint      `gorm:"index;not null" json:"session_id"`
+	ParentID      *uint     `gorm:"index" json:"parent_id,omitempty"` // message this one replies to; siblings are alternative branches
+	Role          string    `gorm:"size:20;not null" json:"role"`     // "user" | "assistant" | "system" | "tool"
+	Message       string    `gorm:"type:text" json:"message"`
+	Citations     JSON      `gorm:"type:jsonb" json:"citations,omitempty"`      // sources an assistant answer was generated from
+	SearchQueries JSON      `gorm:"type:jsonb" json:"search_queries,omitempty"` // rewritten queries a user message's context, or a regenerated answer's, was retrieved with
+	Grounding     JSON      `gorm:"type:jsonb" json:"grounding,omitempty"`      // what the guardrails found and changed in an assistant answer
+	ToolCalls     JSON      `gorm:"type:jsonb" json:"tool_calls,omitempty"`     // tools an assistant message called instead of answering
+	ToolCallID    string    `gorm:"size:255" json:"tool_call_id,omitempty"`     // call a tool message holds the result of
+	ToolName      string    `gorm:"size:100" json:"tool_name,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// IsToolStep reports whether the message is an intermediate step of an
+// answer: a round of tool calls or the result of one.
+func (m *ChatMessage) IsToolStep() bool {
+	return m.Role == "tool" || (m.Role == "assistant" && len(m.ToolCalls) > 0)
 }
 
 func CreateChatMessage(message *ChatMessage) error {
@@ -33,10 +48,123 @@ func ListChatMessagesBySessionID(sessionID uint) ([]ChatMessage, error) {
 	return messages, nil
 }
 
+// ListChatPath returns the messages from the start of the conversation to
+// the message with ID leafID, oldest first. Replies are created after the
+// message they reply to, so IDs increase along the path.
+func ListChatPath(leafID uint) ([]ChatMessage, error) {
+	var messages []ChatMessage
+	err := services.DB.Raw(`
+		WITH RECURSIVE path AS (
+			SELECT * FROM chat_messages WHERE id = ?
+			UNION ALL
+			SELECT m.* FROM chat_messages m JOIN path p ON m.id = p.parent_id
+		)
+		SELECT * FROM path ORDER BY id`, leafID).Scan(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// ListChatMessageSiblings returns the alternative replies to parentID, or the
+// alternative first messages of a session when parentID is nil, oldest first.
+func ListChatMessageSiblings(sessionID uint, parentID *uint) ([]ChatMessage, error) {
+	var messages []ChatMessage
+	query := services.DB.Where("session_id = ?", sessionID)
+	if parentID == nil {
+		query = query.Where("parent_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", *parentID)
+	}
+	if err := query.Order("id ASC").Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// LatestChatDescendant returns the most recent message in the subtree of
+// messageID, the message itself when nothing replies to it.
+func LatestChatDescendant(messageID uint) (uint, error) {
+	var id uint
+	err := services.DB.Raw(`
+		WITH RECURSIVE tree AS (
+			SELECT id FROM chat_messages WHERE id = ?
+			UNION ALL
+			SELECT m.id FROM chat_messages m JOIN tree t ON m.parent_id = t.id
+		)
+		SELECT max(id) FROM tree`, messageID).Scan(&id).Error
+	return id, err
+}
+
+// LatestChatMessageID returns the most recent message of a session, nil when
+// it has none.
+func LatestChatMessageID(sessionID uint) (*uint, error) {
+	var ids []uint
+	if err := services.DB.Model(&ChatMessage{}).Where("session_id = ?", sessionID).Order("id DESC").Limit(1).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	return &ids[0], nil
+}
+
+// BackfillChatMessageParents links the messages of sessions that predate
+// conversation trees into a single path and makes its last message the
+// active one. Only sessions without an active message in which no message
+// has a parent are touched, so it does nothing once they are migrated and
+// never chains the alternative first messages of a conversation tree.
+func BackfillChatMessageParents() error {
+	return services.DB.Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		if err := chatSessionsToBackfill(tx).Pluck("s.id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		return linkChatMessages(tx, ids)
+	})
+}
+
+// chatSessionsToBackfill selects the sessions BackfillChatMessageParents
+// migrates.
+func chatSessionsToBackfill(tx *gorm.DB) *gorm.DB {
+	return tx.Table("chat_sessions s").
+		Where("s.active_leaf_id IS NULL").
+		Where("EXISTS (SELECT 1 FROM chat_messages m WHERE m.session_id = s.id)").
+		Where("NOT EXISTS (SELECT 1 FROM chat_messages m WHERE m.session_id = s.id AND m.parent_id IS NOT NULL)")
+}
+
+// linkChatMessages chains the messages of each session in id order and
+// activates the last one.
+func linkChatMessages(tx *gorm.DB, sessionIDs []uint) error {
+	if err := tx.Exec(`
+		UPDATE chat_messages m SET parent_id = (
+			SELECT max(p.id) FROM chat_messages p WHERE p.session_id = m.session_id AND p.id < m.id
+		)
+		WHERE m.session_id IN ?`, sessionIDs).Error; err != nil {
+		return err
+	}
+	return tx.Exec(`
+		UPDATE chat_sessions s SET active_leaf_id = (
+			SELECT max(m.id) FROM chat_messages m WHERE m.session_id = s.id
+		)
+		WHERE s.id IN ?`, sessionIDs).Error
+}
+
 func UpdateChatMessage(message *ChatMessage) error {
 	return services.DB.Save(message).Error
 }
 
+// DeleteChatMessage deletes a message together with all replies branching
+// off it.
 func DeleteChatMessage(id uint) error {
-	return services.DB.Delete(&ChatMessage{}, id).Error
+	return services.DB.Exec(`
+		WITH RECURSIVE tree AS (
+			SELECT id FROM chat_messages WHERE id = ?
+			UNION ALL
+			SELECT m.id FROM chat_messages m JOIN tree t ON m.parent_id = t.id
+		)
+		DELETE FROM chat_messages WHERE id IN (SELECT id FROM tree)`, id).Error
 }
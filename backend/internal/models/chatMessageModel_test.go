@@ -0,0 +1,74 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+)
+
+// dryRun returns a database that renders statements without running them
+// and collects the SQL of every query and raw statement.
+func dryRun(t *testing.T) (*gorm.DB, *[]string) {
+	t.Helper()
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statements []string
+	capture := func(d *gorm.DB) {
+		sql := d.Dialector.Explain(d.Statement.SQL.String(), d.Statement.Vars...)
+		statements = append(statements, strings.Join(strings.Fields(sql), " "))
+	}
+	db.Callback().Query().After("gorm:query").Register("test:capture", capture)
+	db.Callback().Raw().After("gorm:raw").Register("test:capture", capture)
+	return db, &statements
+}
+
+func TestChatSessionsToBackfill(t *testing.T) {
+	db, statements := dryRun(t)
+	var ids []uint
+	if err := chatSessionsToBackfill(db).Pluck("s.id", &ids).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(*statements) != 1 {
+		t.Fatalf("ran %d statements, want one query", len(*statements))
+	}
+	sql := (*statements)[0]
+
+	for rule, condition := range map[string]string{
+		"sessions that already continue from a message are migrated": "s.active_leaf_id IS NULL",
+		"sessions without messages have nothing to link":             "EXISTS (SELECT 1 FROM chat_messages m WHERE m.session_id = s.id)",
+		"a session with any linked message is a conversation tree":   "NOT EXISTS (SELECT 1 FROM chat_messages m WHERE m.session_id = s.id AND m.parent_id IS NOT NULL)",
+	} {
+		if !strings.Contains(sql, condition) {
+			t.Errorf("%s: %q is missing from %s", rule, condition, sql)
+		}
+	}
+	// every rule must hold
+	if strings.Contains(sql, " OR ") || strings.Count(sql, " AND ") != 3 {
+		t.Errorf("conditions are not all required: %s", sql)
+	}
+}
+
+func TestLinkChatMessages(t *testing.T) {
+	db, statements := dryRun(t)
+	if err := linkChatMessages(db, []uint{3, 5}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		// each message replies to the one before it in its session
+		"UPDATE chat_messages m SET parent_id = ( SELECT max(p.id) FROM chat_messages p WHERE p.session_id = m.session_id AND p.id < m.id ) WHERE m.session_id IN (3,5)",
+		// and the session continues from its last message
+		"UPDATE chat_sessions s SET active_leaf_id = ( SELECT max(m.id) FROM chat_messages m WHERE m.session_id = s.id ) WHERE s.id IN (3,5)",
+	}
+	if len(*statements) != len(want) {
+		t.Fatalf("ran %q, want %d statements", *statements, len(want))
+	}
+	for i := range want {
+		if (*statements)[i] != want[i] {
+			t.Errorf("statement %d = %s\nwant %s", i+1, (*statements)[i], want[i])
+		}
+	}
+}
@@ -3,31 +3,142 @@ package models
 import (
 	"backend/internal/services"
 	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ChatSessionSettings override the defaults of the chat pipeline for one
+// session. Zero values use the defaults.
+type ChatSessionSettings struct {
+	Model         string   `gorm:"size:100" json:"model,omitempty"`
+	Temperature   *float64 `json:"temperature,omitempty"`
+	TopK          int      `gorm:"not null;default:0" json:"top_k,omitempty"`
+	RetrievalMode string   `gorm:"size:20" json:"retrieval_mode,omitempty"` // vector, keyword, hybrid or none
+}
+
 type ChatSession struct {
-	ID              uint      `gorm:"primaryKey" json:"id"`
-	UserID          uint      `gorm:"index;not null" json:"user_id"`
-	KnowledgeBaseID *uint     `gorm:"index" json:"knowledge_base_id,omitempty"`
-	Title           string    `gorm:"size:255" json:"title"`
-	CreatedAt       time.Time `json:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at"`
+	ID              uint                `gorm:"primaryKey" json:"id"`
+	UserID          uint                `gorm:"index;not null" json:"user_id"`
+	KnowledgeBaseID *uint               `gorm:"index" json:"knowledge_base_id,omitempty"`
+	Title           string              `gorm:"size:255" json:"title"`
+	Summary         string              `gorm:"type:text" json:"summary,omitempty"`         // running summary of the turns that left the history window
+	SummarizedUntil uint                `gorm:"not null;default:0" json:"summarized_until"` // ID of the last message folded into Summary
+	ActiveLeafID    *uint               `json:"active_leaf_id,omitempty"`                   // last message of the branch the conversation continues from
+	Settings        ChatSessionSettings `gorm:"embedded;embeddedPrefix:setting_" json:"settings"`
+	// KnowledgeBaseIDs are all knowledge bases the session searches, the
+	// one of KnowledgeBaseID first, whose settings apply to the chat.
+	KnowledgeBaseIDs []uint    `gorm:"-" json:"knowledge_base_ids"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
 
 	User          User           `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"user,omitempty"`
 	KnowledgeBase *KnowledgeBase `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"knowledge_base,omitempty"`
 	Messages      []ChatMessage  `gorm:"foreignKey:SessionID" json:"messages,omitempty"`
 }
 
+// ChatSessionKnowledgeBase attaches a knowledge base to a chat session.
+type ChatSessionKnowledgeBase struct {
+	ChatSessionID   uint `gorm:"primaryKey"`
+	KnowledgeBaseID uint `gorm:"primaryKey;index"`
+	Position        int  `gorm:"not null;default:0"`
+
+	ChatSession   ChatSession   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	KnowledgeBase KnowledgeBase `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
 func CreateChatSession(session *ChatSession) error {
 	return services.DB.Create(session).Error
 }
 
 func GetChatSessionByID(id uint) (*ChatSession, error) {
 	var session ChatSession
-	if err := services.DB.Preload("Messages").First(&session, id).Error; err != nil {
+	if err := services.DB.First(&session, id).Error; err != nil {
+		return nil, err
+	}
+	sessions := []ChatSession{session}
+	if err := loadChatSessionKnowledgeBaseIDs(sessions); err != nil {
 		return nil, err
 	}
-	return &session, nil
+	return &sessions[0], nil
+}
+
+// SetChatSessionKnowledgeBases replaces the knowledge bases attached to a
+// session, keeping their order.
+func SetChatSessionKnowledgeBases(session *ChatSession, kbIDs []uint) error {
+	err := services.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("chat_session_id = ?", session.ID).Delete(&ChatSessionKnowledgeBase{}).Error; err != nil {
+			return err
+		}
+		if len(kbIDs) == 0 {
+			return nil
+		}
+		rows := make([]ChatSessionKnowledgeBase, len(kbIDs))
+		for i, id := range kbIDs {
+			rows[i] = ChatSessionKnowledgeBase{ChatSessionID: session.ID, KnowledgeBaseID: id, Position: i}
+		}
+		return tx.Omit(clause.Associations).Create(&rows).Error
+	})
+	if err != nil {
+		return err
+	}
+	session.KnowledgeBaseIDs = kbIDs
+	return nil
+}
+
+// loadChatSessionKnowledgeBaseIDs fills in the attached knowledge bases of
+// the sessions.
+func loadChatSessionKnowledgeBaseIDs(sessions []ChatSession) error {
+	if len(sessions) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(sessions))
+	for i, s := range sessions {
+		ids[i] = s.ID
+	}
+	var rows []ChatSessionKnowledgeBase
+	if err := services.DB.Where("chat_session_id IN ?", ids).Order("position ASC").Find(&rows).Error; err != nil {
+		return err
+	}
+	attached := map[uint][]uint{}
+	for _, r := range rows {
+		attached[r.ChatSessionID] = append(attached[r.ChatSessionID], r.KnowledgeBaseID)
+	}
+	for i := range sessions {
+		sessions[i].KnowledgeBaseIDs = attached[sessions[i].ID]
+		if sessions[i].KnowledgeBaseIDs == nil {
+			sessions[i].KnowledgeBaseIDs = []uint{}
+		}
+	}
+	return nil
+}
+
+// BackfillChatSessionKnowledgeBases attaches the knowledge base of sessions
+// created before sessions could search several.
+func BackfillChatSessionKnowledgeBases() error {
+	return services.DB.Exec(`
+INSERT INTO chat_session_knowledge_bases (chat_session_id, knowledge_base_id, position)
+SELECT s.id, s.knowledge_base_id, 0
+FROM chat_sessions s
+WHERE s.knowledge_base_id IS NOT NULL
+	AND NOT EXISTS (SELECT 1 FROM chat_session_knowledge_bases a WHERE a.chat_session_id = s.id)`).Error
+}
+
+// UpdateChatSessionSummary replaces the running summary unless another
+// request has summarized the session since it was read.
+func UpdateChatSessionSummary(session *ChatSession, summary string, until uint) (bool, error) {
+	result := services.DB.Model(&ChatSession{}).
+		Where("id = ? AND summarized_until = ?", session.ID, session.SummarizedUntil).
+		Updates(map[string]interface{}{"summary": summary, "summarized_until": until})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	session.Summary = summary
+	session.SummarizedUntil = until
+	return true, nil
 }
 
 func ListChatSessionsByUserID(userID uint) ([]ChatSession, error) {
@@ -35,11 +146,46 @@ func ListChatSessionsByUserID(userID uint) ([]ChatSession, error) {
 	if err := services.DB.Where("user_id = ?", userID).Order("updated_at DESC").Find(&sessions).Error; err != nil {
 		return nil, err
 	}
+	if err := loadChatSessionKnowledgeBaseIDs(sessions); err != nil {
+		return nil, err
+	}
 	return sessions, nil
 }
 
+// UpdateChatSession writes the title, knowledge base and settings of a
+// session and bumps its UpdatedAt. The active branch and the summary are
+// left alone, concurrent chat requests may have changed them.
 func UpdateChatSession(session *ChatSession) error {
-	return services.DB.Save(session).Error
+	return services.DB.Model(&ChatSession{}).Where("id = ?", session.ID).
+		Updates(map[string]interface{}{
+			"title":                  session.Title,
+			"knowledge_base_id":      session.KnowledgeBaseID,
+			"setting_model":          session.Settings.Model,
+			"setting_temperature":    session.Settings.Temperature,
+			"setting_top_k":          session.Settings.TopK,
+			"setting_retrieval_mode": session.Settings.RetrievalMode,
+			"updated_at":             session.UpdatedAt,
+		}).Error
+}
+
+// TouchChatSession bumps the session's UpdatedAt without writing the other
+// columns, which concurrent requests may have changed.
+func TouchChatSession(id uint) error {
+	return services.DB.Model(&ChatSession{}).Where("id = ?", id).Update("updated_at", time.Now()).Error
+}
+
+// SetChatSessionActiveLeaf makes the path ending at leafID the active branch
+// of a session and bumps its UpdatedAt, without writing the other columns.
+func SetChatSessionActiveLeaf(session *ChatSession, leafID *uint) error {
+	now := time.Now()
+	err := services.DB.Model(&ChatSession{}).Where("id = ?", session.ID).
+		Updates(map[string]interface{}{"active_leaf_id": leafID, "updated_at": now}).Error
+	if err != nil {
+		return err
+	}
+	session.ActiveLeafID = leafID
+	session.UpdatedAt = now
+	return nil
 }
 
 func DeleteChatSession(id uint) error {
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"backend/internal/services"
+	"strings"
+)
+
+// ChunkMatch is a chunk found by full-text search. The worker owns the
+// document_chunks table and fills search_vector with the text search
+// configuration of each chunk's language.
+type ChunkMatch struct {
+	ID   string
+	Rank float64
+}
+
+// ChunkServed reports whether the chunk belongs to the version its document
+// currently serves. Chunk IDs derive from the document version and the
+// chunking, so a new version or re-chunking retires them.
+func ChunkServed(id string) (bool, error) {
+	var count int64
+	err := services.DB.Table("document_chunks c").
+		Joins("JOIN documents d ON d.id = c.document_id AND d.version = c.version").
+		Where("c.id = ?", id).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// SearchDocumentChunks runs a keyword query against the chunks of the
+// versions the knowledge base's documents serve. The query is parsed once
+// per text search configuration in configs and matched against the chunks
+// indexed with that configuration, so stemming matches the language the
+// chunk is written in. Each branch compares search_vector with a constant
+// query and can use its GIN index; the branches are combined with UNION ALL.
+// Chunks without a configuration were indexed with "simple".
+func SearchDocumentChunks(kbID uint, query string, configs []string, limit int) ([]ChunkMatch, error) {
+	if len(configs) == 0 {
+		configs = []string{"simple"}
+	}
+	branches := make([]string, len(configs))
+	var args []interface{}
+	for i, config := range configs {
+		stored := []string{config}
+		if config == "simple" {
+			stored = append(stored, "")
+		}
+		branches[i] = `
+	SELECT c.id, ts_rank_cd(c.search_vector, websearch_to_tsquery(?::regconfig, ?)) AS rank
+	FROM document_chunks c
+	JOIN documents d ON d.id = c.document_id AND d.version = c.version
+	WHERE c.knowledge_base_id = ?
+		AND c.search_config IN ?
+		AND c.search_vector @@ websearch_to_tsquery(?::regconfig, ?)`
+		args = append(args, config, query, kbID, stored, config, query)
+	}
+	args = append(args, limit)
+
+	var matches []ChunkMatch
+	err := services.DB.Raw(`
+SELECT id, rank FROM (`+strings.Join(branches, "\n\tUNION ALL")+`
+) ranked
+ORDER BY rank DESC
+LIMIT ?`, args...).Scan(&matches).Error
+	if err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
@@ -2,8 +2,8 @@ package models
 
 import (
 	"time"
-	// "errors"
-	// "gorm.io/gorm"
+	"errors"
+	"gorm.io/gorm"
 	"backend/internal/services"
 )
 
@@ -15,6 +15,19 @@ type Document struct {
     Name            string    `gorm:"size:255" json:"name"`
     FileType        string    `gorm:"size:50" json:"file_type"`
     Description     string    `gorm:"size:255" json:"description"`
+    Metadata        JSON      `gorm:"type:jsonb" json:"metadata,omitempty"` // user-defined key/values, copied to every chunk
+    Language        string    `gorm:"size:10" json:"language,omitempty"` // detected by the worker from the served version
+    Summary         string    `gorm:"type:text" json:"summary,omitempty"` // generated by the worker from the served version
+    SuggestedTitle  string    `gorm:"size:255" json:"suggested_title,omitempty"`
+    Keywords        JSON      `gorm:"type:jsonb" json:"keywords,omitempty"`
+    ObjectName      string    `gorm:"size:1024" json:"object_name"`
+    ContentHash     string    `gorm:"size:64;index" json:"content_hash"`
+    Size            int64     `json:"size"`
+    Version         int       `gorm:"not null;default:1" json:"version"` // searchable version
+    SourceID        *uint     `gorm:"index" json:"source_id,omitempty"` // set for documents fetched by a source
+    SourceURL       string    `gorm:"size:2048" json:"source_url,omitempty"`
+    SourceETag         string `gorm:"size:255" json:"-"` // validators of the last fetch, for conditional requests
+    SourceLastModified string `gorm:"size:100" json:"-"`
     EmbeddingStatus string    `gorm:"size:20;default:'pending'" json:"embedding_status"`
     CreatedAt       time.Time `json:"created_at"`
     UpdatedAt       time.Time `json:"updated_at"`
@@ -36,10 +49,62 @@ func GetDocumentByID(id uint) (*Document, error) {
     return &doc, nil
 }
 
+// FindDocumentByContentHash returns a document of the knowledge base whose
+// current version has the given SHA-256, or nil when there is none.
+// Superseded versions do not count, re-uploading earlier content reverts to it.
+func FindDocumentByContentHash(kbID uint, hash string) (*Document, error) {
+    var doc Document
+    err := services.DB.Where("knowledge_base_id = ? AND content_hash = ?", kbID, hash).
+        First(&doc).Error
+    if err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, nil
+        }
+        return nil, err
+    }
+    return &doc, nil
+}
+
+// FindDocumentByName returns the most recent document with the given name in
+// the knowledge base, or nil when there is none.
+func FindDocumentByName(kbID uint, name string) (*Document, error) {
+    var doc Document
+    err := services.DB.Where("knowledge_base_id = ? AND name = ?", kbID, name).Order("id DESC").First(&doc).Error
+    if err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, nil
+        }
+        return nil, err
+    }
+    return &doc, nil
+}
+
+// ListDocumentsByKnowledgeBase returns the documents of a knowledge base,
+// newest first.
+func ListDocumentsByKnowledgeBase(kbID uint) ([]Document, error) {
+    var docs []Document
+    if err := services.DB.Where("knowledge_base_id = ?", kbID).Order("created_at DESC").Find(&docs).Error; err != nil {
+        return nil, err
+    }
+    return docs, nil
+}
+
 func UpdateDocument(d *Document) error {
     return services.DB.Save(d).Error
 }
 
+// UpdateDocumentDetails writes the name and metadata of a document and bumps
+// its UpdatedAt. The other columns are left alone, the worker may be writing
+// the status, language or summary of a version it is ingesting.
+func UpdateDocumentDetails(d *Document) error {
+    return services.DB.Model(&Document{}).Where("id = ?", d.ID).
+        Updates(map[string]interface{}{
+            "name":       d.Name,
+            "metadata":   d.Metadata,
+            "updated_at": d.UpdatedAt,
+        }).Error
+}
+
 func UpdateDocumentEmbeddingStatus(id uint, status string) error {
     return services.DB.Model(&Document{}).Where("id = ?", id).Update("embedding_status", status).Error
 }
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"backend/internal/services"
+)
+
+// Document source types.
+const (
+	SourceTypeURL = "url"
+	SourceTypeGit = "git"
+)
+
+// DocumentSource is an external location the worker fetches documents from,
+// e.g. a web site or a git repository. Config holds the type specific settings.
+type DocumentSource struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	KnowledgeBaseID uint       `gorm:"index;not null" json:"knowledge_base_id"`
+	UserID          uint       `gorm:"index;not null" json:"user_id"`
+	Type            string     `gorm:"size:20;not null" json:"type"`
+	URL             string     `gorm:"size:2048;not null" json:"url"`
+	Config          JSON       `gorm:"type:jsonb" json:"config"`
+	Schedule        string     `gorm:"size:100" json:"schedule,omitempty"`      // cron spec; empty syncs on demand only
+	Revision        string     `gorm:"size:64" json:"revision,omitempty"`       // last synced commit of a git source
+	RevisionInclude string     `gorm:"size:64" json:"-"`                        // digest of the include patterns Revision was synced with
+	Status          string     `gorm:"size:20;default:'pending'" json:"status"` // "pending" | "syncing" | "idle" | "failed"
+	DocumentCount   int        `json:"document_count"`
+	LastSyncedAt    *time.Time `json:"last_synced_at,omitempty"`
+	LastError       string     `gorm:"type:text" json:"last_error,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+func CreateDocumentSource(s *DocumentSource) error {
+	return services.DB.Create(s).Error
+}
+
+func GetDocumentSourceByID(id uint) (*DocumentSource, error) {
+	var s DocumentSource
+	err := services.DB.First(&s, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+func ListDocumentSources(kbID uint) ([]DocumentSource, error) {
+	var sources []DocumentSource
+	err := services.DB.Where("knowledge_base_id = ?", kbID).Order("id").Find(&sources).Error
+	return sources, err
+}
+
+// UpdateDocumentSourceSchedule stores the user-editable schedule only, so it
+// cannot overwrite the status and revision columns the worker writes.
+func UpdateDocumentSourceSchedule(s *DocumentSource) error {
+	s.UpdatedAt = time.Now()
+	return services.DB.Model(&DocumentSource{}).Where("id = ?", s.ID).Updates(map[string]interface{}{
+		"schedule":   s.Schedule,
+		"updated_at": s.UpdatedAt,
+	}).Error
+}
+
+// DeleteDocumentSource removes the source. Documents it fetched stay in the
+// knowledge base but are no longer refreshed.
+func DeleteDocumentSource(id uint) error {
+	return services.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Document{}).Where("source_id = ?", id).Update("source_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&DocumentSource{}, id).Error
+	})
+}
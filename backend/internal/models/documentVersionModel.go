@@ -0,0 +1,127 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"backend/internal/services"
+)
+
+// DocumentVersion keeps the metadata of every file uploaded for a document.
+// The document itself points at the version that is searchable.
+type DocumentVersion struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	DocumentID      uint      `gorm:"uniqueIndex:idx_document_version;not null" json:"document_id"`
+	Version         int       `gorm:"uniqueIndex:idx_document_version;not null" json:"version"`
+	FileName        string    `gorm:"size:255" json:"file_name"`
+	FileType        string    `gorm:"size:50" json:"file_type"`
+	Description     string    `gorm:"size:255" json:"description"`
+	ObjectName      string    `gorm:"size:1024" json:"object_name"`
+	ContentHash     string    `gorm:"size:64;index" json:"content_hash"`
+	Size            int64     `json:"size"`
+	EmbeddingStatus string    `gorm:"size:20;default:'pending'" json:"embedding_status"`
+	UploadedBy      uint      `json:"uploaded_by"`
+	SourceRevision  string    `gorm:"size:64" json:"source_revision,omitempty"`
+	Language        string    `gorm:"size:10" json:"language,omitempty"`
+	Summary         string    `gorm:"type:text" json:"summary,omitempty"`
+	SuggestedTitle  string    `gorm:"size:255" json:"suggested_title,omitempty"`
+	Keywords        JSON      `gorm:"type:jsonb" json:"keywords,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+
+	Document Document `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// CreateDocumentWithVersion inserts a new document together with its first version.
+func CreateDocumentWithVersion(d *Document, v *DocumentVersion) error {
+	return services.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(d).Error; err != nil {
+			return err
+		}
+		v.DocumentID = d.ID
+		return tx.Create(v).Error
+	})
+}
+
+// EnsureInitialVersion records the document's current file as version 1 for
+// documents uploaded before versioning existed.
+func EnsureInitialVersion(d *Document) error {
+	var count int64
+	if err := services.DB.Model(&DocumentVersion{}).Where("document_id = ?", d.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return services.DB.Create(&DocumentVersion{
+		DocumentID:      d.ID,
+		Version:         d.Version,
+		FileName:        d.Name,
+		FileType:        d.FileType,
+		Description:     d.Description,
+		ObjectName:      d.ObjectName,
+		ContentHash:     d.ContentHash,
+		Size:            d.Size,
+		EmbeddingStatus: d.EmbeddingStatus,
+		UploadedBy:      d.UserID,
+		CreatedAt:       d.CreatedAt,
+		UpdatedAt:       d.UpdatedAt,
+	}).Error
+}
+
+func CreateDocumentVersion(v *DocumentVersion) error {
+	return services.DB.Create(v).Error
+}
+
+func GetDocumentVersion(documentID uint, version int) (*DocumentVersion, error) {
+	var v DocumentVersion
+	err := services.DB.Where("document_id = ? AND version = ?", documentID, version).First(&v).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &v, nil
+}
+
+func ListDocumentVersions(documentID uint) ([]DocumentVersion, error) {
+	var versions []DocumentVersion
+	if err := services.DB.Where("document_id = ?", documentID).Order("version DESC").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// NextDocumentVersion returns the version number for the next upload.
+func NextDocumentVersion(documentID uint) (int, error) {
+	var latest int
+	if err := services.DB.Model(&DocumentVersion{}).Where("document_id = ?", documentID).
+		Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+		return 0, err
+	}
+	return latest + 1, nil
+}
+
+// FindDocumentVersionByContentHash returns the latest version with the given
+// SHA-256 among the documents of the knowledge base, or nil when there is none.
+func FindDocumentVersionByContentHash(kbID uint, hash string) (*DocumentVersion, error) {
+	var v DocumentVersion
+	err := services.DB.Joins("JOIN documents ON documents.id = document_versions.document_id").
+		Where("documents.knowledge_base_id = ? AND document_versions.content_hash = ?", kbID, hash).
+		Order("document_versions.id DESC").
+		First(&v).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &v, nil
+}
+
+func UpdateDocumentVersion(v *DocumentVersion) error {
+	return services.DB.Save(v).Error
+}
@@ -0,0 +1,198 @@
+package models
+
+import (
+	"backend/internal/services"
+	"time"
+)
+
+// Evaluation run statuses.
+const (
+	EvalRunRunning   = "running"
+	EvalRunCompleted = "completed"
+	EvalRunFailed    = "failed"
+)
+
+// Evaluation set statuses. A generated set is filled in by the worker and
+// can only be edited and run once it is ready.
+const (
+	EvalSetReady      = "ready"
+	EvalSetGenerating = "generating"
+	EvalSetFailed     = "failed"
+)
+
+// EvalSet is a golden set of questions a knowledge base should answer.
+type EvalSet struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	UserID          uint      `gorm:"index;not null" json:"user_id"`
+	KnowledgeBaseID uint      `gorm:"index;not null" json:"knowledge_base_id"`
+	Name            string    `gorm:"size:255;not null" json:"name"`
+	Description     string    `gorm:"type:text" json:"description,omitempty"`
+	Status          string    `gorm:"size:20;not null;default:'ready'" json:"status"`
+	Error           string    `gorm:"type:text" json:"error,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+
+	KnowledgeBase KnowledgeBase `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Cases         []EvalCase    `gorm:"foreignKey:SetID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"cases,omitempty"`
+}
+
+// EvalCase is a question with the answer and the documents expected for it.
+type EvalCase struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	SetID           uint      `gorm:"index;not null" json:"set_id"`
+	Question        string    `gorm:"type:text;not null" json:"question"`
+	ExpectedAnswer  string    `gorm:"type:text" json:"expected_answer,omitempty"`
+	ExpectedSources JSON      `gorm:"type:jsonb" json:"expected_sources,omitempty"` // document IDs, names or chunk IDs that should be retrieved
+	SourceChunkID   string    `gorm:"size:36" json:"source_chunk_id,omitempty"`     // chunk a generated question was written from, scored by chunk recall
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// EvalRun is one evaluation of a set. Config holds the retrieval and judge
+// settings it ran with and Metrics the aggregated scores, so runs can be
+// compared after chunking, models or prompts change.
+type EvalRun struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	SetID           uint       `gorm:"index;not null" json:"set_id"`
+	KnowledgeBaseID uint       `gorm:"index;not null" json:"knowledge_base_id"`
+	Label           string     `gorm:"size:255" json:"label,omitempty"`
+	Status          string     `gorm:"size:20;not null" json:"status"`
+	Config          JSON       `gorm:"type:jsonb" json:"config,omitempty"`
+	Metrics         JSON       `gorm:"type:jsonb" json:"metrics,omitempty"`
+	Error           string     `gorm:"type:text" json:"error,omitempty"`
+	StartedAt       time.Time  `json:"started_at"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+
+	Set EvalSet `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// EvalResult is the outcome of one case in a run. Faithfulness and
+// Correctness are nil when the case has nothing to score them against or
+// judging failed.
+type EvalResult struct {
+	ID             uint     `gorm:"primaryKey" json:"id"`
+	RunID          uint     `gorm:"index;not null" json:"run_id"`
+	CaseID         uint     `gorm:"index;not null" json:"case_id"`
+	Question       string   `gorm:"type:text" json:"question"`
+	Answer         string   `gorm:"type:text" json:"answer"`
+	Sources        JSON     `gorm:"type:jsonb" json:"sources,omitempty"`
+	SearchQueries  JSON     `gorm:"type:jsonb" json:"search_queries,omitempty"`
+	Recall         *float64 `json:"recall,omitempty"`
+	ReciprocalRank *float64 `json:"reciprocal_rank,omitempty"`
+	// ChunkRecall and ChunkReciprocalRank score the source chunk of a
+	// generated case. They are nil when that chunk is no longer served.
+	ChunkRecall         *float64 `json:"chunk_recall,omitempty"`
+	ChunkReciprocalRank *float64 `json:"chunk_reciprocal_rank,omitempty"`
+	Faithfulness   *float64 `json:"faithfulness,omitempty"`
+	Correctness    *float64 `json:"correctness,omitempty"`
+	JudgeReason    string   `gorm:"type:text" json:"judge_reason,omitempty"`
+	Error          string   `gorm:"type:text" json:"error,omitempty"`
+	LatencyMs      int64    `json:"latency_ms"`
+
+	Run EvalRun `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// CreateEvalSet stores a set together with its cases.
+func CreateEvalSet(set *EvalSet) error {
+	return services.DB.Omit("KnowledgeBase").Create(set).Error
+}
+
+func GetEvalSetByID(id uint) (*EvalSet, error) {
+	var set EvalSet
+	if err := services.DB.First(&set, id).Error; err != nil {
+		return nil, err
+	}
+	return &set, nil
+}
+
+func ListEvalSetsByKnowledgeBase(kbID uint) ([]EvalSet, error) {
+	var sets []EvalSet
+	if err := services.DB.Where("knowledge_base_id = ?", kbID).Order("id ASC").Find(&sets).Error; err != nil {
+		return nil, err
+	}
+	return sets, nil
+}
+
+// UpdateEvalSet saves the set's own fields, not its cases.
+func UpdateEvalSet(set *EvalSet) error {
+	return services.DB.Omit("KnowledgeBase", "Cases").Save(set).Error
+}
+
+func DeleteEvalSet(id uint) error {
+	return services.DB.Delete(&EvalSet{}, id).Error
+}
+
+func CreateEvalCases(cases []EvalCase) error {
+	if len(cases) == 0 {
+		return nil
+	}
+	return services.DB.Create(&cases).Error
+}
+
+func ListEvalCases(setID uint) ([]EvalCase, error) {
+	var cases []EvalCase
+	if err := services.DB.Where("set_id = ?", setID).Order("id ASC").Find(&cases).Error; err != nil {
+		return nil, err
+	}
+	return cases, nil
+}
+
+func GetEvalCase(setID, caseID uint) (*EvalCase, error) {
+	var c EvalCase
+	if err := services.DB.Where("set_id = ?", setID).First(&c, caseID).Error; err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func UpdateEvalCase(c *EvalCase) error {
+	return services.DB.Save(c).Error
+}
+
+func DeleteEvalCase(setID, caseID uint) error {
+	return services.DB.Where("set_id = ?", setID).Delete(&EvalCase{}, caseID).Error
+}
+
+func CreateEvalRun(run *EvalRun) error {
+	return services.DB.Omit("Set").Create(run).Error
+}
+
+func UpdateEvalRun(run *EvalRun) error {
+	return services.DB.Omit("Set").Save(run).Error
+}
+
+func GetEvalRunByID(id uint) (*EvalRun, error) {
+	var run EvalRun
+	if err := services.DB.First(&run, id).Error; err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// ListEvalRunsBySet returns the runs of a set, newest first.
+func ListEvalRunsBySet(setID uint) ([]EvalRun, error) {
+	var runs []EvalRun
+	if err := services.DB.Where("set_id = ?", setID).Order("id DESC").Find(&runs).Error; err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// FailInterruptedEvalRuns marks runs that were still running when the
+// process stopped as failed.
+func FailInterruptedEvalRuns() error {
+	return services.DB.Model(&EvalRun{}).Where("status = ?", EvalRunRunning).
+		Updates(map[string]interface{}{"status": EvalRunFailed, "error": "interrupted", "finished_at": time.Now()}).Error
+}
+
+func CreateEvalResult(result *EvalResult) error {
+	return services.DB.Omit("Run").Create(result).Error
+}
+
+func ListEvalResults(runID uint) ([]EvalResult, error) {
+	var results []EvalResult
+	if err := services.DB.Where("run_id = ?", runID).Order("case_id ASC").Find(&results).Error; err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 	// "errors"
 	// "gorm.io/gorm"
@@ -12,6 +13,14 @@ type KnowledgeBase struct {
     UserID      uint      `gorm:"index;not null" json:"user_id"`
     Name        string    `gorm:"size:255;not null" json:"name"`
     Description string    `json:"description,omitempty"`
+    QueryRewrite string   `gorm:"size:20;not null;default:'condense'" json:"query_rewrite"` // how chat questions are rewritten before retrieval, none, condense, multi_query or hyde
+    SystemPrompt string   `gorm:"type:text" json:"system_prompt,omitempty"` // text/template for the chat system prompt, empty for the default
+    MinRelevance   float64 `gorm:"not null;default:0" json:"min_relevance"`           // similarity the best chunk must reach before the LLM is asked, 0 disables it
+    FallbackAnswer string  `gorm:"type:text" json:"fallback_answer,omitempty"`       // reply when nothing relevant is found, empty for the default
+    GroundingCheck string  `gorm:"size:10;not null;default:'off'" json:"grounding_check"` // off, flag or strip unsupported sentences of answers
+    AllowedModels  JSON    `gorm:"type:jsonb" json:"allowed_models,omitempty"` // chat models sessions may pick, empty for all configured models
+    AllowedModes   JSON    `gorm:"type:jsonb" json:"allowed_modes,omitempty"`  // retrieval modes sessions may pick, empty for all
+    MaxTopK        int     `gorm:"not null;default:0" json:"max_top_k"`        // most chunks a session may retrieve, 0 for no limit
     CreatedAt   time.Time `json:"created_at"`
     UpdatedAt   time.Time `json:"updated_at"`
 
@@ -20,6 +29,24 @@ type KnowledgeBase struct {
     ChatSessions   []ChatSession  `gorm:"foreignKey:KnowledgeBaseID" json:"chat_sessions,omitempty"`
 }
 
+// AllowedModelList returns the chat models sessions may pick, nil for all.
+func (kb *KnowledgeBase) AllowedModelList() []string {
+    return stringList(kb.AllowedModels)
+}
+
+// AllowedModeList returns the retrieval modes sessions may pick, nil for all.
+func (kb *KnowledgeBase) AllowedModeList() []string {
+    return stringList(kb.AllowedModes)
+}
+
+func stringList(j JSON) []string {
+    var list []string
+    if len(j) > 0 {
+        _ = json.Unmarshal(j, &list)
+    }
+    return list
+}
+
 func CreateKnowledgeBase(kb *KnowledgeBase) error {
     return services.DB.Create(kb).Error
 }
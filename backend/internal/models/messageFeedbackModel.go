@@ -0,0 +1,239 @@
+package models
+
+import (
+	"backend/internal/services"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MessageFeedback is a user's rating of an assistant answer. It is reported
+// to the knowledge bases the answer's sources came from, see
+// MessageFeedbackKnowledgeBase. Those and KnowledgeBaseID, the knowledge
+// base the session chatted with, are copied so reports survive sessions
+// switching knowledge bases.
+type MessageFeedback struct {
+	ID              uint   `gorm:"primaryKey" json:"id"`
+	MessageID       uint   `gorm:"uniqueIndex;not null" json:"message_id"`
+	UserID          uint   `gorm:"index;not null" json:"user_id"`
+	KnowledgeBaseID *uint  `gorm:"index" json:"knowledge_base_id,omitempty"`
+	Rating          int    `gorm:"not null" json:"rating"`          // 1 for thumbs up, -1 for thumbs down
+	Reason          string `gorm:"size:30" json:"reason,omitempty"` // category of what was wrong, see schemas.FeedbackRequest
+	Comment         string `gorm:"type:text" json:"comment,omitempty"`
+	// KnowledgeBaseIDs are the knowledge bases the feedback is reported to.
+	KnowledgeBaseIDs []uint    `gorm:"-" json:"knowledge_base_ids"`
+	CreatedAt        time.Time `gorm:"index" json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+
+	Message       ChatMessage    `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	KnowledgeBase *KnowledgeBase `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"-"`
+}
+
+// MessageFeedbackKnowledgeBase reports a feedback to a knowledge base.
+type MessageFeedbackKnowledgeBase struct {
+	MessageFeedbackID uint `gorm:"primaryKey"`
+	KnowledgeBaseID   uint `gorm:"primaryKey;index"`
+
+	MessageFeedback MessageFeedback `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	KnowledgeBase   KnowledgeBase   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+// SaveMessageFeedback creates the feedback of a message or replaces the
+// rating, reason, comment and knowledge bases given before.
+func SaveMessageFeedback(feedback *MessageFeedback) error {
+	return services.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Omit(clause.Associations).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "message_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"rating", "reason", "comment", "knowledge_base_id", "updated_at"}),
+		}).Create(feedback).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("message_feedback_id = ?", feedback.ID).Delete(&MessageFeedbackKnowledgeBase{}).Error; err != nil {
+			return err
+		}
+		if len(feedback.KnowledgeBaseIDs) == 0 {
+			return nil
+		}
+		rows := make([]MessageFeedbackKnowledgeBase, len(feedback.KnowledgeBaseIDs))
+		for i, id := range feedback.KnowledgeBaseIDs {
+			rows[i] = MessageFeedbackKnowledgeBase{MessageFeedbackID: feedback.ID, KnowledgeBaseID: id}
+		}
+		return tx.Omit(clause.Associations).Create(&rows).Error
+	})
+}
+
+// GetMessageFeedback returns the feedback of a message, nil when there is
+// none.
+func GetMessageFeedback(messageID uint) (*MessageFeedback, error) {
+	var feedback MessageFeedback
+	err := services.DB.Where("message_id = ?", messageID).First(&feedback).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	feedback.KnowledgeBaseIDs = []uint{}
+	err = services.DB.Model(&MessageFeedbackKnowledgeBase{}).
+		Where("message_feedback_id = ?", feedback.ID).
+		Order("knowledge_base_id").
+		Pluck("knowledge_base_id", &feedback.KnowledgeBaseIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	return &feedback, nil
+}
+
+func DeleteMessageFeedback(messageID uint) error {
+	return services.DB.Where("message_id = ?", messageID).Delete(&MessageFeedback{}).Error
+}
+
+// BackfillMessageFeedbackKnowledgeBases reports feedback given before it
+// was attributed to several knowledge bases to the session's knowledge base.
+func BackfillMessageFeedbackKnowledgeBases() error {
+	return services.DB.Exec(`
+INSERT INTO message_feedback_knowledge_bases (message_feedback_id, knowledge_base_id)
+SELECT f.id, f.knowledge_base_id
+FROM message_feedbacks f
+WHERE f.knowledge_base_id IS NOT NULL
+	AND NOT EXISTS (SELECT 1 FROM message_feedback_knowledge_bases a WHERE a.message_feedback_id = f.id)`).Error
+}
+
+// FeedbackPeriod counts the ratings given in one period of a report.
+type FeedbackPeriod struct {
+	Period time.Time `json:"period"`
+	Up     int       `json:"up"`
+	Down   int       `json:"down"`
+}
+
+// FeedbackReason counts the thumbs down given for one reason.
+type FeedbackReason struct {
+	Reason string `json:"reason"`
+	Count  int    `json:"count"`
+}
+
+// RatedQuery is a question whose answers were rated, with its latest
+// comment.
+type RatedQuery struct {
+	Query       string    `json:"query"`
+	Down        int       `json:"down"`
+	Up          int       `json:"up"`
+	LastComment string    `json:"last_comment,omitempty"`
+	LastRatedAt time.Time `json:"last_rated_at"`
+}
+
+// CitedDocument is a document cited by rated answers.
+type CitedDocument struct {
+	DocumentID   uint   `json:"document_id"`
+	DocumentName string `json:"document_name"`
+	Down         int    `json:"down"`
+	Up           int    `json:"up"`
+}
+
+// FeedbackReportQuery scopes a report to a knowledge base and a time range.
+// Interval is a date_trunc unit: day, week or month.
+type FeedbackReportQuery struct {
+	KnowledgeBaseID uint
+	From, To        time.Time
+	Interval        string
+	Limit           int
+}
+
+// FeedbackTimeline counts ratings per period.
+func FeedbackTimeline(q FeedbackReportQuery) ([]FeedbackPeriod, error) {
+	var periods []FeedbackPeriod
+	err := services.DB.Raw(`
+SELECT date_trunc(?, f.created_at) AS period,
+	COUNT(*) FILTER (WHERE f.rating > 0) AS up,
+	COUNT(*) FILTER (WHERE f.rating < 0) AS down
+FROM message_feedbacks f
+WHERE f.id IN (SELECT message_feedback_id FROM message_feedback_knowledge_bases WHERE knowledge_base_id = ?) AND f.created_at >= ? AND f.created_at < ?
+GROUP BY period
+ORDER BY period`, q.Interval, q.KnowledgeBaseID, q.From, q.To).Scan(&periods).Error
+	if err != nil {
+		return nil, err
+	}
+	return periods, nil
+}
+
+// FeedbackReasons counts the reasons given with thumbs down, most frequent
+// first.
+func FeedbackReasons(q FeedbackReportQuery) ([]FeedbackReason, error) {
+	var reasons []FeedbackReason
+	err := services.DB.Raw(`
+SELECT COALESCE(NULLIF(f.reason, ''), 'unspecified') AS reason, COUNT(*) AS count
+FROM message_feedbacks f
+WHERE f.id IN (SELECT message_feedback_id FROM message_feedback_knowledge_bases WHERE knowledge_base_id = ?) AND f.created_at >= ? AND f.created_at < ? AND f.rating < 0
+GROUP BY 1
+ORDER BY count DESC, reason`, q.KnowledgeBaseID, q.From, q.To).Scan(&reasons).Error
+	if err != nil {
+		return nil, err
+	}
+	return reasons, nil
+}
+
+// WorstRatedQueries returns the questions whose answers got the most thumbs
+// down. The question of an answer is the user message it replies to, above
+// the tool calls that led to the answer.
+func WorstRatedQueries(q FeedbackReportQuery) ([]RatedQuery, error) {
+	var queries []RatedQuery
+	err := services.DB.Raw(`
+WITH RECURSIVE ancestors AS (
+	SELECT f.id AS feedback_id, m.id, m.parent_id, m.role, m.message
+	FROM message_feedbacks f
+	JOIN chat_messages a ON a.id = f.message_id
+	JOIN chat_messages m ON m.id = a.parent_id
+	WHERE f.id IN (SELECT message_feedback_id FROM message_feedback_knowledge_bases WHERE knowledge_base_id = ?) AND f.created_at >= ? AND f.created_at < ?
+	UNION ALL
+	SELECT an.feedback_id, m.id, m.parent_id, m.role, m.message
+	FROM ancestors an JOIN chat_messages m ON m.id = an.parent_id
+	WHERE an.role IN ('tool', 'assistant')
+)
+SELECT q.message AS query,
+	COUNT(*) FILTER (WHERE f.rating < 0) AS down,
+	COUNT(*) FILTER (WHERE f.rating > 0) AS up,
+	(ARRAY_AGG(f.comment ORDER BY f.updated_at DESC) FILTER (WHERE f.comment <> ''))[1] AS last_comment,
+	MAX(f.updated_at) AS last_rated_at
+FROM message_feedbacks f
+JOIN ancestors q ON q.feedback_id = f.id AND q.role = 'user'
+GROUP BY q.message
+HAVING COUNT(*) FILTER (WHERE f.rating < 0) > 0
+ORDER BY down DESC, up, last_rated_at DESC
+LIMIT ?`, q.KnowledgeBaseID, q.From, q.To, q.Limit).Scan(&queries).Error
+	if err != nil {
+		return nil, err
+	}
+	return queries, nil
+}
+
+// DocumentsInBadAnswers returns the knowledge base's documents cited by the
+// most answers rated thumbs down, with how often answers citing them were
+// rated up.
+func DocumentsInBadAnswers(q FeedbackReportQuery) ([]CitedDocument, error) {
+	var documents []CitedDocument
+	err := services.DB.Raw(`
+SELECT cited.document_id,
+	COALESCE(d.name, MAX(cited.document_name), '') AS document_name,
+	COUNT(DISTINCT cited.message_id) FILTER (WHERE cited.rating < 0) AS down,
+	COUNT(DISTINCT cited.message_id) FILTER (WHERE cited.rating > 0) AS up
+FROM (
+	SELECT f.message_id, f.rating, (c->>'document_id')::bigint AS document_id, c->>'document_name' AS document_name
+	FROM message_feedbacks f
+	JOIN chat_messages a ON a.id = f.message_id
+	CROSS JOIN LATERAL jsonb_array_elements(CASE WHEN jsonb_typeof(a.citations) = 'array' THEN a.citations ELSE '[]'::jsonb END) c
+	WHERE f.id IN (SELECT message_feedback_id FROM message_feedback_knowledge_bases WHERE knowledge_base_id = ?) AND f.created_at >= ? AND f.created_at < ?
+		AND (c->>'knowledge_base_id')::bigint = ?
+) cited
+LEFT JOIN documents d ON d.id = cited.document_id
+GROUP BY cited.document_id, d.name
+HAVING COUNT(DISTINCT cited.message_id) FILTER (WHERE cited.rating < 0) > 0
+ORDER BY down DESC, up
+LIMIT ?`, q.KnowledgeBaseID, q.From, q.To, q.KnowledgeBaseID, q.Limit).Scan(&documents).Error
+	if err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"backend/internal/services"
+)
+
+// SourceSyncRun records one sync of a document source. The worker creates and
+// completes the rows; they make up the sync history of a knowledge base.
+type SourceSyncRun struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	SourceID        uint       `gorm:"index;not null" json:"source_id"`
+	KnowledgeBaseID uint       `gorm:"index;not null" json:"knowledge_base_id"`
+	Trigger         string     `gorm:"size:20" json:"trigger"`                  // "manual" | "scheduled"
+	Status          string     `gorm:"size:20;default:'running'" json:"status"` // "running" | "done" | "failed"
+	CreatedCount    int        `json:"created_count"`
+	UpdatedCount    int        `json:"updated_count"`
+	UnchangedCount  int        `json:"unchanged_count"`
+	DeletedCount    int        `json:"deleted_count"`
+	Error           string     `gorm:"type:text" json:"error,omitempty"`
+	StartedAt       time.Time  `json:"started_at"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+}
+
+// ListSourceSyncRuns returns the most recent sync runs of a knowledge base,
+// optionally restricted to one source.
+func ListSourceSyncRuns(kbID uint, sourceID uint, limit int) ([]SourceSyncRun, error) {
+	var runs []SourceSyncRun
+	q := services.DB.Where("knowledge_base_id = ?", kbID)
+	if sourceID != 0 {
+		q = q.Where("source_id = ?", sourceID)
+	}
+	err := q.Order("id DESC").Limit(limit).Find(&runs).Error
+	return runs, err
+}
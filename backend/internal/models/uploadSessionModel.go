@@ -0,0 +1,72 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"backend/internal/services"
+)
+
+// UploadSession tracks a direct-to-MinIO upload from the moment the client
+// asks for presigned URLs until the object is finalized into a document.
+type UploadSession struct {
+	ID              string    `gorm:"primaryKey;size:36" json:"id"`
+	UserID          uint      `gorm:"index;not null" json:"user_id"`
+	KnowledgeBaseID uint      `gorm:"index;not null" json:"knowledge_base_id"`
+	DocumentID      *uint     `json:"document_id,omitempty"` // set when uploading a new version
+	FileName        string    `gorm:"size:255;not null" json:"file_name"`
+	FileType        string    `gorm:"size:50" json:"file_type"`
+	Description     string    `gorm:"size:255" json:"description"`
+	Metadata        JSON      `gorm:"type:jsonb" json:"metadata,omitempty"`
+	ContentType     string    `gorm:"size:255" json:"content_type"`
+	ContentHash     string    `gorm:"size:64" json:"content_hash"` // SHA-256 declared by the client, verified by the worker
+	OnDuplicate     string    `gorm:"size:20" json:"on_duplicate"`
+	Size            int64     `json:"size"`
+	ObjectName      string    `gorm:"size:1024" json:"object_name"`
+	UploadID        string    `gorm:"size:255" json:"upload_id,omitempty"` // empty for single PUT uploads
+	PartSize        int64     `json:"part_size,omitempty"`
+	PartCount       int       `json:"part_count,omitempty"`
+	Status          string    `gorm:"size:20;default:'pending';index" json:"status"` // "pending" | "completed" | "aborted" | "expired"
+	ExpiresAt       time.Time `json:"expires_at"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+func CreateUploadSession(s *UploadSession) error {
+	return services.DB.Create(s).Error
+}
+
+func GetUploadSessionByID(id string) (*UploadSession, error) {
+	var s UploadSession
+	err := services.DB.First(&s, "id = ?", id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+func UpdateUploadSession(s *UploadSession) error {
+	return services.DB.Save(s).Error
+}
+
+// ListExpiredUploadSessions returns up to limit pending sessions that
+// expired before the given time.
+func ListExpiredUploadSessions(before time.Time, limit int) ([]UploadSession, error) {
+	var sessions []UploadSession
+	err := services.DB.Where("status = ? AND expires_at < ?", "pending", before).
+		Order("expires_at").Limit(limit).Find(&sessions).Error
+	return sessions, err
+}
+
+// ExpireUploadSession marks a pending session expired. It reports false when
+// the session is no longer pending, e.g. completed or swept concurrently.
+func ExpireUploadSession(id string) (bool, error) {
+	result := services.DB.Model(&UploadSession{}).Where("id = ? AND status = ?", id, "pending").
+		Updates(map[string]interface{}{"status": "expired", "updated_at": time.Now()})
+	return result.RowsAffected > 0, result.Error
+}
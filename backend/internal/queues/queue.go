@@ -9,18 +9,65 @@ import (
     "github.com/hibiken/asynq"
 )
 
-const TaskTypeProcessDocument = "document:process"
+const (
+    TaskTypeProcessDocument  = "document:process"
+    TaskTypeActivateDocument = "document:activate"
+    TaskTypeImportArchive    = "archive:import"
+    TaskTypeSyncSource       = "source:sync"
+    TaskTypeUpdateMetadata   = "document:metadata"
+    TaskTypeGenerateEvalSet  = "eval:generate"
+)
 
 type ProcessDocumentPayload struct {
     KnowledgeBaseID uint   `json:"knowledge_base_id"`
     DocumentID      uint   `json:"document_id"`
+    Version         int    `json:"version"`
     Description     string `json:"description"`
     Bucket          string `json:"bucket"`
     ObjectName      string `json:"object_name"`
     FileType        string `json:"file_type"`
 }
 
-func EnqueueProcessDocument(kbID uint, documentID uint, description string, bucket, objectName string, fileType string) error {
+// ActivateDocumentPayload asks the worker to make one version of a document
+// the only searchable one.
+type ActivateDocumentPayload struct {
+    DocumentID uint `json:"document_id"`
+    Version    int  `json:"version"`
+}
+
+// ImportArchivePayload asks the worker to expand an uploaded archive into
+// documents of the knowledge base.
+type ImportArchivePayload struct {
+    ImportID        uint   `json:"import_id"`
+    KnowledgeBaseID uint   `json:"knowledge_base_id"`
+    UserID          uint   `json:"user_id"`
+    Bucket          string `json:"bucket"`
+    ObjectName      string `json:"object_name"`
+    FileName        string `json:"file_name"`
+}
+
+// UpdateMetadataPayload asks the worker to copy a document's name and
+// metadata into its indexed chunks.
+type UpdateMetadataPayload struct {
+    DocumentID uint `json:"document_id"`
+}
+
+// SyncSourcePayload asks the worker to fetch the documents of a source.
+type SyncSourcePayload struct {
+    SourceID uint   `json:"source_id"`
+    Trigger  string `json:"trigger"` // "manual" | "scheduled"
+}
+
+// GenerateEvalSetPayload asks the worker to write Count questions from
+// chunks of the knowledge base, optionally only of DocumentIDs, into a set.
+type GenerateEvalSetPayload struct {
+    SetID           uint   `json:"set_id"`
+    KnowledgeBaseID uint   `json:"knowledge_base_id"`
+    Count           int    `json:"count"`
+    DocumentIDs     []uint `json:"document_ids,omitempty"`
+}
+
+func EnqueueProcessDocument(kbID uint, documentID uint, version int, description string, bucket, objectName string, fileType string) error {
     redisAddr := config.LoadConfig().RedisAddr
 
     client := asynq.NewClient(asynq.RedisClientOpt{Addr: redisAddr})
@@ -29,6 +76,7 @@ func EnqueueProcessDocument(kbID uint, documentID uint, description string, buck
     payload := ProcessDocumentPayload{
         KnowledgeBaseID: kbID,
         DocumentID:      documentID,
+        Version:         version,
         Description:     description,
         Bucket:          bucket,
         ObjectName:      objectName,
@@ -46,3 +94,101 @@ func EnqueueProcessDocument(kbID uint, documentID uint, description string, buck
     }
     return nil
 }
+
+
+func EnqueueActivateDocument(documentID uint, version int) error {
+    redisAddr := config.LoadConfig().RedisAddr
+
+    client := asynq.NewClient(asynq.RedisClientOpt{Addr: redisAddr})
+    defer client.Close()
+
+    b, err := json.Marshal(ActivateDocumentPayload{DocumentID: documentID, Version: version})
+    if err != nil {
+        return err
+    }
+
+    task := asynq.NewTask(TaskTypeActivateDocument, b)
+    _, err = client.EnqueueContext(context.Background(), task)
+    if err != nil {
+        return fmt.Errorf("enqueue failed: %w", err)
+    }
+    return nil
+}
+
+func EnqueueImportArchive(payload ImportArchivePayload) error {
+    redisAddr := config.LoadConfig().RedisAddr
+
+    client := asynq.NewClient(asynq.RedisClientOpt{Addr: redisAddr})
+    defer client.Close()
+
+    b, err := json.Marshal(payload)
+    if err != nil {
+        return err
+    }
+
+    task := asynq.NewTask(TaskTypeImportArchive, b)
+    _, err = client.EnqueueContext(context.Background(), task)
+    if err != nil {
+        return fmt.Errorf("enqueue failed: %w", err)
+    }
+    return nil
+}
+
+func EnqueueSyncSource(sourceID uint) error {
+    redisAddr := config.LoadConfig().RedisAddr
+
+    client := asynq.NewClient(asynq.RedisClientOpt{Addr: redisAddr})
+    defer client.Close()
+
+    b, err := json.Marshal(SyncSourcePayload{SourceID: sourceID, Trigger: "manual"})
+    if err != nil {
+        return err
+    }
+
+    task := asynq.NewTask(TaskTypeSyncSource, b)
+    _, err = client.EnqueueContext(context.Background(), task)
+    if err != nil {
+        return fmt.Errorf("enqueue failed: %w", err)
+    }
+    return nil
+}
+
+// EnqueueUpdateMetadata asks the worker to copy a document's metadata into the
+// payload of its indexed chunks.
+func EnqueueUpdateMetadata(documentID uint) error {
+    redisAddr := config.LoadConfig().RedisAddr
+
+    client := asynq.NewClient(asynq.RedisClientOpt{Addr: redisAddr})
+    defer client.Close()
+
+    b, err := json.Marshal(UpdateMetadataPayload{DocumentID: documentID})
+    if err != nil {
+        return err
+    }
+
+    task := asynq.NewTask(TaskTypeUpdateMetadata, b)
+    _, err = client.EnqueueContext(context.Background(), task)
+    if err != nil {
+        return fmt.Errorf("enqueue failed: %w", err)
+    }
+    return nil
+}
+
+func EnqueueGenerateEvalSet(payload GenerateEvalSetPayload) error {
+    redisAddr := config.LoadConfig().RedisAddr
+
+    client := asynq.NewClient(asynq.RedisClientOpt{Addr: redisAddr})
+    defer client.Close()
+
+    b, err := json.Marshal(payload)
+    if err != nil {
+        return err
+    }
+
+    task := asynq.NewTask(TaskTypeGenerateEvalSet, b)
+    _, err = client.EnqueueContext(context.Background(), task)
+    if err != nil {
+        return fmt.Errorf("enqueue failed: %w", err)
+    }
+    return nil
+}
@@ -0,0 +1,257 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+
+	"backend/internal/services"
+	"backend/internal/tools"
+)
+
+// ChatRequest is one user turn. Without a knowledge base, or with ModeNone,
+// the model answers from the conversation alone. Summary is the running
+// summary of the turns that precede History.
+type ChatRequest struct {
+	// KnowledgeBaseID is the knowledge base whose settings apply.
+	// KnowledgeBaseIDs, when set, are all knowledge bases searched, with
+	// KnowledgeBaseNames used to label their sources.
+	KnowledgeBaseID    *uint
+	KnowledgeBaseIDs   []uint
+	KnowledgeBaseNames map[uint]string
+	Summary            string
+	History            []services.LLMMessage
+	Question           string
+	Filter             Filter
+	TopK               int
+	Mode               string
+	// Model and Temperature override the LLM defaults for the answer.
+	Model       string
+	Temperature *float64
+	// Rewrite is the query rewriting strategy, see RewriteCondense.
+	Rewrite string
+	// Template is the knowledge base's system prompt template, empty for the
+	// default. UserName and KnowledgeBaseName are available to it.
+	Template          string
+	UserName          string
+	KnowledgeBaseName string
+	Guardrails        Guardrails
+	// Tools are offered to the model, which may call them for up to
+	// MaxToolSteps rounds before answering. SearchTool adds a tool that
+	// searches the knowledge bases with the model's own queries.
+	Tools        []tools.Tool
+	SearchTool   bool
+	MaxToolSteps int
+}
+
+// retrieves reports whether the turn is answered from retrieved context.
+func (r ChatRequest) retrieves() bool {
+	return len(r.searchScopes()) > 0 && r.Mode != ModeNone
+}
+
+// searchScopes returns the knowledge bases to search.
+func (r ChatRequest) searchScopes() []uint {
+	if len(r.KnowledgeBaseIDs) > 0 {
+		return r.KnowledgeBaseIDs
+	}
+	if r.KnowledgeBaseID != nil {
+		return []uint{*r.KnowledgeBaseID}
+	}
+	return nil
+}
+
+// ChatResult is the generated answer and the chunks it was given.
+// SearchQueries are the queries the chunks were retrieved with. Grounding is
+// set when guardrails apply, i.e. for turns answered from retrieved context.
+// ToolSteps are the tool calls the model made before answering, in order.
+type ChatResult struct {
+	Answer           string
+	Sources          []Source
+	SearchQueries    []string
+	Grounding        *Grounding
+	ToolSteps        []ToolStep
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// Pipeline answers questions with retrieval-augmented generation.
+type Pipeline struct {
+	retriever *Retriever
+	llm       *services.LLMService
+}
+
+func NewPipeline(retriever *Retriever, llm *services.LLMService) *Pipeline {
+	return &Pipeline{retriever: retriever, llm: llm}
+}
+
+func (p *Pipeline) Retriever() *Retriever {
+	return p.retriever
+}
+
+// Answer retrieves context for the question and asks the model to answer it.
+// With a knowledge base, the guardrails of req decide whether the model is
+// asked at all and check the answer against the sources.
+func (p *Pipeline) Answer(ctx context.Context, req ChatRequest) (*ChatResult, error) {
+	turn, err := p.Prepare(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return p.Generate(ctx, req, turn)
+}
+
+// PreparedTurn is the retrieved context of a question and the messages that
+// ask the model to answer it.
+type PreparedTurn struct {
+	Messages      []services.LLMMessage
+	Sources       []Source
+	SearchQueries []string
+}
+
+// Prepare retrieves context for the question and builds the messages Answer
+// sends to the model, without generating an answer.
+func (p *Pipeline) Prepare(ctx context.Context, req ChatRequest) (*PreparedTurn, error) {
+	turn := &PreparedTurn{}
+	if req.retrieves() {
+		turn.SearchQueries = p.rewriteQueries(ctx, req.Rewrite, req.Summary, req.History, req.Question)
+		var err error
+		turn.Sources, err = p.retrieveAll(ctx, turn.SearchQueries, req)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	turn.Messages, err = BuildMessages(req, turn.Sources)
+	if err != nil {
+		return nil, err
+	}
+	return turn, nil
+}
+
+// Generate answers a prepared turn, applying the guardrails of req. With
+// tools, the fallback answer is skipped, as the tools may find what
+// retrieval did not, and the grounding check accepts tool results as
+// support.
+func (p *Pipeline) Generate(ctx context.Context, req ChatRequest, turn *PreparedTurn) (*ChatResult, error) {
+	sources, queries := turn.Sources, turn.SearchQueries
+	registry := p.toolRegistry(req, &sources)
+	var grounding *Grounding
+	if req.retrieves() {
+		grounding = &Grounding{MinRelevance: req.Guardrails.MinRelevance}
+		grounding.TopRelevance, _ = topRelevance(sources)
+		if _, below := req.Guardrails.belowThreshold(sources); below && registry.Len() == 0 {
+			grounding.Fallback = true
+			return &ChatResult{
+				Answer:        req.Guardrails.fallbackAnswer(req.Question),
+				Sources:       []Source{},
+				SearchQueries: queries,
+				Grounding:     grounding,
+			}, nil
+		}
+	}
+
+	resp, steps, err := p.completeWithTools(ctx, req, turn.Messages, registry)
+	if err != nil {
+		return nil, fmt.Errorf("generation failed: %w", err)
+	}
+	answer := resp.Content
+	evidence := append(sources[:len(sources):len(sources)], toolEvidence(steps)...)
+	if grounding != nil && len(evidence) > 0 && req.Guardrails.GroundingCheck != "" && req.Guardrails.GroundingCheck != GroundingOff {
+		answer = p.checkGrounding(ctx, req.Guardrails, req.Question, answer, evidence, grounding)
+	}
+	return &ChatResult{
+		Answer:           answer,
+		Sources:          sources,
+		SearchQueries:    queries,
+		Grounding:        grounding,
+		ToolSteps:        steps,
+		Model:            resp.Model,
+		PromptTokens:     resp.PromptTokens,
+		CompletionTokens: resp.CompletionTokens,
+	}, nil
+}
+
+// BuildMessages renders the system prompt and puts it in front of the history
+// and the question.
+func BuildMessages(req ChatRequest, sources []Source) ([]services.LLMMessage, error) {
+	system, err := renderSystemPrompt(req, sources)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]services.LLMMessage, 0, len(req.History)+2)
+	messages = append(messages, services.LLMMessage{Role: "system", Content: system})
+	messages = append(messages, req.History...)
+	messages = append(messages, services.LLMMessage{Role: "user", Content: req.Question})
+	return messages, nil
+}
+
+// retrieveAll searches every knowledge base of req and federates the
+// results, labelling each source with its knowledge base.
+func (p *Pipeline) retrieveAll(ctx context.Context, queries []string, req ChatRequest) ([]Source, error) {
+	scopes := req.searchScopes()
+	rankings := make([][]Source, 0, len(scopes))
+	for _, kbID := range scopes {
+		sources, err := p.retrieve(ctx, queries, SearchOptions{
+			KnowledgeBaseID: kbID,
+			Filter:          req.Filter,
+			TopK:            req.TopK,
+			Mode:            req.Mode,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(scopes) == 1 {
+			return sources, nil
+		}
+		for i := range sources {
+			sources[i].KnowledgeBaseID = kbID
+			sources[i].KnowledgeBaseName = req.KnowledgeBaseNames[kbID]
+		}
+		rankings = append(rankings, sources)
+	}
+	limit := req.TopK
+	if limit <= 0 {
+		limit = 5
+	}
+	return federate(limit, rankings...), nil
+}
+
+// retrieve searches for every query and fuses the rankings.
+func (p *Pipeline) retrieve(ctx context.Context, queries []string, opts SearchOptions) ([]Source, error) {
+	if len(queries) == 1 {
+		return p.retriever.Search(ctx, queries[0], opts)
+	}
+	rankings := make([][]Source, 0, len(queries))
+	for _, q := range queries {
+		sources, err := p.retriever.Search(ctx, q, opts)
+		if err != nil {
+			return nil, err
+		}
+		rankings = append(rankings, sources)
+	}
+	limit := opts.TopK
+	if limit <= 0 {
+		limit = 5
+	}
+	return fuseRankings(limit, rankings...), nil
+}
+
+func sourceLabel(s Source) string {
+	label := s.DocumentName
+	if label == "" {
+		label = fmt.Sprintf("document %d", s.DocumentID)
+	}
+	if s.KnowledgeBaseName != "" {
+		label = s.KnowledgeBaseName + ": " + label
+	}
+	if s.ChunkType == "summary" {
+		label += ", summary"
+	}
+	if s.Page > 0 {
+		label += fmt.Sprintf(", page %d", s.Page)
+	}
+	if s.Symbol != "" {
+		label += ", " + s.Symbol
+	}
+	return label
+}
@@ -0,0 +1,68 @@
+package rag
+
+import "sort"
+
+// federate merges the rankings of several knowledge bases into one list of
+// at most limit sources. Scores are not comparable across knowledge bases,
+// keyword ranks and fused scores in particular depend on the size and
+// wording of each collection, so sources are compared by their relevance to
+// the query where a vector match gave one. A keyword-only match of a hybrid
+// ranking has none; it gets its ranking's best relevance scaled by its
+// min-max normalized score, so it ranks no higher than the knowledge base's
+// best vector match, and a knowledge base with weak matches cannot outrank
+// a strong one just because its own best match is normalized to the top.
+// Only when no ranking knows any relevance, in keyword mode, are the
+// normalized scores compared directly; then every knowledge base's best
+// match scores 1, and sources rank by their standing within their own
+// knowledge base rather than by how well they match.
+func federate(limit int, rankings ...[]Source) []Source {
+	relevanceKnown := false
+	for _, ranking := range rankings {
+		if _, known := topRelevance(ranking); known {
+			relevanceKnown = true
+			break
+		}
+	}
+
+	merged := make([]Source, 0, limit*len(rankings))
+	for _, ranking := range rankings {
+		if len(ranking) == 0 {
+			continue
+		}
+		lo, hi := ranking[0].Score, ranking[0].Score
+		for _, s := range ranking {
+			if s.Score < lo {
+				lo = s.Score
+			}
+			if s.Score > hi {
+				hi = s.Score
+			}
+		}
+		top, _ := topRelevance(ranking)
+		for _, s := range ranking {
+			normalized := 1.0
+			if hi > lo {
+				normalized = (s.Score - lo) / (hi - lo)
+			}
+			switch {
+			case s.Relevance > 0:
+				s.Score = s.Relevance
+			case relevanceKnown:
+				s.Score = normalized * top
+			default:
+				s.Score = normalized
+			}
+			merged = append(merged, s)
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		if merged[i].Score != merged[j].Score {
+			return merged[i].Score > merged[j].Score
+		}
+		return merged[i].Relevance > merged[j].Relevance
+	})
+	if len(merged) > limit {
+		merged = merged[:limit]
+	}
+	return merged
+}
@@ -0,0 +1,64 @@
+package rag
+
+import (
+	"slices"
+	"testing"
+)
+
+func chunkIDs(sources []Source) []string {
+	ids := make([]string, len(sources))
+	for i, s := range sources {
+		ids[i] = s.ChunkID
+	}
+	return ids
+}
+
+func TestFederate(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		rankings [][]Source
+		want     []string
+	}{
+		{
+			// min-max normalization alone would put weak1 on top
+			name:  "vector",
+			limit: 3,
+			rankings: [][]Source{
+				{{ChunkID: "weak1", Score: 0.3, Relevance: 0.3}, {ChunkID: "weak2", Score: 0.29, Relevance: 0.29}},
+				{{ChunkID: "strong1", Score: 0.9, Relevance: 0.9}, {ChunkID: "strong2", Score: 0.85, Relevance: 0.85}, {ChunkID: "strong3", Score: 0.8, Relevance: 0.8}},
+			},
+			want: []string{"strong1", "strong2", "strong3"},
+		},
+		{
+			// fused scores; kw is a keyword-only match of the strong base
+			name:  "hybrid",
+			limit: 4,
+			rankings: [][]Source{
+				{{ChunkID: "weak1", Score: 0.032, Relevance: 0.4}, {ChunkID: "weak2", Score: 0.016}},
+				{{ChunkID: "strong1", Score: 0.033, Relevance: 0.9}, {ChunkID: "kw", Score: 0.0325}, {ChunkID: "strong2", Score: 0.016, Relevance: 0.7}},
+			},
+			want: []string{"strong1", "kw", "strong2", "weak1"},
+		},
+		{
+			name:  "keyword",
+			limit: 3,
+			rankings: [][]Source{
+				{{ChunkID: "a1", Score: 0.5}, {ChunkID: "a2", Score: 0.1}},
+				{{ChunkID: "b1", Score: 0.04}, {ChunkID: "b2", Score: 0.03}, {ChunkID: "b3", Score: 0.02}},
+			},
+			want: []string{"a1", "b1", "b2"},
+		},
+		{
+			name:     "empty ranking",
+			limit:    5,
+			rankings: [][]Source{nil, {{ChunkID: "a", Score: 1, Relevance: 0.5}}},
+			want:     []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		if got := chunkIDs(federate(tt.limit, tt.rankings...)); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: federate = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,413 @@
+package rag
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Filter is a Qdrant filter clause.
+type Filter = map[string]interface{}
+
+// BuiltinFields are chunk payload fields that filters can use next to the
+// document metadata. Metadata keys may not shadow them.
+var BuiltinFields = map[string]bool{
+	"document_id":       true,
+	"document_name":     true,
+	"file_type":         true,
+	"detected_language": true,
+	"page":              true,
+	"source_url":        true,
+	"symbol":            true,
+}
+
+// metadataKeyPattern is the grammar of metadata keys: a letter or underscore
+// followed by letters, digits and underscores, in any script. Dots are not
+// allowed since Qdrant reads them as a path into nested objects.
+var metadataKeyPattern = regexp.MustCompile(`^[\p{L}_][\p{L}\p{N}_]{0,63}$`)
+
+// ValidMetadataKey reports whether name can be used as a metadata key, and
+// so be named in a filter.
+func ValidMetadataKey(name string) bool {
+	return metadataKeyPattern.MatchString(name)
+}
+
+const (
+	maxFilterLength = 2000
+	maxFilterDepth  = 20
+)
+
+// ParseFilter compiles a filter expression such as
+//
+//	department = "HR" AND (year >= 2024 OR tags IN ["policy", "handbook"])
+//
+// into a Qdrant filter. Identifiers name document metadata keys unless they
+// are one of the BuiltinFields. Supported operators are =, !=, <, <=, >, >=,
+// IN and NOT IN; values are strings, numbers, true and false, and strings in
+// the form 2006-01-02 or RFC 3339 can be compared as dates. AND binds tighter
+// than OR, NOT negates the expression that follows it. An empty expression
+// yields a nil filter.
+func ParseFilter(expr string) (Filter, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	if len(expr) > maxFilterLength {
+		return nil, fmt.Errorf("filter is longer than %d characters", maxFilterLength)
+	}
+	tokens, err := lexFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	f, err := p.or(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+	}
+	return f, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func lexFilter(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '\'':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(s) && s[j] != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				sb.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			tokens = append(tokens, token{tokString, sb.String(), i})
+			i = j + 1
+		case c == '-' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(s) && (s[j] == '.' || (s[j] >= '0' && s[j] <= '9')) {
+				j++
+			}
+			tokens = append(tokens, token{tokNumber, s[i:j], i})
+			i = j
+		case r == '_' || unicode.IsLetter(r):
+			j := i + size
+			for j < len(s) {
+				r, size := utf8.DecodeRuneInString(s[j:])
+				if r != '_' && r != '.' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				j += size
+			}
+			tokens = append(tokens, token{tokIdent, s[i:j], i})
+			i = j
+		case c == '=' || c == '!' || c == '<' || c == '>':
+			j := i + 1
+			if j < len(s) && s[j] == '=' {
+				j++
+			}
+			op := s[i:j]
+			if op == "!" {
+				return nil, fmt.Errorf("unexpected '!' at position %d", i)
+			}
+			if op == "==" {
+				op = "="
+			}
+			tokens = append(tokens, token{tokOp, op, i})
+			i = j
+		case strings.IndexByte("()[],", c) >= 0:
+			tokens = append(tokens, token{tokPunct, string(c), i})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %d", r, i)
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(s)}), nil
+}
+
+type filterParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *filterParser) peek() token { return p.tokens[p.pos] }
+
+func (p *filterParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// keyword consumes the next token when it is the given keyword.
+func (p *filterParser) keyword(word string) bool {
+	if t := p.peek(); t.kind == tokIdent && strings.EqualFold(t.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) punct(c string) bool {
+	if t := p.peek(); t.kind == tokPunct && t.text == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) or(depth int) (Filter, error) {
+	if depth > maxFilterDepth {
+		return nil, fmt.Errorf("filter is nested too deeply")
+	}
+	left, err := p.and(depth)
+	if err != nil {
+		return nil, err
+	}
+	clauses := []interface{}{left}
+	for p.keyword("OR") {
+		right, err := p.and(depth)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, right)
+	}
+	if len(clauses) == 1 {
+		return left, nil
+	}
+	return Filter{"should": clauses}, nil
+}
+
+func (p *filterParser) and(depth int) (Filter, error) {
+	left, err := p.not(depth)
+	if err != nil {
+		return nil, err
+	}
+	clauses := []interface{}{left}
+	for p.keyword("AND") {
+		right, err := p.not(depth)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, right)
+	}
+	if len(clauses) == 1 {
+		return left, nil
+	}
+	return Filter{"must": clauses}, nil
+}
+
+func (p *filterParser) not(depth int) (Filter, error) {
+	if p.keyword("NOT") {
+		inner, err := p.not(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return Filter{"must_not": []interface{}{inner}}, nil
+	}
+	if p.punct("(") {
+		inner, err := p.or(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if !p.punct(")") {
+			t := p.peek()
+			return nil, fmt.Errorf("expected ')' at position %d", t.pos)
+		}
+		return inner, nil
+	}
+	return p.comparison()
+}
+
+func (p *filterParser) comparison() (Filter, error) {
+	t := p.next()
+	if t.kind != tokIdent || isFilterKeyword(t.text) {
+		return nil, fmt.Errorf("expected a field name at position %d", t.pos)
+	}
+	key, ok := payloadKey(t.text)
+	if !ok {
+		return nil, fmt.Errorf("invalid field name %q at position %d", t.text, t.pos)
+	}
+
+	negated := p.keyword("NOT")
+	if p.keyword("IN") {
+		values, err := p.list()
+		if err != nil {
+			return nil, err
+		}
+		if negated {
+			return Filter{"must": []interface{}{Filter{"key": key, "match": Filter{"except": values}}}}, nil
+		}
+		return Filter{"must": []interface{}{Filter{"key": key, "match": Filter{"any": values}}}}, nil
+	}
+	if negated {
+		return nil, fmt.Errorf("expected IN after NOT at position %d", p.peek().pos)
+	}
+
+	op := p.next()
+	if op.kind != tokOp {
+		return nil, fmt.Errorf("expected an operator after %s at position %d", t.text, op.pos)
+	}
+	value, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.text {
+	case "=", "!=":
+		cond := matchCondition(key, value)
+		if op.text == "!=" {
+			return Filter{"must_not": []interface{}{cond}}, nil
+		}
+		return Filter{"must": []interface{}{cond}}, nil
+	default:
+		bound, err := rangeBound(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %v", t.text, op.text, err)
+		}
+		name := map[string]string{"<": "lt", "<=": "lte", ">": "gt", ">=": "gte"}[op.text]
+		return Filter{"must": []interface{}{Filter{"key": key, "range": Filter{name: bound}}}}, nil
+	}
+}
+
+// list parses [v, ...] or (v, ...).
+func (p *filterParser) list() ([]interface{}, error) {
+	closing := ""
+	switch {
+	case p.punct("["):
+		closing = "]"
+	case p.punct("("):
+		closing = ")"
+	default:
+		return nil, fmt.Errorf("expected a list after IN at position %d", p.peek().pos)
+	}
+	var values []interface{}
+	for {
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if f, ok := v.(float64); ok {
+			if f != math.Trunc(f) {
+				return nil, fmt.Errorf("IN lists only hold strings and whole numbers")
+			}
+			v = int64(f)
+		}
+		if _, ok := v.(bool); ok {
+			return nil, fmt.Errorf("IN lists only hold strings and whole numbers")
+		}
+		values = append(values, v)
+		if p.punct(closing) {
+			return values, nil
+		}
+		if !p.punct(",") {
+			return nil, fmt.Errorf("expected ',' or '%s' at position %d", closing, p.peek().pos)
+		}
+	}
+}
+
+func (p *filterParser) value() (interface{}, error) {
+	t := p.next()
+	switch t.kind {
+	case tokString:
+		return t.text, nil
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", t.text, t.pos)
+		}
+		return f, nil
+	case tokIdent:
+		switch strings.ToLower(t.text) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return nil, fmt.Errorf("expected a value at position %d", t.pos)
+}
+
+// matchCondition compares for equality. Qdrant matches strings, integers and
+// booleans exactly; other numbers are matched with a closed range.
+func matchCondition(key string, value interface{}) Filter {
+	if f, ok := value.(float64); ok {
+		if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			return Filter{"key": key, "match": Filter{"value": int64(f)}}
+		}
+		return Filter{"key": key, "range": Filter{"gte": f, "lte": f}}
+	}
+	return Filter{"key": key, "match": Filter{"value": value}}
+}
+
+// rangeBound checks that a value can be compared: a number or a date, which
+// Qdrant compares as RFC 3339 timestamps.
+func rangeBound(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case string:
+		if t, err := time.Parse("2006-01-02", v); err == nil {
+			return t.Format(time.RFC3339), nil
+		}
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t.Format(time.RFC3339), nil
+		}
+		return nil, fmt.Errorf("only numbers and dates can be compared, got %q", v)
+	default:
+		return nil, fmt.Errorf("only numbers and dates can be compared")
+	}
+}
+
+// payloadKey maps a field name to its chunk payload key. Names that are
+// neither builtin nor a valid metadata key could never match and are
+// rejected.
+func payloadKey(name string) (string, bool) {
+	if BuiltinFields[name] {
+		return name, true
+	}
+	name = strings.TrimPrefix(name, "metadata.")
+	if !ValidMetadataKey(name) {
+		return "", false
+	}
+	return "metadata." + name, true
+}
+
+func isFilterKeyword(s string) bool {
+	switch strings.ToUpper(s) {
+	case "AND", "OR", "NOT", "IN", "TRUE", "FALSE":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package rag
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{``, `null`},
+		{`document_id = 5`, `{"must":[{"key":"document_id","match":{"value":5}}]}`},
+		{`a != "b"`, `{"must_not":[{"key":"metadata.a","match":{"value":"b"}}]}`},
+		{`größe = 1`, `{"must":[{"key":"metadata.größe","match":{"value":1}}]}`},
+		{`部門 = "HR"`, `{"must":[{"key":"metadata.部門","match":{"value":"HR"}}]}`},
+		{`metadata.year = 2024`, `{"must":[{"key":"metadata.year","match":{"value":2024}}]}`},
+		{`department = "HR" AND (year >= 2024 OR tags IN ["policy", "handbook"])`,
+			`{"must":[{"must":[{"key":"metadata.department","match":{"value":"HR"}}]},{"should":[{"must":[{"key":"metadata.year","range":{"gte":2024}}]},{"must":[{"key":"metadata.tags","match":{"any":["policy","handbook"]}}]}]}]}`},
+		{`NOT page < 3`, `{"must_not":[{"must":[{"key":"page","range":{"lt":3}}]}]}`},
+	}
+	for _, tt := range tests {
+		f, err := ParseFilter(tt.expr)
+		if err != nil {
+			t.Errorf("ParseFilter(%q): %v", tt.expr, err)
+			continue
+		}
+		got, _ := json.Marshal(f)
+		if string(got) != tt.want {
+			t.Errorf("ParseFilter(%q) = %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`a = 1 €`, `unexpected character '€' at position 6`},
+		{`x IN [1,2`, `expected ',' or ']' at position 9`},
+		{`"a`, `unterminated string at position 0`},
+		// metadata keys have no dots, so such a filter could never match
+		{`a.b = 1`, `invalid field name "a.b" at position 0`},
+		{`metadata.a.b = 1`, `invalid field name "metadata.a.b" at position 0`},
+	}
+	for _, tt := range tests {
+		_, err := ParseFilter(tt.expr)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("ParseFilter(%q) error = %v, want %q", tt.expr, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Grounding checks, configured per knowledge base.
+const (
+	// GroundingOff keeps answers as generated.
+	GroundingOff = "off"
+	// GroundingFlag records the sentences the cited passages do not support.
+	GroundingFlag = "flag"
+	// GroundingStrip also removes them from the answer.
+	GroundingStrip = "strip"
+)
+
+// defaultFallbackAnswers are sent when retrieval finds nothing relevant
+// enough and the knowledge base does not define its own fallback.
+var defaultFallbackAnswers = map[string]string{
+	"en": "I don't know. I couldn't find anything in the knowledge base that answers this question.",
+	"vi": "Tôi không biết. Tôi không tìm thấy thông tin nào trong cơ sở tri thức để trả lời câu hỏi này.",
+}
+
+const groundingPrompt = `You check whether an answer is supported by the passages it was written from.
+For every numbered sentence of the answer, decide whether the passages it cites state what it claims; a sentence without citations may rely on any passage.
+Sentences that make no factual claim, such as greetings, transitions or saying that something is unknown, are supported.
+Reply with JSON only, in the form {"unsupported": [{"sentence": 2, "reason": "..."}]}, listing only unsupported sentences.`
+
+// Guardrails keep answers grounded in the knowledge base.
+type Guardrails struct {
+	// MinRelevance is the similarity the best retrieved chunk must reach for
+	// the model to be asked at all; below it FallbackAnswer is sent. Zero
+	// disables the threshold. It only applies when the similarity is known,
+	// i.e. not to keyword search alone.
+	MinRelevance   float64
+	FallbackAnswer string
+	// GroundingCheck is one of GroundingOff, GroundingFlag or GroundingStrip.
+	GroundingCheck string
+}
+
+// Grounding records what the guardrails did to an answer.
+type Grounding struct {
+	TopRelevance float64 `json:"top_relevance,omitempty"`
+	MinRelevance float64 `json:"min_relevance,omitempty"`
+	// Fallback is set when the answer is the fallback instead of a generated
+	// one.
+	Fallback    bool               `json:"fallback,omitempty"`
+	Check       string             `json:"check,omitempty"`
+	Checked     bool               `json:"checked,omitempty"`
+	Unsupported []UnsupportedClaim `json:"unsupported,omitempty"`
+	Stripped    bool               `json:"stripped,omitempty"`
+	// Error is why the check could not be completed; the answer is then
+	// kept as generated.
+	Error string `json:"error,omitempty"`
+}
+
+// UnsupportedClaim is a sentence of an answer the cited passages do not
+// support.
+type UnsupportedClaim struct {
+	Sentence string `json:"sentence"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// topRelevance returns the best known similarity among sources.
+func topRelevance(sources []Source) (float64, bool) {
+	top, known := 0.0, false
+	for _, s := range sources {
+		if s.Relevance > 0 && (!known || s.Relevance > top) {
+			top, known = s.Relevance, true
+		}
+	}
+	return top, known
+}
+
+// belowThreshold reports whether retrieval found nothing relevant enough to
+// answer from.
+func (g Guardrails) belowThreshold(sources []Source) (float64, bool) {
+	if g.MinRelevance <= 0 {
+		return 0, false
+	}
+	if len(sources) == 0 {
+		return 0, true
+	}
+	top, known := topRelevance(sources)
+	return top, known && top < g.MinRelevance
+}
+
+// fallbackAnswer is the configured fallback or the default one in the
+// language of the question.
+func (g Guardrails) fallbackAnswer(question string) string {
+	if strings.TrimSpace(g.FallbackAnswer) != "" {
+		return g.FallbackAnswer
+	}
+	if answer, ok := defaultFallbackAnswers[DetectLanguage(question)]; ok {
+		return answer
+	}
+	return defaultFallbackAnswers["en"]
+}
+
+// checkGrounding asks the model which sentences of answer the sources do not
+// support and, for GroundingStrip, removes them. It returns the answer to
+// keep. A failing check is recorded in grounding and keeps the answer.
+func (p *Pipeline) checkGrounding(ctx context.Context, g Guardrails, question, answer string, sources []Source, grounding *Grounding) string {
+	grounding.Check = g.GroundingCheck
+	segments := splitSentences(answer)
+	var sentences []int
+	for i, seg := range segments {
+		if isSentence(seg) {
+			sentences = append(sentences, i)
+		}
+	}
+	if len(sentences) == 0 {
+		grounding.Checked = true
+		return answer
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Passages:\n")
+	sb.WriteString(contextText(sources))
+	sb.WriteString("\n\nAnswer:\n")
+	for n, i := range sentences {
+		fmt.Fprintf(&sb, "%d. %s\n", n+1, strings.TrimSpace(segments[i]))
+	}
+	reply, err := p.complete(ctx, groundingPrompt, sb.String(), 500)
+	if err != nil {
+		grounding.Error = err.Error()
+		return answer
+	}
+	unsupported, err := parseUnsupported(reply, len(sentences))
+	if err != nil {
+		grounding.Error = err.Error()
+		return answer
+	}
+	grounding.Checked = true
+
+	drop := map[int]bool{}
+	for _, u := range unsupported {
+		i := sentences[u.number-1]
+		if drop[i] {
+			continue
+		}
+		drop[i] = true
+		grounding.Unsupported = append(grounding.Unsupported, UnsupportedClaim{
+			Sentence: strings.TrimSpace(segments[i]),
+			Reason:   u.reason,
+		})
+	}
+	if g.GroundingCheck != GroundingStrip || len(drop) == 0 {
+		return answer
+	}
+
+	grounding.Stripped = true
+	var kept strings.Builder
+	supported := false
+	for i, seg := range segments {
+		if drop[i] {
+			continue
+		}
+		kept.WriteString(seg)
+		if isSentence(seg) {
+			supported = true
+		}
+	}
+	if !supported {
+		grounding.Fallback = true
+		return g.fallbackAnswer(question)
+	}
+	return strings.TrimSpace(kept.String())
+}
+
+type unsupportedSentence struct {
+	number int
+	reason string
+}
+
+// parseUnsupported reads the checker's JSON reply, tolerating text or code
+// fences around it.
+func parseUnsupported(reply string, count int) ([]unsupportedSentence, error) {
+	start, end := strings.Index(reply, "{"), strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("grounding check returned no JSON")
+	}
+	var parsed struct {
+		Unsupported []struct {
+			Sentence json.RawMessage `json:"sentence"`
+			Reason   string          `json:"reason"`
+		} `json:"unsupported"`
+	}
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &parsed); err != nil {
+		return nil, fmt.Errorf("grounding check returned invalid JSON: %w", err)
+	}
+	var result []unsupportedSentence
+	for _, u := range parsed.Unsupported {
+		n, err := strconv.Atoi(strings.Trim(string(u.Sentence), `"`))
+		if err != nil || n < 1 || n > count {
+			continue
+		}
+		result = append(result, unsupportedSentence{number: n, reason: u.Reason})
+	}
+	return result, nil
+}
+
+// citationSuffix matches citation markers that follow a sentence's final
+// punctuation, e.g. the " [2]" of "It is free. [2]".
+var citationSuffix = regexp.MustCompile(`^(?:\s*\[\d+(?:,\s*\d+)*\])+`)
+
+// splitSentences cuts text into sentences and line breaks. Every segment
+// keeps its trailing whitespace, so joining the segments gives text back.
+func splitSentences(text string) []string {
+	var segments []string
+	start := 0
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r != '\n' && r != '.' && r != '!' && r != '?' {
+			continue
+		}
+		if r == '.' && isListNumber(runes[start:i]) {
+			continue
+		}
+		end := i + 1
+		if r != '\n' {
+			if m := citationSuffix.FindString(string(runes[end:])); m != "" {
+				end += len([]rune(m))
+			}
+			if end < len(runes) && !unicode.IsSpace(runes[end]) {
+				continue
+			}
+		}
+		for end < len(runes) && unicode.IsSpace(runes[end]) {
+			end++
+		}
+		segments = append(segments, string(runes[start:end]))
+		start = end
+		i = end - 1
+	}
+	if start < len(runes) {
+		segments = append(segments, string(runes[start:]))
+	}
+	return segments
+}
+
+// isListNumber reports whether a segment so far is the number of a numbered
+// list item, which does not end a sentence.
+func isListNumber(runes []rune) bool {
+	s := strings.TrimSpace(string(runes))
+	return s != "" && strings.IndexFunc(s, func(r rune) bool { return !unicode.IsDigit(r) }) < 0
+}
+
+// isSentence reports whether a segment has words in it, as opposed to
+// whitespace or markdown such as a horizontal rule.
+func isSentence(segment string) bool {
+	return strings.IndexFunc(segment, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r)
+	}) >= 0
+}
@@ -0,0 +1,181 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"backend/internal/services"
+)
+
+// stubLLM serves chat completions with reply and records the user message
+// of every request.
+type stubLLM struct {
+	mu       sync.Mutex
+	reply    func(user string) (string, int)
+	requests []string
+}
+
+func newStubLLM(t *testing.T, reply func(user string) (string, int)) (*stubLLM, *services.LLMService) {
+	t.Helper()
+	stub := &stubLLM{reply: reply}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []services.LLMMessage `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		user := req.Messages[len(req.Messages)-1].Content
+		stub.mu.Lock()
+		stub.requests = append(stub.requests, user)
+		stub.mu.Unlock()
+
+		content, status := stub.reply(user)
+		if status != http.StatusOK {
+			http.Error(w, content, status)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"role": "assistant", "content": content}}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return stub, services.NewLLMService(srv.URL, "", "stub")
+}
+
+func TestSplitSentences(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"It is free. It has no limits.", []string{"It is free. ", "It has no limits."}},
+		// citations after the final punctuation stay with their sentence
+		{"It is free. [2] It has no limits.[1][3]\nAsk again!", []string{"It is free. [2] ", "It has no limits.[1][3]\n", "Ask again!"}},
+		{"Plans are free [1, 2]. Really? Yes.", []string{"Plans are free [1, 2]. ", "Really? ", "Yes."}},
+		// list numbers and decimals do not end a sentence
+		{"Steps:\n1. Open the app.\n2. Sign in.\n10. Done", []string{"Steps:\n", "1. Open the app.\n", "2. Sign in.\n", "10. Done"}},
+		{"The rate rose 3.5 times. Version 2.0.1 is out.", []string{"The rate rose 3.5 times. ", "Version 2.0.1 is out."}},
+		{"It costs 42. More later", []string{"It costs 42. ", "More later"}},
+		{"a\n\n---\n\nb", []string{"a\n\n", "---\n\n", "b"}},
+		{"No punctuation", []string{"No punctuation"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got := splitSentences(tt.text)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("splitSentences(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+		if strings.Join(got, "") != tt.text {
+			t.Errorf("splitSentences(%q) does not join back to the text", tt.text)
+		}
+	}
+}
+
+func TestIsListNumber(t *testing.T) {
+	for s, want := range map[string]bool{
+		"1":          true,
+		"  12":       true,
+		"\n3":        true,
+		"":           false,
+		" ":          false,
+		"1a":         false,
+		"It costs 5": false,
+		"Step 1":     false,
+	} {
+		if got := isListNumber([]rune(s)); got != want {
+			t.Errorf("isListNumber(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestCitationSuffix(t *testing.T) {
+	for s, want := range map[string]string{
+		" [2] Next":    " [2]",
+		"[1][3]\nNext": "[1][3]",
+		" [1, 2,3] x":  " [1, 2,3]",
+		" Next [2]":    "",
+		"[a]":          "",
+		"[1":           "",
+	} {
+		if got := citationSuffix.FindString(s); got != want {
+			t.Errorf("citationSuffix in %q = %q, want %q", s, got, want)
+		}
+	}
+}
+
+func TestParseUnsupported(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		want  []unsupportedSentence
+	}{
+		{"plain", `{"unsupported": [{"sentence": 2, "reason": "not in passage 1"}]}`,
+			[]unsupportedSentence{{2, "not in passage 1"}}},
+		{"fenced with text", "Here you go:\n```json\n{\"unsupported\": [{\"sentence\": \"1\"}, {\"sentence\": 3}]}\n```",
+			[]unsupportedSentence{{1, ""}, {3, ""}}},
+		// numbers the answer does not have are ignored
+		{"out of range", `{"unsupported": [{"sentence": 0}, {"sentence": 4}, {"sentence": "two"}, {"sentence": 3}]}`,
+			[]unsupportedSentence{{3, ""}}},
+		{"all supported", `{"unsupported": []}`, nil},
+		{"other keys", `{"supported": [1, 2, 3]}`, nil},
+	}
+	for _, tt := range tests {
+		got, err := parseUnsupported(tt.reply, 3)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: parseUnsupported = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	for _, reply := range []string{
+		"All sentences are supported.",
+		`{"unsupported": [{"sentence": 1}`,
+		`} {`,
+		`{"unsupported": {"sentence": 1}}`,
+	} {
+		if _, err := parseUnsupported(reply, 3); err == nil {
+			t.Errorf("parseUnsupported(%q) succeeded, want an error", reply)
+		}
+	}
+}
+
+func TestCheckGroundingStrip(t *testing.T) {
+	answer := "Plans are free. [1] Support is 24/7. [2]\n\n1. Open the app.\n2. Sign in."
+	stub, llm := newStubLLM(t, func(string) (string, int) {
+		return `{"unsupported": [{"sentence": 2, "reason": "passage 2 says office hours"}]}`, http.StatusOK
+	})
+	p := NewPipeline(nil, llm)
+
+	var grounding Grounding
+	got := p.checkGrounding(context.Background(), Guardrails{GroundingCheck: GroundingStrip}, "What does it cost?", answer, nil, &grounding)
+	if want := "Plans are free. [1] 1. Open the app.\n2. Sign in."; got != want {
+		t.Errorf("answer = %q, want %q", got, want)
+	}
+	if !grounding.Checked || !grounding.Stripped || len(grounding.Unsupported) != 1 || grounding.Unsupported[0].Sentence != "Support is 24/7. [2]" {
+		t.Errorf("grounding = %+v", grounding)
+	}
+	// the checker numbers sentences, list items included
+	if !strings.Contains(stub.requests[0], "2. Support is 24/7. [2]\n3. 1. Open the app.\n4. 2. Sign in.\n") {
+		t.Errorf("checker was sent %q", stub.requests[0])
+	}
+
+	// a malformed reply keeps the answer and records why
+	_, llm = newStubLLM(t, func(string) (string, int) { return "Sentence 2 is unsupported.", http.StatusOK })
+	grounding = Grounding{}
+	if got := NewPipeline(nil, llm).checkGrounding(context.Background(), Guardrails{GroundingCheck: GroundingStrip}, "q", answer, nil, &grounding); got != answer {
+		t.Errorf("answer after a malformed reply = %q, want it unchanged", got)
+	}
+	if grounding.Checked || grounding.Error == "" {
+		t.Errorf("grounding after a malformed reply = %+v, want an error", grounding)
+	}
+}
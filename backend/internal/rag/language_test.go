@@ -0,0 +1,38 @@
+package rag
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// The fixtures are shared with the worker's detector, which tags the chunks
+// a query's language is matched against; both copies must stay identical.
+const (
+	languageFixtures       = "testdata/languages.json"
+	workerLanguageFixtures = "../../../worker/pipeline/testdata/languages.json"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	data, err := os.ReadFile(languageFixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if worker, err := os.ReadFile(workerLanguageFixtures); err == nil && !bytes.Equal(data, worker) {
+		t.Errorf("%s differs from the worker's %s", languageFixtures, workerLanguageFixtures)
+	}
+
+	var fixtures []struct {
+		Text string `json:"text"`
+		Want string `json:"want"`
+	}
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range fixtures {
+		if got := DetectLanguage(f.Text); got != f.Want {
+			t.Errorf("DetectLanguage(%q) = %q, want %q", f.Text, got, f.Want)
+		}
+	}
+}
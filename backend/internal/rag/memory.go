@@ -0,0 +1,220 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"backend/internal/models"
+	"backend/internal/services"
+)
+
+const summarizePrompt = `You maintain a running summary of a conversation between a user and an assistant.
+Merge the new turns into the current summary. Keep names, numbers, decisions, preferences and open questions the user may refer back to; drop small talk.
+Write at most 200 words in the language of the conversation and reply with the summary only.`
+
+// EstimateTokens approximates the number of tokens text costs. Without the
+// model's tokenizer at hand it assumes four characters per token, which is
+// close for English and errs on the high side for most other languages.
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// MemoryOptions bound the conversation history put into a prompt.
+type MemoryOptions struct {
+	// HistoryTokens is the budget for recent turns, MaxMessages caps their
+	// number. Zero means no limit.
+	HistoryTokens int
+	MaxMessages   int
+}
+
+// ConversationContext is the memory a prompt is built from: the running
+// summary of older turns and the recent turns that fit the budget.
+type ConversationContext struct {
+	Summary         string                `json:"summary,omitempty"`
+	SummarizedUntil uint                  `json:"summarized_until"`
+	Messages        []services.LLMMessage `json:"messages"`
+	MessageIDs      []uint                `json:"message_ids"`
+	SummaryTokens   int                   `json:"summary_tokens"`
+	HistoryTokens   int                   `json:"history_tokens"`
+	Budget          int                   `json:"budget"`
+	// Omitted counts turns that are neither summarized nor in the window,
+	// e.g. because summarizing them failed.
+	Omitted int `json:"omitted"`
+}
+
+// Memory selects the turns of a chat session that go into a prompt and
+// progressively summarizes the ones that no longer fit.
+type Memory struct {
+	llm  *services.LLMService
+	opts MemoryOptions
+	// updateSummary and getSession store and reload the session's summary
+	updateSummary func(session *models.ChatSession, summary string, until uint) (bool, error)
+	getSession    func(id uint) (*models.ChatSession, error)
+}
+
+func NewMemory(llm *services.LLMService, opts MemoryOptions) *Memory {
+	return &Memory{
+		llm:           llm,
+		opts:          opts,
+		updateSummary: models.UpdateChatSessionSummary,
+		getSession:    models.GetChatSessionByID,
+	}
+}
+
+// Window picks the most recent user and assistant turns that fit the budget.
+// messages are the messages of the conversation path after
+// session.SummarizedUntil, oldest first.
+func (m *Memory) Window(session *models.ChatSession, messages []models.ChatMessage) ConversationContext {
+	return m.window(session, messages, m.opts.HistoryTokens, m.opts.MaxMessages)
+}
+
+func (m *Memory) window(session *models.ChatSession, messages []models.ChatMessage, budget, maxMessages int) ConversationContext {
+	cc := ConversationContext{
+		Summary:         session.Summary,
+		SummarizedUntil: session.SummarizedUntil,
+		SummaryTokens:   EstimateTokens(session.Summary),
+		Budget:          budget,
+		Messages:        []services.LLMMessage{},
+		MessageIDs:      []uint{},
+	}
+
+	turns := conversationTurns(messages)
+	start := len(turns)
+	for start > 0 {
+		t := turns[start-1]
+		tokens := EstimateTokens(t.Message)
+		if budget > 0 && cc.HistoryTokens+tokens > budget {
+			break
+		}
+		if maxMessages > 0 && len(turns)-start >= maxMessages {
+			break
+		}
+		cc.HistoryTokens += tokens
+		start--
+	}
+	for _, t := range turns[start:] {
+		cc.Messages = append(cc.Messages, services.LLMMessage{Role: t.Role, Content: t.Message})
+		cc.MessageIDs = append(cc.MessageIDs, t.ID)
+	}
+	cc.Omitted = start
+	return cc
+}
+
+// Compact folds the turns that no longer fit the window into the session's
+// running summary. It summarizes until the remaining turns take at most half
+// the budget, so the next few turns fit without another summary. It returns
+// the messages that are still unsummarized. A failing LLM is logged and
+// leaves the session as it was.
+func (m *Memory) Compact(ctx context.Context, session *models.ChatSession, messages []models.ChatMessage) ([]models.ChatMessage, error) {
+	if m.Window(session, messages).Omitted == 0 {
+		return messages, nil
+	}
+
+	keep := m.window(session, messages, halve(m.opts.HistoryTokens), halve(m.opts.MaxMessages))
+	if len(keep.MessageIDs) == 0 && len(messages) > 0 {
+		// even the last turn does not fit half the budget; keep it anyway
+		keep.MessageIDs = []uint{messages[len(messages)-1].ID}
+	}
+	firstKept := keep.MessageIDs[0]
+
+	var folded []models.ChatMessage
+	for _, msg := range messages {
+		if msg.ID >= firstKept {
+			break
+		}
+		folded = append(folded, msg)
+	}
+	if len(folded) == 0 {
+		return messages, nil
+	}
+
+	summary, err := m.summarize(ctx, session.Summary, conversationTurns(folded))
+	if err != nil {
+		log.Printf("Failed to summarize chat session %d: %v", session.ID, err)
+		return messages, nil
+	}
+	updated, err := m.updateSummary(session, summary, folded[len(folded)-1].ID)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		// summarized concurrently; use what the other request stored if it
+		// summarized this branch
+		fresh, err := m.getSession(session.ID)
+		if err != nil {
+			return nil, err
+		}
+		for i, msg := range messages {
+			if msg.ID == fresh.SummarizedUntil {
+				*session = *fresh
+				return messages[i+1:], nil
+			}
+		}
+		return messages, nil
+	}
+	return messages[len(folded):], nil
+}
+
+func (m *Memory) summarize(ctx context.Context, current string, turns []models.ChatMessage) (string, error) {
+	var sb strings.Builder
+	sb.WriteString("Current summary:\n")
+	if current == "" {
+		sb.WriteString("(none)\n")
+	} else {
+		sb.WriteString(current)
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\nNew turns:\n")
+	for _, t := range turns {
+		role := "User"
+		if t.Role == "assistant" {
+			role = "Assistant"
+		}
+		fmt.Fprintf(&sb, "%s: %s\n", role, t.Message)
+	}
+
+	temperature := 0.0
+	resp, err := m.llm.Complete(ctx, services.LLMRequest{
+		Messages: []services.LLMMessage{
+			{Role: "system", Content: summarizePrompt},
+			{Role: "user", Content: sb.String()},
+		},
+		Temperature: &temperature,
+		MaxTokens:   400,
+	})
+	if err != nil {
+		return "", err
+	}
+	summary := strings.TrimSpace(resp.Content)
+	if summary == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	return summary, nil
+}
+
+// halve halves a limit without turning a positive one into "no limit".
+func halve(limit int) int {
+	if limit <= 0 {
+		return limit
+	}
+	if limit < 2 {
+		return 1
+	}
+	return limit / 2
+}
+
+// conversationTurns drops messages that are not part of the dialogue, such
+// as stored system messages and the tool calls that led to an answer, which
+// the answer already reflects.
+func conversationTurns(messages []models.ChatMessage) []models.ChatMessage {
+	turns := make([]models.ChatMessage, 0, len(messages))
+	for _, msg := range messages {
+		if (msg.Role == "user" || msg.Role == "assistant") && !msg.IsToolStep() {
+			turns = append(turns, msg)
+		}
+	}
+	return turns
+}
@@ -0,0 +1,217 @@
+package rag
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"backend/internal/models"
+)
+
+// turn is a message of ten estimated tokens.
+func turn(id uint, role string) models.ChatMessage {
+	return models.ChatMessage{ID: id, Role: role, Message: strings.Repeat("w", 39) + string(rune('a'+id%26))}
+}
+
+// conversation alternates user and assistant turns with IDs 1..n.
+func conversation(n int) []models.ChatMessage {
+	messages := make([]models.ChatMessage, n)
+	for i := range messages {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		messages[i] = turn(uint(i+1), role)
+	}
+	return messages
+}
+
+func TestMemoryWindow(t *testing.T) {
+	messages := conversation(5)
+	// tool steps are neither shown nor counted
+	messages = slices.Insert(messages, 4,
+		models.ChatMessage{ID: 41, Role: "assistant", ToolCalls: models.JSON(`[{"id":"1"}]`), Message: strings.Repeat("x", 400)},
+		models.ChatMessage{ID: 42, Role: "tool", Message: strings.Repeat("x", 400)},
+	)
+	session := &models.ChatSession{Summary: "twelve chars", SummarizedUntil: 7}
+
+	tests := []struct {
+		name            string
+		opts            MemoryOptions
+		ids             []uint
+		tokens, omitted int
+	}{
+		{"unlimited", MemoryOptions{}, []uint{1, 2, 3, 4, 5}, 50, 0},
+		{"token budget", MemoryOptions{HistoryTokens: 35}, []uint{3, 4, 5}, 30, 2},
+		{"message cap", MemoryOptions{HistoryTokens: 100, MaxMessages: 2}, []uint{4, 5}, 20, 3},
+		// the last turn alone is over budget: nothing fits
+		{"last turn does not fit", MemoryOptions{HistoryTokens: 5}, []uint{}, 0, 5},
+	}
+	for _, tt := range tests {
+		m := NewMemory(nil, tt.opts)
+		cc := m.Window(session, messages)
+		if !slices.Equal(cc.MessageIDs, tt.ids) || cc.HistoryTokens != tt.tokens || cc.Omitted != tt.omitted {
+			t.Errorf("%s: window %v, %d tokens, %d omitted, want %v, %d, %d", tt.name, cc.MessageIDs, cc.HistoryTokens, cc.Omitted, tt.ids, tt.tokens, tt.omitted)
+		}
+		if len(cc.Messages) != len(tt.ids) || cc.Budget != tt.opts.HistoryTokens {
+			t.Errorf("%s: %d messages, budget %d", tt.name, len(cc.Messages), cc.Budget)
+		}
+		if cc.Summary != session.Summary || cc.SummarizedUntil != 7 || cc.SummaryTokens != 3 {
+			t.Errorf("%s: summary %q until %d, %d tokens", tt.name, cc.Summary, cc.SummarizedUntil, cc.SummaryTokens)
+		}
+	}
+}
+
+// summaryStore stands in for the chat_sessions row: updates succeed unless
+// another request summarized the session first.
+type summaryStore struct {
+	stored  models.ChatSession
+	updates int
+}
+
+func (s *summaryStore) update(session *models.ChatSession, summary string, until uint) (bool, error) {
+	s.updates++
+	if session.SummarizedUntil != s.stored.SummarizedUntil {
+		return false, nil
+	}
+	s.stored.Summary, s.stored.SummarizedUntil = summary, until
+	session.Summary, session.SummarizedUntil = summary, until
+	return true, nil
+}
+
+func (s *summaryStore) get(uint) (*models.ChatSession, error) {
+	fresh := s.stored
+	return &fresh, nil
+}
+
+func testMemory(t *testing.T, opts MemoryOptions, reply func(string) (string, int)) (*Memory, *stubLLM, *summaryStore) {
+	t.Helper()
+	stub, llm := newStubLLM(t, reply)
+	m := NewMemory(llm, opts)
+	store := &summaryStore{stored: models.ChatSession{ID: 1}}
+	m.updateSummary, m.getSession = store.update, store.get
+	return m, stub, store
+}
+
+func summaryReply(string) (string, int) { return "the summary", http.StatusOK }
+
+func TestMemoryCompact(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("fits", func(t *testing.T) {
+		m, stub, _ := testMemory(t, MemoryOptions{HistoryTokens: 60}, summaryReply)
+		messages := conversation(6)
+		got, err := m.Compact(ctx, &models.ChatSession{ID: 1}, messages)
+		if err != nil || len(got) != 6 || len(stub.requests) != 0 {
+			t.Errorf("Compact = %d messages, %v after %d LLM calls, want all without a summary", len(got), err, len(stub.requests))
+		}
+	})
+
+	t.Run("summarizes down to half the budget", func(t *testing.T) {
+		m, stub, store := testMemory(t, MemoryOptions{HistoryTokens: 40}, summaryReply)
+		session := &models.ChatSession{ID: 1, Summary: "earlier"}
+		messages := conversation(6)
+		got, err := m.Compact(ctx, session, messages)
+		if err != nil {
+			t.Fatalf("Compact: %v", err)
+		}
+		// 60 tokens do not fit 40; the last 20 are kept so the next turns fit
+		if ids := messageIDs(got); !slices.Equal(ids, []uint{5, 6}) {
+			t.Errorf("unsummarized messages %v, want [5 6]", ids)
+		}
+		if session.Summary != "the summary" || session.SummarizedUntil != 4 || store.stored.SummarizedUntil != 4 {
+			t.Errorf("session = %q until %d, want the new summary until 4", session.Summary, session.SummarizedUntil)
+		}
+		if len(stub.requests) != 1 {
+			t.Fatalf("LLM called %d times, want once", len(stub.requests))
+		}
+		prompt := stub.requests[0]
+		if !strings.HasPrefix(prompt, "Current summary:\nearlier\n") || strings.Count(prompt, "User: ") != 2 || strings.Count(prompt, "Assistant: ") != 2 {
+			t.Errorf("summary prompt = %q, want the old summary and turns 1-4", prompt)
+		}
+		if cc := m.Window(session, got); cc.Omitted != 0 {
+			t.Errorf("window after compacting omits %d turns", cc.Omitted)
+		}
+	})
+
+	t.Run("message cap", func(t *testing.T) {
+		m, _, _ := testMemory(t, MemoryOptions{MaxMessages: 4}, summaryReply)
+		got, err := m.Compact(ctx, &models.ChatSession{ID: 1}, conversation(6))
+		if ids := messageIDs(got); err != nil || !slices.Equal(ids, []uint{5, 6}) {
+			t.Errorf("Compact = %v, %v, want [5 6]", ids, err)
+		}
+	})
+
+	t.Run("last turn does not fit", func(t *testing.T) {
+		m, stub, _ := testMemory(t, MemoryOptions{HistoryTokens: 5}, summaryReply)
+		session := &models.ChatSession{ID: 1}
+		got, err := m.Compact(ctx, session, conversation(3))
+		if err != nil {
+			t.Fatalf("Compact: %v", err)
+		}
+		// the last turn is kept anyway, everything before is summarized
+		if ids := messageIDs(got); !slices.Equal(ids, []uint{3}) || session.SummarizedUntil != 2 || len(stub.requests) != 1 {
+			t.Errorf("Compact = %v until %d after %d LLM calls, want [3] until 2", ids, session.SummarizedUntil, len(stub.requests))
+		}
+
+		// a single turn over budget has nothing to fold
+		m, stub, _ = testMemory(t, MemoryOptions{HistoryTokens: 5}, summaryReply)
+		got, err = m.Compact(ctx, &models.ChatSession{ID: 1}, conversation(1))
+		if err != nil || len(got) != 1 || len(stub.requests) != 0 {
+			t.Errorf("Compact of one turn = %d messages, %v after %d LLM calls", len(got), err, len(stub.requests))
+		}
+	})
+
+	t.Run("failing LLM", func(t *testing.T) {
+		m, _, store := testMemory(t, MemoryOptions{HistoryTokens: 40}, func(string) (string, int) {
+			return "overloaded", http.StatusServiceUnavailable
+		})
+		session := &models.ChatSession{ID: 1}
+		got, err := m.Compact(ctx, session, conversation(6))
+		if err != nil || len(got) != 6 || store.updates != 0 || session.SummarizedUntil != 0 {
+			t.Errorf("Compact = %d messages, %v, %d updates, want the session unchanged", len(got), err, store.updates)
+		}
+	})
+
+	t.Run("summarized concurrently", func(t *testing.T) {
+		m, _, store := testMemory(t, MemoryOptions{HistoryTokens: 40}, summaryReply)
+		// another request summarized turns 1-3 of this branch after the
+		// session was read
+		store.stored = models.ChatSession{ID: 1, Summary: "theirs", SummarizedUntil: 3}
+		session := &models.ChatSession{ID: 1}
+		got, err := m.Compact(ctx, session, conversation(6))
+		if err != nil {
+			t.Fatalf("Compact: %v", err)
+		}
+		if ids := messageIDs(got); !slices.Equal(ids, []uint{4, 5, 6}) || session.Summary != "theirs" || session.SummarizedUntil != 3 {
+			t.Errorf("Compact = %v with %q until %d, want the other summary", ids, session.Summary, session.SummarizedUntil)
+		}
+
+		// a summary of another branch is not used
+		m, _, store = testMemory(t, MemoryOptions{HistoryTokens: 40}, summaryReply)
+		store.stored = models.ChatSession{ID: 1, Summary: "other branch", SummarizedUntil: 99}
+		session = &models.ChatSession{ID: 1}
+		got, err = m.Compact(ctx, session, conversation(6))
+		if err != nil || len(got) != 6 || session.Summary != "" {
+			t.Errorf("Compact = %d messages, %v, summary %q, want the session unchanged", len(got), err, session.Summary)
+		}
+	})
+}
+
+func messageIDs(messages []models.ChatMessage) []uint {
+	ids := make([]uint, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+	return ids
+}
+
+func TestEstimateTokens(t *testing.T) {
+	for text, want := range map[string]int{"": 0, "abcd": 1, "abcde": 2, "xin chào": 2} {
+		if got := EstimateTokens(text); got != want {
+			t.Errorf("EstimateTokens(%q) = %d, want %d", text, got, want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package rag
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"backend/internal/services"
+)
+
+// DefaultPromptTemplate is the system prompt of knowledge bases that do not
+// define their own.
+//
+//go:embed prompts/default.tmpl
+var DefaultPromptTemplate string
+
+const maxPromptTemplateLength = 20000
+
+// PromptData is what a system prompt template can use.
+type PromptData struct {
+	// Context holds the numbered retrieved passages, Sources the same
+	// passages as structured data. Retrieval is false for chats without a
+	// knowledge base or with retrieval turned off.
+	Context   string
+	Sources   []Source
+	Retrieval bool
+	// Summary is the running summary of the conversation before History,
+	// which holds the recent turns. The turns are also sent as chat messages.
+	Summary  string
+	History  []services.LLMMessage
+	Question string
+	// Language is the English name of the language of the question, empty
+	// when it is not detected.
+	Language      string
+	UserName      string
+	KnowledgeBase string
+	Date          string
+	// Tools names the tools the model may call, empty without tools.
+	Tools []string
+}
+
+// ParsePromptTemplate parses a system prompt template; empty text yields the
+// default template.
+func ParsePromptTemplate(text string) (*template.Template, error) {
+	if strings.TrimSpace(text) == "" {
+		text = DefaultPromptTemplate
+	}
+	return template.New("system").Parse(text)
+}
+
+// ValidatePromptTemplate checks that a template parses, renders with sample
+// data and puts the retrieved context into the prompt.
+func ValidatePromptTemplate(text string) error {
+	if len(text) > maxPromptTemplateLength {
+		return fmt.Errorf("template is longer than %d characters", maxPromptTemplateLength)
+	}
+	tmpl, err := ParsePromptTemplate(text)
+	if err != nil {
+		return err
+	}
+	const marker = "sample passage 7f3a"
+	sample := PromptData{
+		Context:       "[1] handbook.pdf, page 2\n" + marker,
+		Sources:       []Source{{DocumentName: "handbook.pdf", Page: 2, Text: marker}},
+		Retrieval:     true,
+		Summary:       "The user asked about leave days.",
+		History:       []services.LLMMessage{{Role: "user", Content: "How many leave days do I have?"}},
+		Question:      "And for part-time staff?",
+		Language:      "English",
+		UserName:      "Alex",
+		KnowledgeBase: "HR",
+		Date:          time.Now().Format("2006-01-02"),
+		Tools:         []string{"calculator"},
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, sample); err != nil {
+		return err
+	}
+	if !strings.Contains(sb.String(), marker) {
+		return fmt.Errorf("template must include the retrieved context, e.g. {{.Context}}")
+	}
+	return nil
+}
+
+// renderSystemPrompt fills the template of req with the retrieved sources.
+func renderSystemPrompt(req ChatRequest, sources []Source) (string, error) {
+	tmpl, err := ParsePromptTemplate(req.Template)
+	if err != nil {
+		return "", fmt.Errorf("invalid prompt template: %w", err)
+	}
+	data := PromptData{
+		Context:       contextText(sources),
+		Sources:       sources,
+		Retrieval:     req.retrieves(),
+		Summary:       req.Summary,
+		History:       req.History,
+		Question:      req.Question,
+		Language:      LanguageName(DetectLanguage(req.Question)),
+		UserName:      req.UserName,
+		KnowledgeBase: req.KnowledgeBaseName,
+		Date:          time.Now().Format("2006-01-02"),
+		Tools:         req.toolNames(),
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt template: %w", err)
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
+
+// contextText numbers the passages so answers can cite them.
+func contextText(sources []Source) string {
+	if len(sources) == 0 {
+		return "(no relevant passages found)"
+	}
+	var sb strings.Builder
+	for i, s := range sources {
+		if i > 0 {
+			sb.WriteString("\n\n")
+		}
+		fmt.Fprintf(&sb, "[%d] %s\n%s", i+1, sourceLabel(s), s.Text)
+	}
+	return sb.String()
+}
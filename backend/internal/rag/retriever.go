@@ -0,0 +1,228 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"backend/internal/models"
+	"backend/internal/services"
+)
+
+// Retrieval modes. Vector search matches meaning, keyword search matches the
+// words of the query through PostgreSQL full-text search, and hybrid fuses
+// both rankings. ModeNone skips retrieval in chats, so the model answers
+// from the conversation alone.
+const (
+	ModeVector  = "vector"
+	ModeKeyword = "keyword"
+	ModeHybrid  = "hybrid"
+	ModeNone    = "none"
+	// ModeGraph would retrieve over a knowledge graph of the documents. The
+	// worker only chunks and embeds documents and extracts no entities or
+	// relations, so there is no graph to search: the mode is accepted by
+	// the API but rejected with ErrGraphUnsupported rather than quietly
+	// served by another mode.
+	ModeGraph = "graph"
+)
+
+// Modes lists the retrieval modes a chat can use.
+var Modes = []string{ModeVector, ModeKeyword, ModeHybrid, ModeNone}
+
+// ErrGraphUnsupported is returned for ModeGraph.
+var ErrGraphUnsupported = errors.New("retrieval mode \"graph\" is not supported: documents are not indexed as a knowledge graph")
+
+// rrfK dampens the weight of top ranks in reciprocal rank fusion.
+const rrfK = 60
+
+// Source is a retrieved chunk, as returned by search and cited by answers.
+type Source struct {
+	ChunkID         string `json:"chunk_id"`
+	KnowledgeBaseID uint   `json:"knowledge_base_id"`
+	// KnowledgeBaseName is set when a chat searches several knowledge bases.
+	KnowledgeBaseName string                 `json:"knowledge_base_name,omitempty"`
+	DocumentID        uint                   `json:"document_id"`
+	DocumentName      string                 `json:"document_name,omitempty"`
+	Page              int                    `json:"page,omitempty"`
+	Symbol            string                 `json:"symbol,omitempty"`
+	Language          string                 `json:"language,omitempty"`
+	ChunkType         string                 `json:"chunk_type,omitempty"` // "summary" for a document's generated summary
+	SourceURL         string                 `json:"source_url,omitempty"`
+	Score             float64                `json:"score"`
+	Relevance         float64                `json:"relevance,omitempty"` // similarity to the query, only known for vector matches
+	Text              string                 `json:"text"`
+	Metadata          map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// SearchOptions scope a search to a knowledge base. Filter is an optional
+// compiled filter expression, see ParseFilter. Mode defaults to ModeVector.
+type SearchOptions struct {
+	KnowledgeBaseID uint
+	Filter          Filter
+	TopK            int
+	Mode            string
+}
+
+// Retriever finds the chunks of a knowledge base closest to a query.
+type Retriever struct {
+	embedder *services.EmbeddingService
+	qdrant   *services.QdrantService
+	// searchConfigs are the text search configurations of the chunks
+	searchConfigs []string
+}
+
+func NewRetriever(embedder *services.EmbeddingService, qdrant *services.QdrantService, searchConfigs []string) *Retriever {
+	return &Retriever{embedder: embedder, qdrant: qdrant, searchConfigs: searchConfigs}
+}
+
+// Search returns the best matching chunks of the versions the knowledge
+// base's documents currently serve.
+func (r *Retriever) Search(ctx context.Context, query string, opts SearchOptions) ([]Source, error) {
+	if opts.TopK <= 0 {
+		opts.TopK = 5
+	}
+	must := []interface{}{
+		Filter{"key": "knowledge_base_id", "match": Filter{"value": opts.KnowledgeBaseID}},
+		Filter{"key": "is_active", "match": Filter{"value": true}},
+	}
+	if opts.Filter != nil {
+		must = append(must, opts.Filter)
+	}
+	scope := Filter{"must": must}
+
+	switch opts.Mode {
+	case "", ModeVector:
+		return r.vectorSearch(ctx, query, scope, opts.TopK)
+	case ModeKeyword:
+		return r.keywordSearch(ctx, query, opts.KnowledgeBaseID, scope, opts.TopK)
+	case ModeHybrid:
+		vector, err := r.vectorSearch(ctx, query, scope, opts.TopK*2)
+		if err != nil {
+			return nil, err
+		}
+		keyword, err := r.keywordSearch(ctx, query, opts.KnowledgeBaseID, scope, opts.TopK*2)
+		if err != nil {
+			return nil, err
+		}
+		return fuseRankings(opts.TopK, vector, keyword), nil
+	case ModeGraph:
+		return nil, ErrGraphUnsupported
+	default:
+		return nil, fmt.Errorf("unknown retrieval mode %q", opts.Mode)
+	}
+}
+
+func (r *Retriever) vectorSearch(ctx context.Context, query string, scope Filter, limit int) ([]Source, error) {
+	vectors, err := r.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	hits, err := r.qdrant.Search(ctx, vectors[0], scope, limit)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+
+	sources := make([]Source, 0, len(hits))
+	for _, h := range hits {
+		s := sourceFromPayload(h.ID, h.Score, h.Payload)
+		s.Relevance = h.Score
+		sources = append(sources, s)
+	}
+	return sources, nil
+}
+
+// keywordSearch ranks chunks with full-text search and then loads the
+// matches from Qdrant, which applies the same scope and filter as a vector
+// search. More matches than needed are ranked since the filter may drop some.
+func (r *Retriever) keywordSearch(ctx context.Context, query string, kbID uint, scope Filter, limit int) ([]Source, error) {
+	matches, err := models.SearchDocumentChunks(kbID, query, r.searchConfigs, limit*4)
+	if err != nil {
+		return nil, fmt.Errorf("keyword search failed: %w", err)
+	}
+	if len(matches) == 0 {
+		return []Source{}, nil
+	}
+	ids := make([]string, len(matches))
+	for i, m := range matches {
+		ids[i] = m.ID
+	}
+	points, err := r.qdrant.GetPoints(ctx, ids, scope)
+	if err != nil {
+		return nil, fmt.Errorf("keyword search failed: %w", err)
+	}
+	payloads := make(map[string]map[string]interface{}, len(points))
+	for _, p := range points {
+		payloads[p.ID] = p.Payload
+	}
+
+	sources := make([]Source, 0, limit)
+	for _, m := range matches {
+		payload, ok := payloads[m.ID]
+		if !ok {
+			continue
+		}
+		sources = append(sources, sourceFromPayload(m.ID, m.Rank, payload))
+		if len(sources) == limit {
+			break
+		}
+	}
+	return sources, nil
+}
+
+// fuseRankings merges rankings with reciprocal rank fusion. The score of a
+// fused source is the sum of 1/(rrfK+rank) over the rankings it appears in;
+// its relevance is the best one any ranking knows.
+func fuseRankings(limit int, rankings ...[]Source) []Source {
+	scores := map[string]float64{}
+	byID := map[string]Source{}
+	for _, ranking := range rankings {
+		for rank, s := range ranking {
+			scores[s.ChunkID] += 1 / float64(rrfK+rank+1)
+			if seen, ok := byID[s.ChunkID]; !ok {
+				byID[s.ChunkID] = s
+			} else if s.Relevance > seen.Relevance {
+				seen.Relevance = s.Relevance
+				byID[s.ChunkID] = seen
+			}
+		}
+	}
+
+	fused := make([]Source, 0, len(byID))
+	for id, s := range byID {
+		s.Score = scores[id]
+		fused = append(fused, s)
+	}
+	sort.Slice(fused, func(i, j int) bool {
+		if fused[i].Score != fused[j].Score {
+			return fused[i].Score > fused[j].Score
+		}
+		return fused[i].ChunkID < fused[j].ChunkID
+	})
+	if len(fused) > limit {
+		fused = fused[:limit]
+	}
+	return fused
+}
+
+func sourceFromPayload(id string, score float64, payload map[string]interface{}) Source {
+	s := Source{ChunkID: id, Score: score}
+	s.KnowledgeBaseID = uint(payloadNumber(payload["knowledge_base_id"]))
+	s.DocumentID = uint(payloadNumber(payload["document_id"]))
+	s.Page = int(payloadNumber(payload["page"]))
+	s.DocumentName, _ = payload["document_name"].(string)
+	s.Symbol, _ = payload["symbol"].(string)
+	s.ChunkType, _ = payload["chunk_type"].(string)
+	s.Language, _ = payload["detected_language"].(string)
+	s.SourceURL, _ = payload["source_url"].(string)
+	s.Text, _ = payload["text"].(string)
+	if m, ok := payload["metadata"].(map[string]interface{}); ok && len(m) > 0 {
+		s.Metadata = m
+	}
+	return s
+}
+
+func payloadNumber(v interface{}) float64 {
+	f, _ := v.(float64)
+	return f
+}
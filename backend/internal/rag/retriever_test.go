@@ -0,0 +1,14 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSearchGraphMode(t *testing.T) {
+	r := NewRetriever(nil, nil, nil)
+	if _, err := r.Search(context.Background(), "q", SearchOptions{KnowledgeBaseID: 1, Mode: ModeGraph}); !errors.Is(err, ErrGraphUnsupported) {
+		t.Errorf("graph search error = %v, want ErrGraphUnsupported", err)
+	}
+}
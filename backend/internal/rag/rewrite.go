@@ -0,0 +1,127 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"backend/internal/services"
+)
+
+// Query rewriting strategies, configured per knowledge base.
+const (
+	// RewriteNone searches for the user's message as written.
+	RewriteNone = "none"
+	// RewriteCondense turns a follow-up into a standalone question using the
+	// conversation so far.
+	RewriteCondense = "condense"
+	// RewriteMultiQuery also searches for up to maxSubQueries sub-questions
+	// and fuses the results.
+	RewriteMultiQuery = "multi_query"
+	// RewriteHyDE also searches for a hypothetical answer, which tends to be
+	// closer to the wording of the documents than the question is.
+	RewriteHyDE = "hyde"
+)
+
+const maxSubQueries = 3
+
+const condensePrompt = `Rewrite the user's latest message as a standalone search query for a document search engine.
+Resolve pronouns and references such as "it", "the second one" or "that policy" using the conversation.
+Keep the language of the latest message. Reply with the query only.`
+
+const multiQueryPrompt = `Break the question below into at most 3 short search queries that together cover what it asks.
+Keep the language of the question. Reply with one query per line and nothing else.`
+
+const hydePrompt = `Write a short passage, as it could appear in a company document, that answers the question below.
+Make up plausible details if needed; the passage is only used to find similar documents.
+Write in the language of the question and reply with the passage only.`
+
+// listMarker matches bullets and numbering the model may put before queries.
+var listMarker = regexp.MustCompile(`^\s*(?:[-*•]|\d+[.)])\s*`)
+
+// rewriteHistoryMessages is how many recent turns condensing looks at.
+const rewriteHistoryMessages = 6
+
+// rewriteQueries returns the queries to retrieve context for question. The
+// first query is always the standalone question; further ones come from the
+// strategy. It falls back to the question itself when the LLM fails.
+func (p *Pipeline) rewriteQueries(ctx context.Context, strategy, summary string, history []services.LLMMessage, question string) []string {
+	if strategy == "" || strategy == RewriteNone {
+		return []string{question}
+	}
+
+	standalone := question
+	if summary != "" || len(history) > 0 {
+		condensed, err := p.complete(ctx, condensePrompt, condenseInput(summary, history, question), 200)
+		if err == nil && condensed != "" {
+			standalone = condensed
+		}
+	}
+	queries := []string{standalone}
+
+	switch strategy {
+	case RewriteMultiQuery:
+		reply, err := p.complete(ctx, multiQueryPrompt, standalone, 200)
+		if err != nil {
+			break
+		}
+		for _, line := range strings.Split(reply, "\n") {
+			q := strings.TrimSpace(listMarker.ReplaceAllString(line, ""))
+			if q == "" || q == standalone {
+				continue
+			}
+			queries = append(queries, q)
+			if len(queries) > maxSubQueries {
+				break
+			}
+		}
+	case RewriteHyDE:
+		passage, err := p.complete(ctx, hydePrompt, standalone, 300)
+		if err == nil && passage != "" {
+			queries = append(queries, passage)
+		}
+	}
+	return queries
+}
+
+// condenseInput lays out the recent conversation and the latest message.
+func condenseInput(summary string, history []services.LLMMessage, question string) string {
+	var sb strings.Builder
+	if summary != "" {
+		sb.WriteString("Summary of the earlier conversation:\n")
+		sb.WriteString(summary)
+		sb.WriteString("\n\n")
+	}
+	if len(history) > rewriteHistoryMessages {
+		history = history[len(history)-rewriteHistoryMessages:]
+	}
+	sb.WriteString("Conversation:\n")
+	for _, m := range history {
+		role := "User"
+		if m.Role == "assistant" {
+			role = "Assistant"
+		}
+		fmt.Fprintf(&sb, "%s: %s\n", role, m.Content)
+	}
+	sb.WriteString("\nLatest message: ")
+	sb.WriteString(question)
+	return sb.String()
+}
+
+// complete runs a single-turn, deterministic completion.
+func (p *Pipeline) complete(ctx context.Context, system, user string, maxTokens int) (string, error) {
+	temperature := 0.0
+	resp, err := p.llm.Complete(ctx, services.LLMRequest{
+		Messages: []services.LLMMessage{
+			{Role: "system", Content: system},
+			{Role: "user", Content: user},
+		},
+		Temperature: &temperature,
+		MaxTokens:   maxTokens,
+	})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(resp.Content), nil
+}
@@ -0,0 +1,194 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"backend/internal/services"
+	"backend/internal/tools"
+)
+
+// defaultMaxToolSteps bounds the rounds of tool calls when the request does
+// not.
+const defaultMaxToolSteps = 5
+
+// ToolStep is a round of tool calls the model made before answering.
+// Content is any text the model wrote along with the calls.
+type ToolStep struct {
+	Content string     `json:"content,omitempty"`
+	Calls   []ToolCall `json:"calls"`
+}
+
+// ToolCall is one call of a step and its result. Failed calls have Error
+// set and the error as their result, which the model saw as well.
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+	Result    string `json:"result"`
+	Error     bool   `json:"error,omitempty"`
+}
+
+// toolNames lists the tools offered for req, see toolRegistry.
+func (r ChatRequest) toolNames() []string {
+	var names []string
+	if r.SearchTool && r.retrieves() {
+		names = append(names, tools.NameSearchKnowledgeBase)
+	}
+	for _, t := range r.Tools {
+		names = append(names, t.Name())
+	}
+	return names
+}
+
+// toolRegistry holds the tools of req. The search tool adds the passages it
+// finds to sources.
+func (p *Pipeline) toolRegistry(req ChatRequest, sources *[]Source) *tools.Registry {
+	registry := tools.NewRegistry()
+	if req.SearchTool && req.retrieves() {
+		registry.Add(&searchTool{pipeline: p, req: req, sources: sources})
+	}
+	for _, t := range req.Tools {
+		registry.Add(t)
+	}
+	return registry
+}
+
+// completeWithTools asks the model for the answer to messages. With tools,
+// the model may call them first: every round of calls is run and its
+// results are sent back, until the model answers or the step limit is
+// reached, after which it must answer with what it has. Tokens of all
+// rounds are summed into the response.
+func (p *Pipeline) completeWithTools(ctx context.Context, req ChatRequest, messages []services.LLMMessage, registry *tools.Registry) (*services.LLMResponse, []ToolStep, error) {
+	maxSteps := req.MaxToolSteps
+	if maxSteps <= 0 {
+		maxSteps = defaultMaxToolSteps
+	}
+
+	var steps []ToolStep
+	total := &services.LLMResponse{}
+	for {
+		llmReq := services.LLMRequest{
+			Model:       req.Model,
+			Messages:    messages,
+			Temperature: req.Temperature,
+		}
+		if registry.Len() > 0 {
+			llmReq.Tools = registry.Definitions()
+			if len(steps) >= maxSteps {
+				llmReq.ToolChoice = "none"
+			}
+		}
+		resp, err := p.llm.Complete(ctx, llmReq)
+		if err != nil {
+			return nil, nil, err
+		}
+		total.Content, total.Model = resp.Content, resp.Model
+		total.PromptTokens += resp.PromptTokens
+		total.CompletionTokens += resp.CompletionTokens
+		if len(resp.ToolCalls) == 0 || len(steps) >= maxSteps {
+			return total, steps, nil
+		}
+
+		step := ToolStep{Content: resp.Content}
+		messages = append(messages, services.LLMMessage{Role: "assistant", Content: resp.Content, ToolCalls: resp.ToolCalls})
+		for _, call := range resp.ToolCalls {
+			result, ok := registry.Call(ctx, call.Function.Name, call.Function.Arguments)
+			step.Calls = append(step.Calls, ToolCall{
+				ID:        call.ID,
+				Name:      call.Function.Name,
+				Arguments: call.Function.Arguments,
+				Result:    result,
+				Error:     !ok,
+			})
+			messages = append(messages, services.LLMMessage{Role: "tool", Content: result, ToolCallID: call.ID})
+		}
+		steps = append(steps, step)
+	}
+}
+
+// toolEvidence turns the results of successful tool calls into passages the
+// grounding check accepts as support. Search results are among the sources
+// already.
+func toolEvidence(steps []ToolStep) []Source {
+	var evidence []Source
+	for _, step := range steps {
+		for _, call := range step.Calls {
+			if call.Error || call.Name == tools.NameSearchKnowledgeBase {
+				continue
+			}
+			evidence = append(evidence, Source{DocumentName: "result of " + call.Name + " " + call.Arguments, Text: call.Result})
+		}
+	}
+	return evidence
+}
+
+// searchTool lets the model search the knowledge bases of a chat with
+// queries of its own, e.g. for a part of the question the retrieved context
+// missed. Passages it finds are added to the sources of the answer and
+// numbered after them, so the answer can cite them.
+type searchTool struct {
+	pipeline *Pipeline
+	req      ChatRequest
+	sources  *[]Source
+}
+
+func (t *searchTool) Name() string {
+	return tools.NameSearchKnowledgeBase
+}
+
+func (t *searchTool) Description() string {
+	return "Searches the knowledge base documents and returns numbered passages, " +
+		"which can be cited like the passages of the context."
+}
+
+func (t *searchTool) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"query": {"type": "string", "description": "a self-contained search query"}
+		},
+		"required": ["query"]
+	}`)
+}
+
+func (t *searchTool) Call(ctx context.Context, args json.RawMessage) (string, error) {
+	var in struct {
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	if strings.TrimSpace(in.Query) == "" {
+		return "", fmt.Errorf("query is empty")
+	}
+	found, err := t.pipeline.retrieveAll(ctx, []string{in.Query}, t.req)
+	if err != nil {
+		return "", err
+	}
+	if len(found) == 0 {
+		return "(no relevant passages found)", nil
+	}
+
+	var sb strings.Builder
+	for _, s := range found {
+		n := -1
+		for i, known := range *t.sources {
+			if known.ChunkID == s.ChunkID {
+				n = i
+				break
+			}
+		}
+		if n < 0 {
+			*t.sources = append(*t.sources, s)
+			n = len(*t.sources) - 1
+		}
+		if sb.Len() > 0 {
+			sb.WriteString("\n\n")
+		}
+		fmt.Fprintf(&sb, "[%d] %s\n%s", n+1, sourceLabel(s), s.Text)
+	}
+	return sb.String(), nil
+}
@@ -15,5 +15,12 @@ func ChatMessageRoutes(router *gin.Engine) {
 		messageGroup.GET("/:messageId", middleware.Authentication(), controllers.GetChatMessageByID())
 		messageGroup.PUT("/:messageId", middleware.Authentication(), controllers.UpdateChatMessage())
 		messageGroup.DELETE("/:messageId", middleware.Authentication(), controllers.DeleteChatMessage())
+		messageGroup.POST("/:messageId/edit", middleware.Authentication(), controllers.EditChatMessage())
+		messageGroup.POST("/:messageId/regenerate", middleware.Authentication(), controllers.RegenerateChatMessage())
+		messageGroup.GET("/:messageId/branches", middleware.Authentication(), controllers.ListChatMessageBranches())
+		messageGroup.POST("/:messageId/activate", middleware.Authentication(), controllers.ActivateChatMessage())
+		messageGroup.PUT("/:messageId/feedback", middleware.Authentication(), controllers.SaveMessageFeedback())
+		messageGroup.GET("/:messageId/feedback", middleware.Authentication(), controllers.GetMessageFeedback())
+		messageGroup.DELETE("/:messageId/feedback", middleware.Authentication(), controllers.DeleteMessageFeedback())
 	}
 }
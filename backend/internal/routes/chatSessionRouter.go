@@ -15,5 +15,7 @@ func ChatSessionRoutes(router *gin.Engine) {
 		sessionGroup.GET("/:id", middleware.Authentication(), controllers.GetChatSessionByID())
 		sessionGroup.PUT("/:id", middleware.Authentication(), controllers.UpdateChatSession())
 		sessionGroup.DELETE("/:id", middleware.Authentication(), controllers.DeleteChatSession())
+		sessionGroup.POST("/:id/chat", middleware.Authentication(), controllers.Chat())
+		sessionGroup.GET("/:id/context", middleware.Authentication(), controllers.GetChatContext())
 	}
 }
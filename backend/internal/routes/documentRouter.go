@@ -15,5 +15,15 @@ func DocumentRoutes(router *gin.Engine) {
 		documentGroup.GET("/:knowledgeBaseId/:docId", middleware.Authentication(), controllers.GetDocumentByID())
 		documentGroup.PUT("/:knowledgeBaseId/:docId", middleware.Authentication(), controllers.UpdateDocument())
 		documentGroup.DELETE("/:knowledgeBaseId/:docId", middleware.Authentication(), controllers.DeleteDocument())
+		documentGroup.GET("/:knowledgeBaseId/:docId/file", middleware.Authentication(), controllers.DownloadDocumentFile())
+		documentGroup.POST("/:knowledgeBaseId/:docId/versions", middleware.Authentication(), controllers.CreateDocumentVersion())
+		documentGroup.GET("/:knowledgeBaseId/:docId/versions", middleware.Authentication(), controllers.ListDocumentVersions())
+		documentGroup.POST("/:knowledgeBaseId/:docId/versions/:version/activate", middleware.Authentication(), controllers.ActivateDocumentVersion())
+		documentGroup.POST("/:knowledgeBaseId/upload-sessions", middleware.Authentication(), controllers.CreateUploadSession())
+		documentGroup.POST("/:knowledgeBaseId/upload-sessions/:sessionId/complete", middleware.Authentication(), controllers.CompleteUploadSession())
+		documentGroup.DELETE("/:knowledgeBaseId/upload-sessions/:sessionId", middleware.Authentication(), controllers.AbortUploadSession())
+		documentGroup.POST("/:knowledgeBaseId/archives", middleware.Authentication(), controllers.CreateArchiveImport())
+		documentGroup.GET("/:knowledgeBaseId/archives", middleware.Authentication(), controllers.ListArchiveImports())
+		documentGroup.GET("/:knowledgeBaseId/archives/:importId", middleware.Authentication(), controllers.GetArchiveImport())
 	}
 }
@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"backend/internal/controllers"
+	"backend/internal/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+func DocumentSourceRoutes(router *gin.Engine) {
+	sourceGroup := router.Group("/sources")
+	{
+		sourceGroup.POST("/:knowledgeBaseId", middleware.Authentication(), controllers.CreateDocumentSource())
+		sourceGroup.GET("/:knowledgeBaseId", middleware.Authentication(), controllers.ListDocumentSources())
+		sourceGroup.GET("/:knowledgeBaseId/history", middleware.Authentication(), controllers.ListSourceSyncHistory())
+		sourceGroup.GET("/:knowledgeBaseId/:sourceId", middleware.Authentication(), controllers.GetDocumentSource())
+		sourceGroup.PUT("/:knowledgeBaseId/:sourceId", middleware.Authentication(), controllers.UpdateDocumentSource())
+		sourceGroup.POST("/:knowledgeBaseId/:sourceId/sync", middleware.Authentication(), controllers.SyncDocumentSource())
+		sourceGroup.DELETE("/:knowledgeBaseId/:sourceId", middleware.Authentication(), controllers.DeleteDocumentSource())
+	}
+}
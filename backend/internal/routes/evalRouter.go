@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"backend/internal/controllers"
+	"backend/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func EvalRoutes(router *gin.Engine) {
+	setGroup := router.Group("/eval-sets")
+	{
+		setGroup.GET("/:setId", middleware.Authentication(), controllers.GetEvalSet())
+		setGroup.PUT("/:setId", middleware.Authentication(), controllers.UpdateEvalSet())
+		setGroup.DELETE("/:setId", middleware.Authentication(), controllers.DeleteEvalSet())
+		setGroup.POST("/:setId/cases", middleware.Authentication(), controllers.AddEvalCases())
+		setGroup.PUT("/:setId/cases/:caseId", middleware.Authentication(), controllers.UpdateEvalCase())
+		setGroup.DELETE("/:setId/cases/:caseId", middleware.Authentication(), controllers.DeleteEvalCase())
+		setGroup.POST("/:setId/runs", middleware.Authentication(), controllers.StartEvalRun())
+		setGroup.GET("/:setId/runs", middleware.Authentication(), controllers.ListEvalRuns())
+	}
+	runGroup := router.Group("/eval-runs")
+	{
+		runGroup.GET("/:runId", middleware.Authentication(), controllers.GetEvalRun())
+		runGroup.GET("/:runId/compare", middleware.Authentication(), controllers.CompareEvalRuns())
+	}
+}
@@ -14,5 +14,9 @@ func KnowledgeBaseRoutes(router *gin.Engine) {
 		kbGroup.GET("/:id", middleware.Authentication(), controllers.GetKnowledgeBaseByID())
 		kbGroup.PUT("/:id", middleware.Authentication(), controllers.UpdateKnowledgeBase())
 		kbGroup.DELETE("/:id", middleware.Authentication(), controllers.DeleteKnowledgeBase())
+		kbGroup.GET("/:id/feedback-report", middleware.Authentication(), controllers.GetFeedbackReport())
+		kbGroup.POST("/:id/eval-sets", middleware.Authentication(), controllers.CreateEvalSet())
+		kbGroup.GET("/:id/eval-sets", middleware.Authentication(), controllers.ListEvalSets())
+		kbGroup.POST("/:id/eval-sets/generate", middleware.Authentication(), controllers.GenerateEvalSet())
 	}
 }
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"backend/internal/controllers"
+	"backend/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SearchRoutes(router *gin.Engine) {
+	searchGroup := router.Group("/search")
+	{
+		searchGroup.POST("/:knowledgeBaseId", middleware.Authentication(), controllers.Search())
+		searchGroup.POST("/:knowledgeBaseId/prompt-preview", middleware.Authentication(), controllers.PromptPreview())
+	}
+}
@@ -1,11 +1,31 @@
 package schemas
 
+// ChatSessionSettings override the chat defaults for a session. Omitted
+// fields use the defaults; the knowledge base decides which values are
+// allowed. The graph retrieval mode is recognized but rejected, since no
+// knowledge graph is built from the documents.
+type ChatSessionSettings struct {
+	Model         string   `json:"model" binding:"max=100"`
+	Temperature   *float64 `json:"temperature" binding:"omitempty,min=0,max=2"`
+	TopK          int      `json:"top_k" binding:"omitempty,min=1,max=50"`
+	RetrievalMode string   `json:"retrieval_mode" binding:"omitempty,oneof=vector keyword hybrid graph none"`
+}
+
+// CreateChatSessionRequest attaches the knowledge base KnowledgeBaseID or
+// the knowledge bases KnowledgeBaseIDs. With several, KnowledgeBaseID picks
+// the one whose settings apply and defaults to the first.
 type CreateChatSessionRequest struct {
-	Title           string `json:"title" binding:"required"`
-	KnowledgeBaseID *uint  `json:"knowledge_base_id,omitempty"`
+	Title            string               `json:"title" binding:"required"`
+	KnowledgeBaseID  *uint                `json:"knowledge_base_id,omitempty"`
+	KnowledgeBaseIDs []uint               `json:"knowledge_base_ids" binding:"max=10"`
+	Settings         *ChatSessionSettings `json:"settings"`
 }
 
+// UpdateChatSessionRequest replaces the settings when Settings is given and
+// keeps them otherwise. The knowledge bases are replaced like on create.
 type UpdateChatSessionRequest struct {
-	Title           string `json:"title"`
-	KnowledgeBaseID *uint  `json:"knowledge_base_id,omitempty"`
+	Title            string               `json:"title"`
+	KnowledgeBaseID  *uint                `json:"knowledge_base_id,omitempty"`
+	KnowledgeBaseIDs []uint               `json:"knowledge_base_ids" binding:"max=10"`
+	Settings         *ChatSessionSettings `json:"settings"`
 }
@@ -7,4 +7,5 @@ type CreateDocumentRequest struct {
 
 type UpdateDocumentRequest struct {
 	Name	string `json:"name"`
+	Metadata	*map[string]interface{} `json:"metadata"`
 }
\ No newline at end of file
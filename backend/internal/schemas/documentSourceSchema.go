@@ -0,0 +1,16 @@
+package schemas
+
+type CreateDocumentSourceRequest struct {
+	Type           string   `json:"type" binding:"required"`
+	URL            string   `json:"url" binding:"required"`
+	MaxDepth       *int     `json:"max_depth" binding:"omitempty,min=0,max=10"`
+	MaxPages       int      `json:"max_pages" binding:"omitempty,min=1,max=10000"`
+	AllowedDomains []string `json:"allowed_domains"`
+	Branch         string   `json:"branch"`
+	Include        []string `json:"include"`
+	Schedule       string   `json:"schedule"`
+}
+
+type UpdateDocumentSourceRequest struct {
+	Schedule *string `json:"schedule"`
+}
@@ -0,0 +1,51 @@
+package schemas
+
+// EvalCaseRequest is a golden question. ExpectedSources are the IDs or names
+// of the documents that should be retrieved for it.
+type EvalCaseRequest struct {
+	Question        string   `json:"question" binding:"required,max=4000"`
+	ExpectedAnswer  string   `json:"expected_answer" binding:"max=8000"`
+	ExpectedSources []string `json:"expected_sources" binding:"max=50"`
+}
+
+type CreateEvalSetRequest struct {
+	Name        string            `json:"name" binding:"required,max=255"`
+	Description string            `json:"description"`
+	Cases       []EvalCaseRequest `json:"cases" binding:"max=1000,dive"`
+}
+
+// GenerateEvalSetRequest asks for Count questions written by the LLM from
+// chunks of the knowledge base, or only of DocumentIDs.
+type GenerateEvalSetRequest struct {
+	Name        string `json:"name" binding:"required,max=255"`
+	Description string `json:"description"`
+	Count       int    `json:"count" binding:"omitempty,min=1,max=200"`
+	DocumentIDs []uint `json:"document_ids" binding:"max=100"`
+}
+
+type UpdateEvalSetRequest struct {
+	Name        *string `json:"name" binding:"omitempty,min=1,max=255"`
+	Description *string `json:"description"`
+}
+
+// UpdateEvalCaseRequest edits a case; omitted fields keep their value.
+type UpdateEvalCaseRequest struct {
+	Question        *string   `json:"question" binding:"omitempty,min=1,max=4000"`
+	ExpectedAnswer  *string   `json:"expected_answer" binding:"omitempty,max=8000"`
+	ExpectedSources *[]string `json:"expected_sources" binding:"omitempty,max=50"`
+}
+
+type AddEvalCasesRequest struct {
+	Cases []EvalCaseRequest `json:"cases" binding:"required,min=1,max=1000,dive"`
+}
+
+// StartEvalRunRequest overrides the knowledge base's retrieval settings for
+// a run. Judge picks how answers are scored: string (default), llm or none
+// to only measure retrieval.
+type StartEvalRunRequest struct {
+	Label   string `json:"label" binding:"max=255"`
+	TopK    int    `json:"top_k" binding:"omitempty,min=1,max=50"`
+	Mode    string `json:"mode" binding:"omitempty,oneof=vector keyword hybrid"`
+	Rewrite string `json:"rewrite" binding:"omitempty,oneof=none condense multi_query hyde"`
+	Judge   string `json:"judge" binding:"omitempty,oneof=string llm none"`
+}
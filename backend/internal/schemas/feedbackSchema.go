@@ -0,0 +1,18 @@
+package schemas
+
+// FeedbackRequest rates an assistant answer: 1 for thumbs up, -1 for thumbs
+// down. Reason categorizes what was wrong with a bad answer.
+type FeedbackRequest struct {
+	Rating  int    `json:"rating" binding:"required,oneof=1 -1"`
+	Reason  string `json:"reason" binding:"omitempty,oneof=incorrect incomplete irrelevant outdated missing_citation not_in_knowledge_base other"`
+	Comment string `json:"comment" binding:"max=4000"`
+}
+
+// FeedbackReportRequest selects the time range of a feedback report. From
+// and To are dates (YYYY-MM-DD); To is inclusive.
+type FeedbackReportRequest struct {
+	From     string `form:"from" binding:"omitempty,datetime=2006-01-02"`
+	To       string `form:"to" binding:"omitempty,datetime=2006-01-02"`
+	Interval string `form:"interval" binding:"omitempty,oneof=day week month"`
+	Limit    int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
@@ -1,11 +1,31 @@
 package schemas
 
 type CreateKnowledgeBaseRequest struct {
-	Name        string `json:"name" binding:"required"`
-	Description string `json:"description"`
+	Name           string  `json:"name" binding:"required"`
+	Description    string  `json:"description"`
+	QueryRewrite   string  `json:"query_rewrite" binding:"omitempty,oneof=none condense multi_query hyde"`
+	SystemPrompt   string  `json:"system_prompt"`
+	MinRelevance   float64 `json:"min_relevance" binding:"min=0,max=1"`
+	FallbackAnswer string  `json:"fallback_answer" binding:"max=2000"`
+	GroundingCheck string  `json:"grounding_check" binding:"omitempty,oneof=off flag strip"`
+	// AllowedModels and AllowedModes restrict what chat sessions may pick,
+	// empty allows all; MaxTopK caps their chunks per question, 0 for none.
+	AllowedModels []string `json:"allowed_models" binding:"max=20"`
+	AllowedModes  []string `json:"allowed_modes" binding:"max=4,dive,oneof=vector keyword hybrid none"`
+	MaxTopK       int      `json:"max_top_k" binding:"min=0,max=50"`
 }
 
 type UpdateKnowledgeBaseRequest struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
-}
\ No newline at end of file
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	QueryRewrite string `json:"query_rewrite" binding:"omitempty,oneof=none condense multi_query hyde"`
+	// SystemPrompt is left as is when omitted; an empty string restores the
+	// default template.
+	SystemPrompt   *string   `json:"system_prompt"`
+	MinRelevance   *float64  `json:"min_relevance" binding:"omitempty,min=0,max=1"`
+	FallbackAnswer *string   `json:"fallback_answer" binding:"omitempty,max=2000"`
+	GroundingCheck string    `json:"grounding_check" binding:"omitempty,oneof=off flag strip"`
+	AllowedModels  *[]string `json:"allowed_models" binding:"omitempty,max=20"`
+	AllowedModes   *[]string `json:"allowed_modes" binding:"omitempty,max=4,dive,oneof=vector keyword hybrid none"`
+	MaxTopK        *int      `json:"max_top_k" binding:"omitempty,min=0,max=50"`
+}
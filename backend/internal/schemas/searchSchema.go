@@ -0,0 +1,40 @@
+package schemas
+
+type SearchRequest struct {
+	Query  string `json:"query" binding:"required"`
+	Filter string `json:"filter"`
+	TopK   int    `json:"top_k" binding:"omitempty,min=1,max=50"`
+	Mode   string `json:"mode" binding:"omitempty,oneof=vector keyword hybrid"`
+}
+
+type ChatRequest struct {
+	Message string `json:"message" binding:"required"`
+	Filter  string `json:"filter"`
+	TopK    int    `json:"top_k" binding:"omitempty,min=1,max=50"`
+	Mode    string `json:"mode" binding:"omitempty,oneof=vector keyword hybrid none"`
+}
+
+// EditChatMessageRequest replaces a user message with Message and answers it
+// again.
+type EditChatMessageRequest struct {
+	Message string `json:"message" binding:"required"`
+	Filter  string `json:"filter"`
+	TopK    int    `json:"top_k" binding:"omitempty,min=1,max=50"`
+	Mode    string `json:"mode" binding:"omitempty,oneof=vector keyword hybrid none"`
+}
+
+type RegenerateChatMessageRequest struct {
+	Filter string `json:"filter"`
+	TopK   int    `json:"top_k" binding:"omitempty,min=1,max=50"`
+	Mode   string `json:"mode" binding:"omitempty,oneof=vector keyword hybrid none"`
+}
+
+// PromptPreviewRequest renders the chat prompt for a sample query. Template
+// previews an unsaved template instead of the knowledge base's own.
+type PromptPreviewRequest struct {
+	Query    string  `json:"query" binding:"required"`
+	Template *string `json:"template"`
+	Filter   string  `json:"filter"`
+	TopK     int     `json:"top_k" binding:"omitempty,min=1,max=50"`
+	Mode     string  `json:"mode" binding:"omitempty,oneof=vector keyword hybrid"`
+}
@@ -0,0 +1,26 @@
+package schemas
+
+type CreateUploadSessionRequest struct {
+	FileName    string                 `json:"file_name" binding:"required"`
+	FileType    string                 `json:"file_type" binding:"required"`
+	Size        int64                  `json:"size" binding:"required,gt=0"`
+	ContentType string                 `json:"content_type"`
+	Description string                 `json:"description"`
+	Metadata    map[string]interface{} `json:"metadata"`
+	SHA256      string                 `json:"sha256" binding:"omitempty,len=64,hexadecimal"`
+	OnDuplicate string                 `json:"on_duplicate"`
+	DocumentID  *uint                  `json:"document_id,omitempty"`
+}
+
+type UploadPart struct {
+	PartNumber int    `json:"part_number" binding:"required,min=1"`
+	ETag       string `json:"etag" binding:"required"`
+}
+
+// CompleteUploadSessionRequest lists the parts of a multipart upload. ETag
+// is the one MinIO returned for a single PUT; when given it must match the
+// stored object.
+type CompleteUploadSessionRequest struct {
+	Parts []UploadPart `json:"parts" binding:"dive"`
+	ETag  string       `json:"etag"`
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// LLMMessage is one message of a chat completion request. Assistant
+// messages may call tools, whose results come back as "tool" messages
+// naming the call they answer.
+type LLMMessage struct {
+	Role       string        `json:"role"`
+	Content    string        `json:"content"`
+	ToolCalls  []LLMToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string        `json:"tool_call_id,omitempty"`
+}
+
+// LLMToolCall is a function call requested by the model. Arguments is a
+// JSON object encoded as a string.
+type LLMToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// LLMTool offers a function to the model. Parameters is the JSON schema of
+// its arguments.
+type LLMTool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description"`
+		Parameters  json.RawMessage `json:"parameters"`
+	} `json:"function"`
+}
+
+// LLMRequest describes a completion. Zero values use the service defaults.
+// ToolChoice is "auto", "none" or "required" when Tools are offered.
+type LLMRequest struct {
+	Model       string
+	Messages    []LLMMessage
+	Temperature *float64
+	MaxTokens   int
+	Tools       []LLMTool
+	ToolChoice  string
+}
+
+// LLMResponse is the generated message and the tokens it cost. ToolCalls
+// are set when the model asks for tool results before answering.
+type LLMResponse struct {
+	Content          string
+	ToolCalls        []LLMToolCall
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// LLMService calls an OpenAI-compatible /chat/completions endpoint.
+type LLMService struct {
+	baseURL    string
+	apiKey     string
+	model      string
+	httpClient *http.Client
+}
+
+func NewLLMService(baseURL, apiKey, model string) *LLMService {
+	return &LLMService{
+		baseURL:    baseURL,
+		apiKey:     apiKey,
+		model:      model,
+		httpClient: &http.Client{Timeout: 120 * time.Second},
+	}
+}
+
+type chatCompletionRequest struct {
+	Model       string       `json:"model"`
+	Messages    []LLMMessage `json:"messages"`
+	Temperature *float64     `json:"temperature,omitempty"`
+	MaxTokens   int          `json:"max_tokens,omitempty"`
+	Tools       []LLMTool    `json:"tools,omitempty"`
+	ToolChoice  string       `json:"tool_choice,omitempty"`
+}
+
+type chatCompletionResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message LLMMessage `json:"message"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// Complete returns the model's reply to the messages.
+func (s *LLMService) Complete(ctx context.Context, r LLMRequest) (*LLMResponse, error) {
+	model := r.Model
+	if model == "" {
+		model = s.model
+	}
+	b, err := json.Marshal(chatCompletionRequest{
+		Model:       model,
+		Messages:    r.Messages,
+		Temperature: r.Temperature,
+		MaxTokens:   r.MaxTokens,
+		Tools:       r.Tools,
+		ToolChoice:  r.ToolChoice,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+"/chat/completions", bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call LLM API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("LLM API returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	var out chatCompletionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("failed to decode LLM response: %w", err)
+	}
+	if len(out.Choices) == 0 {
+		return nil, fmt.Errorf("LLM API returned no choices")
+	}
+	return &LLMResponse{
+		Content:          out.Choices[0].Message.Content,
+		ToolCalls:        out.Choices[0].Message.ToolCalls,
+		Model:            out.Model,
+		PromptTokens:     out.Usage.PromptTokens,
+		CompletionTokens: out.Usage.CompletionTokens,
+	}, nil
+}
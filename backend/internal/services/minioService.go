@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
@@ -13,16 +16,29 @@ type MinioService interface {
 	EnsureBucket(ctx context.Context, bucket string) error
 	UploadObject(ctx context.Context, bucket, objectName string, data io.Reader, size int64, contentType string) error
 	DownloadObject(ctx context.Context, bucket, objectName string) (io.Reader, error)
+	GetObject(ctx context.Context, bucket, objectName string) (*minio.Object, error)
+	PresignedGetObject(ctx context.Context, bucket, objectName string, expiry time.Duration, params url.Values) (*url.URL, error)
+	RemoveObject(ctx context.Context, bucket, objectName string) error
+	StatObject(ctx context.Context, bucket, objectName string) (minio.ObjectInfo, error)
+	PresignedPutObject(ctx context.Context, bucket, objectName string, expiry time.Duration) (*url.URL, error)
+	NewMultipartUpload(ctx context.Context, bucket, objectName, contentType string) (string, error)
+	PresignedUploadPart(ctx context.Context, bucket, objectName, uploadID string, partNumber int, expiry time.Duration) (*url.URL, error)
+	CompleteMultipartUpload(ctx context.Context, bucket, objectName, uploadID string, parts []minio.CompletePart) error
+	AbortMultipartUpload(ctx context.Context, bucket, objectName, uploadID string) error
 }
 
 type MinIOStorage struct {
 	client *minio.Client
 }
 
-func NewMinIOStorage(endpoint, accessKey, secretKey string, useSSL bool) (*MinIOStorage, error) {
+// NewMinIOStorage creates a client for the given endpoint. Setting the region
+// avoids a bucket location lookup, so a client for a public endpoint that is
+// unreachable from the server can still sign URLs.
+func NewMinIOStorage(endpoint, accessKey, secretKey string, useSSL bool, region string) (*MinIOStorage, error) {
 	client, err := minio.New(endpoint, &minio.Options{
 		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
 		Secure: useSSL,
+		Region: region,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create MinIO client: %w", err)
@@ -70,3 +86,93 @@ func (s *MinIOStorage) DownloadObject(ctx context.Context, bucket, objectName st
 
 	return object, nil
 }
+
+// GetObject opens an object for reading. The returned object is seekable, so
+// it can serve HTTP range requests.
+func (s *MinIOStorage) GetObject(ctx context.Context, bucket, objectName string) (*minio.Object, error) {
+	object, err := s.client.GetObject(ctx, bucket, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+
+	return object, nil
+}
+
+func (s *MinIOStorage) PresignedGetObject(ctx context.Context, bucket, objectName string, expiry time.Duration, params url.Values) (*url.URL, error) {
+	u, err := s.client.PresignedGetObject(ctx, bucket, objectName, expiry, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign download: %w", err)
+	}
+
+	return u, nil
+}
+
+func (s *MinIOStorage) RemoveObject(ctx context.Context, bucket, objectName string) error {
+	if err := s.client.RemoveObject(ctx, bucket, objectName, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to remove object: %w", err)
+	}
+
+	return nil
+}
+
+func (s *MinIOStorage) StatObject(ctx context.Context, bucket, objectName string) (minio.ObjectInfo, error) {
+	info, err := s.client.StatObject(ctx, bucket, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		return minio.ObjectInfo{}, fmt.Errorf("failed to stat object: %w", err)
+	}
+
+	return info, nil
+}
+
+func (s *MinIOStorage) PresignedPutObject(ctx context.Context, bucket, objectName string, expiry time.Duration) (*url.URL, error) {
+	u, err := s.client.PresignedPutObject(ctx, bucket, objectName, expiry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign upload: %w", err)
+	}
+
+	return u, nil
+}
+
+func (s *MinIOStorage) NewMultipartUpload(ctx context.Context, bucket, objectName, contentType string) (string, error) {
+	core := minio.Core{Client: s.client}
+	uploadID, err := core.NewMultipartUpload(ctx, bucket, objectName, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return "", fmt.Errorf("failed to start multipart upload: %w", err)
+	}
+
+	return uploadID, nil
+}
+
+func (s *MinIOStorage) PresignedUploadPart(ctx context.Context, bucket, objectName, uploadID string, partNumber int, expiry time.Duration) (*url.URL, error) {
+	params := url.Values{}
+	params.Set("partNumber", strconv.Itoa(partNumber))
+	params.Set("uploadId", uploadID)
+
+	u, err := s.client.Presign(ctx, "PUT", bucket, objectName, expiry, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign part %d: %w", partNumber, err)
+	}
+
+	return u, nil
+}
+
+// CompleteMultipartUpload assembles the parts and returns the ETag of the
+// resulting object.
+func (s *MinIOStorage) CompleteMultipartUpload(ctx context.Context, bucket, objectName, uploadID string, parts []minio.CompletePart) (string, error) {
+	core := minio.Core{Client: s.client}
+	info, err := core.CompleteMultipartUpload(ctx, bucket, objectName, uploadID, parts, minio.PutObjectOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+
+	return info.ETag, nil
+}
+
+func (s *MinIOStorage) AbortMultipartUpload(ctx context.Context, bucket, objectName, uploadID string) error {
+	core := minio.Core{Client: s.client}
+	if err := core.AbortMultipartUpload(ctx, bucket, objectName, uploadID); err != nil {
+		return fmt.Errorf("failed to abort multipart upload: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// QdrantHit is a point returned by a vector search.
+type QdrantHit struct {
+	ID      string                 `json:"id"`
+	Score   float64                `json:"score"`
+	Payload map[string]interface{} `json:"payload"`
+}
+
+// QdrantService reads the chunk vectors written by the worker.
+type QdrantService struct {
+	baseURL    string
+	apiKey     string
+	collection string
+	httpClient *http.Client
+}
+
+func NewQdrantService(baseURL, apiKey, collection string) *QdrantService {
+	return &QdrantService{
+		baseURL:    baseURL,
+		apiKey:     apiKey,
+		collection: collection,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Search returns the limit points closest to vector that match filter, best
+// first.
+func (s *QdrantService) Search(ctx context.Context, vector []float32, filter map[string]interface{}, limit int) ([]QdrantHit, error) {
+	body := map[string]interface{}{
+		"vector":       vector,
+		"filter":       filter,
+		"limit":        limit,
+		"with_payload": true,
+	}
+	var out struct {
+		Result []QdrantHit `json:"result"`
+	}
+	if err := s.do(ctx, http.MethodPost, "/collections/"+s.collection+"/points/search", body, &out); err != nil {
+		return nil, fmt.Errorf("failed to search points: %w", err)
+	}
+	return out.Result, nil
+}
+
+// GetPoints returns the points with the given IDs that match filter, in no
+// particular order.
+func (s *QdrantService) GetPoints(ctx context.Context, ids []string, filter map[string]interface{}) ([]QdrantHit, error) {
+	must := []interface{}{map[string]interface{}{"has_id": ids}}
+	if filter != nil {
+		must = append(must, filter)
+	}
+	body := map[string]interface{}{
+		"filter":       map[string]interface{}{"must": must},
+		"limit":        len(ids),
+		"with_payload": true,
+	}
+	var out struct {
+		Result struct {
+			Points []QdrantHit `json:"points"`
+		} `json:"result"`
+	}
+	if err := s.do(ctx, http.MethodPost, "/collections/"+s.collection+"/points/scroll", body, &out); err != nil {
+		return nil, fmt.Errorf("failed to load points: %w", err)
+	}
+	return out.Result.Points, nil
+}
+
+func (s *QdrantService) do(ctx context.Context, method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.apiKey != "" {
+		req.Header.Set("api-key", s.apiKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("qdrant returned %d: %s", resp.StatusCode, string(respBody))
+	}
+	if out != nil {
+		return json.Unmarshal(respBody, out)
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Calculator evaluates arithmetic expressions, so the model does not have
+// to compute figures itself.
+type Calculator struct{}
+
+func (Calculator) Name() string {
+	return NameCalculator
+}
+
+func (Calculator) Description() string {
+	return "Evaluates an arithmetic expression. Supports + - * / % ^, parentheses, " +
+		"the constants pi and e and the functions sqrt, abs, round, floor, ceil, ln, log10, min and max."
+}
+
+func (Calculator) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"expression": {"type": "string", "description": "e.g. (1250 * 0.19) / 12"}
+		},
+		"required": ["expression"]
+	}`)
+}
+
+func (Calculator) Call(_ context.Context, args json.RawMessage) (string, error) {
+	var in struct {
+		Expression string `json:"expression"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return "", err
+	}
+	v, err := Evaluate(in.Expression)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64), nil
+}
+
+// maxExpressionLength bounds the input, and with it the recursion depth, of
+// Evaluate.
+const maxExpressionLength = 1000
+
+// Evaluate computes an arithmetic expression.
+func Evaluate(expression string) (float64, error) {
+	if len(expression) > maxExpressionLength {
+		return 0, fmt.Errorf("expression is longer than %d characters", maxExpressionLength)
+	}
+	p := &calcParser{input: expression}
+	v, err := p.expr()
+	if err != nil {
+		return 0, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return 0, fmt.Errorf("unexpected %q at position %d", p.input[p.pos:], p.pos+1)
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("result is not a finite number")
+	}
+	return v, nil
+}
+
+// calcParser is a recursive-descent parser that evaluates as it parses:
+//
+//	expr   = term { ("+" | "-") term }
+//	term   = unary { ("*" | "/" | "%") unary }
+//	unary  = ("-" | "+") unary | power
+//	power  = atom [ "^" unary ]
+//	atom   = number | name | name "(" expr { "," expr } ")" | "(" expr ")"
+type calcParser struct {
+	input string
+	pos   int
+}
+
+func (p *calcParser) skipSpace() {
+	for p.pos < len(p.input) && p.input[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// accept consumes op if it comes next.
+func (p *calcParser) accept(op byte) bool {
+	p.skipSpace()
+	if p.pos < len(p.input) && p.input[p.pos] == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *calcParser) expr() (float64, error) {
+	v, err := p.term()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		switch {
+		case p.accept('+'):
+			w, err := p.term()
+			if err != nil {
+				return 0, err
+			}
+			v += w
+		case p.accept('-'):
+			w, err := p.term()
+			if err != nil {
+				return 0, err
+			}
+			v -= w
+		default:
+			return v, nil
+		}
+	}
+}
+
+func (p *calcParser) term() (float64, error) {
+	v, err := p.unary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		var op byte
+		switch {
+		case p.accept('*'):
+			op = '*'
+		case p.accept('/'):
+			op = '/'
+		case p.accept('%'):
+			op = '%'
+		default:
+			return v, nil
+		}
+		w, err := p.unary()
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case '*':
+			v *= w
+		case '/', '%':
+			if w == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			if op == '/' {
+				v /= w
+			} else {
+				v = math.Mod(v, w)
+			}
+		}
+	}
+}
+
+func (p *calcParser) unary() (float64, error) {
+	if p.accept('-') {
+		v, err := p.unary()
+		return -v, err
+	}
+	if p.accept('+') {
+		return p.unary()
+	}
+	return p.power()
+}
+
+func (p *calcParser) power() (float64, error) {
+	v, err := p.atom()
+	if err != nil {
+		return 0, err
+	}
+	if p.accept('^') {
+		// right-associative: 2^3^2 is 2^9
+		w, err := p.unary()
+		if err != nil {
+			return 0, err
+		}
+		v = math.Pow(v, w)
+	}
+	return v, nil
+}
+
+func (p *calcParser) atom() (float64, error) {
+	p.skipSpace()
+	if p.pos >= len(p.input) {
+		return 0, fmt.Errorf("unexpected end of expression")
+	}
+	if p.accept('(') {
+		v, err := p.expr()
+		if err != nil {
+			return 0, err
+		}
+		if !p.accept(')') {
+			return 0, fmt.Errorf("missing closing parenthesis")
+		}
+		return v, nil
+	}
+
+	start := p.pos
+	c := rune(p.input[p.pos])
+	if unicode.IsDigit(c) || c == '.' {
+		for p.pos < len(p.input) && (unicode.IsDigit(rune(p.input[p.pos])) || p.input[p.pos] == '.') {
+			p.pos++
+		}
+		// exponent notation, e.g. 1e-3
+		if p.pos < len(p.input) && (p.input[p.pos] == 'e' || p.input[p.pos] == 'E') {
+			end := p.pos + 1
+			if end < len(p.input) && (p.input[end] == '-' || p.input[end] == '+') {
+				end++
+			}
+			if end < len(p.input) && unicode.IsDigit(rune(p.input[end])) {
+				p.pos = end
+				for p.pos < len(p.input) && unicode.IsDigit(rune(p.input[p.pos])) {
+					p.pos++
+				}
+			}
+		}
+		v, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number %q", p.input[start:p.pos])
+		}
+		return v, nil
+	}
+	if !unicode.IsLetter(c) {
+		return 0, fmt.Errorf("unexpected %q at position %d", string(c), p.pos+1)
+	}
+	for p.pos < len(p.input) && (unicode.IsLetter(rune(p.input[p.pos])) || unicode.IsDigit(rune(p.input[p.pos]))) {
+		p.pos++
+	}
+	name := strings.ToLower(p.input[start:p.pos])
+	if !p.accept('(') {
+		switch name {
+		case "pi":
+			return math.Pi, nil
+		case "e":
+			return math.E, nil
+		}
+		return 0, fmt.Errorf("unknown constant %q", name)
+	}
+
+	var args []float64
+	if !p.accept(')') {
+		for {
+			v, err := p.expr()
+			if err != nil {
+				return 0, err
+			}
+			args = append(args, v)
+			if p.accept(')') {
+				break
+			}
+			if !p.accept(',') {
+				return 0, fmt.Errorf("missing closing parenthesis")
+			}
+		}
+	}
+	return callFunction(name, args)
+}
+
+func callFunction(name string, args []float64) (float64, error) {
+	unary := map[string]func(float64) float64{
+		"sqrt":  math.Sqrt,
+		"abs":   math.Abs,
+		"round": math.Round,
+		"floor": math.Floor,
+		"ceil":  math.Ceil,
+		"ln":    math.Log,
+		"log10": math.Log10,
+	}
+	if f, ok := unary[name]; ok {
+		if len(args) != 1 {
+			return 0, fmt.Errorf("%s takes one argument", name)
+		}
+		return f(args[0]), nil
+	}
+	switch name {
+	case "min", "max":
+		if len(args) == 0 {
+			return 0, fmt.Errorf("%s takes at least one argument", name)
+		}
+		v := args[0]
+		for _, a := range args[1:] {
+			if name == "min" {
+				v = math.Min(v, a)
+			} else {
+				v = math.Max(v, a)
+			}
+		}
+		return v, nil
+	}
+	return 0, fmt.Errorf("unknown function %q", name)
+}
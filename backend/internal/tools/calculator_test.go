@@ -0,0 +1,80 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		expr string
+		want float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3},
+		{"2 ^ 3 ^ 2", 512},
+		{"-2 ^ 2", -4},
+		{"2 ^ -1", 0.5},
+		{"7 % 3 + 8 / 4", 3},
+		{"--3", 3},
+		{"1e3 + 2.5E-1", 1000.25},
+		{".5 * 4", 2},
+		{"(1250 * 0.19) / 12", 19.791666666666668},
+		{"sqrt(16) + abs(-2) + round(2.5) + floor(2.7) + ceil(2.1)", 4 + 2 + 3 + 2 + 3},
+		{"ln(e) + log10(1000)", 4},
+		{"min(3, 1, 2) + MAX(3, 1, 2)", 4},
+		{"2 * pi", 2 * math.Pi},
+	}
+	for _, tt := range tests {
+		got, err := Evaluate(tt.expr)
+		if err != nil {
+			t.Errorf("Evaluate(%q): %v", tt.expr, err)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Evaluate(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"", "unexpected end of expression"},
+		{"1 +", "unexpected end of expression"},
+		{"1 / 0", "division by zero"},
+		{"5 % 0", "division by zero"},
+		{"(1 + 2", "missing closing parenthesis"},
+		{"max(1, 2", "missing closing parenthesis"},
+		{"1 2", `unexpected "2" at position 3`},
+		{"1 # 2", `unexpected "# 2" at position 3`},
+		{"tau", `unknown constant "tau"`},
+		{"exp(1)", `unknown function "exp"`},
+		{"sqrt(1, 2)", "sqrt takes one argument"},
+		{"min()", "min takes at least one argument"},
+		{"sqrt(-1)", "result is not a finite number"},
+		{"10 ^ 400", "result is not a finite number"},
+		{strings.Repeat("1+", maxExpressionLength), "expression is longer than 1000 characters"},
+	}
+	for _, tt := range tests {
+		if _, err := Evaluate(tt.expr); err == nil || err.Error() != tt.want {
+			t.Errorf("Evaluate(%q) error = %v, want %q", tt.expr, err, tt.want)
+		}
+	}
+}
+
+func TestCalculatorCall(t *testing.T) {
+	got, err := Calculator{}.Call(context.Background(), json.RawMessage(`{"expression": "0.1 + 0.2"}`))
+	if err != nil || got != "0.30000000000000004" {
+		t.Errorf("Call = %q, %v", got, err)
+	}
+	if _, err := (Calculator{}).Call(context.Background(), json.RawMessage(`{"expression": 1}`)); err == nil || !strings.HasPrefix(err.Error(), "invalid arguments") {
+		t.Errorf("Call with a number: error = %v, want invalid arguments", err)
+	}
+}
@@ -0,0 +1,182 @@
+package tools
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"backend/internal/models"
+)
+
+const (
+	// maxCSVBytes caps the size of a CSV file query_csv loads.
+	maxCSVBytes = 20 << 20
+	// maxOutputRows caps the rows of a result sent back to the model.
+	maxOutputRows = 100
+	// maxListedTables caps the tables named in the tool description.
+	maxListedTables = 50
+)
+
+// CSVOpener reads the stored file of a document.
+type CSVOpener func(ctx context.Context, doc *models.Document) (io.ReadCloser, error)
+
+// CSVQuery runs SQL over the CSV documents of a chat's knowledge bases. Each
+// document is a table named after the document, with or without its
+// extension; see csvsql.go for the dialect.
+type CSVQuery struct {
+	documents []models.Document
+	open      CSVOpener
+	// tables caches loaded documents for the rest of the turn
+	tables map[uint]*csvTable
+}
+
+func NewCSVQuery(documents []models.Document, open CSVOpener) *CSVQuery {
+	return &CSVQuery{documents: documents, open: open, tables: map[uint]*csvTable{}}
+}
+
+func (t *CSVQuery) Name() string {
+	return NameQueryCSV
+}
+
+func (t *CSVQuery) Description() string {
+	names := make([]string, 0, len(t.documents))
+	for i, doc := range t.documents {
+		if i == maxListedTables {
+			names = append(names, fmt.Sprintf("and %d more", len(t.documents)-i))
+			break
+		}
+		names = append(names, strconv.Quote(doc.Name))
+	}
+	return "Runs a SQL query over a CSV document and returns the result as CSV. " +
+		"Supports SELECT [DISTINCT] ... FROM table [WHERE] [GROUP BY] [HAVING] [ORDER BY] [LIMIT], " +
+		"comparisons, LIKE, IN, BETWEEN, IS NULL, arithmetic, LOWER, UPPER, TRIM, LENGTH, ROUND, ABS, COALESCE " +
+		"and COUNT, SUM, AVG, MIN, MAX; no joins or subqueries. Quote names with spaces or dots in double quotes. " +
+		"An unknown column error lists the columns. Tables: " + strings.Join(names, ", ")
+}
+
+func (t *CSVQuery) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"sql": {"type": "string", "description": "e.g. SELECT region, SUM(amount) AS total FROM \"sales.csv\" GROUP BY region ORDER BY total DESC"}
+		},
+		"required": ["sql"]
+	}`)
+}
+
+func (t *CSVQuery) Call(ctx context.Context, args json.RawMessage) (string, error) {
+	var in struct {
+		SQL string `json:"sql"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return "", err
+	}
+	q, err := parseSQL(in.SQL)
+	if err != nil {
+		return "", err
+	}
+	doc := t.document(q.table)
+	if doc == nil {
+		return "", fmt.Errorf("unknown table %q", q.table)
+	}
+	table, err := t.load(ctx, doc)
+	if err != nil {
+		return "", err
+	}
+	result, err := q.execute(table)
+	if err != nil {
+		return "", err
+	}
+	return formatResult(result), nil
+}
+
+// document resolves a table name to a document.
+func (t *CSVQuery) document(table string) *models.Document {
+	for _, match := range []func(name string) bool{
+		func(name string) bool { return strings.EqualFold(name, table) },
+		func(name string) bool { return strings.EqualFold(strings.TrimSuffix(name, path.Ext(name)), table) },
+	} {
+		for i := range t.documents {
+			if match(t.documents[i].Name) {
+				return &t.documents[i]
+			}
+		}
+	}
+	return nil
+}
+
+func (t *CSVQuery) load(ctx context.Context, doc *models.Document) (*csvTable, error) {
+	if table, ok := t.tables[doc.ID]; ok {
+		return table, nil
+	}
+	if doc.Size > maxCSVBytes {
+		return nil, fmt.Errorf("%s is too large to query", doc.Name)
+	}
+	rc, err := t.open(ctx, doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", doc.Name, err)
+	}
+	defer rc.Close()
+
+	r := csv.NewReader(io.LimitReader(rc, maxCSVBytes))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	header, err := r.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s is empty", doc.Name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", doc.Name, err)
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+	var rows [][]string
+	for {
+		row, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", doc.Name, err)
+		}
+		rows = append(rows, row)
+	}
+
+	table := newCSVTable(header, rows)
+	t.tables[doc.ID] = table
+	return table, nil
+}
+
+// formatResult renders a result as CSV with a row count.
+func formatResult(result *sqlResult) string {
+	var sb strings.Builder
+	w := csv.NewWriter(&sb)
+	w.Write(result.columns)
+	for i, row := range result.rows {
+		if i == maxOutputRows {
+			break
+		}
+		record := make([]string, len(row))
+		for j, v := range row {
+			record[j] = formatValue(v)
+		}
+		w.Write(record)
+	}
+	w.Flush()
+
+	if len(result.rows) > maxOutputRows {
+		fmt.Fprintf(&sb, "(first %d of %d rows; aggregate or add a LIMIT for fewer)", maxOutputRows, len(result.rows))
+	} else if len(result.rows) == 1 {
+		sb.WriteString("(1 row)")
+	} else {
+		fmt.Fprintf(&sb, "(%d rows)", len(result.rows))
+	}
+	return sb.String()
+}
@@ -0,0 +1,1399 @@
+package tools
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// This file implements the SQL dialect of query_csv: a single SELECT over one
+// table, evaluated in memory. It is deliberately small, so a query can only
+// read the CSV it names:
+//
+//	SELECT [DISTINCT] * | expr [[AS] alias], ...
+//	FROM table
+//	[WHERE expr] [GROUP BY expr, ...] [HAVING expr]
+//	[ORDER BY expr [ASC | DESC], ...] [LIMIT n [OFFSET n]]
+//
+// Expressions support literals, columns, arithmetic, ||, comparisons, AND,
+// OR, NOT, [NOT] LIKE, [NOT] IN, [NOT] BETWEEN, IS [NOT] NULL, the scalar
+// functions LOWER, UPPER, TRIM, LENGTH, ROUND, ABS and COALESCE and the
+// aggregates COUNT, SUM, AVG, MIN and MAX. Cells are text; they compare and
+// compute as numbers when both sides parse as numbers, and empty cells are
+// NULL.
+
+const maxSQLLength = 4000
+
+// csvTable is a parsed CSV file. Column names match case-insensitively.
+type csvTable struct {
+	columns []string
+	index   map[string]int
+	rows    [][]string
+}
+
+func newCSVTable(header []string, rows [][]string) *csvTable {
+	t := &csvTable{columns: header, index: map[string]int{}, rows: rows}
+	for i, name := range header {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if _, ok := t.index[key]; !ok {
+			t.index[key] = i
+		}
+	}
+	return t
+}
+
+// sqlResult is the outcome of a query: the output column names and rows.
+type sqlResult struct {
+	columns []string
+	rows    [][]interface{}
+}
+
+type selectItem struct {
+	star  bool
+	expr  sqlExpr
+	name  string
+	alias string
+}
+
+type orderItem struct {
+	expr sqlExpr
+	desc bool
+}
+
+type sqlQuery struct {
+	distinct bool
+	items    []selectItem
+	table    string
+	where    sqlExpr
+	groupBy  []sqlExpr
+	having   sqlExpr
+	orderBy  []orderItem
+	limit    int // -1 for none
+	offset   int
+}
+
+// parseSQL parses a query of the dialect above.
+func parseSQL(sql string) (*sqlQuery, error) {
+	if len(sql) > maxSQLLength {
+		return nil, fmt.Errorf("query is longer than %d characters", maxSQLLength)
+	}
+	tokens, err := lexSQL(sql)
+	if err != nil {
+		return nil, err
+	}
+	p := &sqlParser{input: sql, tokens: tokens}
+	q, err := p.query()
+	if err != nil {
+		return nil, err
+	}
+	p.acceptOp(";")
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos+1)
+	}
+	return q, nil
+}
+
+// --- lexer ---
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokQuoted
+	tokString
+	tokNumber
+	tokOp
+)
+
+type sqlToken struct {
+	kind tokenKind
+	text string
+	pos  int
+	end  int
+}
+
+func lexSQL(s string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	i := 0
+	for i < len(s) {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'':
+			var sb strings.Builder
+			j := i + 1
+			for {
+				if j >= len(s) {
+					return nil, fmt.Errorf("unterminated string at position %d", i+1)
+				}
+				if s[j] == '\'' {
+					if j+1 < len(s) && s[j+1] == '\'' {
+						sb.WriteByte('\'')
+						j += 2
+						continue
+					}
+					break
+				}
+				sb.WriteByte(s[j])
+				j++
+			}
+			tokens = append(tokens, sqlToken{kind: tokString, text: sb.String(), pos: i, end: j + 1})
+			i = j + 1
+		case c == '"' || c == '`':
+			end := strings.IndexByte(s[i+1:], s[i])
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated identifier at position %d", i+1)
+			}
+			tokens = append(tokens, sqlToken{kind: tokQuoted, text: s[i+1 : i+1+end], pos: i, end: i + end + 2})
+			i += end + 2
+		case unicode.IsDigit(c) || (c == '.' && i+1 < len(s) && unicode.IsDigit(rune(s[i+1]))):
+			j := i
+			for j < len(s) && (unicode.IsDigit(rune(s[j])) || s[j] == '.') {
+				j++
+			}
+			if j < len(s) && (s[j] == 'e' || s[j] == 'E') {
+				k := j + 1
+				if k < len(s) && (s[k] == '+' || s[k] == '-') {
+					k++
+				}
+				if k < len(s) && unicode.IsDigit(rune(s[k])) {
+					for k < len(s) && unicode.IsDigit(rune(s[k])) {
+						k++
+					}
+					j = k
+				}
+			}
+			tokens = append(tokens, sqlToken{kind: tokNumber, text: s[i:j], pos: i, end: j})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, sqlToken{kind: tokIdent, text: s[i:j], pos: i, end: j})
+			i = j
+		default:
+			op := ""
+			if i+1 < len(s) {
+				switch two := s[i : i+2]; two {
+				case "<=", ">=", "<>", "!=", "||":
+					op = two
+				}
+			}
+			if op == "" && strings.ContainsRune("(),*+-/%=<>.;", c) {
+				op = string(c)
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at position %d", string(c), i+1)
+			}
+			tokens = append(tokens, sqlToken{kind: tokOp, text: op, pos: i, end: i + len(op)})
+			i += len(op)
+		}
+	}
+	return append(tokens, sqlToken{kind: tokEOF, pos: len(s), end: len(s)}), nil
+}
+
+// --- parser ---
+
+var sqlKeywords = map[string]bool{
+	"select": true, "distinct": true, "from": true, "where": true, "group": true,
+	"by": true, "having": true, "order": true, "asc": true, "desc": true,
+	"limit": true, "offset": true, "as": true, "and": true, "or": true,
+	"not": true, "like": true, "is": true, "null": true, "in": true,
+	"between": true, "true": true, "false": true,
+}
+
+type sqlParser struct {
+	input  string
+	tokens []sqlToken
+	pos    int
+}
+
+func (p *sqlParser) peek() sqlToken {
+	return p.tokens[p.pos]
+}
+
+func (p *sqlParser) next() sqlToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *sqlParser) isKeyword(word string) bool {
+	t := p.peek()
+	return t.kind == tokIdent && strings.EqualFold(t.text, word)
+}
+
+func (p *sqlParser) acceptKeyword(word string) bool {
+	if p.isKeyword(word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *sqlParser) expectKeyword(word string) error {
+	if !p.acceptKeyword(word) {
+		return p.unexpected("expected " + strings.ToUpper(word))
+	}
+	return nil
+}
+
+func (p *sqlParser) acceptOp(op string) bool {
+	t := p.peek()
+	if t.kind == tokOp && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *sqlParser) unexpected(want string) error {
+	t := p.peek()
+	if t.kind == tokEOF {
+		return fmt.Errorf("%s, found end of query", want)
+	}
+	return fmt.Errorf("%s, found %q at position %d", want, t.text, t.pos+1)
+}
+
+func (p *sqlParser) query() (*sqlQuery, error) {
+	q := &sqlQuery{limit: -1}
+	if err := p.expectKeyword("select"); err != nil {
+		return nil, err
+	}
+	q.distinct = p.acceptKeyword("distinct")
+	for {
+		item, err := p.selectItem()
+		if err != nil {
+			return nil, err
+		}
+		q.items = append(q.items, item)
+		if !p.acceptOp(",") {
+			break
+		}
+	}
+
+	if err := p.expectKeyword("from"); err != nil {
+		return nil, err
+	}
+	table, err := p.tableName()
+	if err != nil {
+		return nil, err
+	}
+	q.table = table
+	// an alias is accepted for qualified columns, which ignore it anyway
+	if p.acceptKeyword("as") {
+		if t := p.next(); t.kind != tokIdent && t.kind != tokQuoted {
+			return nil, fmt.Errorf("expected a table alias after AS")
+		}
+	} else if t := p.peek(); t.kind == tokQuoted || (t.kind == tokIdent && !sqlKeywords[strings.ToLower(t.text)]) {
+		p.next()
+	}
+
+	if p.acceptKeyword("where") {
+		if q.where, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("group") {
+		if err := p.expectKeyword("by"); err != nil {
+			return nil, err
+		}
+		if q.groupBy, err = p.exprList(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("having") {
+		if q.having, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("order") {
+		if err := p.expectKeyword("by"); err != nil {
+			return nil, err
+		}
+		for {
+			e, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			item := orderItem{expr: e}
+			if p.acceptKeyword("desc") {
+				item.desc = true
+			} else {
+				p.acceptKeyword("asc")
+			}
+			q.orderBy = append(q.orderBy, item)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+	}
+	if p.acceptKeyword("limit") {
+		if q.limit, err = p.count("LIMIT"); err != nil {
+			return nil, err
+		}
+		if p.acceptKeyword("offset") {
+			if q.offset, err = p.count("OFFSET"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return q, nil
+}
+
+func (p *sqlParser) count(clause string) (int, error) {
+	t := p.next()
+	n, err := strconv.Atoi(t.text)
+	if t.kind != tokNumber || err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", clause)
+	}
+	return n, nil
+}
+
+func (p *sqlParser) selectItem() (selectItem, error) {
+	if p.acceptOp("*") {
+		return selectItem{star: true, name: "*"}, nil
+	}
+	start := p.peek().pos
+	e, err := p.expr()
+	if err != nil {
+		return selectItem{}, err
+	}
+	item := selectItem{expr: e, name: strings.TrimSpace(p.input[start:p.tokens[p.pos-1].end])}
+	if p.acceptKeyword("as") {
+		t := p.next()
+		if t.kind != tokIdent && t.kind != tokQuoted && t.kind != tokString {
+			return selectItem{}, fmt.Errorf("expected an alias after AS")
+		}
+		item.alias = t.text
+	} else if t := p.peek(); t.kind == tokQuoted || (t.kind == tokIdent && !sqlKeywords[strings.ToLower(t.text)]) {
+		item.alias = p.next().text
+	}
+	if item.alias != "" {
+		item.name = item.alias
+	}
+	return item, nil
+}
+
+// tableName reads a quoted name or a bare one that may contain dots and
+// dashes, e.g. sales-2024.csv.
+func (p *sqlParser) tableName() (string, error) {
+	t := p.next()
+	switch t.kind {
+	case tokQuoted, tokString:
+		return t.text, nil
+	case tokIdent:
+	default:
+		return "", fmt.Errorf("expected a table name after FROM")
+	}
+	name := t.text
+	end := t.end
+	for {
+		n := p.peek()
+		if n.pos != end || n.kind == tokEOF || (n.kind == tokOp && n.text != "." && n.text != "-") {
+			return name, nil
+		}
+		p.next()
+		name += p.input[n.pos:n.end]
+		end = n.end
+	}
+}
+
+func (p *sqlParser) exprList() ([]sqlExpr, error) {
+	var list []sqlExpr
+	for {
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+		if !p.acceptOp(",") {
+			return list, nil
+		}
+	}
+}
+
+func (p *sqlParser) expr() (sqlExpr, error) {
+	left, err := p.andExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("or") {
+		right, err := p.andExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "or", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *sqlParser) andExpr() (sqlExpr, error) {
+	left, err := p.notExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("and") {
+		right, err := p.notExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "and", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *sqlParser) notExpr() (sqlExpr, error) {
+	if p.acceptKeyword("not") {
+		x, err := p.notExpr()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{x: x}, nil
+	}
+	return p.comparison()
+}
+
+func (p *sqlParser) comparison() (sqlExpr, error) {
+	left, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind == tokOp {
+		switch t.text {
+		case "=", "!=", "<>", "<", "<=", ">", ">=":
+			p.next()
+			right, err := p.additive()
+			if err != nil {
+				return nil, err
+			}
+			return &binaryExpr{op: t.text, left: left, right: right}, nil
+		}
+	}
+	if p.acceptKeyword("is") {
+		not := p.acceptKeyword("not")
+		if err := p.expectKeyword("null"); err != nil {
+			return nil, err
+		}
+		return &isNullExpr{x: left, not: not}, nil
+	}
+
+	not := false
+	if p.isKeyword("not") {
+		// NOT LIKE, NOT IN, NOT BETWEEN
+		p.next()
+		not = true
+	}
+	var e sqlExpr
+	switch {
+	case p.acceptKeyword("like"):
+		pattern, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		e = &likeExpr{x: left, pattern: pattern}
+	case p.acceptKeyword("in"):
+		if !p.acceptOp("(") {
+			return nil, p.unexpected("expected ( after IN")
+		}
+		list, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		if !p.acceptOp(")") {
+			return nil, p.unexpected("expected )")
+		}
+		e = &inExpr{x: left, list: list}
+	case p.acceptKeyword("between"):
+		low, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("and"); err != nil {
+			return nil, err
+		}
+		high, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		e = &binaryExpr{op: "and",
+			left:  &binaryExpr{op: ">=", left: left, right: low},
+			right: &binaryExpr{op: "<=", left: left, right: high},
+		}
+	default:
+		if not {
+			return nil, p.unexpected("expected LIKE, IN or BETWEEN after NOT")
+		}
+		return left, nil
+	}
+	if not {
+		return &notExpr{x: e}, nil
+	}
+	return e, nil
+}
+
+func (p *sqlParser) additive() (sqlExpr, error) {
+	left, err := p.multiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokOp || (t.text != "+" && t.text != "-" && t.text != "||") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.multiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: t.text, left: left, right: right}
+	}
+}
+
+func (p *sqlParser) multiplicative() (sqlExpr, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokOp || (t.text != "*" && t.text != "/" && t.text != "%") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: t.text, left: left, right: right}
+	}
+}
+
+func (p *sqlParser) unary() (sqlExpr, error) {
+	if p.acceptOp("-") {
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryExpr{op: "-", left: &literal{value: 0.0}, right: x}, nil
+	}
+	if p.acceptOp("+") {
+		return p.unary()
+	}
+	return p.primary()
+}
+
+func (p *sqlParser) primary() (sqlExpr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", t.text)
+		}
+		return &literal{value: v}, nil
+	case tokString:
+		return &literal{value: t.text}, nil
+	case tokQuoted:
+		return p.qualified(t.text), nil
+	case tokOp:
+		if t.text == "(" {
+			e, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if !p.acceptOp(")") {
+				return nil, p.unexpected("expected )")
+			}
+			return e, nil
+		}
+	case tokIdent:
+		word := strings.ToLower(t.text)
+		switch word {
+		case "null":
+			return &literal{}, nil
+		case "true":
+			return &literal{value: true}, nil
+		case "false":
+			return &literal{value: false}, nil
+		}
+		if sqlKeywords[word] {
+			break
+		}
+		if p.acceptOp("(") {
+			return p.call(word)
+		}
+		return p.qualified(t.text), nil
+	}
+	if t.kind != tokEOF {
+		p.pos--
+	}
+	return nil, p.unexpected("expected an expression")
+}
+
+// qualified reads a column reference, ignoring a table qualifier as in
+// t.amount: there is only one table.
+func (p *sqlParser) qualified(name string) sqlExpr {
+	if p.acceptOp(".") {
+		if t := p.peek(); t.kind == tokIdent || t.kind == tokQuoted {
+			return &columnRef{name: p.next().text}
+		}
+		p.pos--
+	}
+	return &columnRef{name: name}
+}
+
+func (p *sqlParser) call(name string) (sqlExpr, error) {
+	switch name {
+	case "count", "sum", "avg", "min", "max":
+		agg := &aggregateExpr{name: name}
+		if name == "count" && p.acceptOp("*") {
+			if !p.acceptOp(")") {
+				return nil, p.unexpected("expected )")
+			}
+			return agg, nil
+		}
+		agg.distinct = p.acceptKeyword("distinct")
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.acceptOp(")") {
+			return nil, p.unexpected(name + " takes one argument; expected )")
+		}
+		agg.arg = arg
+		return agg, nil
+	}
+	if _, ok := scalarFunctions[name]; !ok {
+		return nil, fmt.Errorf("unknown function %s", strings.ToUpper(name))
+	}
+	var args []sqlExpr
+	if !p.acceptOp(")") {
+		var err error
+		if args, err = p.exprList(); err != nil {
+			return nil, err
+		}
+		if !p.acceptOp(")") {
+			return nil, p.unexpected("expected )")
+		}
+	}
+	return &funcExpr{name: name, args: args}, nil
+}
+
+// --- evaluation ---
+
+// sqlEnv is what an expression is evaluated against: a row, and for
+// aggregates the rows of its group, which may be empty. aliases holds the
+// output values of a row while ORDER BY is evaluated.
+type sqlEnv struct {
+	table   *csvTable
+	row     []string
+	grouped bool
+	group   [][]string
+	aliases map[string]interface{}
+}
+
+type sqlExpr interface {
+	eval(env *sqlEnv) (interface{}, error)
+}
+
+type literal struct {
+	value interface{}
+}
+
+func (e *literal) eval(*sqlEnv) (interface{}, error) {
+	return e.value, nil
+}
+
+type columnRef struct {
+	name string
+}
+
+func (e *columnRef) eval(env *sqlEnv) (interface{}, error) {
+	key := strings.ToLower(strings.TrimSpace(e.name))
+	if v, ok := env.aliases[key]; ok {
+		return v, nil
+	}
+	i, ok := env.table.index[key]
+	if !ok {
+		return nil, fmt.Errorf("unknown column %q; the columns are %s", e.name, quoteList(env.table.columns))
+	}
+	if i >= len(env.row) || env.row[i] == "" {
+		return nil, nil
+	}
+	return env.row[i], nil
+}
+
+type notExpr struct {
+	x sqlExpr
+}
+
+func (e *notExpr) eval(env *sqlEnv) (interface{}, error) {
+	v, err := e.x.eval(env)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	return !truthy(v), nil
+}
+
+type isNullExpr struct {
+	x   sqlExpr
+	not bool
+}
+
+func (e *isNullExpr) eval(env *sqlEnv) (interface{}, error) {
+	v, err := e.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return (v == nil) != e.not, nil
+}
+
+type likeExpr struct {
+	x, pattern sqlExpr
+}
+
+func (e *likeExpr) eval(env *sqlEnv) (interface{}, error) {
+	v, err := e.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := e.pattern.eval(env)
+	if err != nil || v == nil || pattern == nil {
+		return nil, err
+	}
+	return matchLike(strings.ToLower(formatValue(v)), strings.ToLower(formatValue(pattern))), nil
+}
+
+type inExpr struct {
+	x    sqlExpr
+	list []sqlExpr
+}
+
+func (e *inExpr) eval(env *sqlEnv) (interface{}, error) {
+	v, err := e.x.eval(env)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	for _, item := range e.list {
+		w, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		if c, ok := compareValues(v, w); ok && c == 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type binaryExpr struct {
+	op          string
+	left, right sqlExpr
+}
+
+func (e *binaryExpr) eval(env *sqlEnv) (interface{}, error) {
+	l, err := e.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "and":
+		if l != nil && !truthy(l) {
+			return false, nil
+		}
+	case "or":
+		if l != nil && truthy(l) {
+			return true, nil
+		}
+	}
+	r, err := e.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.op {
+	case "and", "or":
+		// NULL is unknown: it decides nothing unless the other side does
+		if r != nil && truthy(r) == (e.op == "or") {
+			return truthy(r), nil
+		}
+		if l == nil || r == nil {
+			return nil, nil
+		}
+		return e.op == "and", nil
+	case "||":
+		if l == nil || r == nil {
+			return nil, nil
+		}
+		return formatValue(l) + formatValue(r), nil
+	case "+", "-", "*", "/", "%":
+		a, okA := toNumber(l)
+		b, okB := toNumber(r)
+		if !okA || !okB {
+			return nil, nil
+		}
+		switch e.op {
+		case "+":
+			return a + b, nil
+		case "-":
+			return a - b, nil
+		case "*":
+			return a * b, nil
+		case "/":
+			if b == 0 {
+				return nil, nil
+			}
+			return a / b, nil
+		default:
+			if b == 0 {
+				return nil, nil
+			}
+			return math.Mod(a, b), nil
+		}
+	}
+
+	c, ok := compareValues(l, r)
+	if !ok {
+		return nil, nil
+	}
+	switch e.op {
+	case "=":
+		return c == 0, nil
+	case "!=", "<>":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+var scalarFunctions = map[string]func(args []interface{}) (interface{}, error){
+	"lower": func(args []interface{}) (interface{}, error) {
+		return stringFunction(args, strings.ToLower)
+	},
+	"upper": func(args []interface{}) (interface{}, error) {
+		return stringFunction(args, strings.ToUpper)
+	},
+	"trim": func(args []interface{}) (interface{}, error) {
+		return stringFunction(args, strings.TrimSpace)
+	},
+	"length": func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("LENGTH takes one argument")
+		}
+		if args[0] == nil {
+			return nil, nil
+		}
+		return float64(len([]rune(formatValue(args[0])))), nil
+	},
+	"abs": func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("ABS takes one argument")
+		}
+		if v, ok := toNumber(args[0]); ok {
+			return math.Abs(v), nil
+		}
+		return nil, nil
+	},
+	"round": func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 && len(args) != 2 {
+			return nil, fmt.Errorf("ROUND takes one or two arguments")
+		}
+		v, ok := toNumber(args[0])
+		if !ok {
+			return nil, nil
+		}
+		digits := 0.0
+		if len(args) == 2 {
+			if digits, ok = toNumber(args[1]); !ok {
+				return nil, nil
+			}
+		}
+		scale := math.Pow(10, math.Trunc(digits))
+		return math.Round(v*scale) / scale, nil
+	},
+	"coalesce": func(args []interface{}) (interface{}, error) {
+		for _, a := range args {
+			if a != nil {
+				return a, nil
+			}
+		}
+		return nil, nil
+	},
+}
+
+func stringFunction(args []interface{}, f func(string) string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("the function takes one argument")
+	}
+	if args[0] == nil {
+		return nil, nil
+	}
+	return f(formatValue(args[0])), nil
+}
+
+type funcExpr struct {
+	name string
+	args []sqlExpr
+}
+
+func (e *funcExpr) eval(env *sqlEnv) (interface{}, error) {
+	args := make([]interface{}, len(e.args))
+	for i, a := range e.args {
+		v, err := a.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	return scalarFunctions[e.name](args)
+}
+
+// aggregateExpr is COUNT, SUM, AVG, MIN or MAX; a nil arg is COUNT(*).
+type aggregateExpr struct {
+	name     string
+	arg      sqlExpr
+	distinct bool
+}
+
+func (e *aggregateExpr) eval(env *sqlEnv) (interface{}, error) {
+	if !env.grouped {
+		return nil, fmt.Errorf("%s is not allowed in WHERE", strings.ToUpper(e.name))
+	}
+	if e.arg == nil {
+		return float64(len(env.group)), nil
+	}
+
+	var values []interface{}
+	seen := map[string]bool{}
+	for _, row := range env.group {
+		v, err := e.arg.eval(&sqlEnv{table: env.table, row: row})
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			continue
+		}
+		if e.distinct {
+			key := formatValue(v)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		values = append(values, v)
+	}
+
+	switch e.name {
+	case "count":
+		return float64(len(values)), nil
+	case "sum", "avg":
+		sum, n := 0.0, 0
+		for _, v := range values {
+			if f, ok := toNumber(v); ok {
+				sum += f
+				n++
+			}
+		}
+		if n == 0 {
+			return nil, nil
+		}
+		if e.name == "avg" {
+			return sum / float64(n), nil
+		}
+		return sum, nil
+	default:
+		var best interface{}
+		for _, v := range values {
+			if best == nil {
+				best = v
+				continue
+			}
+			c, _ := compareValues(v, best)
+			if (e.name == "min" && c < 0) || (e.name == "max" && c > 0) {
+				best = v
+			}
+		}
+		return best, nil
+	}
+}
+
+// hasAggregate reports whether e computes over a group.
+func hasAggregate(e sqlExpr) bool {
+	switch e := e.(type) {
+	case *aggregateExpr:
+		return true
+	case *binaryExpr:
+		return hasAggregate(e.left) || hasAggregate(e.right)
+	case *notExpr:
+		return hasAggregate(e.x)
+	case *isNullExpr:
+		return hasAggregate(e.x)
+	case *likeExpr:
+		return hasAggregate(e.x) || hasAggregate(e.pattern)
+	case *inExpr:
+		if hasAggregate(e.x) {
+			return true
+		}
+		for _, item := range e.list {
+			if hasAggregate(item) {
+				return true
+			}
+		}
+	case *funcExpr:
+		for _, a := range e.args {
+			if hasAggregate(a) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// execute runs q against t.
+func (q *sqlQuery) execute(t *csvTable) (*sqlResult, error) {
+	var rows [][]string
+	for _, row := range t.rows {
+		if q.where != nil {
+			v, err := q.where.eval(&sqlEnv{table: t, row: row})
+			if err != nil {
+				return nil, err
+			}
+			if v == nil || !truthy(v) {
+				continue
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	aggregated := len(q.groupBy) > 0 || q.having != nil
+	for _, item := range q.items {
+		aggregated = aggregated || (!item.star && hasAggregate(item.expr))
+	}
+	for _, o := range q.orderBy {
+		aggregated = aggregated || hasAggregate(o.expr)
+	}
+
+	// each output row is computed in its own env: a row, or a group
+	var envs []*sqlEnv
+	if aggregated {
+		groups, err := q.groups(t, rows)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			env := &sqlEnv{table: t, grouped: true, group: group}
+			if len(group) > 0 {
+				env.row = group[0]
+			}
+			if q.having != nil {
+				v, err := q.having.eval(env)
+				if err != nil {
+					return nil, err
+				}
+				if v == nil || !truthy(v) {
+					continue
+				}
+			}
+			envs = append(envs, env)
+		}
+	} else {
+		for _, row := range rows {
+			envs = append(envs, &sqlEnv{table: t, row: row})
+		}
+	}
+
+	result := &sqlResult{}
+	for _, item := range q.items {
+		if item.star {
+			if aggregated {
+				return nil, fmt.Errorf("SELECT * cannot be combined with GROUP BY or aggregates")
+			}
+			result.columns = append(result.columns, t.columns...)
+			continue
+		}
+		result.columns = append(result.columns, item.name)
+	}
+	for _, env := range envs {
+		out := make([]interface{}, 0, len(result.columns))
+		aliases := map[string]interface{}{}
+		for _, item := range q.items {
+			if item.star {
+				for i := range t.columns {
+					var v interface{}
+					if i < len(env.row) && env.row[i] != "" {
+						v = env.row[i]
+					}
+					out = append(out, v)
+				}
+				continue
+			}
+			v, err := item.expr.eval(env)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+			if item.alias != "" {
+				aliases[strings.ToLower(item.alias)] = v
+			}
+		}
+		env.aliases = aliases
+		result.rows = append(result.rows, out)
+	}
+
+	if q.distinct {
+		seen := map[string]bool{}
+		var rows [][]interface{}
+		var kept []*sqlEnv
+		for i, row := range result.rows {
+			key := rowKey(row)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			rows = append(rows, row)
+			kept = append(kept, envs[i])
+		}
+		result.rows, envs = rows, kept
+	}
+
+	if len(q.orderBy) > 0 {
+		if err := q.sort(result, envs); err != nil {
+			return nil, err
+		}
+	}
+
+	if q.offset > 0 {
+		if q.offset >= len(result.rows) {
+			result.rows = nil
+		} else {
+			result.rows = result.rows[q.offset:]
+		}
+	}
+	if q.limit >= 0 && q.limit < len(result.rows) {
+		result.rows = result.rows[:q.limit]
+	}
+	return result, nil
+}
+
+// groups splits rows by the GROUP BY values, in order of first appearance.
+// Without GROUP BY all rows form one group, even when there are none.
+func (q *sqlQuery) groups(t *csvTable, rows [][]string) ([][][]string, error) {
+	if len(q.groupBy) == 0 {
+		return [][][]string{rows}, nil
+	}
+	var groups [][][]string
+	index := map[string]int{}
+	for _, row := range rows {
+		key := make([]interface{}, len(q.groupBy))
+		for i, e := range q.groupBy {
+			v, err := e.eval(&sqlEnv{table: t, row: row})
+			if err != nil {
+				return nil, err
+			}
+			key[i] = v
+		}
+		k := rowKey(key)
+		i, ok := index[k]
+		if !ok {
+			i = len(groups)
+			index[k] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], row)
+	}
+	return groups, nil
+}
+
+// sort orders the result rows. An integer literal refers to an output
+// column by position, as in ORDER BY 2.
+func (q *sqlQuery) sort(result *sqlResult, envs []*sqlEnv) error {
+	keys := make([][]interface{}, len(result.rows))
+	for i, env := range envs {
+		keys[i] = make([]interface{}, len(q.orderBy))
+		for j, o := range q.orderBy {
+			if lit, ok := o.expr.(*literal); ok {
+				if n, ok := lit.value.(float64); ok && n == math.Trunc(n) {
+					if n < 1 || int(n) > len(result.columns) {
+						return fmt.Errorf("ORDER BY position %d is out of range", int(n))
+					}
+					keys[i][j] = result.rows[i][int(n)-1]
+					continue
+				}
+			}
+			v, err := o.expr.eval(env)
+			if err != nil {
+				return err
+			}
+			keys[i][j] = v
+		}
+	}
+
+	order := make([]int, len(result.rows))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		for j, o := range q.orderBy {
+			c := sortCompare(keys[order[a]][j], keys[order[b]][j])
+			if c == 0 {
+				continue
+			}
+			if o.desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+	rows := make([][]interface{}, len(order))
+	for i, k := range order {
+		rows[i] = result.rows[k]
+	}
+	result.rows = rows
+	return nil
+}
+
+// --- values ---
+
+func toNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		if f, ok := toNumber(v); ok {
+			return f != 0
+		}
+		return strings.EqualFold(v, "true")
+	}
+	return false
+}
+
+// compareValues compares numerically when both values are numbers and as
+// text otherwise. ok is false when either is NULL.
+func compareValues(a, b interface{}) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+	if x, ok := toNumber(a); ok {
+		if y, ok := toNumber(b); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	return strings.Compare(formatValue(a), formatValue(b)), true
+}
+
+// sortCompare is compareValues with NULL first.
+func sortCompare(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	c, _ := compareValues(a, b)
+	return c
+}
+
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+func rowKey(values []interface{}) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		if v == nil {
+			parts[i] = "\x01"
+			continue
+		}
+		parts[i] = formatValue(v)
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// matchLike matches s against a LIKE pattern, where % is any run of
+// characters and _ a single one.
+func matchLike(s, pattern string) bool {
+	sr, pr := []rune(s), []rune(pattern)
+	// star is the last % seen and match the position in s it is tried at
+	star, match := -1, 0
+	i, j := 0, 0
+	for i < len(sr) {
+		switch {
+		case j < len(pr) && (pr[j] == '_' || pr[j] == sr[i]):
+			i++
+			j++
+		case j < len(pr) && pr[j] == '%':
+			star, match = j, i
+			j++
+		case star >= 0:
+			match++
+			i, j = match, star+1
+		default:
+			return false
+		}
+	}
+	for j < len(pr) && pr[j] == '%' {
+		j++
+	}
+	return j == len(pr)
+}
+
+func quoteList(names []string) string {
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = strconv.Quote(n)
+	}
+	return strings.Join(quoted, ", ")
+}
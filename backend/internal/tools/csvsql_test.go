@@ -0,0 +1,144 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testTable has an empty amount and an empty qty, which are NULL.
+func testTable() *csvTable {
+	return newCSVTable([]string{"Region", "product", "amount", "qty"}, [][]string{
+		{"north", "apple", "10", "2"},
+		{"south", "pear", "5", ""},
+		{"north", "pear", "2.5", "1"},
+		{"east", "apple", "", "3"},
+		{"south", "Apple", "100", "10"},
+	})
+}
+
+func runSQL(sql string) (string, error) {
+	q, err := parseSQL(sql)
+	if err != nil {
+		return "", err
+	}
+	result, err := q.execute(testTable())
+	if err != nil {
+		return "", err
+	}
+	return formatResult(result), nil
+}
+
+func TestCSVSQL(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{`SELECT * FROM sales WHERE region = 'east'`,
+			"Region,product,amount,qty\neast,apple,,3\n(1 row)"},
+		{`select REGION, t.product from "sales.csv" t where product = 'pear';`,
+			"REGION,t.product\nsouth,pear\nnorth,pear\n(2 rows)"},
+
+		// numbers compare as numbers, not as text where "100" < "9"
+		{`SELECT product, amount FROM sales WHERE amount > 9 ORDER BY amount DESC`,
+			"product,amount\nApple,100\napple,10\n(2 rows)"},
+		{`SELECT MAX(amount) AS hi, MIN(product) AS lo FROM sales`,
+			"hi,lo\n100,Apple\n(1 row)"},
+		{`SELECT amount * 2 + 1 AS x, amount / 0 AS y, 7 % 3 AS z FROM sales WHERE product = 'apple' AND region = 'north'`,
+			"x,y,z\n21,,1\n(1 row)"},
+
+		// NULL is unknown: it matches neither a condition nor its negation
+		{`SELECT product FROM sales WHERE qty IS NULL`, "product\npear\n(1 row)"},
+		{`SELECT product FROM sales WHERE NOT qty > 1`, "product\npear\n(1 row)"},
+		{`SELECT COUNT(*) AS n FROM sales WHERE qty > 1 OR qty <= 1`, "n\n4\n(1 row)"},
+		{`SELECT COUNT(*) AS n FROM sales WHERE qty > 100 OR region = 'south'`, "n\n2\n(1 row)"},
+		{`SELECT region || ':' || qty AS k, amount * qty AS v FROM sales WHERE region = 'east'`,
+			"k,v\neast:3,\n(1 row)"},
+		{`SELECT COALESCE(amount, qty, 0) AS c FROM sales WHERE region = 'east'`, "c\n3\n(1 row)"},
+		{`SELECT COUNT(*), COUNT(amount), COUNT(DISTINCT region), AVG(amount) FROM sales`,
+			"COUNT(*),COUNT(amount),COUNT(DISTINCT region),AVG(amount)\n5,4,3,29.375\n(1 row)"},
+		// an aggregate without GROUP BY has one row, even over no rows
+		{`SELECT COUNT(*) AS n, SUM(amount) AS total FROM sales WHERE region = 'west'`,
+			"n,total\n0,\n(1 row)"},
+
+		{`SELECT product FROM sales WHERE product LIKE 'a%' AND region NOT IN ('east')`,
+			"product\napple\nApple\n(2 rows)"},
+		{`SELECT product FROM sales WHERE amount BETWEEN 2.5 AND 5 AND product NOT LIKE '_pple'`,
+			"product\npear\npear\n(2 rows)"},
+		{`SELECT UPPER(region) AS r, LENGTH(product) AS l, ROUND(amount / 3, 2) AS third, ABS(-qty) AS q FROM sales WHERE region = 'north'`,
+			"r,l,third,q\nNORTH,5,3.33,2\nNORTH,4,0.83,1\n(2 rows)"},
+
+		// GROUP BY keeps groups in order of appearance, HAVING filters them
+		{`SELECT region, SUM(amount) AS total FROM sales GROUP BY region`,
+			"region,total\nnorth,12.5\nsouth,105\neast,\n(3 rows)"},
+		{`SELECT region, COUNT(*) AS n FROM sales GROUP BY region HAVING COUNT(*) > 1 AND SUM(amount) > 20`,
+			"region,n\nsouth,2\n(1 row)"},
+		{`SELECT LOWER(product) AS p, SUM(qty) AS q FROM sales GROUP BY LOWER(product) ORDER BY q DESC`,
+			"p,q\napple,15\npear,1\n(2 rows)"},
+
+		// ORDER BY sorts NULL first, by alias, by position and by a second key
+		{`SELECT region, amount FROM sales ORDER BY amount`,
+			"region,amount\neast,\nnorth,2.5\nsouth,5\nnorth,10\nsouth,100\n(5 rows)"},
+		{`SELECT region, SUM(amount) AS total FROM sales GROUP BY region ORDER BY total DESC`,
+			"region,total\nsouth,105\nnorth,12.5\neast,\n(3 rows)"},
+		{`SELECT region, product FROM sales ORDER BY 1 DESC, product`,
+			"region,product\nsouth,Apple\nsouth,pear\nnorth,apple\nnorth,pear\neast,apple\n(5 rows)"},
+		{`SELECT DISTINCT region FROM sales ORDER BY region`,
+			"region\neast\nnorth\nsouth\n(3 rows)"},
+
+		{`SELECT product FROM sales ORDER BY amount DESC LIMIT 2`,
+			"product\nApple\napple\n(2 rows)"},
+		{`SELECT product FROM sales ORDER BY amount LIMIT 2 OFFSET 3`,
+			"product\napple\nApple\n(2 rows)"},
+		{`SELECT product FROM sales LIMIT 10 OFFSET 5`, "product\n(0 rows)"},
+		{`SELECT product FROM sales LIMIT 0`, "product\n(0 rows)"},
+	}
+	for _, tt := range tests {
+		got, err := runSQL(tt.sql)
+		if err != nil {
+			t.Errorf("%s: %v", tt.sql, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s:\ngot  %q\nwant %q", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestCSVSQLErrors(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{`DELETE FROM sales`, `expected SELECT`},
+		{`SELECT product FROM sales WHERE name = 'x'`, `unknown column "name"; the columns are "Region", "product", "amount", "qty"`},
+		{`SELECT * FROM sales GROUP BY region`, `SELECT * cannot be combined with GROUP BY or aggregates`},
+		{`SELECT product FROM sales WHERE SUM(amount) > 1`, `SUM is not allowed in WHERE`},
+		{`SELECT product FROM sales WHERE product = 'pear`, `unterminated string at position 43`},
+		{`SELECT product FROM sales LIMIT -1`, `LIMIT must be a non-negative integer`},
+		{`SELECT product FROM sales ORDER BY 3`, `ORDER BY position 3 is out of range`},
+		{`SELECT product FROM sales; DROP TABLE sales`, `unexpected "DROP" at position 28`},
+		{`SELECT product FROM sales WHERE amount # 1`, `unexpected "#" at position 40`},
+		{`SELECT ` + strings.Repeat("a, ", maxSQLLength/3) + `b FROM sales`, fmt.Sprintf("query is longer than %d characters", maxSQLLength)},
+	}
+	for _, tt := range tests {
+		_, err := runSQL(tt.sql)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.sql, err, tt.want)
+		}
+	}
+}
+
+func TestFormatResultTruncates(t *testing.T) {
+	result := &sqlResult{columns: []string{"n"}}
+	for i := 0; i < maxOutputRows+5; i++ {
+		result.rows = append(result.rows, []interface{}{float64(i)})
+	}
+	got := formatResult(result)
+	if lines := strings.Count(got, "\n"); lines != maxOutputRows+1 {
+		t.Errorf("output has %d lines, want the header and %d rows", lines, maxOutputRows)
+	}
+	if want := fmt.Sprintf("(first %d of %d rows; aggregate or add a LIMIT for fewer)", maxOutputRows, maxOutputRows+5); !strings.HasSuffix(got, want) {
+		t.Errorf("output ends with %q, want %q", got[strings.LastIndex(got, "\n")+1:], want)
+	}
+}
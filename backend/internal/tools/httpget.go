@@ -0,0 +1,133 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxHTTPBody caps the bytes of a response read by HTTPGet.
+const maxHTTPBody = 64 << 10
+
+// HTTPGet fetches URLs that start with one of the allowlisted prefixes,
+// e.g. a status page or an internal JSON API.
+type HTTPGet struct {
+	allowlist []*url.URL
+	client    *http.Client
+}
+
+// NewHTTPGet allows the given URL prefixes. Prefixes that do not parse as
+// absolute http or https URLs are skipped.
+func NewHTTPGet(allowlist []string) *HTTPGet {
+	t := &HTTPGet{}
+	for _, prefix := range allowlist {
+		u, err := url.Parse(prefix)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			continue
+		}
+		t.allowlist = append(t.allowlist, u)
+	}
+	t.client = &http.Client{
+		Timeout: 10 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return fmt.Errorf("too many redirects")
+			}
+			if !t.allowed(req.URL) {
+				return fmt.Errorf("redirect to %s is not allowed", req.URL.Redacted())
+			}
+			return nil
+		},
+	}
+	return t
+}
+
+func (t *HTTPGet) Name() string {
+	return NameHTTPGet
+}
+
+func (t *HTTPGet) Description() string {
+	prefixes := make([]string, len(t.allowlist))
+	for i, u := range t.allowlist {
+		prefixes[i] = u.String()
+	}
+	return "Fetches a URL with an HTTP GET request and returns the status and the start of the body. " +
+		"Only URLs starting with one of these prefixes are allowed: " + strings.Join(prefixes, ", ")
+}
+
+func (t *HTTPGet) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"url": {"type": "string", "description": "absolute URL, including any query parameters"}
+		},
+		"required": ["url"]
+	}`)
+}
+
+// Empty reports whether no URL is allowed, i.e. the tool is useless.
+func (t *HTTPGet) Empty() bool {
+	return len(t.allowlist) == 0
+}
+
+func (t *HTTPGet) Call(ctx context.Context, args json.RawMessage) (string, error) {
+	var in struct {
+		URL string `json:"url"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return "", err
+	}
+	u, err := url.Parse(in.URL)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+	if !t.allowed(u) {
+		return "", fmt.Errorf("URL is not on the allowlist")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json, text/plain;q=0.9, */*;q=0.5")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPBody))
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+	return fmt.Sprintf("HTTP %d\n%s", resp.StatusCode, body), nil
+}
+
+// allowed reports whether u starts with an allowlisted prefix. Scheme and
+// host must match exactly and the path must continue the prefix's path at
+// a segment boundary, without "..", so https://api.example.com/v1 does not
+// allow https://api.example.com.evil.net or https://api.example.com/v10.
+func (t *HTTPGet) allowed(u *url.URL) bool {
+	if u.User != nil || slices.Contains(strings.Split(u.Path, "/"), "..") {
+		return false
+	}
+	for _, prefix := range t.allowlist {
+		if u.Scheme != prefix.Scheme || !strings.EqualFold(u.Host, prefix.Host) {
+			continue
+		}
+		p := prefix.Path
+		if p == "" || p == "/" {
+			return true
+		}
+		if u.Path == p || strings.HasPrefix(u.Path, strings.TrimSuffix(p, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+
+	"backend/internal/services"
+)
+
+// Names of the built-in tools, as listed in CHAT_TOOLS.
+const (
+	NameSearchKnowledgeBase = "search_knowledge_base"
+	NameQueryCSV            = "query_csv"
+	NameCalculator          = "calculator"
+	NameHTTPGet             = "http_get"
+)
+
+// maxResultLength caps the characters of a tool result sent back to the
+// model, so a large result cannot exhaust the context window.
+const maxResultLength = 8000
+
+// Tool is a function the chat model can call. Parameters is the JSON schema
+// of the arguments Call receives.
+type Tool interface {
+	Name() string
+	Description() string
+	Parameters() json.RawMessage
+	Call(ctx context.Context, args json.RawMessage) (string, error)
+}
+
+// Registry holds the tools offered for one chat turn.
+type Registry struct {
+	tools  []Tool
+	byName map[string]Tool
+}
+
+// NewRegistry registers tools in order; a later tool with the same name is
+// ignored.
+func NewRegistry(tools ...Tool) *Registry {
+	r := &Registry{byName: map[string]Tool{}}
+	for _, t := range tools {
+		r.Add(t)
+	}
+	return r
+}
+
+func (r *Registry) Add(t Tool) {
+	if _, ok := r.byName[t.Name()]; ok {
+		return
+	}
+	r.tools = append(r.tools, t)
+	r.byName[t.Name()] = t
+}
+
+func (r *Registry) Len() int {
+	return len(r.tools)
+}
+
+// Names lists the registered tools in order.
+func (r *Registry) Names() []string {
+	names := make([]string, len(r.tools))
+	for i, t := range r.tools {
+		names[i] = t.Name()
+	}
+	return names
+}
+
+// Definitions describes the tools to the model.
+func (r *Registry) Definitions() []services.LLMTool {
+	defs := make([]services.LLMTool, len(r.tools))
+	for i, t := range r.tools {
+		defs[i].Type = "function"
+		defs[i].Function.Name = t.Name()
+		defs[i].Function.Description = t.Description()
+		defs[i].Function.Parameters = t.Parameters()
+	}
+	return defs
+}
+
+// Call runs the named tool. Unknown tools, malformed arguments and failures
+// are reported in the result, so the model can correct the call; ok is
+// false for them.
+func (r *Registry) Call(ctx context.Context, name, args string) (result string, ok bool) {
+	t, found := r.byName[name]
+	if !found {
+		return fmt.Sprintf("error: unknown tool %q", name), false
+	}
+	if args == "" {
+		args = "{}"
+	}
+	if !json.Valid([]byte(args)) {
+		return "error: arguments are not valid JSON", false
+	}
+	out, err := t.Call(ctx, json.RawMessage(args))
+	if err != nil {
+		if ctx.Err() != nil {
+			return "error: " + ctx.Err().Error(), false
+		}
+		return "error: " + err.Error(), false
+	}
+	return truncate(out, maxResultLength), true
+}
+
+// truncate cuts text to at most limit characters and says so.
+func truncate(text string, limit int) string {
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:limit]) + "\n[truncated]"
+}
+
+// decodeArgs unmarshals the arguments of a call into v.
+func decodeArgs(args json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(args, v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
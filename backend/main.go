@@ -3,10 +3,12 @@ package main
 import (
 	"backend/config"
 	_ "backend/docs" // import để register docs
+	"backend/internal/controllers"
 	"backend/internal/middleware"
 	"backend/internal/models"
 	"backend/internal/routes"
 	"backend/internal/services"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
@@ -39,9 +41,23 @@ func main() {
 		panic(err)
 	}
 	// run AutoMigrate for all models
-	if err := services.DB.AutoMigrate(&models.User{}, &models.KnowledgeBase{}, &models.Document{}, &models.ChatSession{}, &models.ChatMessage{}); err != nil {
+	if err := services.DB.AutoMigrate(&models.User{}, &models.KnowledgeBase{}, &models.DocumentSource{}, &models.SourceSyncRun{}, &models.Document{}, &models.DocumentVersion{}, &models.UploadSession{}, &models.ArchiveImport{}, &models.ChatSession{}, &models.ChatSessionKnowledgeBase{}, &models.ChatMessage{}, &models.MessageFeedback{}, &models.MessageFeedbackKnowledgeBase{}, &models.EvalSet{}, &models.EvalCase{}, &models.EvalRun{}, &models.EvalResult{}); err != nil {
 		panic(err)
 	}
+	if err := models.BackfillChatMessageParents(); err != nil {
+		panic(err)
+	}
+	if err := models.BackfillChatSessionKnowledgeBases(); err != nil {
+		panic(err)
+	}
+	if err := models.BackfillMessageFeedbackKnowledgeBases(); err != nil {
+		panic(err)
+	}
+	// runs are executed in-process, so none survive a restart
+	if err := models.FailInterruptedEvalRuns(); err != nil {
+		panic(err)
+	}
+	go controllers.SweepUploadSessions(time.Duration(config.LoadConfig().UploadSweepMinutes) * time.Minute)
 	defer func() {
 		sqlDB, err := services.DB.DB()
 		if err != nil {
@@ -61,6 +77,9 @@ func main() {
 	routes.ChatSessionRoutes(router)
 	routes.ChatMessageRoutes(router)
 	routes.DocumentRoutes(router)
+	routes.DocumentSourceRoutes(router)
+	routes.SearchRoutes(router)
+	routes.EvalRoutes(router)
 
 	router.Run(":" + port)
 }
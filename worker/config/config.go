@@ -2,19 +2,67 @@ package config
 
 import (
 	"os"
+	"strconv"
 )
 
 type Config struct {
-	RedisAddr        string
-	PostGresUser     string
-	PostGresPassword string
-	PostGresDB       string
-	PostGresHost     string
-	PostGresPort     string
-	MinioEndpoint    string
-	MinioAccessKey   string
-	MinioSecretKey   string
-	MinioUseSSL      bool
+	RedisAddr          string
+	PostGresUser       string
+	PostGresPassword   string
+	PostGresDB         string
+	PostGresHost       string
+	PostGresPort       string
+	MinioEndpoint      string
+	MinioAccessKey     string
+	MinioSecretKey     string
+	MinioUseSSL        bool
+	MinioBucket        string
+	QdrantURL          string
+	QdrantAPIKey       string
+	QdrantCollection   string
+	EmbeddingBaseURL   string
+	EmbeddingAPIKey    string
+	EmbeddingModel     string
+	EmbeddingDimension int
+	EmbeddingBatchSize int
+	ChunkSize          int
+	ChunkOverlap       int
+	// Full-text search: language:configuration pairs such as
+	// "en:english,vi:simple", and the configuration for other chunks.
+	SearchConfigs       string
+	DefaultSearchConfig string
+	// LLM used for document summaries; SummaryMaxInputChars caps how much of
+	// a document it reads.
+	LLMBaseURL           string
+	LLMAPIKey            string
+	LLMModel             string
+	SummaryEnabled       bool
+	SummaryMaxInputChars int
+	// OCR for scanned PDF pages and images: "tesseract", "http" or empty to
+	// disable it.
+	OCRProvider   string
+	OCRLanguage   string
+	OCRServiceURL string
+	OCRAPIKey     string
+	TesseractPath string
+	PDFToPPMPath  string
+	OCRDPI        int
+	// Limits applied when expanding uploaded archives.
+	ArchiveMaxEntries     int
+	ArchiveMaxEntrySizeMB int
+	ArchiveMaxTotalSizeMB int
+	ArchiveMaxRatio       int
+	// Web crawler used by url document sources.
+	CrawlerUserAgent     string
+	CrawlerMaxPageSizeMB int
+	CrawlerDelayMs       int
+	// Git sources are mirrored into GitCacheDir. Local repositories are only
+	// allowed when GitAllowLocal is set, since they expose the worker's disk.
+	GitCacheDir      string
+	GitMaxFileSizeKB int
+	GitAllowLocal    bool
+	// Only one worker replica should run the source sync scheduler.
+	SchedulerEnabled bool
 }
 
 func LoadConfig() *Config {
@@ -24,16 +72,52 @@ func LoadConfig() *Config {
 	}
 
 	return &Config{
-		RedisAddr:        getEnv("REDIS_ADDR", "127.0.0.1:6379"),
-		PostGresUser:     getEnv("POSTGRES_USER", "postgres"),
-		PostGresPassword: getEnv("POSTGRES_PASSWORD", "postgres"),
-		PostGresDB:       getEnv("POSTGRES_DB", "rag_chatbot_db"),
-		PostGresHost:     getEnv("POSTGRES_HOST", "localhost"),
-		PostGresPort:     getEnv("POSTGRES_PORT", "5432"),
-		MinioEndpoint:    getEnv("MINIO_ENDPOINT", "localhost:9008"),
-		MinioAccessKey:   getEnv("MINIO_ACCESS_KEY", "minioadmin"),
-		MinioSecretKey:   getEnv("MINIO_SECRET_KEY", "minioadmin"),
-		MinioUseSSL:      useSSL,
+		RedisAddr:             getEnv("REDIS_ADDR", "127.0.0.1:6379"),
+		PostGresUser:          getEnv("POSTGRES_USER", "postgres"),
+		PostGresPassword:      getEnv("POSTGRES_PASSWORD", "postgres"),
+		PostGresDB:            getEnv("POSTGRES_DB", "rag_chatbot_db"),
+		PostGresHost:          getEnv("POSTGRES_HOST", "localhost"),
+		PostGresPort:          getEnv("POSTGRES_PORT", "5432"),
+		MinioEndpoint:         getEnv("MINIO_ENDPOINT", "localhost:9008"),
+		MinioAccessKey:        getEnv("MINIO_ACCESS_KEY", "minioadmin"),
+		MinioSecretKey:        getEnv("MINIO_SECRET_KEY", "minioadmin"),
+		MinioUseSSL:           useSSL,
+		MinioBucket:           getEnv("MINIO_BUCKET", "documents"),
+		QdrantURL:             getEnv("QDRANT_URL", "http://localhost:6333"),
+		QdrantAPIKey:          getEnv("QDRANT_API_KEY", "qdrantadmin123"),
+		QdrantCollection:      getEnv("QDRANT_COLLECTION", "document_chunks"),
+		EmbeddingBaseURL:      getEnv("EMBEDDING_BASE_URL", "https://api.openai.com/v1"),
+		EmbeddingAPIKey:       getEnv("EMBEDDING_API_KEY", ""),
+		EmbeddingModel:        getEnv("EMBEDDING_MODEL", "text-embedding-3-small"),
+		EmbeddingDimension:    getEnvInt("EMBEDDING_DIMENSION", 1536),
+		EmbeddingBatchSize:    getEnvInt("EMBEDDING_BATCH_SIZE", 32),
+		ChunkSize:             getEnvInt("CHUNK_SIZE", 1000),
+		ChunkOverlap:          getEnvInt("CHUNK_OVERLAP", 150),
+		SearchConfigs:         getEnv("FTS_LANGUAGE_CONFIGS", "en:english,vi:simple"),
+		DefaultSearchConfig:   getEnv("FTS_DEFAULT_CONFIG", "simple"),
+		LLMBaseURL:            getEnv("LLM_BASE_URL", "https://api.openai.com/v1"),
+		LLMAPIKey:             getEnv("LLM_API_KEY", ""),
+		LLMModel:              getEnv("LLM_MODEL", "gpt-4o-mini"),
+		SummaryEnabled:        getEnv("SUMMARY_ENABLED", "true") == "true",
+		SummaryMaxInputChars:  getEnvInt("SUMMARY_MAX_INPUT_CHARS", 12000),
+		OCRProvider:           getEnv("OCR_PROVIDER", ""),
+		OCRLanguage:           getEnv("OCR_LANGUAGE", "eng"),
+		OCRServiceURL:         getEnv("OCR_SERVICE_URL", ""),
+		OCRAPIKey:             getEnv("OCR_API_KEY", ""),
+		TesseractPath:         getEnv("TESSERACT_PATH", "tesseract"),
+		PDFToPPMPath:          getEnv("PDFTOPPM_PATH", "pdftoppm"),
+		OCRDPI:                getEnvInt("OCR_DPI", 300),
+		ArchiveMaxEntries:     getEnvInt("ARCHIVE_MAX_ENTRIES", 1000),
+		ArchiveMaxEntrySizeMB: getEnvInt("ARCHIVE_MAX_ENTRY_SIZE_MB", 100),
+		ArchiveMaxTotalSizeMB: getEnvInt("ARCHIVE_MAX_TOTAL_SIZE_MB", 1024),
+		ArchiveMaxRatio:       getEnvInt("ARCHIVE_MAX_RATIO", 100),
+		CrawlerUserAgent:      getEnv("CRAWLER_USER_AGENT", "RAGChatbotCrawler/1.0"),
+		CrawlerMaxPageSizeMB:  getEnvInt("CRAWLER_MAX_PAGE_SIZE_MB", 10),
+		CrawlerDelayMs:        getEnvInt("CRAWLER_DELAY_MS", 200),
+		GitCacheDir:           getEnv("GIT_CACHE_DIR", "/tmp/rag-git-cache"),
+		GitMaxFileSizeKB:      getEnvInt("GIT_MAX_FILE_SIZE_KB", 1024),
+		GitAllowLocal:         getEnv("GIT_ALLOW_LOCAL", "false") == "true",
+		SchedulerEnabled:      getEnv("SCHEDULER_ENABLED", "true") == "true",
 	}
 }
 
@@ -43,3 +127,12 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	if value, exists := os.LookupEnv(key); exists {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
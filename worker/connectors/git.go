@@ -0,0 +1,258 @@
+package connectors
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"worker/pipeline"
+)
+
+// GitConfig is the git source configuration written by the backend.
+type GitConfig struct {
+	Branch string `json:"branch"`
+	// Include limits the sync to paths matching one of the glob patterns,
+	// matched against the full path and the file name.
+	Include []string `json:"include"`
+}
+
+// GitClient keeps a bare mirror of every git source in cacheDir, so a sync
+// only fetches new commits.
+type GitClient struct {
+	cacheDir    string
+	maxFileSize int64
+	allowLocal  bool
+}
+
+func NewGitClient(cacheDir string, maxFileSize int64, allowLocal bool) *GitClient {
+	return &GitClient{cacheDir: cacheDir, maxFileSize: maxFileSize, allowLocal: allowLocal}
+}
+
+type gitRepo struct {
+	dir string
+}
+
+// gitFile is a blob in a commit's tree.
+type gitFile struct {
+	path string
+	size int64
+}
+
+// isLocalRemote reports whether the remote is a path on the worker's disk.
+func isLocalRemote(remote string) bool {
+	if strings.HasPrefix(remote, "file://") || strings.HasPrefix(remote, "/") || strings.HasPrefix(remote, ".") {
+		return true
+	}
+	// scp-like syntax "host:path" is remote, anything else without a scheme is a path
+	return !strings.Contains(remote, "://") && !strings.Contains(remote, ":")
+}
+
+// mirror clones the remote on first use and fetches all branches afterwards.
+func (g *GitClient) mirror(ctx context.Context, sourceID uint, remote string) (*gitRepo, error) {
+	if remote == "" || strings.HasPrefix(remote, "-") {
+		return nil, fmt.Errorf("%w: invalid repository %q", ErrInvalidSource, remote)
+	}
+	if !g.allowLocal && isLocalRemote(remote) {
+		return nil, fmt.Errorf("%w: local repositories are disabled", ErrInvalidSource)
+	}
+
+	repo := &gitRepo{dir: filepath.Join(g.cacheDir, fmt.Sprintf("source_%d", sourceID))}
+	if _, err := os.Stat(filepath.Join(repo.dir, "HEAD")); err == nil {
+		origin, err := repo.git(ctx, "config", "--get", "remote.origin.url")
+		if err == nil && strings.TrimSpace(string(origin)) == remote {
+			if _, err := repo.git(ctx, "fetch", "--quiet", "--prune", "--force", "origin", "+refs/heads/*:refs/heads/*"); err != nil {
+				return nil, err
+			}
+			return repo, nil
+		}
+		// the source points elsewhere now, start over
+		if err := os.RemoveAll(repo.dir); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.MkdirAll(g.cacheDir, 0o755); err != nil {
+		return nil, err
+	}
+	if _, err := runGit(ctx, "", "clone", "--bare", "--quiet", "--", remote, repo.dir); err != nil {
+		os.RemoveAll(repo.dir)
+		return nil, err
+	}
+	return repo, nil
+}
+
+// resolve returns the commit SHA of the branch, or of the default branch
+// when branch is empty.
+func (r *gitRepo) resolve(ctx context.Context, branch string) (string, error) {
+	ref := "HEAD"
+	if branch != "" {
+		if strings.HasPrefix(branch, "-") {
+			return "", fmt.Errorf("%w: invalid branch %q", ErrInvalidSource, branch)
+		}
+		ref = "refs/heads/" + branch
+	}
+	out, err := r.git(ctx, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("%w: branch %q not found", ErrInvalidSource, branch)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (r *gitRepo) hasCommit(ctx context.Context, sha string) bool {
+	if sha == "" {
+		return false
+	}
+	_, err := r.git(ctx, "cat-file", "-e", sha+"^{commit}")
+	return err == nil
+}
+
+// listFiles returns the regular files of the commit, optionally restricted
+// to the given paths. Symlinks and submodules are left out.
+func (r *gitRepo) listFiles(ctx context.Context, commit string, paths ...string) ([]gitFile, error) {
+	if len(paths) == 0 {
+		return r.lsTree(ctx, commit)
+	}
+	var files []gitFile
+	// keep the command line short
+	for start := 0; start < len(paths); start += 500 {
+		end := start + 500
+		if end > len(paths) {
+			end = len(paths)
+		}
+		batch, err := r.lsTree(ctx, commit, paths[start:end]...)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, batch...)
+	}
+	return files, nil
+}
+
+func (r *gitRepo) lsTree(ctx context.Context, commit string, paths ...string) ([]gitFile, error) {
+	args := append([]string{"ls-tree", "-r", "-z", "--long", commit, "--"}, paths...)
+	out, err := r.git(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []gitFile
+	for _, entry := range strings.Split(string(out), "\x00") {
+		// "<mode> <type> <object> <size>\t<path>"
+		meta, name, ok := strings.Cut(entry, "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 4 || fields[1] != "blob" || fields[0] == "120000" {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			continue
+		}
+		files = append(files, gitFile{path: name, size: size})
+	}
+	return files, nil
+}
+
+// diff lists the paths added or modified and the paths deleted between two
+// commits. Renames show up as a deletion and an addition.
+func (r *gitRepo) diff(ctx context.Context, from, to string) (changed, deleted []string, err error) {
+	out, err := r.git(ctx, "diff", "--name-status", "-z", "--no-renames", from, to, "--")
+	if err != nil {
+		return nil, nil, err
+	}
+	parts := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	for i := 0; i+1 < len(parts); i += 2 {
+		status, name := parts[i], parts[i+1]
+		if strings.HasPrefix(status, "D") {
+			deleted = append(deleted, name)
+		} else {
+			changed = append(changed, name)
+		}
+	}
+	return changed, deleted, nil
+}
+
+func (r *gitRepo) readFile(ctx context.Context, commit, name string) ([]byte, error) {
+	return r.git(ctx, "cat-file", "blob", commit+":"+name)
+}
+
+func (r *gitRepo) git(ctx context.Context, args ...string) ([]byte, error) {
+	return runGit(ctx, r.dir, args...)
+}
+
+// runGit runs the git CLI without prompting for credentials and with only the
+// usual transports enabled.
+func runGit(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	if dir != "" {
+		cmd.Args = append([]string{"git", "--git-dir", dir}, args...)
+	}
+	cmd.Env = append(os.Environ(),
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_ALLOW_PROTOCOL=file:git:http:https:ssh",
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+func supportedSourceFile(name string) bool {
+	return pipeline.SupportedExtension(path.Ext(name))
+}
+
+// wanted reports whether a file of the repository should become a document.
+func (g *GitClient) wanted(f gitFile, include []string) bool {
+	if f.size > g.maxFileSize || !supportedSourceFile(f.path) || isHidden(f.path) {
+		return false
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, pattern := range include {
+		if ok, _ := path.Match(pattern, f.path); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(f.path)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// includeDigest identifies a set of include patterns, so a sync can tell
+// whether the previous one selected files the same way. No patterns give
+// an empty digest.
+func includeDigest(include []string) string {
+	if len(include) == 0 {
+		return ""
+	}
+	patterns := slices.Clone(include)
+	slices.Sort(patterns)
+	sum := sha256.Sum256([]byte(strings.Join(patterns, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// isHidden reports whether a path lies in or is a dotfile, such as .github.
+func isHidden(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,274 @@
+package connectors
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"worker/models"
+)
+
+// testRemote is a bare repository fed from a work tree.
+type testRemote struct {
+	t    *testing.T
+	bare string
+	work string
+}
+
+func newTestRemote(t *testing.T) *testRemote {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	r := &testRemote{t: t, bare: filepath.Join(dir, "remote.git"), work: filepath.Join(dir, "work")}
+	r.run("", "init", "--bare", "--quiet", "--initial-branch=main", r.bare)
+	r.run("", "init", "--quiet", "--initial-branch=main", r.work)
+	r.run(r.work, "remote", "add", "origin", r.bare)
+	return r
+}
+
+func (r *testRemote) run(dir string, args ...string) string {
+	r.t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		r.t.Fatalf("git %v: %v: %s", args, err, out)
+	}
+	return string(out)
+}
+
+// commit writes files (an empty content deletes the file), commits and
+// pushes them, and returns the new commit.
+func (r *testRemote) commit(files map[string]string) string {
+	r.t.Helper()
+	for name, content := range files {
+		p := filepath.Join(r.work, name)
+		if content == "" {
+			r.run(r.work, "rm", "--quiet", name)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			r.t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			r.t.Fatal(err)
+		}
+		r.run(r.work, "add", name)
+	}
+	r.run(r.work, "commit", "--quiet", "-m", "update")
+	r.run(r.work, "push", "--quiet", "origin", "main")
+	return r.run(r.work, "rev-parse", "HEAD")[:40]
+}
+
+func filePaths(files []gitFile) []string {
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.path
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+func TestGitMirror(t *testing.T) {
+	ctx := context.Background()
+	remote := newTestRemote(t)
+	first := remote.commit(map[string]string{
+		"README.md":      "# readme",
+		"docs/guide.md":  "guide",
+		"docs/logo.bin":  "binary",
+		".github/ci.yml": "ci",
+		"src/main.go":    "package main",
+		"docs/big.txt":   "0123456789",
+	})
+
+	g := NewGitClient(t.TempDir(), 1<<20, true)
+	repo, err := g.mirror(ctx, 1, remote.bare)
+	if err != nil {
+		t.Fatalf("mirror: %v", err)
+	}
+	commit, err := repo.resolve(ctx, "main")
+	if err != nil || commit != first {
+		t.Fatalf("resolve(main) = %q, %v, want %q", commit, err, first)
+	}
+	if head, err := repo.resolve(ctx, ""); err != nil || head != first {
+		t.Errorf("resolve(\"\") = %q, %v, want %q", head, err, first)
+	}
+	if _, err := repo.resolve(ctx, "missing"); !errors.Is(err, ErrInvalidSource) {
+		t.Errorf("resolve(missing) error = %v, want ErrInvalidSource", err)
+	}
+
+	files, err := repo.listFiles(ctx, commit)
+	if err != nil {
+		t.Fatalf("listFiles: %v", err)
+	}
+	want := []string{".github/ci.yml", "README.md", "docs/big.txt", "docs/guide.md", "docs/logo.bin", "src/main.go"}
+	if got := filePaths(files); !slices.Equal(got, want) {
+		t.Errorf("listFiles = %v, want %v", got, want)
+	}
+	body, err := repo.readFile(ctx, commit, "docs/guide.md")
+	if err != nil || string(body) != "guide" {
+		t.Errorf("readFile = %q, %v, want %q", body, err, "guide")
+	}
+
+	second := remote.commit(map[string]string{
+		"docs/guide.md": "guide v2",
+		"docs/new.md":   "new",
+		"README.md":     "",
+	})
+	repo, err = g.mirror(ctx, 1, remote.bare)
+	if err != nil {
+		t.Fatalf("mirror after push: %v", err)
+	}
+	if commit, _ := repo.resolve(ctx, "main"); commit != second {
+		t.Fatalf("resolve after fetch = %q, want %q", commit, second)
+	}
+	if !repo.hasCommit(ctx, first) || repo.hasCommit(ctx, "0000000000000000000000000000000000000000") {
+		t.Error("hasCommit does not tell known and unknown commits apart")
+	}
+	changed, deleted, err := repo.diff(ctx, first, second)
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	slices.Sort(changed)
+	if !slices.Equal(changed, []string{"docs/guide.md", "docs/new.md"}) || !slices.Equal(deleted, []string{"README.md"}) {
+		t.Errorf("diff = %v, %v", changed, deleted)
+	}
+
+	local := NewGitClient(t.TempDir(), 1<<20, false)
+	if _, err := local.mirror(ctx, 2, remote.bare); !errors.Is(err, ErrInvalidSource) {
+		t.Errorf("mirror of a local path with local remotes disabled: %v, want ErrInvalidSource", err)
+	}
+	if _, err := g.mirror(ctx, 3, "--upload-pack=evil"); !errors.Is(err, ErrInvalidSource) {
+		t.Errorf("mirror of an option-like remote: %v, want ErrInvalidSource", err)
+	}
+}
+
+func TestFilesToSync(t *testing.T) {
+	ctx := context.Background()
+	remote := newTestRemote(t)
+	first := remote.commit(map[string]string{
+		"docs/a.md":   "a",
+		"docs/b.md":   "b",
+		"src/main.go": "package main",
+	})
+	second := remote.commit(map[string]string{
+		"docs/a.md":  "a v2",
+		"src/lib.go": "package main",
+	})
+
+	g := NewGitClient(t.TempDir(), 1<<20, true)
+	repo, err := g.mirror(ctx, 1, remote.bare)
+	if err != nil {
+		t.Fatalf("mirror: %v", err)
+	}
+
+	newState := func(include []string) *syncState {
+		return &syncState{
+			source: &models.DocumentSource{Revision: first, RevisionInclude: includeDigest(include)},
+			docs: map[string]*models.Document{
+				"docs/a.md": {}, "docs/b.md": {},
+			},
+			seen:   map[string]bool{},
+			result: &SyncResult{},
+		}
+	}
+
+	// same patterns as the previous sync: only the changed files are read
+	include := []string{"docs/*"}
+	st := newState(include)
+	files, err := g.filesToSync(ctx, repo, st, second, include)
+	if err != nil {
+		t.Fatalf("filesToSync: %v", err)
+	}
+	if got := filePaths(files); !slices.Equal(got, []string{"docs/a.md"}) {
+		t.Errorf("incremental sync reads %v, want [docs/a.md]", got)
+	}
+	if !st.seen["docs/b.md"] || st.result.Unchanged != 1 {
+		t.Errorf("unchanged documents: seen %v, %d unchanged", st.seen, st.result.Unchanged)
+	}
+
+	// the patterns changed since: every wanted file is read
+	st = newState(include)
+	include = []string{"docs/*", "*.go"}
+	files, err = g.filesToSync(ctx, repo, st, second, include)
+	if err != nil {
+		t.Fatalf("filesToSync: %v", err)
+	}
+	want := []string{"docs/a.md", "docs/b.md", "src/lib.go", "src/main.go"}
+	if got := filePaths(files); !slices.Equal(got, want) {
+		t.Errorf("sync after an include change reads %v, want %v", got, want)
+	}
+	if len(st.seen) != 0 || st.result.Unchanged != 0 {
+		t.Errorf("full sync marked documents unchanged: seen %v", st.seen)
+	}
+
+	// narrowing the patterns is a change too, so excluded documents go
+	st = newState([]string{"docs/*", "*.go"})
+	files, err = g.filesToSync(ctx, repo, st, second, []string{"docs/b.md"})
+	if err != nil {
+		t.Fatalf("filesToSync: %v", err)
+	}
+	if got := filePaths(files); !slices.Equal(got, []string{"docs/b.md"}) {
+		t.Errorf("sync after narrowing reads %v, want [docs/b.md]", got)
+	}
+	if st.seen["docs/a.md"] {
+		t.Error("excluded document was marked as seen")
+	}
+
+	// the previous commit is gone, e.g. after a force push
+	st = newState(nil)
+	st.source.Revision = "0000000000000000000000000000000000000000"
+	files, err = g.filesToSync(ctx, repo, st, second, nil)
+	if err != nil {
+		t.Fatalf("filesToSync: %v", err)
+	}
+	if got := filePaths(files); len(got) != 4 {
+		t.Errorf("sync without the previous commit reads %v, want all 4 files", got)
+	}
+}
+
+func TestGitWanted(t *testing.T) {
+	g := NewGitClient("", 100, false)
+	tests := []struct {
+		file    gitFile
+		include []string
+		want    bool
+	}{
+		{gitFile{path: "docs/guide.md", size: 10}, nil, true},
+		{gitFile{path: "docs/guide.md", size: 101}, nil, false},
+		{gitFile{path: "docs/logo.bin", size: 10}, nil, false},
+		{gitFile{path: ".github/README.md", size: 10}, nil, false},
+		{gitFile{path: "docs/guide.md", size: 10}, []string{"docs/*.md"}, true},
+		{gitFile{path: "src/guide.md", size: 10}, []string{"docs/*.md"}, false},
+		{gitFile{path: "src/deep/guide.md", size: 10}, []string{"*.md"}, true},
+	}
+	for _, tt := range tests {
+		if got := g.wanted(tt.file, tt.include); got != tt.want {
+			t.Errorf("wanted(%+v, %v) = %v, want %v", tt.file, tt.include, got, tt.want)
+		}
+	}
+}
+
+func TestIncludeDigest(t *testing.T) {
+	if includeDigest(nil) != "" {
+		t.Error("no patterns must give an empty digest")
+	}
+	a := includeDigest([]string{"docs/*", "*.go"})
+	if a != includeDigest([]string{"*.go", "docs/*"}) {
+		t.Error("digest depends on the order of the patterns")
+	}
+	if a == includeDigest([]string{"docs/*"}) || a == includeDigest([]string{"docs/*,*.go"}) {
+		t.Error("different patterns give the same digest")
+	}
+}
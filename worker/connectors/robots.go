@@ -0,0 +1,134 @@
+package connectors
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// robotsRules holds the robots.txt rules that apply to the crawler's user agent.
+type robotsRules struct {
+	allow      []string
+	disallow   []string
+	crawlDelay time.Duration
+}
+
+// parseRobots reads robots.txt and keeps the group for userAgent, falling
+// back to the "*" group. Groups naming several agents are supported.
+func parseRobots(r io.Reader, userAgent string) *robotsRules {
+	agent := strings.ToLower(userAgent)
+	if i := strings.IndexAny(agent, "/ "); i > 0 {
+		agent = agent[:i]
+	}
+
+	var specific, wildcard *robotsRules
+	var current []*robotsRules
+	inRules := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// a user-agent line after rules starts a new group
+			if inRules {
+				current = nil
+				inRules = false
+			}
+			name := strings.ToLower(value)
+			switch {
+			case name == "*":
+				if wildcard == nil {
+					wildcard = &robotsRules{}
+				}
+				current = append(current, wildcard)
+			case name != "" && agent != "" && strings.Contains(agent, name):
+				if specific == nil {
+					specific = &robotsRules{}
+				}
+				current = append(current, specific)
+			}
+		case "allow", "disallow", "crawl-delay":
+			inRules = true
+			for _, rules := range current {
+				switch key {
+				case "allow":
+					if value != "" {
+						rules.allow = append(rules.allow, value)
+					}
+				case "disallow":
+					if value != "" {
+						rules.disallow = append(rules.disallow, value)
+					}
+				case "crawl-delay":
+					if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+						rules.crawlDelay = time.Duration(secs * float64(time.Second))
+					}
+				}
+			}
+		}
+	}
+
+	if specific != nil {
+		return specific
+	}
+	if wildcard != nil {
+		return wildcard
+	}
+	return &robotsRules{}
+}
+
+// allowed applies the longest matching rule to the path; on a tie Allow wins.
+func (r *robotsRules) allowed(path string) bool {
+	best, allow := -1, true
+	for _, pattern := range r.allow {
+		if robotsMatch(pattern, path) && len(pattern) >= best {
+			best, allow = len(pattern), true
+		}
+	}
+	for _, pattern := range r.disallow {
+		if robotsMatch(pattern, path) && len(pattern) > best {
+			best, allow = len(pattern), false
+		}
+	}
+	return allow
+}
+
+// robotsMatch matches a robots.txt path pattern, which may contain "*"
+// wildcards and end with "$" to anchor at the end of the path.
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	for _, part := range parts[1:] {
+		i := strings.Index(path[pos:], part)
+		if i < 0 {
+			return false
+		}
+		pos += i + len(part)
+	}
+	if !anchored {
+		return true
+	}
+	if len(parts) > 1 && parts[len(parts)-1] != "" {
+		return strings.HasSuffix(path, parts[len(parts)-1])
+	}
+	return pos == len(path) || (len(parts) > 1 && parts[len(parts)-1] == "")
+}
@@ -0,0 +1,105 @@
+package connectors
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRobots(t *testing.T) {
+	const robots = `
+# comment
+User-agent: *
+Disallow: /private/
+Crawl-delay: 2
+
+User-agent: OtherBot
+User-agent: KBCrawler
+Disallow: /drafts/
+Allow: /drafts/public
+Crawl-delay: 0.5
+
+User-agent: Nobody
+Disallow: /
+`
+	tests := []struct {
+		name      string
+		agent     string
+		robots    string
+		allowed   []string
+		forbidden []string
+		delay     time.Duration
+	}{
+		{
+			name:      "specific group",
+			agent:     "KBCrawler/1.0 (+https://example.com)",
+			robots:    robots,
+			allowed:   []string{"/", "/private/page", "/drafts/public/a"},
+			forbidden: []string{"/drafts/", "/drafts/x"},
+			delay:     500 * time.Millisecond,
+		},
+		{
+			name:      "wildcard group",
+			agent:     "SomeBot",
+			robots:    robots,
+			allowed:   []string{"/", "/drafts/x"},
+			forbidden: []string{"/private/", "/private/page"},
+			delay:     2 * time.Second,
+		},
+		{
+			name:      "empty user-agent does not match every agent",
+			agent:     "KBCrawler",
+			robots:    "User-agent:\nDisallow: /\n\nUser-agent: *\nDisallow: /tmp/\n",
+			allowed:   []string{"/", "/page"},
+			forbidden: []string{"/tmp/x"},
+		},
+		{
+			name:    "no rules",
+			agent:   "KBCrawler",
+			robots:  "",
+			allowed: []string{"/", "/anything"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := parseRobots(strings.NewReader(tt.robots), tt.agent)
+			for _, path := range tt.allowed {
+				if !rules.allowed(path) {
+					t.Errorf("allowed(%q) = false, want true", path)
+				}
+			}
+			for _, path := range tt.forbidden {
+				if rules.allowed(path) {
+					t.Errorf("allowed(%q) = true, want false", path)
+				}
+			}
+			if rules.crawlDelay != tt.delay {
+				t.Errorf("crawlDelay = %v, want %v", rules.crawlDelay, tt.delay)
+			}
+		})
+	}
+}
+
+func TestRobotsMatch(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/", "/anything", true},
+		{"/docs", "/docs/a", true},
+		{"/docs", "/doc", false},
+		{"/*.pdf", "/files/a.pdf", true},
+		{"/*.pdf$", "/files/a.pdf", true},
+		{"/*.pdf$", "/files/a.pdf?x=1", false},
+		{"/a$", "/a", true},
+		{"/a$", "/ab", false},
+		{"/a*b*c", "/axxbyyc/d", true},
+		{"/a*b*c", "/axxc", false},
+		{"/*$", "/any/path", true},
+	}
+	for _, tt := range tests {
+		if got := robotsMatch(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("robotsMatch(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
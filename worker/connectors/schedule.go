@@ -0,0 +1,43 @@
+package connectors
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/hibiken/asynq"
+
+	"worker/models"
+	"worker/tasks"
+)
+
+// syncUniqueness keeps a scheduled sync from being queued again while the
+// previous one is still pending or running.
+const syncUniqueness = time.Hour
+
+// SourceSchedules feeds asynq's periodic task manager with the sync schedule
+// of every document source. The manager polls it, so schedule changes made
+// through the API are picked up without a restart.
+type SourceSchedules struct{}
+
+func (SourceSchedules) GetConfigs() ([]*asynq.PeriodicTaskConfig, error) {
+	sources, err := models.ListScheduledSources()
+	if err != nil {
+		return nil, err
+	}
+
+	configs := make([]*asynq.PeriodicTaskConfig, 0, len(sources))
+	for _, source := range sources {
+		b, err := json.Marshal(tasks.SyncSourcePayload{SourceID: source.ID, Trigger: tasks.TriggerScheduled})
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, &asynq.PeriodicTaskConfig{
+			Cronspec: source.Schedule,
+			Task:     asynq.NewTask(tasks.TypeSyncSource, b),
+			Opts:     []asynq.Option{asynq.Unique(syncUniqueness)},
+		})
+	}
+	log.Printf("[Scheduler] %d scheduled document sources", len(configs))
+	return configs, nil
+}
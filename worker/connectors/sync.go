@@ -0,0 +1,395 @@
+package connectors
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+
+	"worker/models"
+	"worker/pipeline"
+	"worker/services"
+	"worker/tasks"
+)
+
+// SyncResult counts what a sync did to the source's documents.
+type SyncResult struct {
+	Created   int
+	Updated   int
+	Unchanged int
+	Deleted   int
+}
+
+// Syncer turns the content of a document source into documents. Content is
+// stored in MinIO like an uploaded file and indexed by the regular pipeline.
+type Syncer struct {
+	minio   *services.MinioService
+	queue   *asynq.Client
+	crawler *Crawler
+	git     *GitClient
+	ingest  *pipeline.Pipeline
+	bucket  string
+}
+
+func NewSyncer(minio *services.MinioService, queue *asynq.Client, crawler *Crawler, git *GitClient, ingest *pipeline.Pipeline, bucket string) *Syncer {
+	return &Syncer{minio: minio, queue: queue, crawler: crawler, git: git, ingest: ingest, bucket: bucket}
+}
+
+// item is one piece of content fetched from a source.
+type item struct {
+	key          string // identifies the item across syncs, e.g. its URL
+	fileName     string
+	contentType  string
+	body         []byte
+	etag         string
+	lastModified string
+	notModified  bool
+	revision     string // commit the content was read at, for git sources
+}
+
+// syncState holds the source's documents as of the start of the sync and
+// which of them the sync has seen.
+type syncState struct {
+	source *models.DocumentSource
+	docs   map[string]*models.Document
+	seen   map[string]bool
+	result *SyncResult
+}
+
+// Sync fetches everything the source points at and records the run in the
+// sync history. Unchanged content is left alone, changed content becomes a
+// new version of the existing document, and documents whose content is gone
+// from the source are deleted. Nothing is deleted when the sync could not
+// see the whole source.
+func (s *Syncer) Sync(ctx context.Context, source *models.DocumentSource, trigger string) (*SyncResult, error) {
+	run := &models.SourceSyncRun{
+		SourceID:        source.ID,
+		KnowledgeBaseID: source.KnowledgeBaseID,
+		Trigger:         trigger,
+		Status:          "running",
+		StartedAt:       time.Now(),
+	}
+	if err := models.CreateSourceSyncRun(run); err != nil {
+		return nil, fmt.Errorf("failed to record sync run: %w", err)
+	}
+
+	result, err := s.sync(ctx, source)
+
+	now := time.Now()
+	run.FinishedAt = &now
+	run.Status = "done"
+	if err != nil {
+		run.Status = "failed"
+		run.Error = err.Error()
+	}
+	if result != nil {
+		run.CreatedCount = result.Created
+		run.UpdatedCount = result.Updated
+		run.UnchangedCount = result.Unchanged
+		run.DeletedCount = result.Deleted
+	}
+	if saveErr := models.UpdateSourceSyncRun(run); saveErr != nil {
+		log.Printf("[Sync] Failed to record sync run %d: %v", run.ID, saveErr)
+	}
+	return result, err
+}
+
+func (s *Syncer) sync(ctx context.Context, source *models.DocumentSource) (*SyncResult, error) {
+	docs, err := models.ListSourceDocuments(source.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load source documents: %w", err)
+	}
+	st := &syncState{
+		source: source,
+		docs:   make(map[string]*models.Document, len(docs)),
+		seen:   make(map[string]bool),
+		result: &SyncResult{},
+	}
+	for i := range docs {
+		st.docs[docs[i].SourceURL] = &docs[i]
+	}
+
+	var complete bool
+	switch source.Type {
+	case "url":
+		var cfg WebConfig
+		if len(source.Config) > 0 {
+			if err := json.Unmarshal(source.Config, &cfg); err != nil {
+				return nil, fmt.Errorf("%w: bad config: %v", ErrInvalidSource, err)
+			}
+		}
+		crawl, err := s.crawler.Crawl(ctx, source.URL, cfg, &storedPages{syncer: s, docs: st.docs}, func(p Page) error {
+			return s.store(ctx, st, item{
+				key:          p.URL,
+				fileName:     "page.html",
+				contentType:  "text/html",
+				body:         p.Body,
+				etag:         p.ETag,
+				lastModified: p.LastModified,
+				notModified:  p.NotModified,
+			})
+		})
+		if err != nil {
+			return st.result, err
+		}
+		for _, key := range crawl.Failed {
+			st.seen[key] = true
+		}
+		complete = !crawl.Truncated
+	case "git":
+		commit, include, err := s.syncGit(ctx, st)
+		if err != nil {
+			return st.result, err
+		}
+		if err := s.removeUnseen(ctx, st); err != nil {
+			return st.result, err
+		}
+		if err := models.UpdateDocumentSource(source.ID, map[string]interface{}{"revision": commit, "revision_include": include}); err != nil {
+			return st.result, fmt.Errorf("failed to record revision: %w", err)
+		}
+		return st.result, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown source type %q", ErrInvalidSource, source.Type)
+	}
+
+	if complete {
+		if err := s.removeUnseen(ctx, st); err != nil {
+			return st.result, err
+		}
+	}
+	return st.result, nil
+}
+
+// store saves one item of the source as a document, or as a new version of
+// the document that holds the item's previous content.
+func (s *Syncer) store(ctx context.Context, st *syncState, it item) error {
+	st.seen[it.key] = true
+	existing := st.docs[it.key]
+
+	if it.notModified && existing != nil {
+		st.result.Unchanged++
+		return nil
+	}
+
+	sum := sha256.Sum256(it.body)
+	hash := hex.EncodeToString(sum[:])
+	if existing != nil && existing.ContentHash == hash {
+		st.result.Unchanged++
+		if existing.SourceETag != it.etag || existing.SourceLastModified != it.lastModified {
+			if err := models.UpdateSourceValidators(existing.ID, it.etag, it.lastModified); err != nil {
+				return fmt.Errorf("failed to update document: %w", err)
+			}
+		}
+		return nil
+	}
+
+	source := st.source
+	objectName := fmt.Sprintf("kb_%d/sources/%d/%s/%s", source.KnowledgeBaseID, source.ID, uuid.New().String(), path.Base(it.fileName))
+	if err := s.minio.UploadObject(ctx, s.bucket, objectName, bytes.NewReader(it.body), int64(len(it.body)), it.contentType); err != nil {
+		return err
+	}
+
+	fileType := "doc"
+	if path.Ext(it.fileName) == ".csv" {
+		fileType = "csv"
+	}
+	version := &models.DocumentVersion{
+		FileName:        path.Base(it.fileName),
+		FileType:        fileType,
+		ObjectName:      objectName,
+		ContentHash:     hash,
+		Size:            int64(len(it.body)),
+		UploadedBy:      source.UserID,
+		SourceRevision:  it.revision,
+		EmbeddingStatus: "pending",
+	}
+
+	doc := existing
+	if doc == nil {
+		name := it.key
+		if len(name) > 255 {
+			name = name[:255]
+		}
+		sourceID := source.ID
+		doc = &models.Document{
+			KnowledgeBaseID:    source.KnowledgeBaseID,
+			UserID:             source.UserID,
+			Name:               name,
+			FileType:           fileType,
+			ObjectName:         objectName,
+			ContentHash:        hash,
+			Size:               int64(len(it.body)),
+			Version:            1,
+			SourceID:           &sourceID,
+			SourceURL:          it.key,
+			SourceETag:         it.etag,
+			SourceLastModified: it.lastModified,
+			EmbeddingStatus:    "pending",
+		}
+		version.Version = 1
+		if err := models.CreateDocumentWithVersion(doc, version); err != nil {
+			return fmt.Errorf("failed to create document: %w", err)
+		}
+		st.docs[it.key] = doc
+		st.result.Created++
+	} else {
+		doc.SourceETag = it.etag
+		doc.SourceLastModified = it.lastModified
+		if err := models.AddDocumentVersion(doc, version); err != nil {
+			return fmt.Errorf("failed to add document version: %w", err)
+		}
+		st.result.Updated++
+	}
+
+	if err := tasks.EnqueueProcessDocument(ctx, s.queue, tasks.ProcessDocumentPayload{
+		KnowledgeBaseID: source.KnowledgeBaseID,
+		DocumentID:      doc.ID,
+		Version:         version.Version,
+		Bucket:          s.bucket,
+		ObjectName:      objectName,
+		FileType:        fileType,
+	}); err != nil {
+		log.Printf("[Sync] Failed to enqueue document %d: %v", doc.ID, err)
+	}
+	return nil
+}
+
+// syncGit indexes the files of the source's branch and returns the commit it
+// synced and the digest of the include patterns it applied. When the commit
+// of the previous sync is still in the repository and the patterns did not
+// change, only the files changed since then are read.
+func (s *Syncer) syncGit(ctx context.Context, st *syncState) (string, string, error) {
+	var cfg GitConfig
+	if len(st.source.Config) > 0 {
+		if err := json.Unmarshal(st.source.Config, &cfg); err != nil {
+			return "", "", fmt.Errorf("%w: bad config: %v", ErrInvalidSource, err)
+		}
+	}
+	repo, err := s.git.mirror(ctx, st.source.ID, st.source.URL)
+	if err != nil {
+		return "", "", err
+	}
+	commit, err := repo.resolve(ctx, cfg.Branch)
+	if err != nil {
+		return "", "", err
+	}
+	include := includeDigest(cfg.Include)
+
+	files, err := s.git.filesToSync(ctx, repo, st, commit, cfg.Include)
+	if err != nil {
+		return "", "", err
+	}
+	for _, f := range files {
+		body, err := repo.readFile(ctx, commit, f.path)
+		if err != nil {
+			return "", "", err
+		}
+		if bytes.IndexByte(body, 0) >= 0 {
+			continue // binary file with a text extension
+		}
+		if err := s.store(ctx, st, item{
+			key:         f.path,
+			fileName:    f.path,
+			contentType: "text/plain; charset=utf-8",
+			body:        body,
+			revision:    commit,
+		}); err != nil {
+			return "", "", err
+		}
+	}
+	return commit, include, nil
+}
+
+// filesToSync returns the wanted files of the commit that must be read.
+// When the commit of the previous sync is still in the repository and the
+// include patterns did not change, these are the files changed since then
+// and the documents of the other files are marked as seen and unchanged.
+// Otherwise every wanted file is read.
+func (g *GitClient) filesToSync(ctx context.Context, repo *gitRepo, st *syncState, commit string, include []string) ([]gitFile, error) {
+	var files []gitFile
+	var err error
+	previous := st.source.Revision
+	if previous != "" && len(st.docs) > 0 && st.source.RevisionInclude == includeDigest(include) && repo.hasCommit(ctx, previous) {
+		changed, deleted, err := repo.diff(ctx, previous, commit)
+		if err != nil {
+			return nil, err
+		}
+		touched := make(map[string]bool, len(changed)+len(deleted))
+		for _, name := range append(changed, deleted...) {
+			touched[name] = true
+		}
+		for key := range st.docs {
+			if !touched[key] {
+				st.seen[key] = true
+				st.result.Unchanged++
+			}
+		}
+		if len(changed) > 0 {
+			if files, err = repo.listFiles(ctx, commit, changed...); err != nil {
+				return nil, err
+			}
+		}
+	} else if files, err = repo.listFiles(ctx, commit); err != nil {
+		return nil, err
+	}
+
+	wanted := files[:0]
+	for _, f := range files {
+		if g.wanted(f, include) {
+			wanted = append(wanted, f)
+		}
+	}
+	return wanted, nil
+}
+
+// removeUnseen deletes the documents whose content the sync did not find.
+func (s *Syncer) removeUnseen(ctx context.Context, st *syncState) error {
+	for key, doc := range st.docs {
+		if st.seen[key] {
+			continue
+		}
+		if err := s.ingest.Delete(ctx, s.bucket, doc.ID); err != nil {
+			return err
+		}
+		log.Printf("[Sync] Source %d: deleted document %d, %s is gone", st.source.ID, doc.ID, key)
+		st.result.Deleted++
+	}
+	return nil
+}
+
+// storedPages serves the crawler the validators and stored copies of the
+// pages a url source fetched before.
+type storedPages struct {
+	syncer *Syncer
+	docs   map[string]*models.Document
+}
+
+func (c *storedPages) Validators(url string) (string, string, bool) {
+	doc, ok := c.docs[url]
+	if !ok || (doc.SourceETag == "" && doc.SourceLastModified == "") {
+		return "", "", false
+	}
+	return doc.SourceETag, doc.SourceLastModified, true
+}
+
+func (c *storedPages) Body(ctx context.Context, url string) ([]byte, error) {
+	doc, ok := c.docs[url]
+	if !ok {
+		return nil, fmt.Errorf("no stored copy of %s", url)
+	}
+	reader, err := c.syncer.minio.DownloadObject(ctx, c.syncer.bucket, doc.ObjectName)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
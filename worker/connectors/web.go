@@ -0,0 +1,492 @@
+package connectors
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ErrInvalidSource is returned for sources that can never be synced, e.g. a
+// malformed URL or an unknown source type.
+var ErrInvalidSource = errors.New("invalid source")
+
+// maxSitemapDepth bounds how many nested sitemap indexes are followed.
+const maxSitemapDepth = 3
+
+// WebConfig is the url source configuration written by the backend.
+type WebConfig struct {
+	MaxDepth       int      `json:"max_depth"`
+	MaxPages       int      `json:"max_pages"`
+	AllowedDomains []string `json:"allowed_domains"`
+}
+
+// errGone marks pages that no longer exist, as opposed to transient failures.
+var errGone = errors.New("page is gone")
+
+// Page is a fetched HTML page. NotModified is set when the server confirmed
+// that the stored copy is current; Body then holds that copy.
+type Page struct {
+	URL          string
+	Body         []byte
+	ETag         string
+	LastModified string
+	NotModified  bool
+}
+
+// PageCache tells the crawler about pages stored by earlier syncs, so it can
+// send conditional requests and follow the links of unchanged pages.
+type PageCache interface {
+	// Validators returns the ETag and Last-Modified header of the stored copy.
+	Validators(url string) (etag, lastModified string, ok bool)
+	// Body returns the stored copy of the page.
+	Body(ctx context.Context, url string) ([]byte, error)
+}
+
+// CrawlResult tells the caller which stored pages it may treat as removed.
+type CrawlResult struct {
+	// Truncated is set when MaxPages stopped the crawl early.
+	Truncated bool
+	// Failed lists pages that could not be fetched for a reason other than
+	// being gone, e.g. a timeout or a server error.
+	Failed []string
+}
+
+// Crawler fetches the pages of a web site breadth first, staying on the
+// allowed domains and honouring robots.txt.
+type Crawler struct {
+	client      *http.Client
+	userAgent   string
+	maxPageSize int64
+	delay       time.Duration
+}
+
+func NewCrawler(userAgent string, maxPageSize int64, delay time.Duration) *Crawler {
+	return &Crawler{
+		client:      &http.Client{Timeout: 30 * time.Second},
+		userAgent:   userAgent,
+		maxPageSize: maxPageSize,
+		delay:       delay,
+	}
+}
+
+type crawlState struct {
+	cfg     WebConfig
+	robots  map[string]*robotsRules
+	visited map[string]bool
+	fetched int
+	// incomplete is set when part of a sitemap index could not be read
+	incomplete bool
+	last       time.Time
+}
+
+type queued struct {
+	url   *url.URL
+	depth int
+}
+
+type fetched struct {
+	body         []byte
+	contentType  string
+	url          *url.URL
+	etag         string
+	lastModified string
+	notModified  bool
+}
+
+// Crawl fetches start and, up to cfg.MaxDepth links away, the pages it links
+// to. When start is a sitemap, the pages listed in it are fetched instead and
+// their links are not followed. visit is called for every HTML page. cache
+// may be nil. A start URL that cannot be fetched or is not permitted is an
+// error, so a sync never takes an empty crawl for an empty site.
+func (cr *Crawler) Crawl(ctx context.Context, start string, cfg WebConfig, cache PageCache, visit func(Page) error) (*CrawlResult, error) {
+	startURL, err := url.Parse(start)
+	if err != nil || (startURL.Scheme != "http" && startURL.Scheme != "https") {
+		return nil, fmt.Errorf("%w: %q is not an http(s) URL", ErrInvalidSource, start)
+	}
+	if len(cfg.AllowedDomains) == 0 {
+		cfg.AllowedDomains = []string{startURL.Hostname()}
+	}
+	if cfg.MaxPages <= 0 {
+		cfg.MaxPages = 100
+	}
+
+	st := &crawlState{cfg: cfg, robots: map[string]*robotsRules{}, visited: map[string]bool{}}
+
+	result := &CrawlResult{}
+	queue := []queued{{url: startURL}}
+	for len(queue) > 0 && st.fetched < cfg.MaxPages {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		item := queue[0]
+		queue = queue[1:]
+
+		key := normalizeURL(item.url)
+		if st.visited[key] {
+			continue
+		}
+		if !cr.permitted(ctx, st, item.url) {
+			// without the start page nothing is known about the source,
+			// and a robots.txt that answered 403 once may be a fluke
+			if item.url == startURL {
+				return nil, fmt.Errorf("%s is not allowed by the allowed domains or robots.txt", start)
+			}
+			continue
+		}
+		st.visited[key] = true
+
+		var etag, lastModified string
+		if cache != nil {
+			etag, lastModified, _ = cache.Validators(key)
+		}
+		f, err := cr.fetch(ctx, st, item.url, etag, lastModified)
+		if err != nil && item.url == startURL {
+			return nil, fmt.Errorf("failed to fetch %s: %w", start, err)
+		}
+		if err != nil {
+			log.Printf("[Crawler] Skipping %s: %v", item.url, err)
+			if !errors.Is(err, errGone) {
+				result.Failed = append(result.Failed, key)
+			}
+			continue
+		}
+		finalURL := f.url
+		st.visited[normalizeURL(finalURL)] = true
+
+		if f.notModified {
+			f.body, err = cache.Body(ctx, key)
+			if err != nil {
+				log.Printf("[Crawler] Skipping %s: stored copy unavailable: %v", key, err)
+				result.Failed = append(result.Failed, key)
+				continue
+			}
+			f.contentType = "text/html"
+		}
+		body, contentType := f.body, f.contentType
+
+		if isSitemap(item.url, contentType, body) {
+			pages, err := cr.sitemapURLs(ctx, st, body, 0)
+			if err != nil {
+				log.Printf("[Crawler] Skipping sitemap %s: %v", item.url, err)
+				st.incomplete = true
+				continue
+			}
+			for _, u := range pages {
+				queue = append(queue, queued{url: u, depth: cfg.MaxDepth})
+			}
+			continue
+		}
+		if !strings.HasPrefix(contentType, "text/html") {
+			continue
+		}
+
+		doc, err := html.Parse(bytes.NewReader(body))
+		if err != nil {
+			log.Printf("[Crawler] Skipping %s: %v", finalURL, err)
+			continue
+		}
+		noindex, nofollow := robotsMeta(doc)
+		if !noindex {
+			if err := visit(Page{
+				URL:          normalizeURL(finalURL),
+				Body:         body,
+				ETag:         f.etag,
+				LastModified: f.lastModified,
+				NotModified:  f.notModified,
+			}); err != nil {
+				return nil, err
+			}
+			st.fetched++
+		}
+		if nofollow || item.depth >= cfg.MaxDepth {
+			continue
+		}
+		for _, link := range extractLinks(doc, finalURL) {
+			if !st.visited[normalizeURL(link)] {
+				queue = append(queue, queued{url: link, depth: item.depth + 1})
+			}
+		}
+	}
+	result.Truncated = len(queue) > 0 || st.incomplete
+	return result, nil
+}
+
+// permitted checks the domain allow list and the host's robots.txt.
+func (cr *Crawler) permitted(ctx context.Context, st *crawlState, u *url.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	if !domainAllowed(u.Hostname(), st.cfg.AllowedDomains) {
+		return false
+	}
+	return cr.robotsFor(ctx, st, u).allowed(u.EscapedPath())
+}
+
+func (cr *Crawler) robotsFor(ctx context.Context, st *crawlState, u *url.URL) *robotsRules {
+	origin := u.Scheme + "://" + u.Host
+	if rules, ok := st.robots[origin]; ok {
+		return rules
+	}
+
+	rules := &robotsRules{}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+"/robots.txt", nil)
+	if err == nil {
+		req.Header.Set("User-Agent", cr.userAgent)
+		resp, err := cr.client.Do(req)
+		if err == nil {
+			switch {
+			case resp.StatusCode == http.StatusOK:
+				rules = parseRobots(io.LimitReader(resp.Body, 512<<10), cr.userAgent)
+			case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+				// a site that hides robots.txt does not want to be crawled
+				rules = &robotsRules{disallow: []string{"/"}}
+			}
+			resp.Body.Close()
+		}
+	}
+	st.robots[origin] = rules
+	return rules
+}
+
+// fetch downloads a page, waiting between requests as configured or as asked
+// by robots.txt. Redirects are only followed within the allowed domains. With
+// validators of a stored copy the request is conditional.
+func (cr *Crawler) fetch(ctx context.Context, st *crawlState, u *url.URL, etag, lastModified string) (*fetched, error) {
+	delay := cr.delay
+	if d := cr.robotsFor(ctx, st, u).crawlDelay; d > delay {
+		delay = d
+	}
+	if wait := time.Until(st.last.Add(delay)); wait > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	st.last = time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", cr.userAgent)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	client := *cr.client
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return errors.New("too many redirects")
+		}
+		if !cr.permitted(ctx, st, req.URL) {
+			return fmt.Errorf("redirect to %s is not allowed", req.URL)
+		}
+		return nil
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	f := &fetched{
+		url:          resp.Request.URL,
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotModified && (etag != "" || lastModified != ""):
+		f.notModified = true
+		if f.etag == "" {
+			f.etag = etag
+		}
+		if f.lastModified == "" {
+			f.lastModified = lastModified
+		}
+		return f, nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return nil, fmt.Errorf("%w: status %d", errGone, resp.StatusCode)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	f.body, err = io.ReadAll(io.LimitReader(resp.Body, cr.maxPageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(f.body)) > cr.maxPageSize {
+		return nil, fmt.Errorf("page larger than %d bytes", cr.maxPageSize)
+	}
+
+	f.contentType, _, _ = mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if f.contentType == "" {
+		f.contentType = http.DetectContentType(f.body)
+	}
+	return f, nil
+}
+
+type sitemapDoc struct {
+	XMLName xml.Name
+	URLs    []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+func isSitemap(u *url.URL, contentType string, body []byte) bool {
+	if contentType != "application/xml" && contentType != "text/xml" && !strings.HasSuffix(strings.ToLower(u.Path), ".xml") {
+		return false
+	}
+	head := body
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	return bytes.Contains(head, []byte("<urlset")) || bytes.Contains(head, []byte("<sitemapindex"))
+}
+
+// sitemapURLs lists the page URLs of a sitemap, expanding sitemap indexes.
+func (cr *Crawler) sitemapURLs(ctx context.Context, st *crawlState, body []byte, depth int) ([]*url.URL, error) {
+	var sm sitemapDoc
+	if err := xml.Unmarshal(body, &sm); err != nil {
+		return nil, err
+	}
+
+	var out []*url.URL
+	for _, entry := range sm.URLs {
+		if u, err := url.Parse(strings.TrimSpace(entry.Loc)); err == nil {
+			out = append(out, u)
+		}
+	}
+	if depth >= maxSitemapDepth {
+		st.incomplete = st.incomplete || len(sm.Sitemaps) > 0
+		return out, nil
+	}
+	for _, entry := range sm.Sitemaps {
+		u, err := url.Parse(strings.TrimSpace(entry.Loc))
+		if err != nil || !cr.permitted(ctx, st, u) {
+			continue
+		}
+		child, err := cr.fetch(ctx, st, u, "", "")
+		if err != nil {
+			log.Printf("[Crawler] Skipping sitemap %s: %v", u, err)
+			st.incomplete = true
+			continue
+		}
+		urls, err := cr.sitemapURLs(ctx, st, child.body, depth+1)
+		if err != nil {
+			log.Printf("[Crawler] Skipping sitemap %s: %v", u, err)
+			st.incomplete = true
+			continue
+		}
+		out = append(out, urls...)
+	}
+	return out, nil
+}
+
+// robotsMeta reads <meta name="robots"> directives.
+func robotsMeta(doc *html.Node) (noindex, nofollow bool) {
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Meta && strings.EqualFold(attr(n, "name"), "robots") {
+			for _, directive := range strings.Split(strings.ToLower(attr(n, "content")), ",") {
+				switch strings.TrimSpace(directive) {
+				case "noindex":
+					noindex = true
+				case "nofollow":
+					nofollow = true
+				case "none":
+					noindex, nofollow = true, true
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return noindex, nofollow
+}
+
+// extractLinks returns the absolute targets of the page's <a href> links,
+// honouring <base href> and skipping rel="nofollow" links.
+func extractLinks(doc *html.Node, pageURL *url.URL) []*url.URL {
+	base := pageURL
+	var links []*url.URL
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Base:
+				if u, err := pageURL.Parse(attr(n, "href")); err == nil && attr(n, "href") != "" {
+					base = u
+				}
+			case atom.A:
+				href := attr(n, "href")
+				if href != "" && !strings.Contains(strings.ToLower(attr(n, "rel")), "nofollow") {
+					if u, err := base.Parse(href); err == nil {
+						links = append(links, u)
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return links
+}
+
+// normalizeURL drops the fragment and lower-cases scheme and host so the same
+// page is not fetched twice.
+func normalizeURL(u *url.URL) string {
+	n := *u
+	n.Fragment = ""
+	n.RawFragment = ""
+	n.Scheme = strings.ToLower(n.Scheme)
+	n.Host = strings.ToLower(n.Host)
+	if n.Path == "" {
+		n.Path = "/"
+	}
+	return n.String()
+}
+
+// domainAllowed accepts the listed domains and their subdomains.
+func domainAllowed(host string, domains []string) bool {
+	host = strings.ToLower(host)
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimPrefix(d, "."))
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return strings.TrimSpace(a.Val)
+		}
+	}
+	return ""
+}
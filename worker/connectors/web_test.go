@@ -0,0 +1,280 @@
+package connectors
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testSite serves a small site with robots.txt, a sitemap index and pages
+// exercising links, meta robots directives and errors.
+func testSite(t *testing.T) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	pages := map[string]string{
+		"/": `<html><body>
+			<a href="/a">a</a>
+			<a href="b#top">b</a>
+			<a href="/private/secret">secret</a>
+			<a href="/nofollow-link" rel="nofollow">skipped</a>
+			<a href="https://elsewhere.invalid/">external</a>
+			<a href="/noindex">noindex</a>
+			<a href="/gone">gone</a>
+			<a href="/broken">broken</a>
+		</body></html>`,
+		"/a":            `<html><body><a href="/deep">deep</a><a href="/">home</a></body></html>`,
+		"/b":            `<html><head><base href="/sub/"></head><body><a href="c">c</a></body></html>`,
+		"/sub/c":        `<html><body>c</body></html>`,
+		"/deep":         `<html><body>too deep</body></html>`,
+		"/noindex":      `<html><head><meta name="robots" content="noindex"></head><body><a href="/from-noindex">x</a></body></html>`,
+		"/from-noindex": `<html><body>linked from noindex</body></html>`,
+		"/nofollow":     `<html><head><meta name="robots" content="nofollow"></head><body><a href="/a">a</a></body></html>`,
+	}
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprint(w, "User-agent: *\nDisallow: /private/\n")
+		case "/sitemap.xml":
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprintf(w, `<?xml version="1.0"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>%[1]s/pages.xml</loc></sitemap>
+  <sitemap><loc>%[1]s/missing.xml</loc></sitemap>
+</sitemapindex>`, srv.URL)
+		case "/pages.xml":
+			w.Header().Set("Content-Type", "text/xml")
+			fmt.Fprintf(w, `<?xml version="1.0"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc> %[1]s/a </loc></url>
+  <url><loc>%[1]s/private/secret</loc></url>
+  <url><loc>%[1]s/deep</loc></url>
+</urlset>`, srv.URL)
+		case "/gone":
+			http.NotFound(w, r)
+		case "/broken":
+			http.Error(w, "boom", http.StatusInternalServerError)
+		case "/cached":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v2"`)
+			fmt.Fprint(w, `<html><body>fresh</body></html>`)
+		default:
+			body, ok := pages[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, body)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// crawlPaths crawls start and returns the paths of the visited pages.
+func crawlPaths(t *testing.T, start string, cfg WebConfig, cache PageCache) ([]string, *CrawlResult) {
+	t.Helper()
+	cr := NewCrawler("KBCrawler/1.0", 1<<20, 0)
+	var paths []string
+	result, err := cr.Crawl(context.Background(), start, cfg, cache, func(p Page) error {
+		u, err := url.Parse(p.URL)
+		if err != nil {
+			t.Fatalf("visited invalid URL %q", p.URL)
+		}
+		paths = append(paths, u.Path)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Crawl: %v", err)
+	}
+	slices.Sort(paths)
+	return paths, result
+}
+
+func TestCrawlFollowsLinks(t *testing.T) {
+	srv := testSite(t)
+
+	paths, result := crawlPaths(t, srv.URL+"/", WebConfig{MaxDepth: 1}, nil)
+	want := []string{"/", "/a", "/b"}
+	if !slices.Equal(paths, want) {
+		t.Errorf("visited %v, want %v", paths, want)
+	}
+	if result.Truncated {
+		t.Error("Truncated = true, want false: the depth limit is not truncation")
+	}
+	if !slices.Equal(result.Failed, []string{srv.URL + "/broken"}) {
+		t.Errorf("Failed = %v, want only the server error", result.Failed)
+	}
+
+	paths, _ = crawlPaths(t, srv.URL+"/", WebConfig{MaxDepth: 2}, nil)
+	// links of a noindex page are still followed
+	want = []string{"/", "/a", "/b", "/deep", "/from-noindex", "/sub/c"}
+	if !slices.Equal(paths, want) {
+		t.Errorf("visited %v, want %v", paths, want)
+	}
+}
+
+func TestCrawlHonoursMetaRobots(t *testing.T) {
+	srv := testSite(t)
+
+	paths, _ := crawlPaths(t, srv.URL+"/noindex", WebConfig{MaxDepth: 1}, nil)
+	if !slices.Equal(paths, []string{"/from-noindex"}) {
+		t.Errorf("noindex: visited %v, want only the linked page", paths)
+	}
+	paths, _ = crawlPaths(t, srv.URL+"/nofollow", WebConfig{MaxDepth: 1}, nil)
+	if !slices.Equal(paths, []string{"/nofollow"}) {
+		t.Errorf("nofollow: visited %v, want only the start page", paths)
+	}
+}
+
+func TestCrawlMaxPages(t *testing.T) {
+	srv := testSite(t)
+
+	paths, result := crawlPaths(t, srv.URL+"/", WebConfig{MaxDepth: 2, MaxPages: 2}, nil)
+	if len(paths) != 2 {
+		t.Errorf("visited %v, want 2 pages", paths)
+	}
+	if !result.Truncated {
+		t.Error("Truncated = false, want true")
+	}
+}
+
+func TestCrawlSitemapIndex(t *testing.T) {
+	srv := testSite(t)
+
+	paths, result := crawlPaths(t, srv.URL+"/sitemap.xml", WebConfig{MaxDepth: 3}, nil)
+	// sitemap pages are not followed and robots.txt still applies
+	want := []string{"/a", "/deep"}
+	if !slices.Equal(paths, want) {
+		t.Errorf("visited %v, want %v", paths, want)
+	}
+	if !result.Truncated {
+		t.Error("Truncated = false, want true for the missing child sitemap")
+	}
+}
+
+func TestCrawlStartFailure(t *testing.T) {
+	srv := testSite(t)
+	cr := NewCrawler("KBCrawler/1.0", 1<<20, 0)
+	visit := func(Page) error { return nil }
+
+	if _, err := cr.Crawl(context.Background(), srv.URL+"/gone", WebConfig{}, nil, visit); err == nil {
+		t.Error("Crawl of a missing start page succeeded")
+	}
+	if _, err := cr.Crawl(context.Background(), "ftp://example.com/", WebConfig{}, nil, visit); err == nil {
+		t.Error("Crawl of a non-http URL succeeded")
+	}
+}
+
+func TestCrawlStartNotPermitted(t *testing.T) {
+	srv := testSite(t)
+	cr := NewCrawler("KBCrawler/1.0", 1<<20, 0)
+	visit := func(p Page) error {
+		t.Errorf("visited %s", p.URL)
+		return nil
+	}
+
+	if _, err := cr.Crawl(context.Background(), srv.URL+"/private/secret", WebConfig{}, nil, visit); err == nil {
+		t.Error("Crawl of a start page disallowed by robots.txt succeeded")
+	}
+	if _, err := cr.Crawl(context.Background(), srv.URL+"/", WebConfig{AllowedDomains: []string{"example.com"}}, nil, visit); err == nil {
+		t.Error("Crawl of a start page outside the allowed domains succeeded")
+	}
+
+	// a robots.txt answering 403, e.g. a firewall blip, disallows everything
+	forbidden := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `<html><body>page</body></html>`)
+	}))
+	defer forbidden.Close()
+	if result, err := cr.Crawl(context.Background(), forbidden.URL+"/", WebConfig{}, nil, visit); err == nil {
+		t.Errorf("Crawl behind a forbidden robots.txt succeeded: %+v", result)
+	}
+}
+
+type fakeCache map[string]string
+
+func (c fakeCache) Validators(u string) (string, string, bool) {
+	if _, ok := c[u]; !ok {
+		return "", "", false
+	}
+	return `"v1"`, "", true
+}
+
+func (c fakeCache) Body(ctx context.Context, u string) ([]byte, error) {
+	return []byte(c[u]), nil
+}
+
+func TestCrawlConditionalRequests(t *testing.T) {
+	srv := testSite(t)
+	cr := NewCrawler("KBCrawler/1.0", 1<<20, 0)
+
+	var pages []Page
+	visit := func(p Page) error {
+		pages = append(pages, p)
+		return nil
+	}
+	cache := fakeCache{srv.URL + "/cached": "<html><body>stored</body></html>"}
+	if _, err := cr.Crawl(context.Background(), srv.URL+"/cached", WebConfig{}, cache, visit); err != nil {
+		t.Fatalf("Crawl: %v", err)
+	}
+	if len(pages) != 1 || !pages[0].NotModified || pages[0].ETag != `"v1"` || !strings.Contains(string(pages[0].Body), "stored") {
+		t.Fatalf("with a current copy got %+v, want the stored copy", pages)
+	}
+
+	pages = nil
+	if _, err := cr.Crawl(context.Background(), srv.URL+"/cached", WebConfig{}, nil, visit); err != nil {
+		t.Fatalf("Crawl: %v", err)
+	}
+	if len(pages) != 1 || pages[0].NotModified || pages[0].ETag != `"v2"` || !strings.Contains(string(pages[0].Body), "fresh") {
+		t.Fatalf("without a stored copy got %+v, want the fetched page", pages)
+	}
+}
+
+func TestIsSitemap(t *testing.T) {
+	u, _ := url.Parse("https://example.com/sitemap.xml")
+	page, _ := url.Parse("https://example.com/page")
+	tests := []struct {
+		u           *url.URL
+		contentType string
+		body        string
+		want        bool
+	}{
+		{u, "", `<urlset>`, true},
+		{page, "application/xml", `<sitemapindex>`, true},
+		{page, "text/xml", `<rss>`, false},
+		{page, "text/html", `<urlset>`, false},
+	}
+	for _, tt := range tests {
+		if got := isSitemap(tt.u, tt.contentType, []byte(tt.body)); got != tt.want {
+			t.Errorf("isSitemap(%s, %q, %q) = %v, want %v", tt.u, tt.contentType, tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestDomainAllowed(t *testing.T) {
+	domains := []string{"example.com", ".docs.org"}
+	for host, want := range map[string]bool{
+		"example.com":      true,
+		"WWW.Example.com":  true,
+		"badexample.com":   false,
+		"docs.org":         true,
+		"api.docs.org":     true,
+		"example.com.evil": false,
+	} {
+		if got := domainAllowed(host, domains); got != want {
+			t.Errorf("domainAllowed(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Package evalgen writes evaluation questions from the chunks of a
+// knowledge base, so golden sets do not have to be written by hand.
+package evalgen
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"worker/models"
+	"worker/services"
+)
+
+// ErrNoChunks is returned when the knowledge base has no text to write
+// questions from. Retrying does not help.
+var ErrNoChunks = errors.New("no indexed text to generate questions from")
+
+// ErrNoQuestions is returned when the LLM found nothing to ask about in any
+// sampled chunk.
+var ErrNoQuestions = errors.New("no question could be written from the sampled chunks")
+
+// minChunkLength skips headings, tables of contents and other fragments too
+// short to ask about.
+const minChunkLength = 200
+
+// oversample is how many chunks are sampled per requested question, as the
+// LLM declines chunks without a fact worth asking about.
+const oversample = 2
+
+const questionPrompt = `You write test questions for a question answering system over a document library.
+Read the passage below and write one question a user could ask that the passage fully answers, and the answer according to the passage.
+Make the question self-contained: do not refer to "the passage" or "the document". Keep the answer short.
+Write in the language of the passage. Reply with a JSON object and nothing else:
+{"question": "...", "answer": "..."}
+If the passage has no fact worth asking about, reply {"question": ""}.`
+
+// Generator writes question/answer pairs with an LLM.
+type Generator struct {
+	llm *services.LLMService
+}
+
+func New(llm *services.LLMService) *Generator {
+	return &Generator{llm: llm}
+}
+
+// Generate samples chunks of the knowledge base and writes up to count
+// cases. Each case expects the document of its chunk to be retrieved and
+// records the chunk itself, which runs score as chunk recall. Chunk IDs
+// derive from the document version and the chunking, so chunk recall is only
+// measured while the document still serves that chunk. A chunk the LLM fails
+// on is skipped; generation only fails when no case could be written.
+func (g *Generator) Generate(ctx context.Context, setID, kbID uint, count int, documentIDs []uint) ([]models.EvalCase, error) {
+	chunks, err := models.SampleTextChunks(kbID, documentIDs, minChunkLength, count*oversample)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample chunks: %w", err)
+	}
+	if len(chunks) == 0 {
+		return nil, ErrNoChunks
+	}
+
+	var cases []models.EvalCase
+	var lastErr error
+	seen := map[string]bool{}
+	for _, ch := range chunks {
+		if len(cases) >= count {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		question, answer, err := g.write(ctx, ch.Content)
+		if err != nil {
+			log.Printf("[EvalGen] Set %d: chunk %s skipped: %v", setID, ch.ID, err)
+			lastErr = err
+			continue
+		}
+		key := strings.ToLower(question)
+		if question == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		sources, err := json.Marshal([]string{strconv.FormatUint(uint64(ch.DocumentID), 10)})
+		if err != nil {
+			return nil, err
+		}
+		cases = append(cases, models.EvalCase{
+			SetID:           setID,
+			Question:        question,
+			ExpectedAnswer:  answer,
+			ExpectedSources: models.JSON(sources),
+			SourceChunkID:   ch.ID,
+		})
+	}
+	if len(cases) == 0 {
+		if lastErr != nil {
+			return nil, lastErr
+		}
+		return nil, ErrNoQuestions
+	}
+	return cases, nil
+}
+
+// write asks the LLM for a question about the passage. An empty question
+// means the passage was not worth asking about.
+func (g *Generator) write(ctx context.Context, passage string) (question, answer string, err error) {
+	temperature := 0.3
+	resp, err := g.llm.Complete(ctx, services.LLMRequest{
+		Messages: []services.LLMMessage{
+			{Role: "system", Content: questionPrompt},
+			{Role: "user", Content: passage},
+		},
+		Temperature: &temperature,
+		MaxTokens:   400,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return parseQuestion(resp.Content)
+}
+
+// parseQuestion reads the JSON object of the reply, ignoring any text or
+// code fence around it.
+func parseQuestion(reply string) (question, answer string, err error) {
+	start := strings.Index(reply, "{")
+	end := strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return "", "", fmt.Errorf("reply is not a JSON object")
+	}
+	var q struct {
+		Question string `json:"question"`
+		Answer   string `json:"answer"`
+	}
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &q); err != nil {
+		return "", "", fmt.Errorf("invalid question: %w", err)
+	}
+	question, answer = strings.TrimSpace(q.Question), strings.TrimSpace(q.Answer)
+	if question != "" && answer == "" {
+		return "", "", fmt.Errorf("reply has no answer")
+	}
+	return question, answer, nil
+}
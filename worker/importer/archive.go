@@ -0,0 +1,419 @@
+package importer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+
+	"worker/models"
+	"worker/pipeline"
+	"worker/services"
+	"worker/tasks"
+)
+
+// ErrInvalidArchive is returned for archives that cannot be read or exceed the
+// configured limits. Retrying such an import will never succeed.
+var ErrInvalidArchive = errors.New("invalid archive")
+
+// Entry statuses reported for every file found in an archive.
+const (
+	EntryImported = "imported"
+	EntrySkipped  = "skipped"
+)
+
+// maxNameLength matches the size of the documents.name column.
+const maxNameLength = 255
+
+type Limits struct {
+	MaxEntries   int
+	MaxEntrySize int64
+	MaxTotalSize int64
+	// MaxRatio caps the uncompressed/compressed size ratio of a zip entry.
+	MaxRatio int64
+}
+
+// EntryReport describes what happened to one archive entry.
+type EntryReport struct {
+	Path       string `json:"path"`
+	Status     string `json:"status"`
+	Reason     string `json:"reason,omitempty"`
+	DocumentID uint   `json:"document_id,omitempty"`
+}
+
+// Importer expands an uploaded archive into one document per supported file
+// and queues each of them for ingestion.
+type Importer struct {
+	minio  *services.MinioService
+	queue  *asynq.Client
+	limits Limits
+}
+
+func New(minio *services.MinioService, queue *asynq.Client, limits Limits) *Importer {
+	return &Importer{minio: minio, queue: queue, limits: limits}
+}
+
+// entry is a regular file inside an archive. compressed is 0 when the format
+// does not expose a per-entry compressed size.
+type entry struct {
+	name       string
+	size       int64
+	compressed int64
+	open       func() (io.ReadCloser, error)
+}
+
+// Run imports the archive described by p. Entries already imported by an
+// earlier attempt are recognised by their content hash and path, so a retried
+// task does not create duplicate documents.
+func (im *Importer) Run(ctx context.Context, p tasks.ImportArchivePayload) ([]EntryReport, error) {
+	archive, err := im.download(ctx, p.Bucket, p.ObjectName)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	var walk walkFunc
+	name := strings.ToLower(p.FileName)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		walk = walkZip
+	case strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz"):
+		walk = walkTarGz
+	default:
+		return nil, fmt.Errorf("%w: unsupported archive type %q", ErrInvalidArchive, p.FileName)
+	}
+
+	// an archive over the limits must not leave a partial import behind
+	if err := im.checkDeclared(archive, walk); err != nil {
+		return nil, err
+	}
+
+	// declared sizes may lie, so the bytes actually read are checked again
+	// before each entry is committed
+	var reports []EntryReport
+	var total int64
+	err = walk(archive, func(e entry) error {
+		report, n, err := im.importEntry(ctx, p, e, im.limits.MaxTotalSize-total)
+		total += n
+		if err != nil {
+			return err
+		}
+		reports = append(reports, report)
+		return nil
+	})
+	return reports, err
+}
+
+// checkDeclared enforces the entry count and the total size limits from the
+// sizes the archive declares, before anything is imported. Entries that will
+// be skipped do not count towards the total size.
+func (im *Importer) checkDeclared(archive *os.File, walk walkFunc) error {
+	var total int64
+	count := 0
+	return walk(archive, func(e entry) error {
+		count++
+		if count > im.limits.MaxEntries {
+			return fmt.Errorf("%w: more than %d entries", ErrInvalidArchive, im.limits.MaxEntries)
+		}
+		if _, reason := im.screen(e); reason != "" {
+			return nil
+		}
+		total += e.size
+		if total > im.limits.MaxTotalSize {
+			return fmt.Errorf("%w: expands to more than %d bytes", ErrInvalidArchive, im.limits.MaxTotalSize)
+		}
+		return nil
+	})
+}
+
+func (im *Importer) download(ctx context.Context, bucket, objectName string) (*os.File, error) {
+	reader, err := im.minio.DownloadObject(ctx, bucket, objectName)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	f, err := os.CreateTemp("", "archive-*")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(f, reader); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, fmt.Errorf("failed to download archive: %w", err)
+	}
+	return f, nil
+}
+
+// screen returns the cleaned path of an entry and, when the entry is to be
+// skipped without reading it, the reason why.
+func (im *Importer) screen(e entry) (string, string) {
+	name, ok := cleanPath(e.name)
+	if !ok {
+		return e.name, "unsafe path"
+	}
+	ext := strings.ToLower(path.Ext(name))
+	switch {
+	case isHidden(name):
+		return name, "hidden or system file"
+	case !pipeline.SupportedExtension(ext):
+		return name, "unsupported file type"
+	case len(name) > maxNameLength:
+		return name, "path too long"
+	case e.size > im.limits.MaxEntrySize:
+		return name, "file too large"
+	case e.compressed > 0 && e.size/e.compressed > im.limits.MaxRatio:
+		return name, "suspicious compression ratio"
+	}
+	return name, ""
+}
+
+// importEntry stores one archive entry as a new document. remaining is what
+// is left of the total size limit; an entry that reads more than that fails
+// the import before it is committed. It returns the number of bytes read.
+func (im *Importer) importEntry(ctx context.Context, p tasks.ImportArchivePayload, e entry, remaining int64) (EntryReport, int64, error) {
+	name, reason := im.screen(e)
+	report := EntryReport{Path: name, Status: EntrySkipped, Reason: reason}
+	if reason != "" {
+		return report, 0, nil
+	}
+	ext := strings.ToLower(path.Ext(name))
+
+	tmp, hash, n, err := spool(e, min(im.limits.MaxEntrySize, remaining))
+	if err != nil {
+		return report, n, err
+	}
+	if n > remaining {
+		return report, n, fmt.Errorf("%w: expands to more than %d bytes", ErrInvalidArchive, im.limits.MaxTotalSize)
+	}
+	if tmp == nil {
+		report.Reason = "file too large"
+		return report, n, nil
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	existing, err := models.FindDocumentByContentHash(p.KnowledgeBaseID, hash)
+	if err != nil {
+		return report, n, fmt.Errorf("failed to check for duplicates: %w", err)
+	}
+	if existing != nil {
+		if existing.Name == name {
+			report.Status = EntryImported
+		} else {
+			report.Reason = fmt.Sprintf("duplicate of document %d", existing.ID)
+		}
+		report.DocumentID = existing.ID
+		return report, n, nil
+	}
+
+	objectName := fmt.Sprintf("kb_%d/%s/%s", p.KnowledgeBaseID, uuid.New().String(), path.Base(name))
+	if err := im.minio.UploadObject(ctx, p.Bucket, objectName, tmp, n, ""); err != nil {
+		return report, n, err
+	}
+
+	fileType := "doc"
+	if ext == ".csv" {
+		fileType = "csv"
+	}
+	description := "Imported from " + p.FileName
+	if len(description) > 255 {
+		description = description[:255]
+	}
+	doc := &models.Document{
+		KnowledgeBaseID: p.KnowledgeBaseID,
+		UserID:          p.UserID,
+		Name:            name,
+		FileType:        fileType,
+		Description:     description,
+		ObjectName:      objectName,
+		ContentHash:     hash,
+		Size:            n,
+		Version:         1,
+		EmbeddingStatus: "processing",
+	}
+	version := &models.DocumentVersion{
+		Version:         1,
+		FileName:        name,
+		FileType:        fileType,
+		Description:     description,
+		ObjectName:      objectName,
+		ContentHash:     hash,
+		Size:            n,
+		UploadedBy:      p.UserID,
+		EmbeddingStatus: "processing",
+	}
+	if err := models.CreateDocumentWithVersion(doc, version); err != nil {
+		return report, n, fmt.Errorf("failed to create document: %w", err)
+	}
+
+	if err := tasks.EnqueueProcessDocument(ctx, im.queue, tasks.ProcessDocumentPayload{
+		KnowledgeBaseID: p.KnowledgeBaseID,
+		DocumentID:      doc.ID,
+		Version:         1,
+		Description:     description,
+		Bucket:          p.Bucket,
+		ObjectName:      objectName,
+		FileType:        fileType,
+	}); err != nil {
+		// nothing would process the document, so it must not stay processing
+		log.Printf("[Importer] Failed to enqueue document %d: %v", doc.ID, err)
+		if err := models.UpdateEmbeddingStatus(doc.ID, 1, "failed"); err != nil {
+			log.Printf("[Importer] Failed to mark document %d failed: %v", doc.ID, err)
+		}
+		report.Reason = "failed to queue for processing"
+	}
+
+	report.Status = EntryImported
+	report.DocumentID = doc.ID
+	return report, n, nil
+}
+
+// spool copies an entry to a temporary file while hashing it. The declared
+// size of an entry cannot be trusted, so at most limit bytes are kept; a nil
+// file means the entry is larger than limit.
+func spool(e entry, limit int64) (*os.File, string, int64, error) {
+	rc, err := e.open()
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer rc.Close()
+
+	tmp, err := os.CreateTemp("", "entry-*")
+	if err != nil {
+		return nil, "", 0, err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), io.LimitReader(rc, limit+1))
+	if err == nil && n > limit {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, "", n, nil
+	}
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, "", n, fmt.Errorf("%w: failed to read %s: %v", ErrInvalidArchive, e.name, err)
+	}
+	return tmp, hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// walkFunc calls visit for every regular file of an archive, in order.
+type walkFunc func(f *os.File, visit func(entry) error) error
+
+func walkZip(f *os.File, visit func(entry) error) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(f, info.Size())
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	for _, zf := range zr.File {
+		if !zf.Mode().IsRegular() {
+			continue
+		}
+		zf := zf
+		if err := visit(entry{
+			name:       zf.Name,
+			size:       int64(zf.UncompressedSize64),
+			compressed: int64(zf.CompressedSize64),
+			open:       zf.Open,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkTarGz streams a gzip-compressed tarball. Entries must be read in order,
+// so open hands out the shared tar reader.
+func walkTarGz(f *os.File, visit func(entry) error) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := visit(entry{
+			name: hdr.Name,
+			size: hdr.Size,
+			open: func() (io.ReadCloser, error) { return io.NopCloser(tr), nil },
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+// cleanPath normalises an entry name and rejects absolute paths and names
+// that would escape the archive root.
+func cleanPath(name string) (string, bool) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || (len(name) > 1 && name[1] == ':') {
+		return "", false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", false
+		}
+	}
+	cleaned := path.Clean(name)
+	if cleaned == "." || cleaned == "" {
+		return "", false
+	}
+	return cleaned, true
+}
+
+// isHidden matches dotfiles and the metadata folders added by macOS archivers.
+func isHidden(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalReport encodes entry reports for the archive import's report column.
+func MarshalReport(reports []EntryReport) (models.JSON, error) {
+	if reports == nil {
+		reports = []EntryReport{}
+	}
+	b, err := json.Marshal(reports)
+	if err != nil {
+		return nil, err
+	}
+	return models.JSON(b), nil
+}
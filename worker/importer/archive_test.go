@@ -0,0 +1,270 @@
+package importer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var testLimits = Limits{MaxEntries: 10, MaxEntrySize: 100, MaxTotalSize: 250, MaxRatio: 10}
+
+// file is an archive member; a name ending in "/" is a directory.
+type file struct {
+	name string
+	body string
+}
+
+func writeZip(t *testing.T, files []file) *os.File {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, f.body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return tempFile(t, buf.Bytes())
+}
+
+func writeTarGz(t *testing.T, files []file) *os.File {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: 0o644, Size: int64(len(f.body)), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(f.name, "/") {
+			hdr.Typeflag, hdr.Size = tar.TypeDir, 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, f.body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: "link.txt", Linkname: "/etc/passwd", Typeflag: tar.TypeSymlink}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return tempFile(t, buf.Bytes())
+}
+
+func tempFile(t *testing.T, data []byte) *os.File {
+	t.Helper()
+	f, err := os.Create(filepath.Join(t.TempDir(), "archive"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestWalk(t *testing.T) {
+	files := []file{
+		{"docs/", ""},
+		{"docs/a.txt", "alpha"},
+		{"b.md", "bravo!"},
+	}
+	for name, walk := range map[string]struct {
+		fn walkFunc
+		f  *os.File
+	}{
+		"zip":    {walkZip, writeZip(t, files)},
+		"tar.gz": {walkTarGz, writeTarGz(t, files)},
+	} {
+		var got []string
+		err := walk.fn(walk.f, func(e entry) error {
+			rc, err := e.open()
+			if err != nil {
+				return err
+			}
+			defer rc.Close()
+			body, err := io.ReadAll(rc)
+			if err != nil {
+				return err
+			}
+			if int64(len(body)) != e.size {
+				t.Errorf("%s: %s declares %d bytes, read %d", name, e.name, e.size, len(body))
+			}
+			got = append(got, e.name+"="+string(body))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		// directories and links are not visited
+		if want := []string{"docs/a.txt=alpha", "b.md=bravo!"}; !slices.Equal(got, want) {
+			t.Errorf("%s: visited %q, want %q", name, got, want)
+		}
+
+		stop := errors.New("stop")
+		if err := walk.fn(walk.f, func(entry) error { return stop }); !errors.Is(err, stop) {
+			t.Errorf("%s: error = %v, want the visit error", name, err)
+		}
+	}
+
+	garbage := tempFile(t, []byte("not an archive"))
+	if err := walkZip(garbage, func(entry) error { return nil }); !errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("walkZip(garbage) = %v, want ErrInvalidArchive", err)
+	}
+	if err := walkTarGz(garbage, func(entry) error { return nil }); !errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("walkTarGz(garbage) = %v, want ErrInvalidArchive", err)
+	}
+}
+
+func TestCleanPath(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{"a.txt", "a.txt", true},
+		{"docs/./sub//b.md", "docs/sub/b.md", true},
+		{`docs\win\c.txt`, "docs/win/c.txt", true},
+		{"docs/", "docs", true},
+		{"/etc/passwd", "", false},
+		{`C:\boot.ini`, "", false},
+		{"c:/boot.ini", "", false},
+		{"../escape.txt", "", false},
+		{"docs/../../escape.txt", "", false},
+		{`docs\..\..\escape.txt`, "", false},
+		{"docs/..", "", false},
+		{".", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := cleanPath(tt.name)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("cleanPath(%q) = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestScreen(t *testing.T) {
+	im := &Importer{limits: testLimits}
+	tests := []struct {
+		e          entry
+		name       string
+		wantReason string
+	}{
+		{entry{name: "docs/a.txt", size: 50, compressed: 10}, "docs/a.txt", ""},
+		{entry{name: "notes.md", size: 100}, "notes.md", ""},
+		{entry{name: "../a.txt", size: 1}, "../a.txt", "unsafe path"},
+		{entry{name: "__MACOSX/._a.txt", size: 1}, "__MACOSX/._a.txt", "hidden or system file"},
+		{entry{name: "docs/.env", size: 1}, "docs/.env", "hidden or system file"},
+		{entry{name: "movie.mp4", size: 1}, "movie.mp4", "unsupported file type"},
+		{entry{name: strings.Repeat("a", 300) + ".txt", size: 1}, strings.Repeat("a", 300) + ".txt", "path too long"},
+		{entry{name: "big.txt", size: 101}, "big.txt", "file too large"},
+		{entry{name: "bomb.txt", size: 100, compressed: 9}, "bomb.txt", "suspicious compression ratio"},
+		{entry{name: "dense.txt", size: 100, compressed: 10}, "dense.txt", ""},
+		// a tar entry has no compressed size, so only the size limit applies
+		{entry{name: "tar.txt", size: 100}, "tar.txt", ""},
+	}
+	for _, tt := range tests {
+		name, reason := im.screen(tt.e)
+		if name != tt.name || reason != tt.wantReason {
+			t.Errorf("screen(%q) = %q, %q, want %q, %q", tt.e.name, name, reason, tt.name, tt.wantReason)
+		}
+	}
+}
+
+func openString(s string) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader(s)), nil }
+}
+
+func TestSpool(t *testing.T) {
+	tests := []struct {
+		body  string
+		limit int64
+		n     int64
+		kept  bool
+	}{
+		{"hello", 10, 5, true},
+		{"hello", 5, 5, true},
+		// the entry declared a small size but keeps going: reading stops
+		// one byte past the limit
+		{strings.Repeat("x", 1000), 5, 6, false},
+		{"", 0, 0, true},
+	}
+	for _, tt := range tests {
+		tmp, hash, n, err := spool(entry{name: "a.txt", size: 1, open: openString(tt.body)}, tt.limit)
+		if err != nil {
+			t.Fatalf("spool(%d bytes, limit %d): %v", len(tt.body), tt.limit, err)
+		}
+		if n != tt.n || (tmp != nil) != tt.kept {
+			t.Errorf("spool(%d bytes, limit %d) read %d bytes, kept %v, want %d, %v", len(tt.body), tt.limit, n, tmp != nil, tt.n, tt.kept)
+		}
+		if tmp == nil {
+			continue
+		}
+		body, err := io.ReadAll(tmp)
+		tmp.Close()
+		os.Remove(tmp.Name())
+		if err != nil || string(body) != tt.body {
+			t.Errorf("spooled %q, %v, want %q", body, err, tt.body)
+		}
+		if len(hash) != 64 {
+			t.Errorf("hash = %q, want a SHA-256", hash)
+		}
+	}
+
+	failing := entry{name: "a.txt", open: func() (io.ReadCloser, error) { return nil, errors.New("bad header") }}
+	if _, _, _, err := spool(failing, 10); !errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("spool of an unreadable entry = %v, want ErrInvalidArchive", err)
+	}
+}
+
+func TestCheckDeclared(t *testing.T) {
+	im := &Importer{limits: testLimits}
+	tests := []struct {
+		name  string
+		files []file
+		ok    bool
+	}{
+		{"within limits", []file{{"a.txt", strings.Repeat("a", 100)}, {"b.txt", strings.Repeat("b", 100)}}, true},
+		{"skipped entries do not count", []file{{"a.txt", strings.Repeat("a", 100)}, {"b.mp4", strings.Repeat("b", 200)}, {".c.txt", strings.Repeat("c", 200)}}, true},
+		{"total too large", []file{{"a.txt", strings.Repeat("a", 100)}, {"b.txt", strings.Repeat("b", 100)}, {"c.txt", strings.Repeat("c", 100)}}, false},
+		{"too many entries", slices.Repeat([]file{{"a.mp4", ""}}, 11), false},
+	}
+	for _, tt := range tests {
+		for format, f := range map[string]struct {
+			walk walkFunc
+			file *os.File
+		}{
+			"zip":    {walkZip, writeZip(t, tt.files)},
+			"tar.gz": {walkTarGz, writeTarGz(t, tt.files)},
+		} {
+			err := im.checkDeclared(f.file, f.walk)
+			if tt.ok && err != nil {
+				t.Errorf("%s, %s: %v", tt.name, format, err)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalidArchive) {
+				t.Errorf("%s, %s: error = %v, want ErrInvalidArchive", tt.name, format, err)
+			}
+		}
+	}
+}
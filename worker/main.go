@@ -3,27 +3,24 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"time"
 
 	"worker/config"
+	"worker/connectors"
+	"worker/evalgen"
+	"worker/importer"
+	"worker/models"
+	"worker/pipeline"
 	"worker/services"
+	"worker/tasks"
 
 	"github.com/hibiken/asynq"
+	"gorm.io/gorm"
 )
 
-const TaskTypeProcessDocument = "document:process"
-
-type ProcessDocumentPayload struct {
-	KnowledgeBaseID uint   `json:"knowledge_base_id"`
-	DocumentID      uint   `json:"document_id"`
-	Description     string `json:"description"`
-	Bucket          string `json:"bucket"`
-	ObjectName      string `json:"object_name"`
-	FileType        string `json:"file_type"`
-}
-
 func main() {
 	// Load configuration
 	cfg := config.LoadConfig()
@@ -39,6 +36,91 @@ func main() {
 		log.Fatalf("Failed to initialize MinIO service: %v", err)
 	}
 
+	if err := services.InitDB(); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer services.CloseDB()
+
+	if err := models.AutoMigrate(); err != nil {
+		log.Fatalf("Failed to migrate worker tables: %v", err)
+	}
+
+	var ocr services.OCR
+	switch cfg.OCRProvider {
+	case "":
+	case "tesseract":
+		ocr = services.NewTesseractOCR(cfg.TesseractPath, cfg.OCRLanguage)
+	case "http":
+		ocr = services.NewHTTPOCR(cfg.OCRServiceURL, cfg.OCRAPIKey)
+	default:
+		log.Fatalf("Unknown OCR_PROVIDER %q", cfg.OCRProvider)
+	}
+
+	var llm *services.LLMService
+	if cfg.SummaryEnabled {
+		llm = services.NewLLMService(cfg.LLMBaseURL, cfg.LLMAPIKey, cfg.LLMModel)
+	}
+
+	ingest := pipeline.New(
+		minioSvc,
+		services.NewEmbeddingService(cfg.EmbeddingBaseURL, cfg.EmbeddingAPIKey, cfg.EmbeddingModel),
+		services.NewQdrantService(cfg.QdrantURL, cfg.QdrantAPIKey, cfg.QdrantCollection),
+		pipeline.Options{
+			ChunkSize:            cfg.ChunkSize,
+			ChunkOverlap:         cfg.ChunkOverlap,
+			EmbeddingBatchSize:   cfg.EmbeddingBatchSize,
+			EmbeddingDimension:   cfg.EmbeddingDimension,
+			OCR:                  ocr,
+			PDFToPPM:             cfg.PDFToPPMPath,
+			OCRDPI:               cfg.OCRDPI,
+			SearchConfigs:        pipeline.ParseSearchConfigs(cfg.SearchConfigs),
+			DefaultSearchConfig:  cfg.DefaultSearchConfig,
+			LLM:                  llm,
+			SummaryMaxInputChars: cfg.SummaryMaxInputChars,
+		},
+	)
+	if err := ingest.EnsureCollection(context.Background()); err != nil {
+		log.Fatalf("Failed to prepare Qdrant collection: %v", err)
+	}
+
+	questions := evalgen.New(services.NewLLMService(cfg.LLMBaseURL, cfg.LLMAPIKey, cfg.LLMModel))
+
+	queue := asynq.NewClient(asynq.RedisClientOpt{Addr: cfg.RedisAddr})
+	defer queue.Close()
+
+	archives := importer.New(minioSvc, queue, importer.Limits{
+		MaxEntries:   cfg.ArchiveMaxEntries,
+		MaxEntrySize: int64(cfg.ArchiveMaxEntrySizeMB) << 20,
+		MaxTotalSize: int64(cfg.ArchiveMaxTotalSizeMB) << 20,
+		MaxRatio:     int64(cfg.ArchiveMaxRatio),
+	})
+
+	syncer := connectors.NewSyncer(minioSvc, queue,
+		connectors.NewCrawler(
+			cfg.CrawlerUserAgent,
+			int64(cfg.CrawlerMaxPageSizeMB)<<20,
+			time.Duration(cfg.CrawlerDelayMs)*time.Millisecond,
+		),
+		connectors.NewGitClient(cfg.GitCacheDir, int64(cfg.GitMaxFileSizeKB)<<10, cfg.GitAllowLocal),
+		ingest,
+		cfg.MinioBucket,
+	)
+
+	if cfg.SchedulerEnabled {
+		scheduler, err := asynq.NewPeriodicTaskManager(asynq.PeriodicTaskManagerOpts{
+			RedisConnOpt:               asynq.RedisClientOpt{Addr: cfg.RedisAddr},
+			PeriodicTaskConfigProvider: connectors.SourceSchedules{},
+			SyncInterval:               time.Minute,
+		})
+		if err != nil {
+			log.Fatalf("Failed to create source sync scheduler: %v", err)
+		}
+		if err := scheduler.Start(); err != nil {
+			log.Fatalf("Failed to start source sync scheduler: %v", err)
+		}
+		defer scheduler.Shutdown()
+	}
+
 	log.Printf("Starting worker, connecting to Redis at %s", cfg.RedisAddr)
 
 	srv := asynq.NewServer(
@@ -52,8 +134,23 @@ func main() {
 	)
 
 	mux := asynq.NewServeMux()
-	mux.HandleFunc(TaskTypeProcessDocument, func(ctx context.Context, t *asynq.Task) error {
-		return handleProcessDocument(ctx, t, minioSvc)
+	mux.HandleFunc(tasks.TypeProcessDocument, func(ctx context.Context, t *asynq.Task) error {
+		return handleProcessDocument(ctx, t, ingest)
+	})
+	mux.HandleFunc(tasks.TypeActivateDocument, func(ctx context.Context, t *asynq.Task) error {
+		return handleActivateDocument(ctx, t, ingest)
+	})
+	mux.HandleFunc(tasks.TypeUpdateMetadata, func(ctx context.Context, t *asynq.Task) error {
+		return handleUpdateMetadata(ctx, t, ingest)
+	})
+	mux.HandleFunc(tasks.TypeImportArchive, func(ctx context.Context, t *asynq.Task) error {
+		return handleImportArchive(ctx, t, archives)
+	})
+	mux.HandleFunc(tasks.TypeSyncSource, func(ctx context.Context, t *asynq.Task) error {
+		return handleSyncSource(ctx, t, syncer)
+	})
+	mux.HandleFunc(tasks.TypeGenerateEvalSet, func(ctx context.Context, t *asynq.Task) error {
+		return handleGenerateEvalSet(ctx, t, questions)
 	})
 
 	if err := srv.Run(mux); err != nil {
@@ -61,17 +158,21 @@ func main() {
 	}
 }
 
-func handleProcessDocument(ctx context.Context, t *asynq.Task, minioSvc *services.MinioService) error {
-	var payload ProcessDocumentPayload
+func handleProcessDocument(ctx context.Context, t *asynq.Task, ingest *pipeline.Pipeline) error {
+	var payload tasks.ProcessDocumentPayload
 	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
 		log.Printf("Failed to unmarshal payload: %v", err)
 		return fmt.Errorf("failed to unmarshal payload: %w", err)
 	}
+	if payload.Version == 0 {
+		payload.Version = 1
+	}
 
 	log.Println("========================================")
 	log.Println("[Worker] Document Processing Started")
 	log.Println("========================================")
 	log.Printf("Document ID:    %d", payload.DocumentID)
+	log.Printf("Version:        %d", payload.Version)
 	log.Printf("Knowledge Base ID: %d", payload.KnowledgeBaseID)
 	log.Printf("Bucket:         %s", payload.Bucket)
 	log.Printf("Object Name:    %s", payload.ObjectName)
@@ -80,34 +181,36 @@ func handleProcessDocument(ctx context.Context, t *asynq.Task, minioSvc *service
 	log.Printf("Started At:     %s", time.Now().Format(time.RFC3339))
 	log.Println("========================================")
 
-	// Get file metadata from MinIO
-	objectInfo, err := minioSvc.GetObjectInfo(ctx, payload.Bucket, payload.ObjectName)
-	if err != nil {
-		log.Printf("Failed to get object info: %v", err)
-		return fmt.Errorf("failed to get object info: %w", err)
-	}
-
-	log.Println("[Worker] File Metadata:")
-	log.Printf("  - Size:         %d bytes", objectInfo.Size)
-
-	// Process based on file type
-	var processingErr error
-	switch payload.FileType {
-	case "csv":
-		processingErr = processCSVFile(ctx, minioSvc, payload)
-	case "doc":
-		processingErr = processDocFile(ctx, minioSvc, payload)
-	case "graph":
-		processingErr = processGraphFile(ctx, minioSvc, payload)
-	default:
-		processingErr = fmt.Errorf("unsupported file type: %s", payload.FileType)
+	if err := models.UpdateEmbeddingStatus(payload.DocumentID, payload.Version, "processing"); err != nil {
+		log.Printf("Failed to update document status: %v", err)
 	}
 
+	processingErr := ingest.Run(ctx, pipeline.Input{
+		DocumentID:      payload.DocumentID,
+		Version:         payload.Version,
+		KnowledgeBaseID: payload.KnowledgeBaseID,
+		Bucket:          payload.Bucket,
+		ObjectName:      payload.ObjectName,
+		FileType:        payload.FileType,
+	})
 	if processingErr != nil {
 		log.Printf("Failed to process document: %v", processingErr)
+		permanent := errors.Is(processingErr, pipeline.ErrUnsupportedFormat) || errors.Is(processingErr, pipeline.ErrContentMismatch)
+		if permanent || isLastAttempt(ctx) {
+			if err := models.UpdateEmbeddingStatus(payload.DocumentID, payload.Version, "failed"); err != nil {
+				log.Printf("Failed to update document status: %v", err)
+			}
+		}
+		if permanent {
+			return fmt.Errorf("%v: %w", processingErr, asynq.SkipRetry)
+		}
 		return processingErr
 	}
 
+	if err := models.UpdateEmbeddingStatus(payload.DocumentID, payload.Version, "done"); err != nil {
+		return fmt.Errorf("failed to update document status: %w", err)
+	}
+
 	// After processing is complete
 	log.Println("========================================")
 	log.Printf("[Worker] Document ID %d processed successfully!", payload.DocumentID)
@@ -117,38 +220,202 @@ func handleProcessDocument(ctx context.Context, t *asynq.Task, minioSvc *service
 	return nil
 }
 
-// processCSVFile processes CSV files (simulates 5s processing)
-func processCSVFile(ctx context.Context, minioSvc *services.MinioService, payload ProcessDocumentPayload) error {
-	log.Printf("[Worker] Processing CSV file: %s", payload.ObjectName)
-	log.Println("[Worker] Simulating CSV processing... (5 seconds)")
+func handleActivateDocument(ctx context.Context, t *asynq.Task, ingest *pipeline.Pipeline) error {
+	var payload tasks.ActivateDocumentPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+
+	doc, err := models.GetDocumentByID(payload.DocumentID)
+	if err != nil {
+		return fmt.Errorf("failed to load document: %w", err)
+	}
+	if doc.Version != payload.Version {
+		// superseded by a later activation
+		log.Printf("[Worker] Skipping activation of document %d v%d, document serves v%d", payload.DocumentID, payload.Version, doc.Version)
+		return nil
+	}
+
+	if err := ingest.Activate(ctx, payload.DocumentID, payload.Version); err != nil {
+		return err
+	}
+	log.Printf("[Worker] Document %d now serves version %d", payload.DocumentID, payload.Version)
+	return nil
+}
+
+func handleUpdateMetadata(ctx context.Context, t *asynq.Task, ingest *pipeline.Pipeline) error {
+	var payload tasks.UpdateMetadataPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+	if err := ingest.UpdateMetadata(ctx, payload.DocumentID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// deleted since, its points are gone too
+			return nil
+		}
+		return err
+	}
+	log.Printf("[Worker] Updated metadata of document %d", payload.DocumentID)
+	return nil
+}
 
-	// Simulate CSV processing
-	time.Sleep(5 * time.Second)
+func handleImportArchive(ctx context.Context, t *asynq.Task, archives *importer.Importer) error {
+	var payload tasks.ImportArchivePayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
 
-	log.Printf("[Worker] CSV file processing complete: %s", payload.ObjectName)
+	log.Printf("[Worker] Importing archive %s into knowledge base %d (import %d)", payload.FileName, payload.KnowledgeBaseID, payload.ImportID)
+	if err := models.UpdateArchiveImport(payload.ImportID, map[string]interface{}{"status": "processing"}); err != nil {
+		log.Printf("Failed to update archive import status: %v", err)
+	}
+
+	reports, importErr := archives.Run(ctx, payload)
+
+	imported, skipped := 0, 0
+	for _, r := range reports {
+		if r.Status == importer.EntryImported {
+			imported++
+		} else {
+			skipped++
+		}
+	}
+	report, err := importer.MarshalReport(reports)
+	if err != nil {
+		return err
+	}
+	fields := map[string]interface{}{
+		"imported_count": imported,
+		"skipped_count":  skipped,
+		"report":         report,
+	}
+
+	if importErr != nil {
+		log.Printf("Failed to import archive: %v", importErr)
+		permanent := errors.Is(importErr, importer.ErrInvalidArchive)
+		if permanent || isLastAttempt(ctx) {
+			fields["status"] = "failed"
+			fields["error"] = importErr.Error()
+			if err := models.UpdateArchiveImport(payload.ImportID, fields); err != nil {
+				log.Printf("Failed to update archive import status: %v", err)
+			}
+		}
+		if permanent {
+			return fmt.Errorf("%v: %w", importErr, asynq.SkipRetry)
+		}
+		return importErr
+	}
+
+	fields["status"] = "done"
+	fields["error"] = ""
+	if err := models.UpdateArchiveImport(payload.ImportID, fields); err != nil {
+		return fmt.Errorf("failed to update archive import status: %w", err)
+	}
+	log.Printf("[Worker] Archive import %d done: %d imported, %d skipped", payload.ImportID, imported, skipped)
 	return nil
 }
 
-// processDocFile processes document files (simulates 5s processing)
-func processDocFile(ctx context.Context, minioSvc *services.MinioService, payload ProcessDocumentPayload) error {
-	log.Printf("[Worker] Processing DOC file: %s", payload.ObjectName)
-	log.Println("[Worker] Simulating document processing... (5 seconds)")
+func handleSyncSource(ctx context.Context, t *asynq.Task, syncer *connectors.Syncer) error {
+	var payload tasks.SyncSourcePayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+
+	source, err := models.GetDocumentSourceByID(payload.SourceID)
+	if err != nil {
+		return fmt.Errorf("failed to load source: %w", err)
+	}
 
-	// Simulate document processing
-	time.Sleep(5 * time.Second)
+	if payload.Trigger == "" {
+		payload.Trigger = tasks.TriggerManual
+	}
 
-	log.Printf("[Worker] DOC file processing complete: %s", payload.ObjectName)
+	log.Printf("[Worker] Syncing %s source %d (%s, %s)", source.Type, source.ID, source.URL, payload.Trigger)
+	if err := models.UpdateDocumentSource(source.ID, map[string]interface{}{"status": "syncing"}); err != nil {
+		log.Printf("Failed to update source status: %v", err)
+	}
+
+	result, syncErr := syncer.Sync(ctx, source, payload.Trigger)
+	if syncErr != nil {
+		log.Printf("Failed to sync source %d: %v", source.ID, syncErr)
+		permanent := errors.Is(syncErr, connectors.ErrInvalidSource)
+		status := "pending"
+		if permanent || isLastAttempt(ctx) {
+			status = "failed"
+		}
+		if err := models.UpdateDocumentSource(source.ID, map[string]interface{}{
+			"status":     status,
+			"last_error": syncErr.Error(),
+		}); err != nil {
+			log.Printf("Failed to update source status: %v", err)
+		}
+		if permanent {
+			return fmt.Errorf("%v: %w", syncErr, asynq.SkipRetry)
+		}
+		return syncErr
+	}
+
+	count, err := models.CountSourceDocuments(source.ID)
+	if err != nil {
+		return fmt.Errorf("failed to count source documents: %w", err)
+	}
+	if err := models.UpdateDocumentSource(source.ID, map[string]interface{}{
+		"status":         "idle",
+		"last_error":     "",
+		"last_synced_at": time.Now(),
+		"document_count": count,
+	}); err != nil {
+		return fmt.Errorf("failed to update source status: %w", err)
+	}
+	log.Printf("[Worker] Source %d synced: %d created, %d updated, %d unchanged, %d deleted", source.ID, result.Created, result.Updated, result.Unchanged, result.Deleted)
 	return nil
 }
 
-// processGraphFile processes graph files (simulates 5s processing)
-func processGraphFile(ctx context.Context, minioSvc *services.MinioService, payload ProcessDocumentPayload) error {
-	log.Printf("[Worker] Processing GRAPH file: %s", payload.ObjectName)
-	log.Println("[Worker] Simulating graph processing... (5 seconds)")
+func handleGenerateEvalSet(ctx context.Context, t *asynq.Task, questions *evalgen.Generator) error {
+	var payload tasks.GenerateEvalSetPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+	if _, err := models.GetEvalSetByID(payload.SetID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// deleted while queued
+			return nil
+		}
+		return err
+	}
 
-	// Simulate graph processing
-	time.Sleep(5 * time.Second)
+	log.Printf("[Worker] Generating %d questions for eval set %d of knowledge base %d", payload.Count, payload.SetID, payload.KnowledgeBaseID)
+	cases, genErr := questions.Generate(ctx, payload.SetID, payload.KnowledgeBaseID, payload.Count, payload.DocumentIDs)
+	if genErr == nil {
+		genErr = models.ReplaceEvalCases(payload.SetID, cases)
+	}
+	if genErr != nil {
+		log.Printf("Failed to generate eval set %d: %v", payload.SetID, genErr)
+		permanent := errors.Is(genErr, evalgen.ErrNoChunks) || errors.Is(genErr, evalgen.ErrNoQuestions)
+		if permanent || isLastAttempt(ctx) {
+			if err := models.UpdateEvalSet(payload.SetID, map[string]interface{}{
+				"status": "failed",
+				"error":  genErr.Error(),
+			}); err != nil {
+				log.Printf("Failed to update eval set status: %v", err)
+			}
+		}
+		if permanent {
+			return fmt.Errorf("%v: %w", genErr, asynq.SkipRetry)
+		}
+		return genErr
+	}
 
-	log.Printf("[Worker] GRAPH file processing complete: %s", payload.ObjectName)
+	if err := models.UpdateEvalSet(payload.SetID, map[string]interface{}{"status": "ready", "error": ""}); err != nil {
+		return fmt.Errorf("failed to update eval set status: %w", err)
+	}
+	log.Printf("[Worker] Eval set %d generated with %d questions", payload.SetID, len(cases))
 	return nil
 }
+
+// isLastAttempt reports whether asynq will not retry the task if it fails now.
+func isLastAttempt(ctx context.Context) bool {
+	retried, ok1 := asynq.GetRetryCount(ctx)
+	maxRetry, ok2 := asynq.GetMaxRetry(ctx)
+	return ok1 && ok2 && retried >= maxRetry
+}
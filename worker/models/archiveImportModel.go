@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"worker/services"
+)
+
+// ArchiveImport mirrors the backend's archive_imports table. The worker fills
+// in the outcome of expanding the archive.
+type ArchiveImport struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	KnowledgeBaseID uint      `gorm:"index;not null" json:"knowledge_base_id"`
+	UserID          uint      `gorm:"index;not null" json:"user_id"`
+	FileName        string    `gorm:"size:255" json:"file_name"`
+	ObjectName      string    `gorm:"size:1024" json:"object_name"`
+	Status          string    `gorm:"size:20;default:'pending'" json:"status"`
+	ImportedCount   int       `json:"imported_count"`
+	SkippedCount    int       `json:"skipped_count"`
+	Report          JSON      `gorm:"type:jsonb" json:"report"`
+	Error           string    `gorm:"type:text" json:"error,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+func UpdateArchiveImport(id uint, fields map[string]interface{}) error {
+	fields["updated_at"] = time.Now()
+	return services.DB.Model(&ArchiveImport{}).Where("id = ?", id).Updates(fields).Error
+}
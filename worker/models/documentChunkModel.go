@@ -0,0 +1,148 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"worker/services"
+)
+
+// DocumentChunk is one chunk of the extracted text of a document version.
+// IDs are derived from the document, version and chunk content, so
+// re-chunking the same input yields the same rows and the same Qdrant point
+// IDs.
+type DocumentChunk struct {
+	ID              string    `gorm:"primaryKey;size:36" json:"id"`
+	DocumentID      uint      `gorm:"index:idx_chunk_document_version;not null" json:"document_id"`
+	Version         int       `gorm:"index:idx_chunk_document_version;not null;default:1" json:"version"`
+	KnowledgeBaseID uint      `gorm:"index;not null" json:"knowledge_base_id"`
+	ChunkIndex      int       `gorm:"not null" json:"chunk_index"`
+	Page            int       `json:"page"`
+	Symbol          string    `gorm:"size:255" json:"symbol,omitempty"`
+	Kind            string    `gorm:"size:20;not null;default:''" json:"kind,omitempty"` // empty for document text, "summary" for the generated summary
+	Content         string    `gorm:"type:text" json:"content"`
+	Language        string    `gorm:"size:10" json:"language,omitempty"`
+	SearchConfig    string    `gorm:"size:64" json:"search_config,omitempty"` // text search configuration of SearchVector, also used for queries
+	SearchVector    string    `gorm:"type:tsvector;index:idx_chunk_search_vector,type:gin;<-:false;->:false" json:"-"`
+	Indexed         bool      `gorm:"not null;default:false" json:"indexed"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// ReplaceDocumentChunks makes chunks the exact chunk set of the document
+// version. Rows that already exist keep their Indexed flag; rows that are no
+// longer part of the set are removed.
+func ReplaceDocumentChunks(documentID uint, version int, chunks []DocumentChunk) error {
+	ids := make([]string, 0, len(chunks))
+	for _, ch := range chunks {
+		ids = append(ids, ch.ID)
+	}
+
+	return services.DB.Transaction(func(tx *gorm.DB) error {
+		stale := tx.Where("document_id = ? AND version = ?", documentID, version)
+		if len(ids) > 0 {
+			stale = stale.Where("id NOT IN ?", ids)
+		}
+		if err := stale.Delete(&DocumentChunk{}).Error; err != nil {
+			return err
+		}
+		if len(chunks) == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"language", "search_config"}),
+		}).CreateInBatches(chunks, 100).Error
+	})
+}
+
+// UpdateChunkSearchVectors builds the full-text search vectors of the
+// document version's chunks with each chunk's search configuration.
+func UpdateChunkSearchVectors(documentID uint, version int) error {
+	return services.DB.Exec(
+		"UPDATE document_chunks SET search_vector = to_tsvector(COALESCE(NULLIF(search_config, ''), 'simple')::regconfig, content) WHERE document_id = ? AND version = ?",
+		documentID, version,
+	).Error
+}
+
+// ListTextChunks returns the chunks holding the document version's own
+// text, in document order.
+func ListTextChunks(documentID uint, version int) ([]DocumentChunk, error) {
+	var chunks []DocumentChunk
+	if err := services.DB.Where("document_id = ? AND version = ? AND kind = ?", documentID, version, "").
+		Order("chunk_index ASC").Find(&chunks).Error; err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
+
+// ReplaceChunkOfKind makes chunk the only chunk of its kind in the document
+// version, keeping the Indexed flag when it already exists.
+func ReplaceChunkOfKind(chunk DocumentChunk) error {
+	return services.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("document_id = ? AND version = ? AND kind = ? AND id <> ?", chunk.DocumentID, chunk.Version, chunk.Kind, chunk.ID).
+			Delete(&DocumentChunk{}).Error; err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"language", "search_config"}),
+		}).Create(&chunk).Error
+	})
+}
+
+func ListUnindexedChunks(documentID uint, version int, limit int) ([]DocumentChunk, error) {
+	var chunks []DocumentChunk
+	if err := services.DB.Where("document_id = ? AND version = ? AND indexed = ?", documentID, version, false).
+		Order("chunk_index ASC").Limit(limit).Find(&chunks).Error; err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
+
+func ListChunkIDs(documentID uint, version int) ([]string, error) {
+	var ids []string
+	if err := services.DB.Model(&DocumentChunk{}).Where("document_id = ? AND version = ?", documentID, version).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func MarkChunksIndexed(ids []string) error {
+	return services.DB.Model(&DocumentChunk{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+		"indexed":    true,
+		"updated_at": time.Now(),
+	}).Error
+}
+
+// SampleTextChunks picks up to limit random text chunks of at least minLength
+// bytes from the versions the knowledge base's documents serve, optionally
+// only of documentIDs. Picks alternate between documents, so a few long
+// documents do not crowd out the rest.
+func SampleTextChunks(kbID uint, documentIDs []uint, minLength, limit int) ([]DocumentChunk, error) {
+	where := "c.knowledge_base_id = ? AND c.kind = '' AND length(c.content) >= ?"
+	args := []interface{}{kbID, minLength}
+	if len(documentIDs) > 0 {
+		where += " AND c.document_id IN ?"
+		args = append(args, documentIDs)
+	}
+	args = append(args, limit)
+
+	var chunks []DocumentChunk
+	err := services.DB.Raw(`
+SELECT id, document_id, version, knowledge_base_id, chunk_index, page, content, language FROM (
+	SELECT c.id, c.document_id, c.version, c.knowledge_base_id, c.chunk_index, c.page, c.content, c.language,
+		row_number() OVER (PARTITION BY c.document_id ORDER BY random()) AS pick
+	FROM document_chunks c
+	JOIN documents d ON d.id = c.document_id AND d.version = c.version
+	WHERE `+where+`
+) sampled
+ORDER BY pick, random()
+LIMIT ?`, args...).Scan(&chunks).Error
+	if err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
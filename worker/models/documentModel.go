@@ -0,0 +1,206 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"worker/services"
+)
+
+// Document mirrors the backend's documents table. The backend owns the schema;
+// the worker reads documents, updates their processing status and creates
+// documents found in imported archives.
+type Document struct {
+	ID              uint   `gorm:"primaryKey" json:"id"`
+	KnowledgeBaseID uint   `gorm:"index" json:"knowledge_base_id"`
+	UserID          uint   `gorm:"index;not null" json:"user_id"`
+	Name            string `gorm:"size:255" json:"name"`
+	FileType        string `gorm:"size:50" json:"file_type"`
+	Description     string `gorm:"size:255" json:"description"`
+	ObjectName      string `gorm:"size:1024" json:"object_name"`
+	ContentHash     string `gorm:"size:64;index" json:"content_hash"`
+	Size            int64  `json:"size"`
+	Version         int    `gorm:"not null;default:1" json:"version"`
+	SourceID        *uint  `gorm:"index" json:"source_id,omitempty"`
+	SourceURL       string `gorm:"size:2048" json:"source_url,omitempty"`
+	// user-defined key/values, copied into the payload of every chunk
+	Metadata JSON `gorm:"type:jsonb" json:"metadata,omitempty"`
+	// generated from the served version's content
+	Language       string `gorm:"size:10" json:"language,omitempty"`
+	Summary        string `gorm:"type:text" json:"summary,omitempty"`
+	SuggestedTitle string `gorm:"size:255" json:"suggested_title,omitempty"`
+	Keywords       JSON   `gorm:"type:jsonb" json:"keywords,omitempty"`
+	// validators of the last fetch, for conditional requests
+	SourceETag         string    `gorm:"size:255" json:"-"`
+	SourceLastModified string    `gorm:"size:100" json:"-"`
+	EmbeddingStatus    string    `gorm:"size:20;default:'pending'" json:"embedding_status"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+func GetDocumentByID(id uint) (*Document, error) {
+	var doc Document
+	if err := services.DB.First(&doc, id).Error; err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// CreateDocumentWithVersion inserts a new document together with its first version.
+func CreateDocumentWithVersion(d *Document, v *DocumentVersion) error {
+	return services.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(d).Error; err != nil {
+			return err
+		}
+		v.DocumentID = d.ID
+		return tx.Create(v).Error
+	})
+}
+
+// AddDocumentVersion stores a new version of an existing document and makes
+// it the version the document serves once indexed.
+func AddDocumentVersion(d *Document, v *DocumentVersion) error {
+	return services.DB.Transaction(func(tx *gorm.DB) error {
+		var last int
+		if err := tx.Model(&DocumentVersion{}).Where("document_id = ?", d.ID).
+			Select("COALESCE(MAX(version), 0)").Scan(&last).Error; err != nil {
+			return err
+		}
+		v.DocumentID = d.ID
+		v.Version = last + 1
+		if err := tx.Create(v).Error; err != nil {
+			return err
+		}
+		d.Version = v.Version
+		d.FileType = v.FileType
+		d.ObjectName = v.ObjectName
+		d.ContentHash = v.ContentHash
+		d.Size = v.Size
+		d.EmbeddingStatus = v.EmbeddingStatus
+		return tx.Save(d).Error
+	})
+}
+
+// FindDocumentBySourceURL returns the document fetched by the source from the
+// given URL or path, or nil when there is none.
+func FindDocumentBySourceURL(sourceID uint, sourceURL string) (*Document, error) {
+	var doc Document
+	err := services.DB.Where("source_id = ? AND source_url = ?", sourceID, sourceURL).First(&doc).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// ListSourceDocuments returns every document fetched by the source.
+func ListSourceDocuments(sourceID uint) ([]Document, error) {
+	var docs []Document
+	err := services.DB.Where("source_id = ?", sourceID).Find(&docs).Error
+	return docs, err
+}
+
+// UpdateSourceValidators stores the ETag and Last-Modified header of the
+// latest fetch of a source document.
+func UpdateSourceValidators(id uint, etag, lastModified string) error {
+	return services.DB.Model(&Document{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"source_etag":          etag,
+		"source_last_modified": lastModified,
+	}).Error
+}
+
+// DeleteDocument removes a document with its versions, chunks and
+// checkpoints. It returns the deleted versions so the caller can remove their
+// files.
+func DeleteDocument(id uint) ([]DocumentVersion, error) {
+	var versions []DocumentVersion
+	err := services.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("document_id = ?", id).Find(&versions).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("document_id = ?", id).Delete(&DocumentChunk{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("document_id = ?", id).Delete(&IngestionCheckpoint{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("document_id = ?", id).Delete(&DocumentVersion{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Document{}, id).Error
+	})
+	return versions, err
+}
+
+// FindDocumentByContentHash returns a document of the knowledge base that has
+// a version with the given SHA-256, or nil when there is none.
+func FindDocumentByContentHash(kbID uint, hash string) (*Document, error) {
+	var doc Document
+	err := services.DB.Where("knowledge_base_id = ?", kbID).
+		Where("content_hash = ? OR id IN (?)", hash,
+			services.DB.Model(&DocumentVersion{}).Select("document_id").Where("content_hash = ?", hash)).
+		First(&doc).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// UpdateDocumentSummary stores the generated summary of one version of a
+// document. Like the status, the document row is only updated while that
+// version is the one it serves.
+func UpdateDocumentSummary(id uint, version int, summary, title string, keywords JSON) error {
+	fields := map[string]interface{}{
+		"summary":         summary,
+		"suggested_title": title,
+		"keywords":        keywords,
+		"updated_at":      time.Now(),
+	}
+	if err := services.DB.Model(&DocumentVersion{}).Where("document_id = ? AND version = ?", id, version).Updates(fields).Error; err != nil {
+		return err
+	}
+	return services.DB.Model(&Document{}).Where("id = ? AND version = ?", id, version).Updates(fields).Error
+}
+
+// UpdateDocumentLanguage stores the dominant language of one version of a
+// document, on the document row only while it serves that version.
+func UpdateDocumentLanguage(id uint, version int, language string) error {
+	fields := map[string]interface{}{"language": language}
+	if err := services.DB.Model(&DocumentVersion{}).Where("document_id = ? AND version = ?", id, version).Updates(fields).Error; err != nil {
+		return err
+	}
+	return services.DB.Model(&Document{}).Where("id = ? AND version = ?", id, version).Updates(fields).Error
+}
+
+// UpdateContentHash records the SHA-256 of one version's file, on the
+// document row only while it serves that version.
+func UpdateContentHash(id uint, version int, hash string) error {
+	fields := map[string]interface{}{"content_hash": hash}
+	if err := services.DB.Model(&DocumentVersion{}).Where("document_id = ? AND version = ?", id, version).Updates(fields).Error; err != nil {
+		return err
+	}
+	return services.DB.Model(&Document{}).Where("id = ? AND version = ?", id, version).Updates(fields).Error
+}
+
+// UpdateEmbeddingStatus sets the status of one version of a document. The
+// document row is only updated while that version is the one it serves.
+func UpdateEmbeddingStatus(id uint, version int, status string) error {
+	now := time.Now()
+	if err := services.DB.Model(&DocumentVersion{}).Where("document_id = ? AND version = ?", id, version).Updates(map[string]interface{}{
+		"embedding_status": status,
+		"updated_at":       now,
+	}).Error; err != nil {
+		return err
+	}
+	return services.DB.Model(&Document{}).Where("id = ? AND version = ?", id, version).Updates(map[string]interface{}{
+		"embedding_status": status,
+		"updated_at":       now,
+	}).Error
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"worker/services"
+)
+
+// DocumentSource mirrors the backend's document_sources table. The worker
+// syncs sources and records the outcome.
+type DocumentSource struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	KnowledgeBaseID uint       `gorm:"index;not null" json:"knowledge_base_id"`
+	UserID          uint       `gorm:"index;not null" json:"user_id"`
+	Type            string     `gorm:"size:20;not null" json:"type"`
+	URL             string     `gorm:"size:2048;not null" json:"url"`
+	Config          JSON       `gorm:"type:jsonb" json:"config"`
+	Schedule        string     `gorm:"size:100" json:"schedule,omitempty"`
+	Revision        string     `gorm:"size:64" json:"revision,omitempty"`
+	RevisionInclude string     `gorm:"size:64" json:"-"`
+	Status          string     `gorm:"size:20;default:'pending'" json:"status"`
+	DocumentCount   int        `json:"document_count"`
+	LastSyncedAt    *time.Time `json:"last_synced_at,omitempty"`
+	LastError       string     `gorm:"type:text" json:"last_error,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+func GetDocumentSourceByID(id uint) (*DocumentSource, error) {
+	var s DocumentSource
+	if err := services.DB.First(&s, id).Error; err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func UpdateDocumentSource(id uint, fields map[string]interface{}) error {
+	fields["updated_at"] = time.Now()
+	return services.DB.Model(&DocumentSource{}).Where("id = ?", id).Updates(fields).Error
+}
+
+// ListScheduledSources returns the sources that have a sync schedule.
+func ListScheduledSources() ([]DocumentSource, error) {
+	var sources []DocumentSource
+	err := services.DB.Where("schedule <> ''").Find(&sources).Error
+	return sources, err
+}
+
+// CountSourceDocuments returns how many documents were fetched by the source.
+func CountSourceDocuments(sourceID uint) (int64, error) {
+	var n int64
+	err := services.DB.Model(&Document{}).Where("source_id = ?", sourceID).Count(&n).Error
+	return n, err
+}
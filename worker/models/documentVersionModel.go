@@ -0,0 +1,46 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"worker/services"
+)
+
+// DocumentVersion mirrors the backend's document_versions table.
+type DocumentVersion struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	DocumentID      uint      `gorm:"not null" json:"document_id"`
+	Version         int       `gorm:"not null" json:"version"`
+	FileName        string    `gorm:"size:255" json:"file_name"`
+	FileType        string    `gorm:"size:50" json:"file_type"`
+	Description     string    `gorm:"size:255" json:"description"`
+	ObjectName      string    `gorm:"size:1024" json:"object_name"`
+	ContentHash     string    `gorm:"size:64;index" json:"content_hash"`
+	Size            int64     `json:"size"`
+	UploadedBy      uint      `json:"uploaded_by"`
+	SourceRevision  string    `gorm:"size:64" json:"source_revision,omitempty"`
+	Language        string    `gorm:"size:10" json:"language,omitempty"`
+	Summary         string    `gorm:"type:text" json:"summary,omitempty"`
+	SuggestedTitle  string    `gorm:"size:255" json:"suggested_title,omitempty"`
+	Keywords        JSON      `gorm:"type:jsonb" json:"keywords,omitempty"`
+	EmbeddingStatus string    `gorm:"size:20;default:'pending'" json:"embedding_status"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// GetDocumentVersion returns nil when the version does not exist, e.g. for
+// documents uploaded before versions were recorded.
+func GetDocumentVersion(documentID uint, version int) (*DocumentVersion, error) {
+	var v DocumentVersion
+	err := services.DB.First(&v, "document_id = ? AND version = ?", documentID, version).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &v, nil
+}
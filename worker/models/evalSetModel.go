@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"worker/services"
+)
+
+// EvalSet mirrors the backend's eval_sets table. The worker fills in
+// generated sets and reports their status.
+type EvalSet struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	KnowledgeBaseID uint      `gorm:"index;not null" json:"knowledge_base_id"`
+	Status          string    `gorm:"size:20;not null;default:'ready'" json:"status"`
+	Error           string    `gorm:"type:text" json:"error,omitempty"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// EvalCase mirrors the backend's eval_cases table.
+type EvalCase struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	SetID           uint      `gorm:"index;not null" json:"set_id"`
+	Question        string    `gorm:"type:text;not null" json:"question"`
+	ExpectedAnswer  string    `gorm:"type:text" json:"expected_answer,omitempty"`
+	ExpectedSources JSON      `gorm:"type:jsonb" json:"expected_sources,omitempty"`
+	SourceChunkID   string    `gorm:"size:36" json:"source_chunk_id,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+func GetEvalSetByID(id uint) (*EvalSet, error) {
+	var set EvalSet
+	if err := services.DB.First(&set, id).Error; err != nil {
+		return nil, err
+	}
+	return &set, nil
+}
+
+func UpdateEvalSet(id uint, fields map[string]interface{}) error {
+	fields["updated_at"] = time.Now()
+	return services.DB.Model(&EvalSet{}).Where("id = ?", id).Updates(fields).Error
+}
+
+// ReplaceEvalCases makes cases the cases of the set, so a retried
+// generation does not add its questions twice.
+func ReplaceEvalCases(setID uint, cases []EvalCase) error {
+	return services.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("set_id = ?", setID).Delete(&EvalCase{}).Error; err != nil {
+			return err
+		}
+		if len(cases) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(cases, 100).Error
+	})
+}
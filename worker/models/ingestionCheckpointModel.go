@@ -0,0 +1,47 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"worker/services"
+)
+
+// IngestionCheckpoint records the last completed pipeline stage of a document
+// version so a retried task can resume instead of starting over. The checkpoint is
+// only valid for the object (name and ETag) it was produced from.
+type IngestionCheckpoint struct {
+	DocumentID uint      `gorm:"primaryKey;autoIncrement:false" json:"document_id"`
+	Version    int       `gorm:"primaryKey;autoIncrement:false" json:"version"`
+	ObjectName string    `gorm:"size:1024" json:"object_name"`
+	ObjectETag string    `gorm:"size:255" json:"object_etag"`
+	Stage      string    `gorm:"size:20" json:"stage"`
+	ChunkCount int       `json:"chunk_count"`
+	Attempts   int       `json:"attempts"`
+	LastError  string    `gorm:"type:text" json:"last_error"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func GetIngestionCheckpoint(documentID uint, version int) (*IngestionCheckpoint, error) {
+	var cp IngestionCheckpoint
+	err := services.DB.First(&cp, "document_id = ? AND version = ?", documentID, version).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &cp, nil
+}
+
+func SaveIngestionCheckpoint(cp *IngestionCheckpoint) error {
+	cp.UpdatedAt = time.Now()
+	return services.DB.Save(cp).Error
+}
+
+// AutoMigrate creates the tables owned by the worker.
+func AutoMigrate() error {
+	return services.DB.AutoMigrate(&DocumentChunk{}, &IngestionCheckpoint{})
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"worker/services"
+)
+
+// SourceSyncRun mirrors the backend's source_sync_runs table. The worker
+// records every sync it runs.
+type SourceSyncRun struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	SourceID        uint       `gorm:"index;not null" json:"source_id"`
+	KnowledgeBaseID uint       `gorm:"index;not null" json:"knowledge_base_id"`
+	Trigger         string     `gorm:"size:20" json:"trigger"`
+	Status          string     `gorm:"size:20;default:'running'" json:"status"`
+	CreatedCount    int        `json:"created_count"`
+	UpdatedCount    int        `json:"updated_count"`
+	UnchangedCount  int        `json:"unchanged_count"`
+	DeletedCount    int        `json:"deleted_count"`
+	Error           string     `gorm:"type:text" json:"error,omitempty"`
+	StartedAt       time.Time  `json:"started_at"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+}
+
+func CreateSourceSyncRun(r *SourceSyncRun) error {
+	return services.DB.Create(r).Error
+}
+
+func UpdateSourceSyncRun(r *SourceSyncRun) error {
+	return services.DB.Save(r).Error
+}
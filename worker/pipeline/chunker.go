@@ -0,0 +1,163 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// chunkNamespace seeds the name-based UUIDs used as chunk and point IDs.
+var chunkNamespace = uuid.MustParse("6f1c2b1e-8a53-4f0e-9d8e-2f4d1b7c9a10")
+
+// Chunk is a piece of text small enough to embed.
+type Chunk struct {
+	ID     string
+	Index  int
+	Page   int
+	Symbol string
+	Text   string
+}
+
+// ChunkID derives a stable ID from the document version, the chunk position
+// and its content. Running the chunker twice over the same text yields the
+// same IDs.
+func ChunkID(documentID uint, version int, index int, text string) string {
+	sum := sha256.Sum256([]byte(text))
+	name := fmt.Sprintf("%d/%d/%d/%x", documentID, version, index, sum)
+	return uuid.NewSHA1(chunkNamespace, []byte(name)).String()
+}
+
+// SplitSections packs paragraphs into chunks of at most size characters,
+// repeating the last overlap characters of a chunk at the start of the next
+// one. Chunks never span sections so page numbers stay accurate, and table
+// sections are only split between rows.
+func SplitSections(documentID uint, version int, sections []Section, size, overlap int) []Chunk {
+	if size <= 0 {
+		size = 1000
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = 0
+	}
+
+	var chunks []Chunk
+	for _, section := range sections {
+		var texts []string
+		if section.Table {
+			texts = splitTable(section.Text, size)
+		} else {
+			texts = splitText(section.Text, size, overlap)
+		}
+		for _, text := range texts {
+			index := len(chunks)
+			chunks = append(chunks, Chunk{
+				ID:     ChunkID(documentID, version, index, text),
+				Index:  index,
+				Page:   section.Page,
+				Symbol: section.Symbol,
+				Text:   text,
+			})
+		}
+	}
+	return chunks
+}
+
+func splitText(text string, size, overlap int) []string {
+	var pieces []string
+	for _, para := range strings.Split(text, "\n\n") {
+		// keep the indentation of the first line, it matters for code
+		para = strings.TrimRight(strings.TrimLeft(para, "\r\n"), " \t\r\n")
+		if strings.TrimSpace(para) == "" {
+			continue
+		}
+		if len(para) <= size {
+			pieces = append(pieces, para)
+			continue
+		}
+		pieces = append(pieces, splitLines(para, size)...)
+	}
+
+	var chunks []string
+	var current strings.Builder
+	for _, piece := range pieces {
+		if current.Len() > 0 && current.Len()+len(piece)+2 > size {
+			chunk := current.String()
+			chunks = append(chunks, chunk)
+			current.Reset()
+			if tail := overlapTail(chunk, overlap); tail != "" && len(tail)+len(piece)+2 <= size {
+				current.WriteString(tail)
+			}
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n\n")
+		}
+		current.WriteString(piece)
+	}
+	if current.Len() > 0 {
+		chunks = append(chunks, current.String())
+	}
+	return chunks
+}
+
+// splitLines breaks a paragraph that is longer than size on line boundaries,
+// falling back to words for lines that are too long on their own.
+func splitLines(para string, size int) []string {
+	var out []string
+	var current strings.Builder
+	for _, line := range strings.Split(para, "\n") {
+		if len(line) > size {
+			if current.Len() > 0 {
+				out = append(out, current.String())
+				current.Reset()
+			}
+			out = append(out, splitWords(line, size)...)
+			continue
+		}
+		if current.Len() > 0 && current.Len()+len(line)+1 > size {
+			out = append(out, current.String())
+			current.Reset()
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n")
+		}
+		current.WriteString(line)
+	}
+	if current.Len() > 0 {
+		out = append(out, current.String())
+	}
+	return out
+}
+
+// splitWords breaks text that is longer than size on word boundaries.
+func splitWords(para string, size int) []string {
+	var out []string
+	var current strings.Builder
+	for _, word := range strings.Fields(para) {
+		if current.Len() > 0 && current.Len()+len(word)+1 > size {
+			out = append(out, current.String())
+			current.Reset()
+		}
+		if current.Len() > 0 {
+			current.WriteString(" ")
+		}
+		current.WriteString(word)
+	}
+	if current.Len() > 0 {
+		out = append(out, current.String())
+	}
+	return out
+}
+
+// overlapTail returns roughly the last n characters of s, starting at a word.
+func overlapTail(s string, n int) string {
+	if n <= 0 || len(s) <= n {
+		return ""
+	}
+	tail := s[len(s)-n:]
+	i := strings.IndexAny(tail, " \n")
+	if i < 0 {
+		return ""
+	}
+	return strings.TrimSpace(tail[i+1:])
+}
@@ -0,0 +1,151 @@
+package pipeline
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// codeLanguage describes how to find the declarations a source file is split
+// on. decl must capture the declared name in its first group.
+type codeLanguage struct {
+	decl *regexp.Regexp
+	// comment matches lines that belong to the declaration below them, such
+	// as doc comments, decorators and annotations.
+	comment *regexp.Regexp
+}
+
+var (
+	slashComment = regexp.MustCompile(`^\s*(//|/\*|\*|@)`)
+	hashComment  = regexp.MustCompile(`^\s*(#|@)`)
+)
+
+// Declarations are only recognised at the top level or one indentation level
+// deep, which covers functions, classes and the methods of classes.
+var codeLanguages = map[string]*codeLanguage{
+	".go": {comment: slashComment,
+		decl: regexp.MustCompile(`^(?:func\s+(?:\([^)]*\)\s*)?(\w+)|type\s+(\w+))`)},
+	".py": {comment: hashComment,
+		decl: regexp.MustCompile(`^(?:    |\t)?(?:async\s+)?(?:def|class)\s+(\w+)`)},
+	".js":   {comment: slashComment, decl: jsDecl},
+	".jsx":  {comment: slashComment, decl: jsDecl},
+	".mjs":  {comment: slashComment, decl: jsDecl},
+	".ts":   {comment: slashComment, decl: jsDecl},
+	".tsx":  {comment: slashComment, decl: jsDecl},
+	".java": {comment: slashComment, decl: classDecl},
+	".kt": {comment: slashComment,
+		decl: regexp.MustCompile(`^(?:    |\t)?(?:(?:public|private|protected|internal|open|abstract|data|sealed|override|suspend|inline)\s+)*(?:fun|class|object|interface)\s+(?:<[^>]*>\s*)?(?:\w+\.)?(\w+)`)},
+	".cs":  {comment: slashComment, decl: classDecl},
+	".c":   {comment: slashComment, decl: cDecl},
+	".h":   {comment: slashComment, decl: cDecl},
+	".cc":  {comment: slashComment, decl: cDecl},
+	".cpp": {comment: slashComment, decl: cDecl},
+	".hpp": {comment: slashComment, decl: cDecl},
+	".rs": {comment: slashComment,
+		decl: regexp.MustCompile(`^(?:    |\t)?(?:pub(?:\([^)]*\))?\s+)?(?:async\s+|unsafe\s+|const\s+)*(?:fn|struct|enum|trait|impl|mod)\s+(?:<[^>]*>\s*)?(\w+)`)},
+	".rb": {comment: hashComment,
+		decl: regexp.MustCompile(`^(?:  )?(?:def|class|module)\s+(?:self\.)?([\w:?!]+)`)},
+	".php": {comment: slashComment,
+		decl: regexp.MustCompile(`^(?:    |\t)?(?:(?:public|private|protected|static|abstract|final)\s+)*(?:function|class|interface|trait)\s+(\w+)`)},
+	".swift": {comment: slashComment,
+		decl: regexp.MustCompile(`^(?:    |\t)?(?:(?:public|private|internal|open|fileprivate|static|final|override)\s+)*(?:func|class|struct|enum|protocol|extension)\s+(\w+)`)},
+	".sh": {comment: hashComment,
+		decl: regexp.MustCompile(`^(?:function\s+)?(\w+)\s*\(\)\s*\{?`)},
+	".sql": {comment: regexp.MustCompile(`^\s*--`),
+		decl: regexp.MustCompile(`(?i)^create\s+(?:or\s+replace\s+)?(?:table|view|function|procedure|index|trigger)\s+(?:if\s+not\s+exists\s+)?([\w."]+)`)},
+}
+
+var (
+	jsDecl = regexp.MustCompile(`^(?:  |    |\t)?(?:export\s+)?(?:default\s+)?(?:(?:async|abstract|static|public|private|protected)\s+)*(?:function\*?\s+(\w+)|class\s+(\w+)|interface\s+(\w+)|type\s+(\w+)\s*=|(?:const|let|var)\s+(\w+)\s*=\s*(?:async\s+)?(?:function|\([^)]*\)\s*=>|\w+\s*=>))`)
+	// classDecl finds types and methods in Java-like languages.
+	classDecl = regexp.MustCompile(`^(?:    |\t)?(?:(?:public|private|protected|internal|static|final|abstract|sealed|partial|override|virtual|async|synchronized)\s+)*(?:(?:class|interface|enum|record|struct)\s+(\w+)|[\w<>\[\],.? ]+\s+(\w+)\s*\([^;]*$)`)
+	cDecl     = regexp.MustCompile(`^(?:(?:static|inline|extern|virtual|const)\s+)*(?:(?:struct|class|enum|union)\s+(\w+)\s*\{?\s*$|[\w:<>*& ]+[\s*&]+([\w:~]+)\s*\([^;]*$)`)
+)
+
+// extractCode splits a source file into one section per declaration, so a
+// chunk never mixes two functions or classes. Comments and annotations
+// directly above a declaration stay with it.
+func extractCode(lang *codeLanguage, data []byte) ([]Section, error) {
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("%w: source file is not valid UTF-8", ErrUnsupportedFormat)
+	}
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+
+	var sections []Section
+	start, symbol := 0, ""
+	flush := func(end int) {
+		text := strings.Join(lines[start:end], "\n")
+		if strings.TrimSpace(text) != "" {
+			sections = append(sections, Section{Symbol: symbol, Text: text})
+		}
+	}
+
+	for i, line := range lines {
+		m := lang.decl.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		boundary := i
+		for boundary > start && strings.TrimSpace(lines[boundary-1]) != "" && lang.comment.MatchString(lines[boundary-1]) {
+			boundary--
+		}
+		if boundary > start {
+			flush(boundary)
+			start = boundary
+		}
+		symbol = firstGroup(m)
+	}
+	flush(len(lines))
+	return sections, nil
+}
+
+// extractMarkdown splits a Markdown file at its headings. Lines inside
+// fenced code blocks are never taken for headings.
+func extractMarkdown(data []byte) ([]Section, error) {
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("%w: file is not valid UTF-8 text", ErrUnsupportedFormat)
+	}
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+
+	var sections []Section
+	var current []string
+	symbol, fence := "", ""
+	flush := func() {
+		text := strings.Join(current, "\n")
+		if strings.TrimSpace(text) != "" {
+			sections = append(sections, Section{Symbol: symbol, Text: text})
+		}
+		current = nil
+	}
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:3]
+		case strings.HasPrefix(line, "#"):
+			level := len(line) - len(strings.TrimLeft(line, "#"))
+			if level <= 6 && (len(line) == level || line[level] == ' ') {
+				flush()
+				symbol = strings.TrimSpace(strings.Trim(line, "# "))
+			}
+		}
+		current = append(current, line)
+	}
+	flush()
+	return sections, nil
+}
+
+func firstGroup(m []string) string {
+	for _, g := range m[1:] {
+		if g != "" {
+			return g
+		}
+	}
+	return ""
+}
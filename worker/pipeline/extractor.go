@@ -0,0 +1,262 @@
+package pipeline
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// ErrUnsupportedFormat is returned for files the extractor cannot read.
+// Retrying such a document will never succeed.
+var ErrUnsupportedFormat = errors.New("unsupported file format")
+
+// supportedExtensions lists the file extensions Extract can read.
+var supportedExtensions = map[string]bool{
+	".pdf":      true,
+	".docx":     true,
+	".csv":      true,
+	".txt":      true,
+	".md":       true,
+	".markdown": true,
+	".html":     true,
+	".htm":      true,
+	".json":     true,
+	".xml":      true,
+	".yaml":     true,
+	".yml":      true,
+	".toml":     true,
+	".rst":      true,
+}
+
+// SupportedExtension reports whether files with the given extension can be
+// extracted.
+func SupportedExtension(ext string) bool {
+	ext = strings.ToLower(ext)
+	return supportedExtensions[ext] || imageExtensions[ext] || codeLanguages[ext] != nil
+}
+
+// Section is a contiguous piece of extracted text. Page is 1-based for paged
+// formats and 0 otherwise. Symbol names the function, class or heading the
+// section belongs to, when the format has such structure. Table sections
+// hold one Markdown table, which the chunker only splits between rows.
+type Section struct {
+	Page   int    `json:"page"`
+	Symbol string `json:"symbol,omitempty"`
+	Table  bool   `json:"table,omitempty"`
+	Text   string `json:"text"`
+}
+
+// Extract turns the raw bytes of an uploaded file into text sections. Pages
+// without a text layer come back with empty text.
+func Extract(fileType, objectName string, data []byte) ([]Section, error) {
+	ext := strings.ToLower(path.Ext(objectName))
+
+	switch {
+	case ext == ".pdf":
+		return extractPDF(data)
+	case ext == ".docx":
+		return extractDOCX(data)
+	case ext == ".csv" || fileType == "csv":
+		return extractCSV(data)
+	case ext == ".html" || ext == ".htm":
+		return extractHTML(data)
+	case imageExtensions[ext]:
+		// the pipeline fills in the text with OCR
+		return []Section{{Page: 1}}, nil
+	case ext == ".md" || ext == ".markdown":
+		return extractMarkdown(data)
+	case codeLanguages[ext] != nil:
+		return extractCode(codeLanguages[ext], data)
+	default:
+		return extractPlainText(data)
+	}
+}
+
+func extractPDF(data []byte) ([]Section, error) {
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid pdf: %v", ErrUnsupportedFormat, err)
+	}
+
+	fonts := make(map[string]*pdf.Font)
+	var sections []Section
+	for i := 1; i <= r.NumPage(); i++ {
+		page := r.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		for _, name := range page.Fonts() {
+			if _, ok := fonts[name]; !ok {
+				f := page.Font(name)
+				fonts[name] = &f
+			}
+		}
+		if tables := pdfPageSections(page, i); tables != nil {
+			sections = append(sections, tables...)
+			continue
+		}
+		text, err := page.GetPlainText(fonts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pdf page %d: %w", i, err)
+		}
+		sections = append(sections, Section{Page: i, Text: text})
+	}
+	return sections, nil
+}
+
+func extractDOCX(data []byte) ([]Section, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid docx: %v", ErrUnsupportedFormat, err)
+	}
+
+	var body io.ReadCloser
+	for _, f := range zr.File {
+		if f.Name == "word/document.xml" {
+			body, err = f.Open()
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	if body == nil {
+		return nil, fmt.Errorf("%w: docx has no word/document.xml", ErrUnsupportedFormat)
+	}
+	defer body.Close()
+
+	// Tables become sections of their own. Nested tables are flattened into
+	// the cell that holds them.
+	var sections []Section
+	var sb strings.Builder
+	var rows [][]string
+	var cell strings.Builder
+	depth := 0
+	flushText := func() {
+		if strings.TrimSpace(sb.String()) != "" {
+			sections = append(sections, Section{Text: sb.String()})
+		}
+		sb.Reset()
+	}
+	out := func() *strings.Builder {
+		if depth > 0 {
+			return &cell
+		}
+		return &sb
+	}
+
+	dec := xml.NewDecoder(body)
+	inText := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse docx: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				out().WriteString("\t")
+			case "br":
+				out().WriteString("\n")
+			case "tbl":
+				depth++
+			case "tr":
+				if depth == 1 {
+					rows = append(rows, nil)
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if depth > 0 {
+					cell.WriteString(" ")
+				} else {
+					sb.WriteString("\n\n")
+				}
+			case "tc":
+				if depth == 1 && len(rows) > 0 {
+					rows[len(rows)-1] = append(rows[len(rows)-1], strings.TrimSpace(cell.String()))
+					cell.Reset()
+				}
+			case "tbl":
+				depth--
+				if depth > 0 {
+					continue
+				}
+				if table, ok := markdownTable(rows); ok {
+					flushText()
+					sections = append(sections, Section{Table: true, Text: table})
+				} else {
+					// a layout table, keep its text in reading order
+					for _, row := range rows {
+						sb.WriteString(strings.Join(row, " "))
+						sb.WriteString("\n\n")
+					}
+				}
+				rows = nil
+			}
+		case xml.CharData:
+			if inText {
+				out().Write(t)
+			}
+		}
+	}
+	flushText()
+
+	return sections, nil
+}
+
+// extractCSV renders each record as "column: value" pairs so a chunk keeps
+// the header context of every row it contains.
+func extractCSV(data []byte) ([]Section, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid csv: %v", ErrUnsupportedFormat, err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	header := records[0]
+	var sb strings.Builder
+	for _, record := range records[1:] {
+		fields := make([]string, 0, len(record))
+		for i, value := range record {
+			name := fmt.Sprintf("column %d", i+1)
+			if i < len(header) && header[i] != "" {
+				name = header[i]
+			}
+			fields = append(fields, name+": "+value)
+		}
+		sb.WriteString(strings.Join(fields, "; "))
+		sb.WriteString("\n\n")
+	}
+
+	return []Section{{Text: sb.String()}}, nil
+}
+
+func extractPlainText(data []byte) ([]Section, error) {
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("%w: file is not valid UTF-8 text", ErrUnsupportedFormat)
+	}
+	return []Section{{Text: string(data)}}, nil
+}
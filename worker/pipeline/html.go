@@ -0,0 +1,235 @@
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// boilerplate elements never contain the content of a page.
+var boilerplate = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Template: true,
+	atom.Svg:      true,
+	atom.Iframe:   true,
+	atom.Nav:      true,
+	atom.Header:   true,
+	atom.Footer:   true,
+	atom.Aside:    true,
+	atom.Form:     true,
+	atom.Button:   true,
+	atom.Select:   true,
+}
+
+// boilerplateRoles are ARIA landmarks used for navigation and page chrome.
+var boilerplateRoles = map[string]bool{
+	"navigation":    true,
+	"banner":        true,
+	"contentinfo":   true,
+	"complementary": true,
+	"search":        true,
+}
+
+// blocks end a paragraph of extracted text.
+var blocks = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true, atom.Main: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Ul: true, atom.Ol: true, atom.Li: true, atom.Dl: true, atom.Dt: true, atom.Dd: true,
+	atom.Table: true, atom.Tr: true, atom.Pre: true, atom.Blockquote: true, atom.Figure: true,
+}
+
+// htmlTitle returns the text of the document's <title> element.
+func htmlTitle(doc *html.Node) string {
+	if n := findElement(doc, atom.Title); n != nil {
+		return strings.Join(strings.Fields(textContent(n)), " ")
+	}
+	return ""
+}
+
+// extractHTML keeps the readable text of a page. When the page marks its
+// content with <main> or <article>, everything outside of it is dropped;
+// navigation, headers, footers and scripts are always dropped.
+func extractHTML(data []byte) ([]Section, error) {
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid html: %v", ErrUnsupportedFormat, err)
+	}
+
+	root := findElement(doc, atom.Main)
+	if root == nil {
+		root = findElement(doc, atom.Article)
+	}
+	if root == nil {
+		root = findElement(doc, atom.Body)
+	}
+	if root == nil {
+		root = doc
+	}
+
+	var t htmlText
+	if title := htmlTitle(doc); title != "" {
+		t.sb.WriteString(title)
+		t.sb.WriteString("\n\n")
+	}
+	t.write(root)
+	t.flush()
+	if len(t.sections) == 0 {
+		return []Section{{}}, nil
+	}
+	return t.sections, nil
+}
+
+// htmlText collects the readable text of a page. Data tables become
+// sections of their own.
+type htmlText struct {
+	sb       strings.Builder
+	sections []Section
+}
+
+// flush turns the text written so far into a section, collapsing the
+// whitespace of every paragraph.
+func (t *htmlText) flush() {
+	var paras []string
+	for _, para := range strings.Split(t.sb.String(), "\n\n") {
+		if para = strings.Join(strings.Fields(para), " "); para != "" {
+			paras = append(paras, para)
+		}
+	}
+	if len(paras) > 0 {
+		t.sections = append(t.sections, Section{Text: strings.Join(paras, "\n\n")})
+	}
+	t.sb.Reset()
+}
+
+func (t *htmlText) write(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		// paragraph breaks come from the markup, not the source layout
+		t.sb.WriteString(strings.ReplaceAll(n.Data, "\n", " "))
+		return
+	case html.ElementNode:
+		if boilerplate[n.DataAtom] || boilerplateRoles[attr(n, "role")] || attr(n, "aria-hidden") == "true" {
+			return
+		}
+		if n.DataAtom == atom.Br {
+			t.sb.WriteString(" ")
+			return
+		}
+		if n.DataAtom == atom.Table {
+			if caption, rows, ok := htmlTableRows(n); ok {
+				if table, ok := markdownTable(rows); ok {
+					if caption != "" {
+						t.sb.WriteString("\n\n" + caption)
+					}
+					t.flush()
+					t.sections = append(t.sections, Section{Table: true, Text: table})
+					return
+				}
+			}
+		}
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		t.write(c)
+	}
+
+	if n.Type == html.ElementNode {
+		switch {
+		case blocks[n.DataAtom]:
+			t.sb.WriteString("\n\n")
+		case n.DataAtom == atom.Td || n.DataAtom == atom.Th:
+			t.sb.WriteString(" | ")
+		case n.DataAtom == atom.A:
+			t.sb.WriteString(" ")
+		}
+	}
+}
+
+// htmlTableRows reads the caption and cells of a table. Tables that contain
+// other tables are used for layout and are reported as not ok.
+func htmlTableRows(table *html.Node) (caption string, rows [][]string, ok bool) {
+	ok = true
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil && ok; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			switch c.DataAtom {
+			case atom.Table:
+				ok = false
+			case atom.Caption:
+				caption = cellText(c)
+			case atom.Thead, atom.Tbody, atom.Tfoot:
+				walk(c)
+			case atom.Tr:
+				var row []string
+				for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.Type != html.ElementNode || (cell.DataAtom != atom.Td && cell.DataAtom != atom.Th) {
+						continue
+					}
+					if findElement(cell, atom.Table) != nil {
+						ok = false
+						return
+					}
+					row = append(row, cellText(cell))
+					// keep the columns of later cells aligned
+					span, _ := strconv.Atoi(attr(cell, "colspan"))
+					for i := 1; i < span && i < 50; i++ {
+						row = append(row, "")
+					}
+				}
+				rows = append(rows, row)
+			}
+		}
+	}
+	walk(table)
+	return caption, rows, ok
+}
+
+// cellText is the readable text of a table cell on one line.
+func cellText(n *html.Node) string {
+	var t htmlText
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		t.write(c)
+	}
+	return strings.Join(strings.Fields(t.sb.String()), " ")
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(textContent(c))
+	}
+	return sb.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return strings.ToLower(strings.TrimSpace(a.Val))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,118 @@
+package pipeline
+
+import (
+	"strings"
+	"unicode"
+)
+
+// languageProfile recognizes a language by its most frequent words and, for
+// languages that have them, letters no other supported language uses.
+type languageProfile struct {
+	code      string
+	stopwords map[string]bool
+	marker    func(r rune) bool
+}
+
+var languageProfiles = []languageProfile{
+	{
+		code:      "vi",
+		stopwords: wordSet("và của là có không những được cho trong với các này một người đã để khi thì cũng như từ đến theo về sẽ nếu tại hoặc bị nhưng phải"),
+		marker:    isVietnameseLetter,
+	},
+	{
+		code:      "en",
+		stopwords: wordSet("the and of to is in that for with are this it on be as by was from or an at have not which you can will if all has their more"),
+	},
+}
+
+func wordSet(words string) map[string]bool {
+	set := map[string]bool{}
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+// isVietnameseLetter reports letters that only Vietnamese uses among the
+// supported languages: đ, ă, ơ, ư and the vowels with stacked or dot-below
+// tone marks of the Latin Extended Additional block.
+func isVietnameseLetter(r rune) bool {
+	switch unicode.ToLower(r) {
+	case 'đ', 'ă', 'ơ', 'ư', 'ĩ', 'ũ':
+		return true
+	}
+	return r >= 0x1EA0 && r <= 0x1EF9
+}
+
+// minLanguageScore is the evidence needed before a language is reported, so
+// tables of numbers or identifiers stay undetected.
+const minLanguageScore = 2
+
+// DetectLanguage returns the ISO 639-1 code of the language text is written
+// in, or "" when it is too short or in none of the supported languages.
+// Every stopword counts once and every word containing a marker letter counts
+// twice; the language with the highest score wins.
+func DetectLanguage(text string) string {
+	scores := make([]int, len(languageProfiles))
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	for _, w := range words {
+		w = strings.ToLower(w)
+		for i, lp := range languageProfiles {
+			if lp.stopwords[w] {
+				scores[i]++
+			}
+			if lp.marker != nil && strings.IndexFunc(w, lp.marker) >= 0 {
+				scores[i] += 2
+			}
+		}
+	}
+
+	best, bestScore := "", minLanguageScore-1
+	for i, lp := range languageProfiles {
+		if scores[i] > bestScore {
+			best, bestScore = lp.code, scores[i]
+		}
+	}
+	return best
+}
+
+// DominantLanguage returns the language most of the chunk text is written in,
+// weighted by length.
+func DominantLanguage(languages []string, lengths []int) string {
+	totals := map[string]int{}
+	for i, lang := range languages {
+		if lang != "" {
+			totals[lang] += lengths[i]
+		}
+	}
+	best, bestTotal := "", 0
+	for lang, total := range totals {
+		if total > bestTotal || (total == bestTotal && lang < best) {
+			best, bestTotal = lang, total
+		}
+	}
+	return best
+}
+
+// ParseSearchConfigs reads a list such as "en:english,vi:simple" mapping
+// languages to PostgreSQL text search configurations.
+func ParseSearchConfigs(s string) map[string]string {
+	configs := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		lang, config, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if ok && lang != "" && config != "" {
+			configs[strings.TrimSpace(lang)] = strings.TrimSpace(config)
+		}
+	}
+	return configs
+}
+
+// searchConfig returns the text search configuration for chunks in lang.
+func (p *Pipeline) searchConfig(lang string) string {
+	if config, ok := p.opts.SearchConfigs[lang]; ok {
+		return config
+	}
+	return p.opts.DefaultSearchConfig
+}
@@ -0,0 +1,39 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// The fixtures are shared with the backend's detector, which matches a
+// query's language against the chunks tagged here; both copies must stay
+// identical.
+const (
+	languageFixtures        = "testdata/languages.json"
+	backendLanguageFixtures = "../../backend/internal/rag/testdata/languages.json"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	data, err := os.ReadFile(languageFixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backend, err := os.ReadFile(backendLanguageFixtures); err == nil && !bytes.Equal(data, backend) {
+		t.Errorf("%s differs from the backend's %s", languageFixtures, backendLanguageFixtures)
+	}
+
+	var fixtures []struct {
+		Text string `json:"text"`
+		Want string `json:"want"`
+	}
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range fixtures {
+		if got := DetectLanguage(f.Text); got != f.Want {
+			t.Errorf("DetectLanguage(%q) = %q, want %q", f.Text, got, f.Want)
+		}
+	}
+}
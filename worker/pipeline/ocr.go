@@ -0,0 +1,134 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// imageExtensions lists the image formats that are read with OCR.
+var imageExtensions = map[string]bool{
+	".png":  true,
+	".jpg":  true,
+	".jpeg": true,
+	".tif":  true,
+	".tiff": true,
+}
+
+// recognize fills the sections without a text layer, i.e. scanned PDF pages
+// and images, with OCR output. Sections that already have text are left alone.
+func (p *Pipeline) recognize(ctx context.Context, in Input, ext string, data []byte, sections []Section) ([]Section, error) {
+	var missing []int
+	for i, s := range sections {
+		if strings.TrimSpace(s.Text) == "" {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) == 0 {
+		return sections, nil
+	}
+	if p.opts.OCR == nil {
+		if imageExtensions[ext] {
+			return nil, fmt.Errorf("%w: images need OCR, which is not configured", ErrUnsupportedFormat)
+		}
+		return sections, nil
+	}
+
+	var pages map[int][]byte
+	if ext == ".pdf" {
+		numbers := make([]int, len(missing))
+		for j, i := range missing {
+			numbers[j] = sections[i].Page
+		}
+		var err error
+		if pages, err = p.renderPDFPages(ctx, data, numbers); err != nil {
+			return nil, err
+		}
+	}
+	for _, i := range missing {
+		image := data
+		if ext == ".pdf" {
+			rendered, ok := pages[sections[i].Page]
+			if !ok {
+				return nil, fmt.Errorf("failed to render pdf page %d", sections[i].Page)
+			}
+			image = rendered
+		}
+		text, err := p.opts.OCR.Recognize(ctx, image)
+		if err != nil {
+			return nil, err
+		}
+		sections[i].Text = text
+	}
+	log.Printf("[Pipeline] Document %d v%d: recognized %d pages with OCR", in.DocumentID, in.Version, len(missing))
+	return sections, nil
+}
+
+// renderPDFPages renders the given 1-based pages of a PDF to PNG and returns
+// them by page number. pdftoppm runs once per contiguous run of pages, so
+// pages that were not asked for are never rendered.
+func (p *Pipeline) renderPDFPages(ctx context.Context, data []byte, pages []int) (map[int][]byte, error) {
+	dir, err := os.MkdirTemp("", "ocr-pdf-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "input.pdf")
+	if err := os.WriteFile(input, data, 0o600); err != nil {
+		return nil, err
+	}
+	output := filepath.Join(dir, "page")
+	for _, r := range pageRuns(pages) {
+		first, last := r[0], r[1]
+		cmd := exec.CommandContext(ctx, p.opts.PDFToPPM, "-f", strconv.Itoa(first), "-l", strconv.Itoa(last), "-r", strconv.Itoa(p.opts.OCRDPI), "-png", input, output)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("failed to render pdf pages %d-%d: %v: %s", first, last, err, strings.TrimSpace(string(out)))
+		}
+	}
+
+	// pdftoppm names the files page-<n>.png, with n zero-padded to the
+	// digits of the document's page count
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	rendered := make(map[int][]byte, len(pages))
+	for _, e := range entries {
+		n, ok := strings.CutPrefix(e.Name(), "page-")
+		if !ok {
+			continue
+		}
+		page, err := strconv.Atoi(strings.TrimSuffix(n, ".png"))
+		if err != nil || !slices.Contains(pages, page) {
+			continue
+		}
+		if rendered[page], err = os.ReadFile(filepath.Join(dir, e.Name())); err != nil {
+			return nil, err
+		}
+	}
+	return rendered, nil
+}
+
+// pageRuns groups page numbers into sorted, contiguous [first, last] runs.
+func pageRuns(pages []int) [][2]int {
+	sorted := slices.Clone(pages)
+	slices.Sort(sorted)
+	sorted = slices.Compact(sorted)
+
+	var runs [][2]int
+	for _, page := range sorted {
+		if n := len(runs); n > 0 && runs[n-1][1] == page-1 {
+			runs[n-1][1] = page
+			continue
+		}
+		runs = append(runs, [2]int{page, page})
+	}
+	return runs
+}
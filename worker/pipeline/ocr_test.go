@@ -0,0 +1,168 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// stubOCR "recognizes" an image as its own bytes and records the calls.
+type stubOCR struct {
+	images []string
+	err    error
+}
+
+func (s *stubOCR) Recognize(ctx context.Context, image []byte) (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+	s.images = append(s.images, string(image))
+	return "text of " + string(image), nil
+}
+
+// fakePDFToPPM writes a pdftoppm stand-in that renders every page of the
+// requested range as "page <n>" and logs each run to the returned file.
+func fakePDFToPPM(t *testing.T) (binary, runs string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	dir := t.TempDir()
+	runs = filepath.Join(dir, "runs")
+	binary = filepath.Join(dir, "pdftoppm")
+	script := `#!/bin/sh
+echo "$@" >> "` + runs + `"
+while [ $# -gt 2 ]; do
+	case "$1" in
+	-f) first=$2; shift ;;
+	-l) last=$2; shift ;;
+	esac
+	shift
+done
+i=$first
+while [ "$i" -le "$last" ]; do
+	printf 'page %d' "$i" > "$2-$(printf %02d "$i").png"
+	i=$((i + 1))
+done
+`
+	if err := os.WriteFile(binary, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return binary, runs
+}
+
+func TestRecognizePDF(t *testing.T) {
+	binary, runs := fakePDFToPPM(t)
+	ocr := &stubOCR{}
+	p := &Pipeline{opts: Options{OCR: ocr, PDFToPPM: binary, OCRDPI: 150}}
+
+	sections := []Section{
+		{Page: 1, Text: "typed text"},
+		{Page: 2, Text: " \n"},
+		{Page: 3},
+		{Page: 4, Text: "more typed text"},
+		{Page: 5, Text: "and more"},
+		{Page: 6},
+	}
+	got, err := p.recognize(context.Background(), Input{DocumentID: 1}, ".pdf", []byte("%PDF"), sections)
+	if err != nil {
+		t.Fatalf("recognize: %v", err)
+	}
+	want := []string{"typed text", "text of page 2", "text of page 3", "more typed text", "and more", "text of page 6"}
+	for i, s := range got {
+		if s.Text != want[i] {
+			t.Errorf("page %d text = %q, want %q", s.Page, s.Text, want[i])
+		}
+	}
+	if !slices.Equal(ocr.images, []string{"page 2", "page 3", "page 6"}) {
+		t.Errorf("OCR read %v, want only the pages without text", ocr.images)
+	}
+
+	// one run per contiguous range, pages with text are never rendered
+	log, err := os.ReadFile(runs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := strings.Split(strings.TrimSpace(string(log)), "\n")
+	wantCalls := []string{"-f 2 -l 3 -r 150 -png ", "-f 6 -l 6 -r 150 -png "}
+	if len(calls) != len(wantCalls) {
+		t.Fatalf("pdftoppm ran %d times, want %d: %q", len(calls), len(wantCalls), calls)
+	}
+	for i, call := range calls {
+		if !strings.HasPrefix(call, wantCalls[i]) {
+			t.Errorf("pdftoppm run %d arguments = %q, want prefix %q", i, call, wantCalls[i])
+		}
+	}
+}
+
+func TestPageRuns(t *testing.T) {
+	tests := []struct {
+		pages []int
+		want  [][2]int
+	}{
+		{[]int{4}, [][2]int{{4, 4}}},
+		{[]int{1, 2, 3}, [][2]int{{1, 3}}},
+		{[]int{1, 1000}, [][2]int{{1, 1}, {1000, 1000}}},
+		{[]int{7, 3, 2, 8, 3}, [][2]int{{2, 3}, {7, 8}}},
+	}
+	for _, tt := range tests {
+		if got := pageRuns(tt.pages); !slices.Equal(got, tt.want) {
+			t.Errorf("pageRuns(%v) = %v, want %v", tt.pages, got, tt.want)
+		}
+	}
+}
+
+func TestRecognizeImage(t *testing.T) {
+	ocr := &stubOCR{}
+	p := &Pipeline{opts: Options{OCR: ocr}}
+
+	got, err := p.recognize(context.Background(), Input{}, ".png", []byte("scan"), []Section{{}})
+	if err != nil {
+		t.Fatalf("recognize: %v", err)
+	}
+	if len(got) != 1 || got[0].Text != "text of scan" {
+		t.Errorf("sections = %+v, want the recognized image", got)
+	}
+}
+
+func TestRecognizeWithoutOCR(t *testing.T) {
+	p := &Pipeline{}
+
+	if _, err := p.recognize(context.Background(), Input{}, ".png", []byte("scan"), []Section{{}}); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("image without OCR: error = %v, want ErrUnsupportedFormat", err)
+	}
+	sections := []Section{{Page: 1, Text: "text"}, {Page: 2}}
+	got, err := p.recognize(context.Background(), Input{}, ".pdf", nil, sections)
+	if err != nil || len(got) != 2 || got[1].Text != "" {
+		t.Errorf("pdf without OCR = %+v, %v, want the sections unchanged", got, err)
+	}
+}
+
+func TestRecognizeSkipsTextSections(t *testing.T) {
+	ocr := &stubOCR{err: errors.New("must not be called")}
+	p := &Pipeline{opts: Options{OCR: ocr, PDFToPPM: "/nonexistent/pdftoppm"}}
+
+	sections := []Section{{Page: 1, Text: "a"}, {Page: 2, Text: "b"}}
+	if _, err := p.recognize(context.Background(), Input{}, ".pdf", []byte("%PDF"), sections); err != nil {
+		t.Errorf("recognize with text on every page: %v", err)
+	}
+}
+
+func TestRecognizeErrors(t *testing.T) {
+	binary, _ := fakePDFToPPM(t)
+	ocrErr := errors.New("ocr down")
+	p := &Pipeline{opts: Options{OCR: &stubOCR{err: ocrErr}, PDFToPPM: binary, OCRDPI: 150}}
+	if _, err := p.recognize(context.Background(), Input{}, ".pdf", []byte("%PDF"), []Section{{Page: 1}}); !errors.Is(err, ocrErr) {
+		t.Errorf("error = %v, want the OCR error", err)
+	}
+
+	p = &Pipeline{opts: Options{OCR: &stubOCR{}, PDFToPPM: "/nonexistent/pdftoppm", OCRDPI: 150}}
+	if _, err := p.recognize(context.Background(), Input{}, ".pdf", []byte("%PDF"), []Section{{Page: 1}}); err == nil {
+		t.Error("recognize succeeded without pdftoppm")
+	}
+}
@@ -0,0 +1,558 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+
+	"worker/models"
+	"worker/services"
+)
+
+// Pipeline stages, in order. Each stage is recorded in the document's
+// ingestion checkpoint once it has completed.
+const (
+	StageExtracted  = "extracted"
+	StageChunked    = "chunked"
+	StageSummarized = "summarized"
+	StageIndexed    = "indexed"
+	StageActivated  = "activated"
+	StageDone       = "done"
+)
+
+var stageOrder = map[string]int{
+	"":              0,
+	StageExtracted:  1,
+	StageChunked:    2,
+	StageSummarized: 3,
+	StageIndexed:    4,
+	StageActivated:  5,
+	StageDone:       6,
+}
+
+// Input identifies the document version and stored object to ingest.
+type Input struct {
+	DocumentID      uint
+	Version         int
+	KnowledgeBaseID uint
+	Bucket          string
+	ObjectName      string
+	FileType        string
+}
+
+type Options struct {
+	ChunkSize          int
+	ChunkOverlap       int
+	EmbeddingBatchSize int
+	EmbeddingDimension int
+	// OCR reads scanned PDF pages and images; nil disables it. PDF pages are
+	// rendered with the PDFToPPM binary at OCRDPI.
+	OCR      services.OCR
+	PDFToPPM string
+	OCRDPI   int
+	// SearchConfigs maps detected languages to the PostgreSQL text search
+	// configuration of their chunks; other chunks use DefaultSearchConfig.
+	SearchConfigs       map[string]string
+	DefaultSearchConfig string
+	// LLM summarizes every document version; nil disables summaries.
+	LLM                  *services.LLMService
+	SummaryMaxInputChars int
+}
+
+// Pipeline runs extract -> chunk -> summarize -> embed/upsert -> activate ->
+// cleanup for one document version. Every stage is idempotent and
+// checkpointed, so running it again after a crash resumes from the last
+// completed stage and never duplicates vectors.
+//
+// Points of all versions are kept in Qdrant; only the version the document
+// currently serves carries is_active=true, which lets a rollback switch
+// versions without re-indexing.
+type Pipeline struct {
+	minio    *services.MinioService
+	embedder *services.EmbeddingService
+	qdrant   *services.QdrantService
+	opts     Options
+}
+
+func New(minio *services.MinioService, embedder *services.EmbeddingService, qdrant *services.QdrantService, opts Options) *Pipeline {
+	if opts.EmbeddingBatchSize <= 0 {
+		opts.EmbeddingBatchSize = 32
+	}
+	if opts.PDFToPPM == "" {
+		opts.PDFToPPM = "pdftoppm"
+	}
+	if opts.OCRDPI <= 0 {
+		opts.OCRDPI = 300
+	}
+	if opts.DefaultSearchConfig == "" {
+		opts.DefaultSearchConfig = "simple"
+	}
+	return &Pipeline{minio: minio, embedder: embedder, qdrant: qdrant, opts: opts}
+}
+
+// EnsureCollection prepares the vector collection used by Run.
+func (p *Pipeline) EnsureCollection(ctx context.Context) error {
+	return p.qdrant.EnsureCollection(ctx, p.opts.EmbeddingDimension)
+}
+
+func (p *Pipeline) Run(ctx context.Context, in Input) error {
+	if in.Version == 0 {
+		in.Version = 1
+	}
+
+	info, err := p.minio.GetObjectInfo(ctx, in.Bucket, in.ObjectName)
+	if err != nil {
+		return err
+	}
+
+	cp, err := models.GetIngestionCheckpoint(in.DocumentID, in.Version)
+	if err != nil {
+		return fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+	if cp == nil || cp.ObjectName != in.ObjectName || cp.ObjectETag != info.ETag {
+		if cp != nil {
+			log.Printf("[Pipeline] Document %d v%d: object changed, restarting ingestion", in.DocumentID, in.Version)
+		}
+		cp = &models.IngestionCheckpoint{
+			DocumentID: in.DocumentID,
+			Version:    in.Version,
+			ObjectName: in.ObjectName,
+			ObjectETag: info.ETag,
+		}
+	} else if cp.Stage != "" {
+		log.Printf("[Pipeline] Document %d v%d: resuming after stage %q", in.DocumentID, in.Version, cp.Stage)
+	}
+	cp.Attempts++
+
+	if err := p.run(ctx, in, cp); err != nil {
+		cp.LastError = err.Error()
+		if saveErr := models.SaveIngestionCheckpoint(cp); saveErr != nil {
+			log.Printf("[Pipeline] Document %d v%d: failed to save checkpoint: %v", in.DocumentID, in.Version, saveErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (p *Pipeline) run(ctx context.Context, in Input, cp *models.IngestionCheckpoint) error {
+	var sections []Section
+
+	if !reached(cp, StageExtracted) {
+		var err error
+		sections, err = p.extract(ctx, in)
+		if err != nil {
+			return err
+		}
+		if err := p.advance(cp, StageExtracted); err != nil {
+			return err
+		}
+	}
+
+	if !reached(cp, StageChunked) {
+		if sections == nil {
+			var err error
+			sections, err = p.loadSections(ctx, in)
+			if err != nil {
+				return err
+			}
+		}
+		count, err := p.chunk(in, sections)
+		if err != nil {
+			return err
+		}
+		cp.ChunkCount = count
+		if err := p.advance(cp, StageChunked); err != nil {
+			return err
+		}
+	}
+
+	if !reached(cp, StageSummarized) {
+		if err := p.summarize(ctx, in); err != nil {
+			return err
+		}
+		if err := p.advance(cp, StageSummarized); err != nil {
+			return err
+		}
+	}
+
+	if !reached(cp, StageIndexed) {
+		if err := p.index(ctx, in); err != nil {
+			return err
+		}
+		if err := p.advance(cp, StageIndexed); err != nil {
+			return err
+		}
+	}
+
+	if !reached(cp, StageActivated) {
+		if err := p.activateIfCurrent(ctx, in.DocumentID, in.Version); err != nil {
+			return err
+		}
+		if err := p.advance(cp, StageActivated); err != nil {
+			return err
+		}
+	}
+
+	if !reached(cp, StageDone) {
+		if err := p.removeOrphans(ctx, in); err != nil {
+			return err
+		}
+		if err := p.advance(cp, StageDone); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extract reads the original object and stores the extracted sections next
+// to it, so later stages can be retried without extracting again.
+func (p *Pipeline) extract(ctx context.Context, in Input) ([]Section, error) {
+	reader, err := p.minio.DownloadObject(ctx, in.Bucket, in.ObjectName)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+	if err := verifyContent(in, data); err != nil {
+		return nil, err
+	}
+
+	sections, err := Extract(in.FileType, in.ObjectName, data)
+	if err != nil {
+		return nil, err
+	}
+	sections, err = p.recognize(ctx, in, strings.ToLower(path.Ext(in.ObjectName)), data, sections)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(sections)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.minio.UploadObject(ctx, in.Bucket, sectionsObjectName(in.DocumentID, in.Version), bytes.NewReader(b), int64(len(b)), "application/json"); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[Pipeline] Document %d v%d: extracted %d sections", in.DocumentID, in.Version, len(sections))
+	return sections, nil
+}
+
+// ErrContentMismatch is returned when a file does not hash to the SHA-256
+// recorded for its version, e.g. a direct upload whose client declared a
+// different checksum. Retrying such a document will never succeed.
+var ErrContentMismatch = errors.New("content does not match the declared sha256")
+
+// verifyContent checks data against the content hash of the version. Direct
+// uploads are not read by the API, so their hash is the one the client
+// declared, or none. A missing hash is recorded; on a mismatch the actual
+// hash replaces the declared one, so later uploads are not deduplicated
+// against content that was never stored.
+func verifyContent(in Input, data []byte) error {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	v, err := models.GetDocumentVersion(in.DocumentID, in.Version)
+	if err != nil {
+		return fmt.Errorf("failed to load version: %w", err)
+	}
+	if v == nil || v.ContentHash == hash {
+		return nil
+	}
+	if err := models.UpdateContentHash(in.DocumentID, in.Version, hash); err != nil {
+		return fmt.Errorf("failed to record content hash: %w", err)
+	}
+	if v.ContentHash != "" {
+		return fmt.Errorf("%w: declared %s, stored file has %s", ErrContentMismatch, v.ContentHash, hash)
+	}
+	return nil
+}
+
+func (p *Pipeline) loadSections(ctx context.Context, in Input) ([]Section, error) {
+	reader, err := p.minio.DownloadObject(ctx, in.Bucket, sectionsObjectName(in.DocumentID, in.Version))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	var sections []Section
+	if err := json.NewDecoder(reader).Decode(&sections); err != nil {
+		return nil, fmt.Errorf("failed to load extracted sections: %w", err)
+	}
+	return sections, nil
+}
+
+func (p *Pipeline) chunk(in Input, sections []Section) (int, error) {
+	chunks := SplitSections(in.DocumentID, in.Version, sections, p.opts.ChunkSize, p.opts.ChunkOverlap)
+
+	rows := make([]models.DocumentChunk, 0, len(chunks))
+	languages := make([]string, 0, len(chunks))
+	lengths := make([]int, 0, len(chunks))
+	for _, ch := range chunks {
+		lang := DetectLanguage(ch.Text)
+		languages = append(languages, lang)
+		lengths = append(lengths, len(ch.Text))
+		rows = append(rows, models.DocumentChunk{
+			ID:              ch.ID,
+			DocumentID:      in.DocumentID,
+			Version:         in.Version,
+			KnowledgeBaseID: in.KnowledgeBaseID,
+			ChunkIndex:      ch.Index,
+			Page:            ch.Page,
+			Symbol:          ch.Symbol,
+			Content:         ch.Text,
+			Language:        lang,
+			SearchConfig:    p.searchConfig(lang),
+		})
+	}
+	if err := models.ReplaceDocumentChunks(in.DocumentID, in.Version, rows); err != nil {
+		return 0, fmt.Errorf("failed to store chunks: %w", err)
+	}
+	if err := models.UpdateChunkSearchVectors(in.DocumentID, in.Version); err != nil {
+		return 0, fmt.Errorf("failed to build search vectors: %w", err)
+	}
+	if err := models.UpdateDocumentLanguage(in.DocumentID, in.Version, DominantLanguage(languages, lengths)); err != nil {
+		return 0, fmt.Errorf("failed to store document language: %w", err)
+	}
+
+	log.Printf("[Pipeline] Document %d v%d: stored %d chunks", in.DocumentID, in.Version, len(rows))
+	return len(rows), nil
+}
+
+// index embeds and upserts chunks batch by batch. A chunk is flagged as
+// indexed only after its point is persisted in Qdrant; a crash in between
+// re-upserts the same point ID on retry, which overwrites rather than
+// duplicates it. New points start inactive and are switched on by the
+// activate stage.
+func (p *Pipeline) index(ctx context.Context, in Input) error {
+	base, err := p.basePayload(in)
+	if err != nil {
+		return err
+	}
+
+	for {
+		batch, err := models.ListUnindexedChunks(in.DocumentID, in.Version, p.opts.EmbeddingBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to load chunks: %w", err)
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		texts := make([]string, len(batch))
+		ids := make([]string, len(batch))
+		for i, ch := range batch {
+			texts[i] = ch.Content
+			ids[i] = ch.ID
+		}
+
+		vectors, err := p.embedder.Embed(ctx, texts)
+		if err != nil {
+			return err
+		}
+
+		points := make([]services.QdrantPoint, len(batch))
+		for i, ch := range batch {
+			payload := map[string]interface{}{
+				"document_id":       in.DocumentID,
+				"version":           in.Version,
+				"is_active":         false,
+				"knowledge_base_id": in.KnowledgeBaseID,
+				"chunk_index":       ch.ChunkIndex,
+				"page":              ch.Page,
+				"text":              ch.Content,
+			}
+			if ch.Symbol != "" {
+				payload["symbol"] = ch.Symbol
+			}
+			if ch.Kind != "" {
+				payload["chunk_type"] = ch.Kind
+			}
+			if ch.Language != "" {
+				payload["detected_language"] = ch.Language
+			}
+			for k, v := range base {
+				payload[k] = v
+			}
+			points[i] = services.QdrantPoint{ID: ch.ID, Vector: vectors[i], Payload: payload}
+		}
+		if err := p.qdrant.UpsertPoints(ctx, points); err != nil {
+			return err
+		}
+		if err := models.MarkChunksIndexed(ids); err != nil {
+			return fmt.Errorf("failed to mark chunks indexed: %w", err)
+		}
+
+		log.Printf("[Pipeline] Document %d v%d: indexed %d chunks", in.DocumentID, in.Version, len(batch))
+	}
+}
+
+// basePayload returns the payload fields shared by every point of the
+// document version: the document's name, type and metadata, where a source
+// document came from (its URL, or its path for git sources) and the revision
+// it was fetched at.
+func (p *Pipeline) basePayload(in Input) (map[string]interface{}, error) {
+	doc, err := models.GetDocumentByID(in.DocumentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load document: %w", err)
+	}
+	version, err := models.GetDocumentVersion(in.DocumentID, in.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load document version: %w", err)
+	}
+
+	payload, err := documentPayload(doc)
+	if err != nil {
+		return nil, err
+	}
+	if doc.SourceURL != "" {
+		payload["source_url"] = doc.SourceURL
+	}
+	if version != nil && version.SourceRevision != "" {
+		payload["revision"] = version.SourceRevision
+	}
+	return payload, nil
+}
+
+// documentPayload holds the fields of a point that can change without
+// re-indexing the document.
+func documentPayload(doc *models.Document) (map[string]interface{}, error) {
+	metadata := map[string]interface{}{}
+	if len(doc.Metadata) > 0 {
+		if err := json.Unmarshal(doc.Metadata, &metadata); err != nil {
+			return nil, fmt.Errorf("invalid metadata on document %d: %w", doc.ID, err)
+		}
+	}
+	return map[string]interface{}{
+		"document_name": doc.Name,
+		"file_type":     doc.FileType,
+		"metadata":      metadata,
+	}, nil
+}
+
+// UpdateMetadata copies the document's current name and metadata into the
+// payload of all its points, so filters see edits without re-indexing.
+func (p *Pipeline) UpdateMetadata(ctx context.Context, documentID uint) error {
+	doc, err := models.GetDocumentByID(documentID)
+	if err != nil {
+		return fmt.Errorf("failed to load document: %w", err)
+	}
+	payload, err := documentPayload(doc)
+	if err != nil {
+		return err
+	}
+	return p.qdrant.SetPayload(ctx, payload, map[string]interface{}{
+		"must": []interface{}{matchFilter("document_id", documentID)},
+	})
+}
+
+// Activate makes the given version the only searchable version of the
+// document. It is used to roll back to an already indexed version.
+func (p *Pipeline) Activate(ctx context.Context, documentID uint, version int) error {
+	if err := p.qdrant.SetPayload(ctx,
+		map[string]interface{}{"is_active": false},
+		map[string]interface{}{
+			"must":     []interface{}{matchFilter("document_id", documentID)},
+			"must_not": []interface{}{matchFilter("version", version)},
+		},
+	); err != nil {
+		return err
+	}
+	return p.qdrant.SetPayload(ctx,
+		map[string]interface{}{"is_active": true},
+		map[string]interface{}{
+			"must": []interface{}{matchFilter("document_id", documentID), matchFilter("version", version)},
+		},
+	)
+}
+
+// Delete removes a document from the index and the database and deletes the
+// files of all its versions.
+func (p *Pipeline) Delete(ctx context.Context, bucket string, documentID uint) error {
+	if err := p.qdrant.DeletePoints(ctx, map[string]interface{}{
+		"must": []interface{}{matchFilter("document_id", documentID)},
+	}); err != nil {
+		return err
+	}
+
+	versions, err := models.DeleteDocument(documentID)
+	if err != nil {
+		return fmt.Errorf("failed to delete document: %w", err)
+	}
+
+	for _, v := range versions {
+		for _, objectName := range []string{v.ObjectName, sectionsObjectName(documentID, v.Version)} {
+			if err := p.minio.RemoveObject(ctx, bucket, objectName); err != nil {
+				log.Printf("[Pipeline] Document %d: %v", documentID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// activateIfCurrent activates the freshly indexed version unless the document
+// was rolled back to another version while it was being processed.
+func (p *Pipeline) activateIfCurrent(ctx context.Context, documentID uint, version int) error {
+	doc, err := models.GetDocumentByID(documentID)
+	if err != nil {
+		return fmt.Errorf("failed to load document: %w", err)
+	}
+	if doc.Version != version {
+		log.Printf("[Pipeline] Document %d v%d: document serves v%d, leaving this version inactive", documentID, version, doc.Version)
+		return nil
+	}
+	return p.Activate(ctx, documentID, version)
+}
+
+// removeOrphans deletes points of the document version that are not part of
+// its current chunk set, e.g. left over from a previous ingestion of the file.
+func (p *Pipeline) removeOrphans(ctx context.Context, in Input) error {
+	ids, err := models.ListChunkIDs(in.DocumentID, in.Version)
+	if err != nil {
+		return fmt.Errorf("failed to load chunk ids: %w", err)
+	}
+
+	filter := map[string]interface{}{
+		"must": []interface{}{
+			matchFilter("document_id", in.DocumentID),
+			matchFilter("version", in.Version),
+		},
+	}
+	if len(ids) > 0 {
+		filter["must_not"] = []interface{}{
+			map[string]interface{}{"has_id": ids},
+		}
+	}
+	return p.qdrant.DeletePoints(ctx, filter)
+}
+
+func (p *Pipeline) advance(cp *models.IngestionCheckpoint, stage string) error {
+	cp.Stage = stage
+	cp.LastError = ""
+	if err := models.SaveIngestionCheckpoint(cp); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
+
+func reached(cp *models.IngestionCheckpoint, stage string) bool {
+	return stageOrder[cp.Stage] >= stageOrder[stage]
+}
+
+func matchFilter(key string, value interface{}) map[string]interface{} {
+	return map[string]interface{}{"key": key, "match": map[string]interface{}{"value": value}}
+}
+
+func sectionsObjectName(documentID uint, version int) string {
+	return fmt.Sprintf("derived/doc_%d/v%d/sections.json", documentID, version)
+}
@@ -0,0 +1,163 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"worker/models"
+	"worker/services"
+)
+
+// ChunkKindSummary marks the chunk that holds a document's generated summary.
+const ChunkKindSummary = "summary"
+
+const summaryPrompt = `You describe documents for a document library.
+Read the document below and reply with a JSON object and nothing else:
+{"title": "a short descriptive title", "summary": "three to five sentences on what the document is about", "keywords": ["five to ten keywords"]}
+Write the title, summary and keywords in the language of the document.`
+
+// Summary is what the LLM says a document is about.
+type Summary struct {
+	Title    string   `json:"title"`
+	Summary  string   `json:"summary"`
+	Keywords []string `json:"keywords"`
+}
+
+// summarize asks the LLM for a title, summary and keywords of the document
+// version, stores them and adds the summary as a chunk of its own, so broad
+// questions can match the document as a whole. Summaries are best effort: a
+// failing LLM is logged and does not hold up indexing.
+func (p *Pipeline) summarize(ctx context.Context, in Input) error {
+	if p.opts.LLM == nil {
+		return nil
+	}
+	chunks, err := models.ListTextChunks(in.DocumentID, in.Version)
+	if err != nil {
+		return fmt.Errorf("failed to load chunks: %w", err)
+	}
+	text := summaryInput(chunks, p.opts.SummaryMaxInputChars)
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+
+	s, err := p.generateSummary(ctx, text)
+	if err != nil {
+		log.Printf("[Pipeline] Document %d v%d: summary skipped: %v", in.DocumentID, in.Version, err)
+		return nil
+	}
+
+	keywords, err := json.Marshal(s.Keywords)
+	if err != nil {
+		return err
+	}
+	if err := models.UpdateDocumentSummary(in.DocumentID, in.Version, s.Summary, s.Title, models.JSON(keywords)); err != nil {
+		return fmt.Errorf("failed to store summary: %w", err)
+	}
+
+	content := s.Summary
+	if s.Title != "" {
+		content = s.Title + "\n\n" + content
+	}
+	if len(s.Keywords) > 0 {
+		content += "\n\nKeywords: " + strings.Join(s.Keywords, ", ")
+	}
+	lang := DetectLanguage(content)
+	if err := models.ReplaceChunkOfKind(models.DocumentChunk{
+		ID:              ChunkID(in.DocumentID, in.Version, -1, content),
+		DocumentID:      in.DocumentID,
+		Version:         in.Version,
+		KnowledgeBaseID: in.KnowledgeBaseID,
+		ChunkIndex:      -1,
+		Kind:            ChunkKindSummary,
+		Content:         content,
+		Language:        lang,
+		SearchConfig:    p.searchConfig(lang),
+	}); err != nil {
+		return fmt.Errorf("failed to store summary chunk: %w", err)
+	}
+	if err := models.UpdateChunkSearchVectors(in.DocumentID, in.Version); err != nil {
+		return fmt.Errorf("failed to build search vectors: %w", err)
+	}
+
+	log.Printf("[Pipeline] Document %d v%d: summarized as %q", in.DocumentID, in.Version, s.Title)
+	return nil
+}
+
+func (p *Pipeline) generateSummary(ctx context.Context, text string) (*Summary, error) {
+	temperature := 0.2
+	resp, err := p.opts.LLM.Complete(ctx, services.LLMRequest{
+		Messages: []services.LLMMessage{
+			{Role: "system", Content: summaryPrompt},
+			{Role: "user", Content: text},
+		},
+		Temperature: &temperature,
+		MaxTokens:   600,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parseSummary(resp.Content)
+}
+
+// parseSummary reads the JSON object of the reply, ignoring any text or code
+// fence around it.
+func parseSummary(reply string) (*Summary, error) {
+	start := strings.Index(reply, "{")
+	end := strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("reply is not a JSON object")
+	}
+	var s Summary
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &s); err != nil {
+		return nil, fmt.Errorf("invalid summary: %w", err)
+	}
+	s.Title = strings.TrimSpace(s.Title)
+	s.Summary = strings.TrimSpace(s.Summary)
+	if s.Summary == "" {
+		return nil, fmt.Errorf("reply has no summary")
+	}
+	s.Title = truncateUTF8(s.Title, 255)
+	keywords := s.Keywords[:0]
+	for _, k := range s.Keywords {
+		if k = strings.TrimSpace(k); k != "" {
+			keywords = append(keywords, k)
+		}
+	}
+	s.Keywords = keywords
+	return &s, nil
+}
+
+// summaryInput joins the document's chunks in order, up to limit bytes.
+func summaryInput(chunks []models.DocumentChunk, limit int) string {
+	if limit <= 0 {
+		limit = 12000
+	}
+	var sb strings.Builder
+	for _, ch := range chunks {
+		if sb.Len()+len(ch.Content) > limit {
+			rest := limit - sb.Len()
+			if rest > 0 {
+				sb.WriteString(truncateUTF8(ch.Content, rest))
+			}
+			break
+		}
+		sb.WriteString(ch.Content)
+		sb.WriteString("\n\n")
+	}
+	return sb.String()
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,240 @@
+package pipeline
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// markdownTable renders rows as a Markdown table, taking the first row as the
+// header. It reports false for layout tables that are not worth keeping as a
+// table, i.e. fewer than two rows or columns.
+func markdownTable(rows [][]string) (string, bool) {
+	width := 0
+	var kept [][]string
+	for _, row := range rows {
+		empty := true
+		for _, cell := range row {
+			if cell != "" {
+				empty = false
+				break
+			}
+		}
+		if empty {
+			continue
+		}
+		kept = append(kept, row)
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	if len(kept) < 2 || width < 2 {
+		return "", false
+	}
+
+	var sb strings.Builder
+	writeRow := func(row []string) {
+		sb.WriteString("|")
+		for i := 0; i < width; i++ {
+			cell := ""
+			if i < len(row) {
+				cell = strings.ReplaceAll(strings.Join(strings.Fields(row[i]), " "), "|", `\|`)
+			}
+			sb.WriteString(" " + cell + " |")
+		}
+		sb.WriteString("\n")
+	}
+	writeRow(kept[0])
+	sb.WriteString("|" + strings.Repeat(" --- |", width) + "\n")
+	for _, row := range kept[1:] {
+		writeRow(row)
+	}
+	return strings.TrimRight(sb.String(), "\n"), true
+}
+
+// splitTable breaks a Markdown table that is longer than size between rows
+// and repeats the header in every piece, so each chunk can be read on its own.
+func splitTable(text string, size int) []string {
+	if len(text) <= size {
+		return []string{text}
+	}
+	lines := strings.Split(text, "\n")
+	header := ""
+	if len(lines) > 2 && strings.HasPrefix(lines[1], "| ---") {
+		header = lines[0] + "\n" + lines[1]
+		lines = lines[2:]
+	}
+
+	var out []string
+	var current strings.Builder
+	for _, line := range lines {
+		if len(header)+len(line)+1 > size {
+			// a row that does not fit even alone
+			if current.Len() > 0 {
+				out = append(out, current.String())
+				current.Reset()
+			}
+			out = append(out, splitWords(line, size)...)
+			continue
+		}
+		if current.Len() > 0 && current.Len()+len(line)+1 > size {
+			out = append(out, current.String())
+			current.Reset()
+		}
+		if current.Len() == 0 && header != "" {
+			current.WriteString(header)
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n")
+		}
+		current.WriteString(line)
+	}
+	if current.Len() > 0 {
+		out = append(out, current.String())
+	}
+	return out
+}
+
+// pdfCell is a run of glyphs on a line with no column-sized gap in it.
+type pdfCell struct {
+	x0, x1 float64
+	text   strings.Builder
+}
+
+type pdfLine struct {
+	y, size float64
+	cells   []*pdfCell
+}
+
+func (l *pdfLine) text() string {
+	parts := make([]string, 0, len(l.cells))
+	for _, c := range l.cells {
+		parts = append(parts, strings.TrimSpace(c.text.String()))
+	}
+	return strings.Join(parts, " ")
+}
+
+// pdfLines groups the glyphs of a page into lines, top to bottom, and the
+// glyphs of a line into cells separated by gaps wider than a character.
+func pdfLines(glyphs []pdf.Text) []*pdfLine {
+	sort.SliceStable(glyphs, func(i, j int) bool {
+		if math.Abs(glyphs[i].Y-glyphs[j].Y) > 1 {
+			return glyphs[i].Y > glyphs[j].Y
+		}
+		return glyphs[i].X < glyphs[j].X
+	})
+
+	var lines []*pdfLine
+	var line *pdfLine
+	for _, g := range glyphs {
+		size := math.Max(g.FontSize, 1)
+		if line == nil || math.Abs(g.Y-line.y) > size/2 {
+			line = &pdfLine{y: g.Y, size: size}
+			lines = append(lines, line)
+		}
+		var last *pdfCell
+		if n := len(line.cells); n > 0 {
+			last = line.cells[n-1]
+		}
+		gap := 0.0
+		if last != nil {
+			gap = g.X - last.x1
+		}
+		if last == nil || gap > size {
+			last = &pdfCell{x0: g.X}
+			line.cells = append(line.cells, last)
+		} else if gap > size*0.15 && !strings.HasSuffix(last.text.String(), " ") {
+			last.text.WriteString(" ")
+		}
+		last.text.WriteString(g.S)
+		last.x1 = math.Max(last.x1, g.X+g.W)
+	}
+
+	for _, l := range lines {
+		cells := l.cells[:0]
+		for _, c := range l.cells {
+			if strings.TrimSpace(c.text.String()) != "" {
+				cells = append(cells, c)
+			}
+		}
+		l.cells = cells
+	}
+	return lines
+}
+
+// alignedWith reports whether two lines have the same columns: as many cells,
+// each overlapping the cell above it.
+func alignedWith(a, b *pdfLine) bool {
+	if len(a.cells) < 2 || len(a.cells) != len(b.cells) {
+		return false
+	}
+	slack := math.Max(a.size, b.size)
+	for i := range a.cells {
+		if a.cells[i].x0 > b.cells[i].x1+slack || b.cells[i].x0 > a.cells[i].x1+slack {
+			return false
+		}
+	}
+	return true
+}
+
+// pdfPageSections finds tables on a PDF page: at least three consecutive
+// lines with the same aligned columns. It returns nil when the page has no
+// table, in which case the plain text extraction is kept.
+func pdfPageSections(page pdf.Page, number int) (sections []Section) {
+	defer func() {
+		// the content parser panics on malformed streams
+		if recover() != nil {
+			sections = nil
+		}
+	}()
+
+	return tableSections(pdfLines(page.Content().Text), number)
+}
+
+// tableSections turns the lines of a page into text and table sections, or
+// nil when no run of lines forms a table.
+func tableSections(lines []*pdfLine, number int) (sections []Section) {
+	var text []string
+	found := false
+	flushText := func() {
+		if t := strings.TrimSpace(strings.Join(text, "\n")); t != "" {
+			sections = append(sections, Section{Page: number, Text: t})
+		}
+		text = nil
+	}
+
+	for i := 0; i < len(lines); {
+		end := i + 1
+		for end < len(lines) && alignedWith(lines[end-1], lines[end]) {
+			end++
+		}
+		if end-i >= 3 {
+			rows := make([][]string, 0, end-i)
+			for _, l := range lines[i:end] {
+				row := make([]string, 0, len(l.cells))
+				for _, c := range l.cells {
+					row = append(row, strings.TrimSpace(c.text.String()))
+				}
+				rows = append(rows, row)
+			}
+			if table, ok := markdownTable(rows); ok {
+				flushText()
+				sections = append(sections, Section{Page: number, Table: true, Text: table})
+				found = true
+				i = end
+				continue
+			}
+		}
+		for _, l := range lines[i:end] {
+			text = append(text, l.text())
+		}
+		i = end
+	}
+	if !found {
+		return nil
+	}
+	flushText()
+	return sections
+}
@@ -0,0 +1,238 @@
+package pipeline
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ledongthuc/pdf"
+)
+
+func TestMarkdownTable(t *testing.T) {
+	tests := []struct {
+		name string
+		rows [][]string
+		want string
+		ok   bool
+	}{
+		{
+			name: "header and rows",
+			rows: [][]string{{"Plan", "Price"}, {"Basic", "10"}, {"Pro", "25"}},
+			want: "| Plan | Price |\n| --- | --- |\n| Basic | 10 |\n| Pro | 25 |",
+			ok:   true,
+		},
+		{
+			name: "empty rows dropped, short rows padded",
+			rows: [][]string{{"", ""}, {"a", "b", "c"}, {"", "", ""}, {"d"}},
+			want: "| a | b | c |\n| --- | --- | --- |\n| d |  |  |",
+			ok:   true,
+		},
+		{
+			name: "pipes escaped, whitespace collapsed",
+			rows: [][]string{{"x|y", "multi\n  line"}, {"1", "2"}},
+			want: "| x\\|y | multi line |\n| --- | --- |\n| 1 | 2 |",
+			ok:   true,
+		},
+		{name: "one row", rows: [][]string{{"a", "b"}, {"", ""}}},
+		{name: "one column", rows: [][]string{{"a"}, {"b"}, {"c"}}},
+		{name: "no rows"},
+	}
+	for _, tt := range tests {
+		got, ok := markdownTable(tt.rows)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: markdownTable = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSplitTable(t *testing.T) {
+	header := "| id | name |\n| --- | --- |"
+	var rows []string
+	for _, name := range []string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot"} {
+		rows = append(rows, "| "+name[:1]+" | "+name+" |")
+	}
+	table := header + "\n" + strings.Join(rows, "\n")
+
+	if got := splitTable(table, len(table)); len(got) != 1 || got[0] != table {
+		t.Errorf("table that fits = %q, want it unchanged", got)
+	}
+
+	size := len(header) + 40
+	pieces := splitTable(table, size)
+	if len(pieces) < 2 {
+		t.Fatalf("split into %d pieces, want several", len(pieces))
+	}
+	var got []string
+	for _, piece := range pieces {
+		if len(piece) > size {
+			t.Errorf("piece is %d long, want at most %d: %q", len(piece), size, piece)
+		}
+		body, ok := strings.CutPrefix(piece, header+"\n")
+		if !ok {
+			t.Errorf("piece does not start with the header: %q", piece)
+			continue
+		}
+		got = append(got, strings.Split(body, "\n")...)
+	}
+	// every row is kept whole and in order
+	if strings.Join(got, "\n") != strings.Join(rows, "\n") {
+		t.Errorf("rows across pieces = %q, want %q", got, rows)
+	}
+
+	// a row too long for any chunk is split between words, without header
+	long := header + "\n| 1 | " + strings.Repeat("word ", 20) + "|"
+	pieces = splitTable(long, len(header)+20)
+	for _, piece := range pieces {
+		if strings.Contains(piece, "---") {
+			t.Errorf("oversized row piece carries the header: %q", piece)
+		}
+		if len(piece) > len(header)+20 {
+			t.Errorf("piece is %d long, want at most %d", len(piece), len(header)+20)
+		}
+	}
+
+	// without a header row the pieces are just rows
+	plain := strings.Join(rows, "\n")
+	for _, piece := range splitTable(plain, 30) {
+		if strings.Contains(piece, "---") || !strings.HasPrefix(piece, "| ") {
+			t.Errorf("headerless piece = %q", piece)
+		}
+	}
+}
+
+// line lays out cells on one PDF line: each cell starts at its x and has one
+// 5pt wide glyph per character, in a 10pt font.
+func line(y float64, cells ...interface{}) []pdf.Text {
+	var glyphs []pdf.Text
+	for i := 0; i < len(cells); i += 2 {
+		x := cells[i].(float64)
+		for _, r := range cells[i+1].(string) {
+			glyphs = append(glyphs, pdf.Text{FontSize: 10, X: x, Y: y, W: 5, S: string(r)})
+			x += 5
+		}
+	}
+	return glyphs
+}
+
+func TestPDFTables(t *testing.T) {
+	var glyphs []pdf.Text
+	glyphs = append(glyphs, line(700, 50.0, "Price list")...)
+	glyphs = append(glyphs, line(680, 50.0, "Plan", 200.0, "Price")...)
+	glyphs = append(glyphs, line(665, 50.0, "Basic", 200.0, "10")...)
+	// a cell shifted by a few points still lines up
+	glyphs = append(glyphs, line(650, 52.0, "Enterprise", 198.0, "call us")...)
+	glyphs = append(glyphs, line(620, 50.0, "Prices", 90.0, "exclude", 140.0, "tax.")...)
+
+	sections := tableSections(pdfLines(glyphs), 3)
+	want := []Section{
+		{Page: 3, Text: "Price list"},
+		{Page: 3, Table: true, Text: "| Plan | Price |\n| --- | --- |\n| Basic | 10 |\n| Enterprise | call us |"},
+		{Page: 3, Text: "Prices exclude tax."},
+	}
+	if len(sections) != len(want) {
+		t.Fatalf("sections = %+v, want %+v", sections, want)
+	}
+	for i := range want {
+		if sections[i] != want[i] {
+			t.Errorf("section %d = %+v, want %+v", i, sections[i], want[i])
+		}
+	}
+
+	// two aligned lines are not enough for a table
+	var short []pdf.Text
+	short = append(short, line(680, 50.0, "Plan", 200.0, "Price")...)
+	short = append(short, line(665, 50.0, "Basic", 200.0, "10")...)
+	short = append(short, line(650, 50.0, "A sentence that runs across the page.")...)
+	if sections := tableSections(pdfLines(short), 1); sections != nil {
+		t.Errorf("page without a table = %+v, want nil", sections)
+	}
+
+	// columns that do not line up are not a table
+	var ragged []pdf.Text
+	ragged = append(ragged, line(680, 50.0, "a", 100.0, "b")...)
+	ragged = append(ragged, line(665, 50.0, "c", 300.0, "d")...)
+	ragged = append(ragged, line(650, 50.0, "e", 500.0, "f")...)
+	if sections := tableSections(pdfLines(ragged), 1); sections != nil {
+		t.Errorf("misaligned columns = %+v, want nil", sections)
+	}
+}
+
+func TestPDFLines(t *testing.T) {
+	// glyphs arrive out of order; a small gap is a space, a wide one a new cell
+	glyphs := []pdf.Text{
+		{FontSize: 10, X: 60, Y: 700, W: 5, S: "b"},
+		{FontSize: 10, X: 50, Y: 700.5, W: 5, S: "a"},
+		{FontSize: 10, X: 200, Y: 700, W: 5, S: "c"},
+		{FontSize: 10, X: 50, Y: 680, W: 5, S: "d"},
+	}
+	lines := pdfLines(glyphs)
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+	if got := lines[0].text(); got != "a b c" || len(lines[0].cells) != 2 {
+		t.Errorf("first line = %q in %d cells, want \"a b c\" in 2", got, len(lines[0].cells))
+	}
+	if got := lines[1].text(); got != "d" {
+		t.Errorf("second line = %q, want \"d\"", got)
+	}
+}
+
+func docx(t *testing.T, body string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("word/document.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := `<?xml version="1.0"?><w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` + body + `</w:body></w:document>`
+	if _, err := w.Write([]byte(doc)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func para(text string) string { return `<w:p><w:r><w:t>` + text + `</w:t></w:r></w:p>` }
+
+func row(cells ...string) string {
+	s := `<w:tr>`
+	for _, c := range cells {
+		s += `<w:tc>` + c + `</w:tc>`
+	}
+	return s + `</w:tr>`
+}
+
+func TestExtractDOCXTables(t *testing.T) {
+	nested := `<w:tbl>` + row(para("inner a"), para("inner b")) + `</w:tbl>`
+	body := para("Intro") +
+		`<w:tbl>` +
+		row(para("Plan"), para("Price")) +
+		row(para("Basic"), para("10")+para("per month")) +
+		row(para("Pro"), nested) +
+		`</w:tbl>` +
+		// a one-column layout table keeps its text in reading order
+		`<w:tbl>` + row(para("boxed note")) + row(para("second line")) + `</w:tbl>` +
+		para("Outro")
+
+	sections, err := extractDOCX(docx(t, body))
+	if err != nil {
+		t.Fatalf("extractDOCX: %v", err)
+	}
+	if len(sections) != 3 {
+		t.Fatalf("sections = %+v, want text, table, text", sections)
+	}
+	if sections[0].Table || strings.TrimSpace(sections[0].Text) != "Intro" {
+		t.Errorf("first section = %+v, want the intro", sections[0])
+	}
+	wantTable := "| Plan | Price |\n| --- | --- |\n| Basic | 10 per month |\n| Pro | inner a inner b |"
+	if !sections[1].Table || sections[1].Text != wantTable {
+		t.Errorf("table = %q, want %q", sections[1].Text, wantTable)
+	}
+	if sections[2].Table || strings.Fields(sections[2].Text)[0] != "boxed" || !strings.HasSuffix(strings.TrimSpace(sections[2].Text), "Outro") {
+		t.Errorf("last section = %q, want the layout table text and the outro", sections[2].Text)
+	}
+}
@@ -34,7 +34,8 @@ func (s *MinioService) GetObjectInfo(ctx context.Context, bucket, objectName str
 	return &info, nil
 }
 
-func (s *MinioService) DownloadObject(ctx context.Context, bucket, objectName string) (io.Reader, error) {
+// DownloadObject opens an object for reading; the caller must close it.
+func (s *MinioService) DownloadObject(ctx context.Context, bucket, objectName string) (io.ReadCloser, error) {
 	object, err := s.client.GetObject(ctx, bucket, objectName, minio.GetObjectOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to download object: %w", err)
@@ -43,6 +44,21 @@ func (s *MinioService) DownloadObject(ctx context.Context, bucket, objectName st
 	return object, nil
 }
 
+func (s *MinioService) UploadObject(ctx context.Context, bucket, objectName string, data io.Reader, size int64, contentType string) error {
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	_, err := s.client.PutObject(ctx, bucket, objectName, data, size, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+
+	return nil
+}
+
 func (s *MinioService) GetObject(ctx context.Context, bucket, objectName string) (*minio.Object, error) {
 	object, err := s.client.GetObject(ctx, bucket, objectName, minio.GetObjectOptions{})
 	if err != nil {
@@ -51,3 +67,11 @@ func (s *MinioService) GetObject(ctx context.Context, bucket, objectName string)
 
 	return object, nil
 }
+
+func (s *MinioService) RemoveObject(ctx context.Context, bucket, objectName string) error {
+	if err := s.client.RemoveObject(ctx, bucket, objectName, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to remove object: %w", err)
+	}
+
+	return nil
+}
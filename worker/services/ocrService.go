@@ -0,0 +1,100 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// OCR recognises the text in an image (PNG, JPEG or TIFF).
+type OCR interface {
+	Recognize(ctx context.Context, image []byte) (string, error)
+}
+
+// TesseractOCR runs the tesseract CLI on the worker host.
+type TesseractOCR struct {
+	binary   string
+	language string
+}
+
+func NewTesseractOCR(binary, language string) *TesseractOCR {
+	return &TesseractOCR{binary: binary, language: language}
+}
+
+func (t *TesseractOCR) Recognize(ctx context.Context, image []byte) (string, error) {
+	// tesseract reads multi-page TIFFs from a file but not always from stdin
+	f, err := os.CreateTemp("", "ocr-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(image); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	cmd := exec.CommandContext(ctx, t.binary, f.Name(), "stdout", "-l", t.language)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("tesseract failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// HTTPOCR posts the image to an OCR service, which answers with
+// {"text": "..."}.
+type HTTPOCR struct {
+	url        string
+	apiKey     string
+	httpClient *http.Client
+}
+
+func NewHTTPOCR(url, apiKey string) *HTTPOCR {
+	return &HTTPOCR{
+		url:        url,
+		apiKey:     apiKey,
+		httpClient: &http.Client{Timeout: 120 * time.Second},
+	}
+}
+
+func (s *HTTPOCR) Recognize(ctx context.Context, image []byte) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(image))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", http.DetectContentType(image))
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to call OCR service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("OCR service returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	var out struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("failed to decode OCR response: %w", err)
+	}
+	return out.Text, nil
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"fmt"
+	"log"
+
+	"worker/config"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+var DB *gorm.DB
+
+// InitDB connects to the database created and migrated by the backend.
+func InitDB() error {
+	cfg := config.LoadConfig()
+
+	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=UTC",
+		cfg.PostGresHost,
+		cfg.PostGresUser,
+		cfg.PostGresPassword,
+		cfg.PostGresDB,
+		cfg.PostGresPort,
+	)
+
+	gdb, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	DB = gdb
+	log.Printf("Successfully connected to database '%s'", cfg.PostGresDB)
+
+	return nil
+}
+
+// CloseDB closes underlying database connection when possible.
+func CloseDB() error {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// QdrantPoint is a single vector with its payload as stored in Qdrant.
+type QdrantPoint struct {
+	ID      string                 `json:"id"`
+	Vector  []float32              `json:"vector"`
+	Payload map[string]interface{} `json:"payload,omitempty"`
+}
+
+type QdrantService struct {
+	baseURL    string
+	apiKey     string
+	collection string
+	httpClient *http.Client
+}
+
+func NewQdrantService(baseURL, apiKey, collection string) *QdrantService {
+	return &QdrantService{
+		baseURL:    baseURL,
+		apiKey:     apiKey,
+		collection: collection,
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// EnsureCollection creates the collection and its payload indexes when missing.
+func (s *QdrantService) EnsureCollection(ctx context.Context, dimension int) error {
+	status, err := s.do(ctx, http.MethodGet, "/collections/"+s.collection, nil, nil)
+	if err == nil {
+		return nil
+	}
+	if status != http.StatusNotFound {
+		return fmt.Errorf("failed to check collection: %w", err)
+	}
+
+	body := map[string]interface{}{
+		"vectors": map[string]interface{}{
+			"size":     dimension,
+			"distance": "Cosine",
+		},
+	}
+	if _, err := s.do(ctx, http.MethodPut, "/collections/"+s.collection, body, nil); err != nil {
+		return fmt.Errorf("failed to create collection: %w", err)
+	}
+
+	indexes := map[string]string{
+		"document_id":       "integer",
+		"knowledge_base_id": "integer",
+		"version":           "integer",
+		"is_active":         "bool",
+	}
+	for field, schema := range indexes {
+		index := map[string]interface{}{"field_name": field, "field_schema": schema}
+		if _, err := s.do(ctx, http.MethodPut, "/collections/"+s.collection+"/index?wait=true", index, nil); err != nil {
+			return fmt.Errorf("failed to create payload index %s: %w", field, err)
+		}
+	}
+
+	return nil
+}
+
+// UpsertPoints writes points and waits until they are persisted. Upserting a
+// point with an existing ID replaces it, so retries never duplicate vectors.
+func (s *QdrantService) UpsertPoints(ctx context.Context, points []QdrantPoint) error {
+	if len(points) == 0 {
+		return nil
+	}
+	body := map[string]interface{}{"points": points}
+	if _, err := s.do(ctx, http.MethodPut, "/collections/"+s.collection+"/points?wait=true", body, nil); err != nil {
+		return fmt.Errorf("failed to upsert points: %w", err)
+	}
+	return nil
+}
+
+// SetPayload merges payload into every point matching the given filter.
+func (s *QdrantService) SetPayload(ctx context.Context, payload map[string]interface{}, filter map[string]interface{}) error {
+	body := map[string]interface{}{"payload": payload, "filter": filter}
+	if _, err := s.do(ctx, http.MethodPost, "/collections/"+s.collection+"/points/payload?wait=true", body, nil); err != nil {
+		return fmt.Errorf("failed to set payload: %w", err)
+	}
+	return nil
+}
+
+// DeletePoints removes every point matching the given Qdrant filter.
+func (s *QdrantService) DeletePoints(ctx context.Context, filter map[string]interface{}) error {
+	body := map[string]interface{}{"filter": filter}
+	if _, err := s.do(ctx, http.MethodPost, "/collections/"+s.collection+"/points/delete?wait=true", body, nil); err != nil {
+		return fmt.Errorf("failed to delete points: %w", err)
+	}
+	return nil
+}
+
+func (s *QdrantService) do(ctx context.Context, method, path string, body interface{}, out interface{}) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, reader)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.apiKey != "" {
+		req.Header.Set("api-key", s.apiKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("qdrant returned %d: %s", resp.StatusCode, string(respBody))
+	}
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return resp.StatusCode, err
+		}
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,77 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+)
+
+// Task types shared with the backend, which enqueues most of them.
+const (
+	TypeProcessDocument  = "document:process"
+	TypeActivateDocument = "document:activate"
+	TypeImportArchive    = "archive:import"
+	TypeSyncSource       = "source:sync"
+	TypeUpdateMetadata   = "document:metadata"
+	TypeGenerateEvalSet  = "eval:generate"
+)
+
+type ProcessDocumentPayload struct {
+	KnowledgeBaseID uint   `json:"knowledge_base_id"`
+	DocumentID      uint   `json:"document_id"`
+	Version         int    `json:"version"`
+	Description     string `json:"description"`
+	Bucket          string `json:"bucket"`
+	ObjectName      string `json:"object_name"`
+	FileType        string `json:"file_type"`
+}
+
+type ActivateDocumentPayload struct {
+	DocumentID uint `json:"document_id"`
+	Version    int  `json:"version"`
+}
+
+type ImportArchivePayload struct {
+	ImportID        uint   `json:"import_id"`
+	KnowledgeBaseID uint   `json:"knowledge_base_id"`
+	UserID          uint   `json:"user_id"`
+	Bucket          string `json:"bucket"`
+	ObjectName      string `json:"object_name"`
+	FileName        string `json:"file_name"`
+}
+
+type UpdateMetadataPayload struct {
+	DocumentID uint `json:"document_id"`
+}
+
+type GenerateEvalSetPayload struct {
+	SetID           uint   `json:"set_id"`
+	KnowledgeBaseID uint   `json:"knowledge_base_id"`
+	Count           int    `json:"count"`
+	DocumentIDs     []uint `json:"document_ids,omitempty"`
+}
+
+// Sync triggers recorded in the sync history.
+const (
+	TriggerManual    = "manual"
+	TriggerScheduled = "scheduled"
+)
+
+type SyncSourcePayload struct {
+	SourceID uint   `json:"source_id"`
+	Trigger  string `json:"trigger"`
+}
+
+// EnqueueProcessDocument queues ingestion of a document created by the worker.
+func EnqueueProcessDocument(ctx context.Context, client *asynq.Client, payload ProcessDocumentPayload) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if _, err := client.EnqueueContext(ctx, asynq.NewTask(TypeProcessDocument, b)); err != nil {
+		return fmt.Errorf("enqueue failed: %w", err)
+	}
+	return nil
+}